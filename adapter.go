@@ -0,0 +1,65 @@
+package sessions
+
+import (
+	"net/http"
+)
+
+// Load loads the session for the request, and returns a copy of the request
+// whose context carries it. It is intended for web frameworks with their own
+// context types and middleware chains, where Enable would mean wrapping the
+// framework in an http.Handler and buffering the response twice. Call Save
+// before the response headers are written to save the session again.
+//
+// If the request already carries a session, because it has been through
+// Load or the Enable middleware, it is returned unchanged. The ErrorHandler
+// is not called if the session can't be loaded; the error is returned along
+// with the original request instead. CookielessHandler and ExpiredHandler
+// have no effect on requests loaded with Load.
+func (s *Session) Load(r *http.Request) (*http.Request, error) {
+	if r.Context().Value(contextKeyCache) != nil {
+		return r, nil
+	}
+
+	c, err := s.load(r)
+	if err != nil {
+		return r, withPhase(PhaseLoad, err)
+	}
+	r = addCacheToRequestContext(r, c)
+	s.prepare(r, c)
+	return r, nil
+}
+
+// Save saves the session loaded by Load, adding the session cookie to the
+// headers of w if it needs to be sent. It must be called before the response
+// headers are written, for example from a framework's before-response hook.
+// Nothing is saved if ManualSave is true, in which case call Commit instead.
+// The ErrorHandler is not called if the session can't be saved; the error is
+// returned instead. Requests handled by the Enable middleware are saved by
+// the middleware, so use Commit rather than Save there.
+func (s *Session) Save(w http.ResponseWriter, r *http.Request) error {
+	if s.ManualSave {
+		return nil
+	}
+
+	var c *cache
+	switch v := r.Context().Value(contextKeyCache).(type) {
+	case *cache:
+		c = v
+	case *lazyCache:
+		var err error
+		c, err = v.loaded()
+		if err != nil {
+			return err
+		}
+	}
+	if c == nil {
+		return nil
+	}
+
+	err := withPhase(PhaseSave, s.save(w, r, c))
+	if err != nil {
+		return err
+	}
+	s.afterSave(r, c)
+	return nil
+}
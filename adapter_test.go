@@ -0,0 +1,102 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoadAndSaveWithoutMiddleware(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	// serve imitates a framework which calls Load and Save around its own
+	// handlers, without going through Enable.
+	serve := func(cookie string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		if cookie != "" {
+			r.Header.Set("Cookie", cookie)
+		}
+
+		r, err := s.Load(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Put(r, "count", s.GetInt(r, "count")+1)
+		err = s.Save(rr, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(rr, s.GetInt(r, "count"))
+		return rr
+	}
+
+	rr := serve("")
+	cookie := rr.Header().Get("Set-Cookie")
+	if cookie == "" {
+		t.Fatal("got no session cookie")
+	}
+
+	rr = serve(cookie)
+	if rr.Body.String() != "2" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "2")
+	}
+}
+
+func TestLoadTwice(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	r, err := s.Load(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put(r, "foo", "bar")
+
+	r, err = s.Load(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.GetString(r, "foo") != "bar" {
+		t.Errorf("got %q: expected %q", s.GetString(r, "foo"), "bar")
+	}
+}
+
+func TestSaveUnmodified(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	rr := httptest.NewRecorder()
+	r, err := s.Load(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Save(rr, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr.Header().Get("Set-Cookie") != "" {
+		t.Errorf("got %q: expected %q", rr.Header().Get("Set-Cookie"), "")
+	}
+
+	err = s.Save(rr, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Errorf("got %v: expected %v", err, nil)
+	}
+}
+
+func TestSaveError(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		t.Errorf("ErrorHandler called with %v", err)
+	}
+
+	r, err := s.Load(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put(r, "foo", make(chan int))
+	err = s.Save(httptest.NewRecorder(), r)
+	if err == nil {
+		t.Errorf("got %v: expected an error", err)
+	}
+}
@@ -0,0 +1,148 @@
+package sessions
+
+import (
+	"errors"
+	"reflect"
+)
+
+// ErrListUnsupported is returned by ListSessions and UserSessions when the
+// Store doesn't implement Lister, or there is no Store.
+var ErrListUnsupported = errors.New("session: the store can't list sessions")
+
+// StoredSession describes a session held in the Store, as returned by
+// ListSessions, UserSessions and InspectSession.
+type StoredSession struct {
+	// Token is the session token, which can be passed to RevokeSession. It
+	// is as sensitive as the session itself, so only show it to trusted
+	// staff.
+	Token string
+
+	// ID is the session's ID (see Session.ID), if it has one.
+	ID string
+
+	// UserID is the value of the PrincipalKey, or nil if the session doesn't
+	// have an owner.
+	UserID interface{}
+
+	// Client describes the client which created the session, if it was
+	// recorded.
+	Client ClientInfo
+
+	TokenInfo
+}
+
+// ListSessions returns a page of the sessions in the Store, for building
+// internal tools for support staff. Pass "" as the cursor for the first page,
+// and the returned cursor for the next page, which is "" after the last page.
+// A page may hold fewer than limit sessions, even none, before the last page.
+// Unless includeValues is true, only the key names of the session data are
+// returned. Sessions which can't be decoded with the session's keys are left
+// out. The Store must implement Lister, or ErrListUnsupported is returned.
+func (s *Session) ListSessions(cursor string, limit int, includeValues bool) ([]StoredSession, string, error) {
+	l, ok := s.Store.(Lister)
+	if !ok {
+		return nil, "", ErrListUnsupported
+	}
+	tokens, next, err := l.List(cursor, limit)
+	if err != nil {
+		return nil, "", wrapError(ErrStoreFailed, err)
+	}
+
+	list := make([]StoredSession, 0, len(tokens))
+	for _, token := range tokens {
+		ss, err := s.InspectSession(token, includeValues)
+		if errors.Is(err, ErrStoreFailed) {
+			return nil, "", err
+		} else if err != nil {
+			continue
+		}
+		list = append(list, *ss)
+	}
+	return list, next, nil
+}
+
+// UserSessions returns all of the sessions in the Store which are owned by the
+// given user, such as for a support tool which shows a user's sessions. It
+// pages through every session in the Store, so it is slow for large stores.
+// The Store must implement Lister, or ErrListUnsupported is returned.
+func (s *Session) UserSessions(userID interface{}, includeValues bool) ([]StoredSession, error) {
+	return s.matchSessions(func(id interface{}) bool {
+		return reflect.DeepEqual(id, userID)
+	}, includeValues)
+}
+
+// matchSessions returns all of the sessions in the Store whose owner matches.
+func (s *Session) matchSessions(match func(userID interface{}) bool, includeValues bool) ([]StoredSession, error) {
+	var list []StoredSession
+	cursor := ""
+	for {
+		page, next, err := s.ListSessions(cursor, 1000, includeValues)
+		if err != nil {
+			return nil, err
+		}
+		for _, ss := range page {
+			if match(ss.UserID) {
+				list = append(list, ss)
+			}
+		}
+		if next == "" {
+			return list, nil
+		}
+		cursor = next
+	}
+}
+
+// InspectSession finds the session with the given token in the Store, and
+// describes it. Unless includeValues is true, only the key names of the
+// session data are returned. ErrInvalidToken is returned if the session isn't
+// in the Store or can't be decoded.
+func (s *Session) InspectSession(token string, includeValues bool) (*StoredSession, error) {
+	if s.Store == nil {
+		return nil, ErrInvalidToken
+	}
+	c := &cache{}
+	err := s.find(s.Store, c, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.storedSession(c, token, includeValues)
+}
+
+// storedSession describes the session data in c, which was found in the Store
+// under the token.
+func (s *Session) storedSession(c *cache, token string, includeValues bool) (*StoredSession, error) {
+	err := s.openFields(c)
+	if err != nil {
+		return nil, err
+	}
+
+	ss := &StoredSession{
+		Token:  token,
+		ID:     c.ID,
+		UserID: c.Data[s.principalKey()],
+		Client: c.Client,
+		TokenInfo: TokenInfo{
+			Expiry:   c.Expiry,
+			IssuedAt: c.IssuedAt,
+			Size:     len(token),
+			Keys:     sortedKeys(c.Data),
+		},
+	}
+	if includeValues {
+		ss.Values = c.Data
+	}
+	return ss, nil
+}
+
+// RevokeSession deletes the session with the given token from the Store, so
+// that it can't be used again.
+func (s *Session) RevokeSession(token string) error {
+	if s.Store == nil {
+		return ErrInvalidToken
+	}
+	err := s.storeDelete(s.Store, token)
+	if err != nil {
+		return wrapError(ErrStoreFailed, err)
+	}
+	return nil
+}
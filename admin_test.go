@@ -0,0 +1,104 @@
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golangcollege/sessions/memstore"
+)
+
+func TestListSessions(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = memstore.NewWithCleanupInterval(0)
+
+	var cookies []string
+	for _, user := range []string{"alice", "bob", "alice"} {
+		user := user
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.LoginUser(r, user)
+			s.Put(r, "foo", "bar")
+		})
+		_, cookie := testRequest(t, s.Enable(h), "")
+		cookies = append(cookies, cookie)
+	}
+
+	var all []StoredSession
+	cursor := ""
+	for {
+		page, next, err := s.ListSessions(cursor, 2, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(all) != 3 {
+		t.Fatalf("got %d: expected %d", len(all), 3)
+	}
+	for _, ss := range all {
+		if ss.Values != nil {
+			t.Errorf("got %v: expected %v", ss.Values, nil)
+		}
+		expected := []string{"_authTime", "_loginTime", "foo", "userID"}
+		if !reflect.DeepEqual(ss.Keys, expected) {
+			t.Errorf("got %v: expected %v", ss.Keys, expected)
+		}
+	}
+
+	list, err := s.UserSessions("alice", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("got %d: expected %d", len(list), 2)
+	}
+	if list[0].Values["foo"] != "bar" {
+		t.Errorf("got %v: expected %v", list[0].Values["foo"], "bar")
+	}
+
+	token := strings.TrimPrefix(strings.SplitN(cookies[1], ";", 2)[0], cookieName+"=")
+	ss, err := s.InspectSession(token, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ss.UserID != "bob" {
+		t.Errorf("got %v: expected %v", ss.UserID, "bob")
+	}
+
+	err = s.RevokeSession(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.InspectSession(token, false)
+	if err != ErrInvalidToken {
+		t.Errorf("got %v: expected %v", err, ErrInvalidToken)
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(s.GetString(r, "foo")))
+	})
+	body, _ := testRequest(t, s.Enable(h), cookies[1])
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+}
+
+func TestListSessionsUnsupported(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	_, _, err := s.ListSessions("", 10, false)
+	if err != ErrListUnsupported {
+		t.Errorf("got %v: expected %v", err, ErrListUnsupported)
+	}
+
+	// Embedding the Store interface hides the MemStore's List method.
+	s.Store = NewEncryptedStore(struct{ Store }{memstore.NewWithCleanupInterval(0)}, []byte("Zq4t7w!z%C*F-JaNdRgUkXp2s5u8x/A?"))
+	_, err = s.UserSessions("alice", false)
+	if !errors.Is(err, ErrListUnsupported) {
+		t.Errorf("got %v: expected %v", err, ErrListUnsupported)
+	}
+}
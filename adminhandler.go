@@ -0,0 +1,109 @@
+package sessions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AdminHandler returns an http.Handler which serves a JSON API over the
+// sessions in the Store, for internal tools used by support staff. It is
+// wrapped with the auth middleware, which must only let trusted staff
+// through, and should protect the DELETE endpoint against CSRF. AdminHandler
+// panics if auth is nil, so that the API can't be exposed by accident. Mount
+// it with http.StripPrefix, for example under "/admin/sessions". It serves:
+//
+//	GET    /?cursor=&limit=   a page of sessions, as ListSessions
+//	GET    /?user=alice       the sessions owned by a user, as UserSessions
+//	GET    /{token}           one session, as InspectSession
+//	DELETE /{token}           revokes a session, as RevokeSession
+//
+// Add values=1 to a GET request to include the session data values. The user
+// parameter is compared with the string form of each session's owner. Lists
+// are returned as {"sessions": [...], "next": "<cursor>"}.
+func (s *Session) AdminHandler(auth func(http.Handler) http.Handler) http.Handler {
+	if auth == nil {
+		panic("session: AdminHandler needs auth middleware")
+	}
+	return auth(http.HandlerFunc(s.serveAdmin))
+}
+
+func (s *Session) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	token := strings.Trim(r.URL.Path, "/")
+	includeValues := r.URL.Query().Get("values") == "1"
+
+	switch {
+	case token == "" && r.Method == http.MethodGet:
+		s.adminList(w, r, includeValues)
+	case token != "" && r.Method == http.MethodGet:
+		ss, err := s.InspectSession(token, includeValues)
+		if err != nil {
+			adminError(w, err)
+			return
+		}
+		adminJSON(w, ss)
+	case token != "" && r.Method == http.MethodDelete:
+		err := s.RevokeSession(token)
+		if err != nil {
+			adminError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Session) adminList(w http.ResponseWriter, r *http.Request, includeValues bool) {
+	q := r.URL.Query()
+	resp := struct {
+		Sessions []StoredSession `json:"sessions"`
+		Next     string          `json:"next"`
+	}{}
+
+	var err error
+	if user := q.Get("user"); user != "" {
+		resp.Sessions, err = s.matchSessions(func(userID interface{}) bool {
+			return userID != nil && fmt.Sprint(userID) == user
+		}, includeValues)
+	} else {
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		if limit <= 0 || limit > 1000 {
+			limit = 100
+		}
+		resp.Sessions, resp.Next, err = s.ListSessions(q.Get("cursor"), limit, includeValues)
+	}
+	if err != nil {
+		adminError(w, err)
+		return
+	}
+	if resp.Sessions == nil {
+		resp.Sessions = []StoredSession{}
+	}
+	adminJSON(w, resp)
+}
+
+func adminJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		adminError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// adminError responds with the status for the error, without its details.
+func adminError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrListUnsupported):
+		status = http.StatusNotImplemented
+	case errors.Is(err, ErrInvalidToken):
+		status = http.StatusNotFound
+	}
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,106 @@
+package sessions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golangcollege/sessions/memstore"
+)
+
+func TestAdminHandler(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = memstore.NewWithCleanupInterval(0)
+
+	var cookies []string
+	for _, user := range []string{"alice", "bob"} {
+		user := user
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.LoginUser(r, user)
+		})
+		_, cookie := testRequest(t, s.Enable(h), "")
+		cookies = append(cookies, cookie)
+	}
+
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer staff" {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	admin := http.StripPrefix("/admin/sessions", s.AdminHandler(auth))
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Authorization", "Bearer staff")
+		admin.ServeHTTP(rr, r)
+		return rr
+	}
+
+	rr := httptest.NewRecorder()
+	admin.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/sessions/", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusForbidden)
+	}
+
+	rr = do("GET", "/admin/sessions/?limit=10")
+	var list struct {
+		Sessions []StoredSession `json:"sessions"`
+		Next     string          `json:"next"`
+	}
+	err := json.Unmarshal(rr.Body.Bytes(), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Sessions) != 2 || list.Next != "" {
+		t.Errorf("got %d, %q: expected %d, %q", len(list.Sessions), list.Next, 2, "")
+	}
+
+	rr = do("GET", "/admin/sessions/?user=bob")
+	err = json.Unmarshal(rr.Body.Bytes(), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Sessions) != 1 || list.Sessions[0].UserID != "bob" {
+		t.Fatalf("got %+v: expected bob's session", list.Sessions)
+	}
+
+	token := strings.TrimPrefix(strings.SplitN(cookies[1], ";", 2)[0], cookieName+"=")
+	rr = do("GET", "/admin/sessions/"+token+"?values=1")
+	var ss StoredSession
+	err = json.Unmarshal(rr.Body.Bytes(), &ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ss.Values["userID"] != "bob" {
+		t.Errorf("got %v: expected %v", ss.Values["userID"], "bob")
+	}
+
+	rr = do("DELETE", "/admin/sessions/"+token)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusNoContent)
+	}
+	rr = do("GET", "/admin/sessions/"+token)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusNotFound)
+	}
+	rr = do("POST", "/admin/sessions/")
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestAdminHandlerNoAuth(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4")).AdminHandler(nil)
+}
@@ -0,0 +1,207 @@
+package sessions
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// The types of AuditEvent.
+const (
+	AuditCreated      = "created"
+	AuditRenewed      = "renewed"
+	AuditDestroyed    = "destroyed"
+	AuditOwnerChanged = "owner_changed"
+)
+
+// AuditEvent describes a change to the lifecycle of a session.
+type AuditEvent struct {
+	// Type is one of AuditCreated, AuditRenewed, AuditDestroyed or
+	// AuditOwnerChanged.
+	Type string `json:"type"`
+
+	// Time is the time that the event was recorded.
+	Time time.Time `json:"time"`
+
+	// UserID is the value of the PrincipalKey after the event, and
+	// PreviousUserID is its value when the request began. Both are nil if the
+	// session doesn't have an owner.
+	UserID         interface{} `json:"userID,omitempty"`
+	PreviousUserID interface{} `json:"previousUserID,omitempty"`
+
+	// SessionID is the session's ID (see Session.ID), which stays the same
+	// when its token is renewed. It is empty for sessions which were saved
+	// before Audit or Publisher was set, until they are next saved.
+	SessionID string `json:"sessionID,omitempty"`
+
+	// RemoteAddr and UserAgent describe the request which caused the event.
+	RemoteAddr string `json:"remoteAddr"`
+	UserAgent  string `json:"userAgent"`
+}
+
+// AuditSink records audit events. Record is called synchronously at the end of
+// the request, and should be safe for concurrent use. If it returns an error
+// then the error is logged, because the response has already been committed.
+type AuditSink interface {
+	Record(event AuditEvent) error
+}
+
+// Publisher publishes session events to other services, for example over a
+// pub/sub bus. Publish is called synchronously at the end of the request, so
+// implementations which may be slow should publish in the background. It
+// should be safe for concurrent use. If it returns an error then the error is
+// logged, because the response has already been committed.
+type Publisher interface {
+	Publish(event AuditEvent) error
+}
+
+type auditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewAuditLog returns an AuditSink which appends each event to w as a line of
+// JSON. To write to a file, open it with os.O_APPEND. Writes are serialized,
+// so a single audit log can be shared by multiple sessions.
+func NewAuditLog(w io.Writer) AuditSink {
+	return &auditLog{enc: json.NewEncoder(w)}
+}
+
+func (l *auditLog) Record(event AuditEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.enc.Encode(event)
+}
+
+// ID returns a random identifier for the session, which stays the same when
+// its token is renewed, and is sent with its AuditEvents. Unlike the session
+// token, it can be shared with other services, so that they can match the
+// events to the sessions they know about. A session without an ID is given
+// one, and saved.
+func (s *Session) ID(r *http.Request) string {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ID == "" {
+		id, err := newID(s.random())
+		if err != nil {
+			c.reject(err)
+			return ""
+		}
+		c.ID = id
+		c.modified = true
+	}
+	return c.ID
+}
+
+// newID returns a new random session ID.
+func newID(random io.Reader) (string, error) {
+	b := make([]byte, 16)
+	_, err := io.ReadFull(random, b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// audit sends the audit events for the request to the Audit sink and the
+// Publisher, and to the OnCreate, OnRenew and OnDestroy hooks.
+func (s *Session) audit(r *http.Request, c *cache) {
+	if s.Audit == nil && s.Publisher == nil && s.OnCreate == nil && s.OnRenew == nil && s.OnDestroy == nil {
+		return
+	}
+
+	c.mu.Lock()
+	if !c.modified || c.skipSave {
+		c.mu.Unlock()
+		return
+	}
+
+	base := AuditEvent{
+		Time:           time.Now().UTC(),
+		PreviousUserID: c.owner,
+		SessionID:      c.ID,
+		RemoteAddr:     r.RemoteAddr,
+		UserAgent:      r.UserAgent(),
+	}
+	if !c.destroyed {
+		base.UserID = c.Data[s.principalKey()]
+	}
+
+	var types []string
+	if c.restarted {
+		types = append(types, AuditDestroyed)
+	}
+	switch {
+	case c.destroyed:
+		if !c.isNew {
+			types = append(types, AuditDestroyed)
+		}
+	case c.isNew:
+		types = append(types, AuditCreated)
+	case c.renewed:
+		types = append(types, AuditRenewed)
+	}
+	if !c.destroyed && !reflect.DeepEqual(c.owner, base.UserID) {
+		types = append(types, AuditOwnerChanged)
+	}
+
+	c.isNew = false
+	c.renewed = false
+	previousID := c.previousID
+	c.restarted = false
+	c.previousID = ""
+	c.owner = base.UserID
+	c.mu.Unlock()
+
+	for i, typ := range types {
+		event := base
+		event.Type = typ
+		if i == 0 && typ == AuditDestroyed && previousID != "" {
+			// The destroyed session was replaced by a new one.
+			event.SessionID = previousID
+		}
+		if fn := s.lifecycleHook(typ); fn != nil {
+			fn(r, event)
+		}
+		if s.Audit != nil {
+			s.auditFailed(r, "session audit failed", s.Audit.Record(event))
+		}
+		if s.Publisher != nil {
+			s.auditFailed(r, "session event publishing failed", s.Publisher.Publish(event))
+		}
+	}
+}
+
+// auditFailed logs an error from the Audit sink or the Publisher.
+func (s *Session) auditFailed(r *http.Request, msg string, err error) {
+	if err == nil {
+		return
+	}
+	if s.Logger != nil {
+		s.logError(r, msg, err)
+	} else {
+		log.Output(3, err.Error())
+	}
+}
+
+// lifecycleHook returns the hook for the type of audit event, if any.
+func (s *Session) lifecycleHook(typ string) func(r *http.Request, event AuditEvent) {
+	switch typ {
+	case AuditCreated:
+		return s.OnCreate
+	case AuditRenewed:
+		return s.OnRenew
+	case AuditDestroyed:
+		return s.OnDestroy
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package sessions
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	var buf bytes.Buffer
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Audit = NewAuditLog(&buf)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.GetString(r, "foo")
+	})
+	testRequest(t, s.Enable(h), cookie)
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.LoginUser(r, "alice")
+	})
+	_, cookie = testRequest(t, s.Enable(h), cookie)
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Destroy(r)
+	})
+	testRequest(t, s.Enable(h), cookie)
+
+	var types []string
+	var owners []interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var event AuditEvent
+		err := dec.Decode(&event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, event.Type)
+		owners = append(owners, event.UserID)
+	}
+
+	expectedTypes := []string{AuditCreated, AuditRenewed, AuditOwnerChanged, AuditDestroyed}
+	if !reflect.DeepEqual(types, expectedTypes) {
+		t.Errorf("got %v: expected %v", types, expectedTypes)
+	}
+	expectedOwners := []interface{}{nil, "alice", "alice", nil}
+	if !reflect.DeepEqual(owners, expectedOwners) {
+		t.Errorf("got %v: expected %v", owners, expectedOwners)
+	}
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	var events []string
+	var owners []interface{}
+	record := func(r *http.Request, event AuditEvent) {
+		events = append(events, event.Type)
+		owners = append(owners, event.PreviousUserID)
+	}
+	s.OnCreate = record
+	s.OnRenew = record
+	s.OnDestroy = record
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.LoginUser(r, "alice")
+	})
+	_, cookie = testRequest(t, s.Enable(h), cookie)
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Destroy(r)
+	})
+	testRequest(t, s.Enable(h), cookie)
+
+	expectedEvents := []string{AuditCreated, AuditRenewed, AuditDestroyed}
+	if !reflect.DeepEqual(events, expectedEvents) {
+		t.Errorf("got %v: expected %v", events, expectedEvents)
+	}
+	expectedOwners := []interface{}{nil, nil, "alice"}
+	if !reflect.DeepEqual(owners, expectedOwners) {
+		t.Errorf("got %v: expected %v", owners, expectedOwners)
+	}
+}
+
+type testPublisher struct {
+	events []AuditEvent
+}
+
+func (p *testPublisher) Publish(event AuditEvent) error {
+	p.events = append(p.events, event)
+	return nil
+}
+
+func TestPublisher(t *testing.T) {
+	p := &testPublisher{}
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Publisher = p
+
+	var id string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = s.ID(r)
+		s.LoginUser(r, "alice")
+	})
+	_, cookie = testRequest(t, s.Enable(h), cookie)
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Destroy(r)
+		s.Put(r, "foo", "baz")
+	})
+	testRequest(t, s.Enable(h), cookie)
+
+	var types []string
+	for _, event := range p.events {
+		types = append(types, event.Type)
+	}
+	expectedTypes := []string{AuditCreated, AuditRenewed, AuditOwnerChanged, AuditDestroyed, AuditCreated, AuditOwnerChanged}
+	if !reflect.DeepEqual(types, expectedTypes) {
+		t.Fatalf("got %v: expected %v", types, expectedTypes)
+	}
+	if id == "" {
+		t.Fatal("expected a session ID")
+	}
+	for _, event := range p.events[:4] {
+		if event.SessionID != id {
+			t.Errorf("%s: got %q: expected %q", event.Type, event.SessionID, id)
+		}
+	}
+	for _, event := range p.events[4:] {
+		if event.SessionID == "" || event.SessionID == id {
+			t.Errorf("%s: got %q: expected a new session ID", event.Type, event.SessionID)
+		}
+	}
+}
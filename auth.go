@@ -0,0 +1,336 @@
+package sessions
+
+import (
+	"encoding/gob"
+	"net/http"
+	"time"
+)
+
+// defaultPrincipalKey is used by LoginUser and LogoutUser when the session's
+// PrincipalKey is empty.
+const defaultPrincipalKey = "userID"
+
+const (
+	keyLoginTime       = "_loginTime"
+	keyAuthTime        = "_authTime"
+	keyStepUpTime      = "_stepUpTime"
+	keyPendingUserID   = "_pendingUserID"
+	keyPendingDeadline = "_pendingDeadline"
+	keyImpersonators   = "_impersonators"
+)
+
+// ImpersonationEvent describes a change to the impersonation stack, and is
+// passed to the OnImpersonate hook.
+type ImpersonationEvent struct {
+	// Started is true when an impersonation begins, and false when it ends.
+	Started bool
+
+	// RealUser is the ID of the user who originally logged in.
+	RealUser interface{}
+
+	// From and To are the effective user IDs before and after the change.
+	From interface{}
+	To   interface{}
+}
+
+func init() {
+	// The login time is stored as a time.Time value, so it must be registered
+	// for it to be encoded within the session data. time.Duration is
+	// registered too, so that it can be used with GetDuration and PopDuration,
+	// and so is map[string]string for GetMap and PopMap. The other types with
+	// typed getters are registered by encoding/gob itself.
+	gob.Register(time.Time{})
+	gob.Register(time.Duration(0))
+	gob.Register([]interface{}{})
+	gob.Register(map[string]string{})
+}
+
+func (s *Session) principalKey() string {
+	if s.PrincipalKey == "" {
+		return defaultPrincipalKey
+	}
+	return s.PrincipalKey
+}
+
+// LoginUser records that the given user has authenticated. It stores the user
+// ID under the PrincipalKey (or "userID" if PrincipalKey is empty), records the
+// current time as the login time and the time of the most recent
+// authentication, and renews the session so that it gets a fresh expiry time
+// and a new token.
+func (s *Session) LoginUser(r *http.Request, userID interface{}) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now().UTC()
+	s.login(c, userID, now)
+	c.set(keyAuthTime, now)
+}
+
+// login stores the user ID and login time and renews the session. The caller
+// must hold c.mu.
+func (s *Session) login(c *cache, userID interface{}, now time.Time) {
+	c.set(s.principalKey(), userID)
+	c.set(keyLoginTime, now)
+	s.renew(c)
+}
+
+// LogoutUser removes all session data except for the keys listed in
+// LogoutPreserveKeys (such as a user's language or theme preferences), and
+// renews the session so that the client receives a new token. A session which
+// was switched to RememberLifetime by RememberMe() goes back to the normal
+// Lifetime.
+func (s *Session) LogoutUser(r *http.Request) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	preserved := make(map[string]interface{}, len(s.LogoutPreserveKeys))
+	for _, key := range s.LogoutPreserveKeys {
+		if val, exists := c.Data[key]; exists {
+			preserved[key] = val
+		}
+	}
+	c.Data = preserved
+	for key := range c.KeyExpiry {
+		if _, exists := preserved[key]; !exists {
+			delete(c.KeyExpiry, key)
+		}
+	}
+	if c.Persist == persistRemember {
+		c.Persist = persistDefault
+	}
+	s.renew(c)
+}
+
+// LoginTime returns the time that the user was logged in by LoginUser. The
+// zero time is returned if the user is not logged in.
+func (s *Session) LoginTime(r *http.Request) time.Time {
+	return s.GetTime(r, keyLoginTime)
+}
+
+// Reauthenticate records that the logged in user has just proved their
+// identity again (for example, by re-entering their password), so that
+// NeedsReauth() will return false until the ReauthTimeout has passed.
+func (s *Session) Reauthenticate(r *http.Request) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	c.set(keyAuthTime, time.Now().UTC())
+	c.modified = true
+	c.mu.Unlock()
+}
+
+// NeedsReauth returns true if the user's most recent authentication was more
+// than ReauthTimeout ago, or if they have not authenticated in this session at
+// all. It can be used to make a user log in again before a sensitive action
+// (such as changing their password) while letting them keep browsing with
+// their existing session. A session restored with RestoreRememberedUser()
+// always needs re-authentication.
+func (s *Session) NeedsReauth(r *http.Request) bool {
+	authTime := s.GetTime(r, keyAuthTime)
+	if authTime.IsZero() {
+		return true
+	}
+	return s.expired(authTime.Add(s.ReauthTimeout))
+}
+
+// LastAuthenticatedAt returns the time that the user most recently
+// authenticated, with LoginUser() or Reauthenticate(). The zero time is
+// returned if the user has not authenticated in this session.
+func (s *Session) LastAuthenticatedAt(r *http.Request) time.Time {
+	return s.GetTime(r, keyAuthTime)
+}
+
+// StepUp records that the user has just completed a step-up authentication
+// (such as an MFA challenge) for access to more sensitive actions. Calling
+// StepUp also counts as authenticating, so it updates LastAuthenticatedAt.
+func (s *Session) StepUp(r *http.Request) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	now := time.Now().UTC()
+	c.set(keyAuthTime, now)
+	c.set(keyStepUpTime, now)
+	c.modified = true
+	c.mu.Unlock()
+}
+
+// LastStepUpAt returns the time that StepUp() was last called for the
+// session. The zero time is returned if the user has not stepped up.
+func (s *Session) LastStepUpAt(r *http.Request) time.Time {
+	return s.GetTime(r, keyStepUpTime)
+}
+
+// SteppedUpWithin returns true if the user completed a step-up authentication
+// within the given duration. It can be used to implement policies such as
+// "require MFA within the last 15 minutes for admin actions":
+//
+//	if !session.SteppedUpWithin(r, 15*time.Minute) {
+//		http.Redirect(w, r, "/mfa", http.StatusSeeOther)
+//		return
+//	}
+func (s *Session) SteppedUpWithin(r *http.Request, d time.Duration) bool {
+	t := s.LastStepUpAt(r)
+	if t.IsZero() {
+		return false
+	}
+	return !s.expired(t.Add(d))
+}
+
+// StartPending2FA puts the session into a restricted, half-authenticated state
+// for a user who has verified their password but still needs to complete a
+// second authentication factor. The user is not logged in (nothing is stored
+// under the PrincipalKey) until Complete2FA() is called. If the second factor
+// isn't completed within the Pending2FATimeout, the pending state is removed
+// automatically.
+func (s *Session) StartPending2FA(r *http.Request, userID interface{}) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	c.set(keyPendingUserID, userID)
+	c.set(keyPendingDeadline, time.Now().Add(s.Pending2FATimeout).UTC())
+	c.modified = true
+	c.mu.Unlock()
+}
+
+// Pending2FA returns the ID of the user who is waiting to complete a second
+// authentication factor. If there is no pending user, or the deadline has
+// passed, then ok will be false.
+func (s *Session) Pending2FA(r *http.Request) (userID interface{}, ok bool) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s.prunePending2FA(c)
+	userID, ok = c.Data[keyPendingUserID]
+	return userID, ok
+}
+
+// Complete2FA should be called once the pending user has successfully
+// completed their second authentication factor. It removes the pending state
+// and logs the user in with LoginUser(). If there is no pending user, or the
+// deadline has passed, then the session is not changed and false is returned.
+func (s *Session) Complete2FA(r *http.Request) bool {
+	userID, ok := s.Pending2FA(r)
+	if !ok {
+		return false
+	}
+
+	s.Cancel2FA(r)
+	s.LoginUser(r, userID)
+	return true
+}
+
+// Cancel2FA removes any pending two-factor authentication state from the
+// session.
+func (s *Session) Cancel2FA(r *http.Request) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.Data[keyPendingUserID]; !exists {
+		return
+	}
+	c.unset(keyPendingUserID)
+	c.unset(keyPendingDeadline)
+	c.modified = true
+}
+
+// prunePending2FA removes the pending two-factor authentication state if its
+// deadline has passed. The caller must hold c.mu.
+func (s *Session) prunePending2FA(c *cache) {
+	deadline, ok := c.Data[keyPendingDeadline].(time.Time)
+	if !ok || !s.expired(deadline) {
+		return
+	}
+	c.unset(keyPendingUserID)
+	c.unset(keyPendingDeadline)
+	c.modified = true
+}
+
+// Impersonate makes the given user the effective user for the session, for
+// example when an administrator uses a "view as user" feature. The current
+// value of the PrincipalKey is pushed onto a stack in the session data and
+// replaced with userID, so any code which checks the PrincipalKey will see the
+// impersonated user. Impersonations can be nested. The session is renewed, and
+// the OnImpersonate hook is called if it is set.
+func (s *Session) Impersonate(r *http.Request, userID interface{}) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	key := s.principalKey()
+	from := c.Data[key]
+	stack, _ := c.Data[keyImpersonators].([]interface{})
+	stack = append(stack, from)
+	c.set(keyImpersonators, stack)
+	c.set(key, userID)
+	s.renew(c)
+	c.mu.Unlock()
+
+	if s.OnImpersonate != nil {
+		s.OnImpersonate(r, ImpersonationEvent{Started: true, RealUser: stack[0], From: from, To: userID})
+	}
+}
+
+// StopImpersonating ends the most recent impersonation, restoring the previous
+// effective user. It returns false if no impersonation is in progress. The
+// session is renewed, and the OnImpersonate hook is called if it is set.
+func (s *Session) StopImpersonating(r *http.Request) bool {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	stack, _ := c.Data[keyImpersonators].([]interface{})
+	if len(stack) == 0 {
+		c.mu.Unlock()
+		return false
+	}
+
+	key := s.principalKey()
+	from := c.Data[key]
+	to := stack[len(stack)-1]
+	real := stack[0]
+	if len(stack) == 1 {
+		c.unset(keyImpersonators)
+	} else {
+		c.set(keyImpersonators, stack[:len(stack)-1])
+	}
+	c.set(key, to)
+	s.renew(c)
+	c.mu.Unlock()
+
+	if s.OnImpersonate != nil {
+		s.OnImpersonate(r, ImpersonationEvent{Started: false, RealUser: real, From: from, To: to})
+	}
+	return true
+}
+
+// EffectiveUser returns the ID of the user that the session is currently
+// acting as, which is the value stored under the PrincipalKey.
+func (s *Session) EffectiveUser(r *http.Request) interface{} {
+	return s.Get(r, s.principalKey())
+}
+
+// RealUser returns the ID of the user who originally logged in, regardless of
+// any impersonation that is in progress.
+func (s *Session) RealUser(r *http.Request) interface{} {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stack, _ := c.Data[keyImpersonators].([]interface{})
+	if len(stack) > 0 {
+		return stack[0]
+	}
+	return c.Data[s.principalKey()]
+}
+
+// IsImpersonating returns true if an impersonation is in progress.
+func (s *Session) IsImpersonating(r *http.Request) bool {
+	return s.Exists(r, keyImpersonators)
+}
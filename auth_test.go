@@ -0,0 +1,211 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoginLogoutUser(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	c.Expiry = time.Now().Add(time.Minute)
+	c.Data["theme"] = "dark"
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.LogoutPreserveKeys = []string{"theme"}
+
+	if !s.LoginTime(r).IsZero() {
+		t.Errorf("got %v: expected %v", s.LoginTime(r), time.Time{})
+	}
+
+	s.LoginUser(r, 42)
+	if s.GetInt(r, "userID") != 42 {
+		t.Errorf("got %v: expected %v", s.GetInt(r, "userID"), 42)
+	}
+	if time.Since(s.LoginTime(r)) > time.Second {
+		t.Errorf("got %v: expected approximately %v", s.LoginTime(r), time.Now())
+	}
+	if time.Until(c.Expiry) < 23*time.Hour {
+		t.Errorf("session was not renewed on login")
+	}
+
+	s.Put(r, "cart", []string{"apple"})
+	c.Expiry = time.Now().Add(time.Minute)
+
+	s.LogoutUser(r)
+	if !reflect.DeepEqual(s.Keys(r), []string{"theme"}) {
+		t.Errorf("got %v: expected %v", s.Keys(r), []string{"theme"})
+	}
+	if time.Until(c.Expiry) < 23*time.Hour {
+		t.Errorf("session was not renewed on logout")
+	}
+	if !c.modified {
+		t.Errorf("got %v: expected %v", c.modified, true)
+	}
+}
+
+func TestNeedsReauth(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	if !s.NeedsReauth(r) {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+
+	s.LoginUser(r, 42)
+	if s.NeedsReauth(r) {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+
+	c.Data[keyAuthTime] = time.Now().Add(-20 * time.Minute).UTC()
+	if !s.NeedsReauth(r) {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+
+	s.Reauthenticate(r)
+	if s.NeedsReauth(r) {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+
+	s.ReauthTimeout = -time.Second
+	if !s.NeedsReauth(r) {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+}
+
+func TestStepUp(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	s.LoginUser(r, 42)
+	if time.Since(s.LastAuthenticatedAt(r)) > time.Second {
+		t.Errorf("got %v: expected approximately %v", s.LastAuthenticatedAt(r), time.Now())
+	}
+	if !s.LastStepUpAt(r).IsZero() {
+		t.Errorf("got %v: expected %v", s.LastStepUpAt(r), time.Time{})
+	}
+	if s.SteppedUpWithin(r, 15*time.Minute) {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+
+	s.StepUp(r)
+	if !s.SteppedUpWithin(r, 15*time.Minute) {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+	if !s.LastAuthenticatedAt(r).Equal(s.LastStepUpAt(r)) {
+		t.Errorf("got %v: expected %v", s.LastAuthenticatedAt(r), s.LastStepUpAt(r))
+	}
+
+	c.Data[keyStepUpTime] = time.Now().Add(-20 * time.Minute).UTC()
+	if s.SteppedUpWithin(r, 15*time.Minute) {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+
+	s.LogoutUser(r)
+	if !s.LastStepUpAt(r).IsZero() || !s.LastAuthenticatedAt(r).IsZero() {
+		t.Errorf("authentication timestamps were not removed on logout")
+	}
+}
+
+func TestPending2FA(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	if s.Complete2FA(r) {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+
+	s.StartPending2FA(r, 42)
+	userID, ok := s.Pending2FA(r)
+	if !ok || userID != 42 {
+		t.Errorf("got %v, %v: expected %v, %v", userID, ok, 42, true)
+	}
+	if s.Exists(r, "userID") {
+		t.Errorf("user was logged in before completing 2FA")
+	}
+
+	if !s.Complete2FA(r) {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+	if s.GetInt(r, "userID") != 42 {
+		t.Errorf("got %v: expected %v", s.GetInt(r, "userID"), 42)
+	}
+	if _, ok := s.Pending2FA(r); ok {
+		t.Errorf("pending state was not removed")
+	}
+
+	s.Pending2FATimeout = -time.Second
+	s.StartPending2FA(r, 43)
+	if s.Complete2FA(r) {
+		t.Errorf("2FA was completed after the deadline")
+	}
+	if s.Exists(r, keyPendingUserID) || s.Exists(r, keyPendingDeadline) {
+		t.Errorf("pending state was not removed after the deadline")
+	}
+}
+
+func TestImpersonate(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	var events []ImpersonationEvent
+	s.OnImpersonate = func(r *http.Request, event ImpersonationEvent) {
+		events = append(events, event)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.LoginUser(r, 1)
+		s.Impersonate(r, 2)
+		s.Impersonate(r, 3)
+	})
+
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.IsImpersonating(r), s.EffectiveUser(r), s.RealUser(r))
+		s.StopImpersonating(r)
+		fmt.Fprint(w, s.IsImpersonating(r), s.EffectiveUser(r), s.RealUser(r))
+		s.StopImpersonating(r)
+		fmt.Fprint(w, s.IsImpersonating(r), s.EffectiveUser(r), s.RealUser(r))
+		fmt.Fprint(w, s.StopImpersonating(r))
+	})
+
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "true 3 1true 2 1false 1 1false" {
+		t.Errorf("got %q: expected %q", body, "true 3 1true 2 1false 1 1false")
+	}
+
+	expected := []ImpersonationEvent{
+		{Started: true, RealUser: 1, From: 1, To: 2},
+		{Started: true, RealUser: 1, From: 2, To: 3},
+		{Started: false, RealUser: 1, From: 3, To: 2},
+		{Started: false, RealUser: 1, From: 2, To: 1},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("got %v: expected %v", events, expected)
+	}
+}
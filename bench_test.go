@@ -0,0 +1,172 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// benchSizes are the approximate sizes in bytes of the session data used by
+// the benchmarks, from a session holding a user ID and a few flags up to one
+// which needs most of the 4096 byte cookie limit.
+var benchSizes = []int{512, 1024, 2048, 4096}
+
+// benchData returns session data with string values totalling about size
+// bytes, in 64 byte values.
+func benchData(size int) map[string]interface{} {
+	data := make(map[string]interface{})
+	for i := 0; i < size/64; i++ {
+		data[fmt.Sprintf("key%03d", i)] = fmt.Sprintf("%064x", i*2654435761)
+	}
+	return data
+}
+
+func benchCache(size int) *cache {
+	c := newCache(time.Hour)
+	c.Data = benchData(size)
+	c.IssuedAt = time.Now().UTC()
+	return c
+}
+
+// benchCookies returns the Cookie header for a request carrying the session
+// data, which may be split across several cookies.
+func benchCookies(b *testing.B, s *Session, size int) string {
+	rr := httptest.NewRecorder()
+	r, err := s.Load(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for key, val := range benchData(size) {
+		s.Put(r, key, val)
+	}
+	err = s.Save(rr, r)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range rr.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	return r.Header.Get("Cookie")
+}
+
+// newBenchSession returns a session which splits large session cookies, so
+// that the largest benchmark sizes can be saved in cookies.
+func newBenchSession() *Session {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Chunk = true
+	return s
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+			c := benchCache(size)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := s.encode(c)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+			token, err := s.encode(benchCache(size))
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.SetBytes(int64(len(token)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c := &cache{}
+				err := c.decode(s.codec(), s.ciphers(), token, s.decryptionKeys(c))
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLoad(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			s := newBenchSession()
+			cookie := benchCookies(b, s, size)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.Header.Set("Cookie", cookie)
+				_, err := s.Load(r)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSave(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			s := newBenchSession()
+			cookie := benchCookies(b, s, size)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				r := httptest.NewRequest("GET", "/", nil)
+				r.Header.Set("Cookie", cookie)
+				r, err := s.Load(r)
+				if err != nil {
+					b.Fatal(err)
+				}
+				s.Put(r, "key000", i)
+				b.StartTimer()
+
+				err = s.Save(httptest.NewRecorder(), r)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEnable(b *testing.B) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		w.Write([]byte("Hello world"))
+	})
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	cookie := rr.Header().Get("Set-Cookie")
+
+	handler := s.Enable(h)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Cookie", cookie)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
@@ -0,0 +1,144 @@
+package sessions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+)
+
+// exporterLabel is the label used for TLS exported keying material (RFC 5705).
+const exporterLabel = "EXPORTER-golangcollege-sessions"
+
+// TLSExporterBinding is a Binding function which binds sessions to the TLS
+// connection, using exported keying material (RFC 5705). Because the keying
+// material is different for every TLS session, a client which opens a new
+// connection without resuming its TLS session will be given a new session, so
+// this is only suitable for high-security deployments where that is
+// acceptable. It returns nil for requests which weren't made over TLS.
+func TLSExporterBinding(r *http.Request) []byte {
+	if r.TLS == nil {
+		return nil
+	}
+
+	b, err := r.TLS.ExportKeyingMaterial(exporterLabel, nil, 32)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// UserAgentBinding is a Binding function which binds sessions to the client's
+// User-Agent header, with any version numbers removed so that sessions survive
+// browser updates. It is a weak fingerprint, since the User-Agent is easily
+// copied along with a stolen cookie, but it stops the cookie being replayed
+// naively from a different browser or operating system. It returns nil for
+// requests without a User-Agent.
+func UserAgentBinding(r *http.Request) []byte {
+	ua := r.UserAgent()
+	if ua == "" {
+		return nil
+	}
+
+	b := make([]byte, 0, len(ua))
+	for i := 0; i < len(ua); i++ {
+		if c := ua[i]; (c < '0' || c > '9') && c != '.' && c != '_' {
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+// CombineBindings returns a Binding function which binds sessions to all of
+// the values returned by fns, for example to both the User-Agent and the TLS
+// connection:
+//
+//	session.Binding = sessions.CombineBindings(sessions.UserAgentBinding, sessions.TLSExporterBinding)
+//
+// It returns nil, so that the session is not bound, only if all of fns do.
+func CombineBindings(fns ...func(r *http.Request) []byte) func(r *http.Request) []byte {
+	return func(r *http.Request) []byte {
+		var b []byte
+		bound := false
+		for _, fn := range fns {
+			val := fn(r)
+			if val != nil {
+				bound = true
+			}
+			var n [4]byte
+			binary.BigEndian.PutUint32(n[:], uint32(len(val)))
+			b = append(b, n[:]...)
+			b = append(b, val...)
+		}
+		if !bound {
+			return nil
+		}
+		return b
+	}
+}
+
+// bind checks that the session is bound to the client making the request, and
+// binds it if it is not bound yet. It returns false if the session is bound to
+// a different client.
+func (s *Session) bind(r *http.Request, c *cache) bool {
+	if s.Binding == nil {
+		return true
+	}
+
+	val := s.Binding(r)
+	if val == nil {
+		return c.Binding == nil
+	}
+
+	sum := sha256.Sum256(val)
+	if c.Binding == nil {
+		c.Binding = sum[:]
+		return true
+	}
+	return hmac.Equal(c.Binding, sum[:])
+}
+
+// CertIdentity describes the TLS client certificate which a session is bound
+// to when BindClientCert is true.
+type CertIdentity struct {
+	// Fingerprint is the hex-encoded SHA-256 hash of the certificate.
+	Fingerprint string
+
+	// Subject is the certificate's subject distinguished name.
+	Subject string
+}
+
+func newCertIdentity(r *http.Request) CertIdentity {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return CertIdentity{}
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+	sum := sha256.Sum256(cert.Raw)
+	return CertIdentity{
+		Fingerprint: hex.EncodeToString(sum[:]),
+		Subject:     cert.Subject.String(),
+	}
+}
+
+// checkCert returns false if the session is bound to a different client
+// certificate from the one used for the request.
+func (s *Session) checkCert(r *http.Request, c *cache) bool {
+	if !s.BindClientCert {
+		return true
+	}
+	return c.Cert.Fingerprint == newCertIdentity(r).Fingerprint
+}
+
+// ClientCert returns the identity of the TLS client certificate that the
+// current session is bound to. If the session isn't bound to a certificate
+// then ok will be false.
+func (s *Session) ClientCert(r *http.Request) (id CertIdentity, ok bool) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.Cert, c.Cert.Fingerprint != ""
+}
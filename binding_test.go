@@ -0,0 +1,164 @@
+package sessions
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBinding(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	var channel string
+	s.Binding = func(r *http.Request) []byte {
+		if channel == "" {
+			return nil
+		}
+		return []byte(channel)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+
+	channel = "conn-1"
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+
+	channel = "conn-2"
+	body, _ = testRequest(t, s.Enable(h), cookie)
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+
+	channel = ""
+	body, _ = testRequest(t, s.Enable(h), cookie)
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+}
+
+func TestTLSExporterBinding(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b := TLSExporterBinding(r); b != nil {
+		t.Errorf("got %v: expected %v", b, nil)
+	}
+}
+
+func TestBindClientCert(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.BindClientCert = true
+
+	alice := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+		{Raw: []byte("alice"), Subject: pkix.Name{CommonName: "alice"}},
+	}}
+	bob := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+		{Raw: []byte("bob"), Subject: pkix.Name{CommonName: "bob"}},
+	}}
+
+	do := func(h http.Handler, state *tls.ConnectionState, cookie string) (string, string) {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.TLS = state
+		if cookie != "" {
+			r.Header.Set("Cookie", cookie)
+		}
+		h.ServeHTTP(rr, r)
+		return rr.Body.String(), rr.Header().Get("Set-Cookie")
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := do(s.Enable(h), alice, "")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := s.ClientCert(r)
+		fmt.Fprintf(w, "%s %s %v %d", s.GetString(r, "foo"), id.Subject, ok, len(id.Fingerprint))
+	})
+
+	body, _ := do(s.Enable(h), alice, cookie)
+	if body != "bar CN=alice true 64" {
+		t.Errorf("got %q: expected %q", body, "bar CN=alice true 64")
+	}
+
+	body, _ = do(s.Enable(h), bob, cookie)
+	if body != " CN=bob true 64" {
+		t.Errorf("got %q: expected %q", body, " CN=bob true 64")
+	}
+
+	body, _ = do(s.Enable(h), nil, cookie)
+	if body != "  false 0" {
+		t.Errorf("got %q: expected %q", body, "  false 0")
+	}
+}
+
+func TestUserAgentBinding(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Binding = UserAgentBinding
+
+	do := func(ua, cookie string) (string, string) {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", ua)
+		if cookie != "" {
+			r.Header.Set("Cookie", cookie)
+		}
+		s.Enable(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, s.GetString(r, "foo"))
+			s.Put(r, "foo", "bar")
+		})).ServeHTTP(rr, r)
+		return rr.Body.String(), rr.Header().Get("Set-Cookie")
+	}
+
+	_, cookie := do("Mozilla/5.0 (X11; Linux x86_64) Firefox/118.0", "")
+
+	body, _ := do("Mozilla/5.0 (X11; Linux x86_64) Firefox/119.0", cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+
+	body, _ = do("Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/118.0", cookie)
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+}
+
+func TestCombineBindings(t *testing.T) {
+	value := func(v string) func(*http.Request) []byte {
+		return func(*http.Request) []byte {
+			if v == "" {
+				return nil
+			}
+			return []byte(v)
+		}
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+
+	if b := CombineBindings(value(""), value(""))(r); b != nil {
+		t.Errorf("got %v: expected %v", b, nil)
+	}
+
+	// The values must not be ambiguous when they are concatenated.
+	ab := CombineBindings(value("a"), value("bc"))(r)
+	abc := CombineBindings(value("ab"), value("c"))(r)
+	if string(ab) == string(abc) {
+		t.Errorf("got %v: expected different bindings", ab)
+	}
+}
@@ -1,11 +1,12 @@
 package sessions
 
 import (
-	"bytes"
 	"context"
-	"encoding/gob"
 	"errors"
+	"io"
+	"math/rand"
 	"net/http"
+	"reflect"
 	"sort"
 	"sync"
 	"time"
@@ -13,16 +14,79 @@ import (
 
 type contextKey string
 
-var contextKeyCache = contextKey("cache")
+var (
+	contextKeyCache  = contextKey("cache")
+	contextKeyWriter = contextKey("writer")
+)
+
+// The possible values of the cache Persist field. Gob doesn't transmit zero
+// values, so the per-session override is stored as an int rather than a
+// *bool. persistRemember is persistOn with the RememberLifetime.
+const (
+	persistDefault = iota
+	persistOn
+	persistOff
+	persistRemember
+)
 
 var errMissingCache = errors.New("session: cache not present in request context")
 
 type cache struct {
 	Data      map[string]interface{}
 	Expiry    time.Time
+	Deadline  time.Time
+	IssuedAt  time.Time
+	Version   int
+	Persist   int
+	Client    ClientInfo
+	Binding   []byte
+	Cert      CertIdentity
+	KeyExpiry map[string]time.Time
+	Revision  int
+	ID        string
 	modified  bool
 	destroyed bool
+	skipSave  bool
 	mu        sync.Mutex
+
+	device       int
+	deviceUserID interface{}
+	original     map[string]interface{}
+	snapshotted  bool
+	origModified bool
+	origExpiry   time.Time
+	origPersist  int
+	isNew        bool
+	restarted    bool
+	rejected     bool
+	skipRoll     bool
+	renewed      bool
+	owner        interface{}
+	onCommit     []func()
+	token        string
+	oldToken     string
+	keyIndex     int
+	cipherIndex  int
+	migrateTo    *Session
+	migrateFrom  *Session
+	secureKeys   map[string]bool
+	undecodable  bool
+	touched      bool
+	spilled      bool
+	previousID   string
+
+	// invalid holds the first error from a value which was rejected by the
+	// Validators, or from generating the session ID, which stops the session
+	// from being saved.
+	invalid error
+
+	// keys holds the tenant keys returned by KeysFor for the request, or nil
+	// if the session's usual keys are used.
+	keys [][32]byte
+
+	// loaded holds a copy of the session as it was when the handler started
+	// using it, which Discard restores.
+	loaded *cache
 }
 
 func newCache(lifetime time.Duration) *cache {
@@ -32,24 +96,94 @@ func newCache(lifetime time.Duration) *cache {
 	}
 }
 
-func (c *cache) encode(key [32]byte) (string, error) {
-	var b bytes.Buffer
-	err := gob.NewEncoder(&b).Encode(c)
+// emptyCache returns the cache for a new session started by the given request.
+func (s *Session) emptyCache(r *http.Request) *cache {
+	c := newCache(0)
+	s.resetExpiry(c)
+	c.Version = s.SchemaVersion
+	c.isNew = true
+	c.keys = s.tenantKeys(r)
+	if s.RecordClientInfo {
+		c.Client = newClientInfo(r)
+	}
+	s.bind(r, c)
+	if s.BindClientCert {
+		c.Cert = newCertIdentity(r)
+	}
+	return c
+}
+
+// clone returns a shallow copy of the cache's encoded fields, along with the
+// keys which must be sealed when it is encoded. The caller must hold c.mu.
+func (c *cache) clone() *cache {
+	cp := &cache{
+		Data:       make(map[string]interface{}, len(c.Data)+1),
+		Expiry:     c.Expiry,
+		Deadline:   c.Deadline,
+		IssuedAt:   c.IssuedAt,
+		Version:    c.Version,
+		Persist:    c.Persist,
+		Client:     c.Client,
+		Binding:    c.Binding,
+		Cert:       c.Cert,
+		KeyExpiry:  c.KeyExpiry,
+		Revision:   c.Revision,
+		ID:         c.ID,
+		secureKeys: c.secureKeys,
+		keys:       c.keys,
+	}
+	for key, val := range c.Data {
+		cp.Data[key] = val
+	}
+	return cp
+}
+
+// encode encodes, compresses and encrypts the cache. Unless legacy is true,
+// the encoded state is wrapped in an envelope which records its format.
+func (c *cache) encode(codec Codec, compressed, legacy bool, cipher Cipher, key [32]byte, random io.Reader) (string, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if !legacy {
+		buf.Write(envelopeHeader(codec, 0))
+	}
+	payload, err := c.marshal(codec, buf)
 	if err != nil {
-		return "", err
+		return "", wrapError(ErrEncodeFailed, err)
+	}
+	b := buf.Bytes()
+	if compressed {
+		zbuf := getBuffer()
+		defer putBuffer(zbuf)
+		if !legacy {
+			zbuf.Write(envelopeHeader(codec, envelopeCompressed))
+		}
+		if z := compress(payload, zbuf); len(z) < len(payload) {
+			b = zbuf.Bytes()
+		}
 	}
 
-	return encrypt(b.Bytes(), key)
+	token, err := sealToken(cipher, b, key, random)
+	if err != nil {
+		return "", wrapError(ErrEncryptFailed, err)
+	}
+	return token, nil
 }
 
-func (c *cache) decode(token string, keys [][32]byte) error {
-	b, err := decrypt(token, keys)
+func (c *cache) decode(codec Codec, ciphers []Cipher, token string, keys [][32]byte) error {
+	b, i, j, err := openToken(ciphers, token, keys)
 	if err != nil {
 		return err
 	}
+	c.cipherIndex = i
+	c.keyIndex = j
 
-	r := bytes.NewReader(b)
-	return gob.NewDecoder(r).Decode(c)
+	codec, b, err = openEnvelope(codec, b)
+	if err == nil {
+		err = c.unmarshal(codec, b)
+	}
+	c.undecodable = err != nil
+	return err
 }
 
 func addCacheToRequestContext(r *http.Request, c *cache) *http.Request {
@@ -58,22 +192,416 @@ func addCacheToRequestContext(r *http.Request, c *cache) *http.Request {
 }
 
 func getCacheFromRequestContext(r *http.Request) *cache {
-	c, ok := r.Context().Value(contextKeyCache).(*cache)
-	if !ok {
-		panic(errMissingCache)
+	return getCacheFromContext(r.Context())
+}
+
+func addWriterToRequestContext(r *http.Request, bw *bufferedResponseWriter) *http.Request {
+	ctx := context.WithValue(r.Context(), contextKeyWriter, bw)
+	return r.WithContext(ctx)
+}
+
+// deepCopy returns a deep copy of v. Pointers, maps and slices which can be
+// reached more than once, including through a cycle, are only copied once,
+// and the copy is shared in the same way as the original.
+func deepCopy(v reflect.Value) reflect.Value {
+	return make(copier).copy(v)
+}
+
+// visit identifies a pointer, map or slice which has already been copied.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// copier remembers the copies made by deepCopy.
+type copier map[visit]reflect.Value
+
+func (cc copier) copy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		key := visit{v.Pointer(), v.Type(), 0}
+		if cp, ok := cc[key]; ok {
+			return cp
+		}
+		cp := reflect.New(v.Type().Elem())
+		cc[key] = cp
+		cp.Elem().Set(cc.copy(v.Elem()))
+		return cp
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(cc.copy(v.Elem()))
+		return cp
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		key := visit{v.Pointer(), v.Type(), v.Len()}
+		if cp, ok := cc[key]; ok {
+			return cp
+		}
+		cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		cc[key] = cp
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(cc.copy(v.Index(i)))
+		}
+		return cp
+	case reflect.Array:
+		cp := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(cc.copy(v.Index(i)))
+		}
+		return cp
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		key := visit{v.Pointer(), v.Type(), 0}
+		if cp, ok := cc[key]; ok {
+			return cp
+		}
+		cp := reflect.MakeMapWithSize(v.Type(), v.Len())
+		cc[key] = cp
+		iter := v.MapRange()
+		for iter.Next() {
+			cp.SetMapIndex(cc.copy(iter.Key()), cc.copy(iter.Value()))
+		}
+		return cp
+	case reflect.Struct:
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if cp.Field(i).CanSet() {
+				cp.Field(i).Set(cc.copy(v.Field(i)))
+			}
+		}
+		return cp
 	}
-	return c
+	return v
 }
 
 // Put adds a key and corresponding value to the session data. Any existing
 // value for the key will be replaced.
+//
+// If any of the Validators reject the value then the session data is left
+// unchanged, and the session isn't saved: the *ValidationError is passed to the
+// ErrorHandler at the end of the request instead. Use PutChecked() if you want
+// to handle validation errors yourself.
 func (s *Session) Put(r *http.Request, key string, val interface{}) {
+	s.PutCtx(r.Context(), key, val)
+}
+
+// PutChecked works like Put, except that the value is first checked against
+// any Validators for the key, and the session data is trial encoded to make
+// sure that the session cookie won't be longer than 4096 bytes. If a validator
+// rejects the value then the error is returned, and if the cookie would be too
+// long then ErrCookieTooLong is returned. In both cases the session data is
+// left unchanged, which lets handlers fall back gracefully (for example, by
+// trimming a history list) instead of the whole response failing when the
+// session data is saved.
+func (s *Session) PutChecked(r *http.Request, key string, val interface{}) error {
+	c := getCacheFromRequestContext(r)
+
+	err := s.validate(key, val)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err = s.checkSize(c, key, val)
+	if err != nil {
+		return err
+	}
+
+	s.put(c, key, val)
+	return nil
+}
+
+// checkSize returns ErrCookieTooLong if adding the key and value to the
+// session data would make the session cookie longer than 4096 bytes. There is
+// no limit when a Store or Transport is in use, Chunk is enabled, or oversized
+// sessions are spilled to the OversizeStore. The caller must hold c.mu.
+func (s *Session) checkSize(c *cache, key string, val interface{}) error {
+	if s.Store != nil || s.Chunk || s.Transport != nil || (s.OnOversize == OversizeSpill && s.OversizeStore != nil) {
+		return nil
+	}
+
+	projected := c.clone()
+	projected.IssuedAt = time.Now().UTC()
+	projected.Data[key] = val
+
+	cookie, err := s.cookie(projected)
+	if err != nil {
+		return err
+	}
+	if len(cookie.String()) > maxCookieLength {
+		return ErrCookieTooLong
+	}
+	return nil
+}
+
+// PutIfAbsent adds a key and corresponding value to the session data only if
+// the key is not already present, and returns true if the value was added. The
+// check and the write happen under a single lock. If any of the Validators
+// reject the value then false is returned, and the error is handled as it is
+// by Put.
+func (s *Session) PutIfAbsent(r *http.Request, key string, val interface{}) bool {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.Data[key]; exists {
+		return false
+	}
+
+	err := s.validate(key, val)
+	if err != nil {
+		c.reject(err)
+		return false
+	}
+
+	s.put(c, key, val)
+	return true
+}
+
+// CompareAndSwap replaces the value for a given key with new, but only if the
+// current value is equal to old (as determined by reflect.DeepEqual). A missing
+// key is treated as having the value nil. It returns true if the value was
+// swapped. The comparison and the write happen under a single lock, which makes
+// it suitable for state machine transitions such as moving through the steps of
+// a checkout. If any of the Validators reject the value then false is
+// returned, and the error is handled as it is by Put.
+func (s *Session) CompareAndSwap(r *http.Request, key string, old, new interface{}) bool {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !reflect.DeepEqual(c.Data[key], old) {
+		return false
+	}
+
+	err := s.validate(key, new)
+	if err != nil {
+		c.reject(err)
+		return false
+	}
+
+	s.put(c, key, new)
+	return true
+}
+
+// Update reads the current value for a given key, passes it to fn, and stores
+// the value that fn returns, all while holding the session data lock. A missing
+// key is passed to fn as nil. This makes read-modify-write operations on a
+// value race-free. For example:
+//
+//	session.Update(r, "count", func(old interface{}) interface{} {
+//		n, _ := old.(int)
+//		return n + 1
+//	})
+//
+// fn must not call any other methods on the session, or it will deadlock. If
+// any of the Validators reject the new value then the value is left unchanged,
+// and the error is handled as it is by Put.
+func (s *Session) Update(r *http.Request, key string, fn func(old interface{}) interface{}) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	val := fn(c.Data[key])
+
+	err := s.validate(key, val)
+	if err != nil {
+		c.reject(err)
+		return
+	}
+
+	s.put(c, key, val)
+}
+
+// Increment adds delta to the int value for a given key, and returns the new
+// value, while holding the session data lock, so that concurrent increments
+// aren't lost. A missing key is treated as 0. Numbers which were decoded as
+// another numeric type by the Codec (such as the float64 values produced by
+// JSONCodec) are converted to an int first. If any of the Validators reject
+// the new value then the current value is returned unchanged, and the error
+// is handled as it is by Put.
+//
+// If the key holds a value which isn't a number, it is left unchanged and 0
+// is returned. The session isn't saved, and a *ValidationError wrapping
+// ErrNotNumber is passed to the ErrorHandler instead.
+func (s *Session) Increment(r *http.Request, key string, delta int) int {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current, ok := toIntOK(c.Data[key])
+	if !ok && c.Data[key] != nil {
+		c.reject(&ValidationError{Key: key, Err: ErrNotNumber})
+		return 0
+	}
+	n := current + delta
+
+	err := s.validate(key, n)
+	if err != nil {
+		c.reject(err)
+		return n - delta
+	}
+
+	s.put(c, key, n)
+	return n
+}
+
+// Decrement subtracts delta from the int value for a given key, and returns
+// the new value. It is equivalent to Increment with -delta.
+func (s *Session) Decrement(r *http.Request, key string, delta int) int {
+	return s.Increment(r, key, -delta)
+}
+
+// WithLock calls fn with exclusive access to the session data map, so that
+// logic involving several keys (such as moving a value from one key to
+// another) happens atomically. The session is marked as modified, and renewed
+// if the value for the PrincipalKey changes. Validators are not applied to
+// values set by fn. Any time-to-live set with PutWithTTL is dropped for the
+// keys which fn removes or replaces.
+//
+// fn must not call any other methods on the session, or it will deadlock, and
+// it must not retain the map after it returns.
+func (s *Session) WithLock(r *http.Request, fn func(data map[string]interface{})) {
 	c := getCacheFromRequestContext(r)
 
 	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var principal interface{}
+	if s.PrincipalKey != "" {
+		principal = c.Data[s.PrincipalKey]
+	}
+	expiring := make(map[string]interface{}, len(c.KeyExpiry))
+	for key := range c.KeyExpiry {
+		expiring[key] = c.Data[key]
+	}
+
+	fn(c.Data)
+	c.modified = true
+
+	// Drop the time-to-live of any key which fn removed or replaced.
+	for key, old := range expiring {
+		val, exists := c.Data[key]
+		if !exists || !reflect.DeepEqual(old, val) {
+			delete(c.KeyExpiry, key)
+		}
+	}
+
+	if s.PrincipalKey != "" && !reflect.DeepEqual(principal, c.Data[s.PrincipalKey]) {
+		s.renew(c)
+	}
+}
+
+// put stores a value in the session data, renewing the session if the value
+// for the PrincipalKey has changed. The caller must hold c.mu.
+func (s *Session) put(c *cache, key string, val interface{}) {
+	if key == s.PrincipalKey && key != "" {
+		old, exists := c.Data[key]
+		if !exists || !reflect.DeepEqual(old, val) {
+			s.renew(c)
+		}
+	}
+	c.set(key, val)
+	c.modified = true
+}
+
+// set stores a value in the session data, dropping any time-to-live set for
+// the key, so that an old TTL never applies to a new value. Writes to c.Data
+// go through set, unset or clear, unless the caller updates KeyExpiry itself.
+// The caller must hold c.mu.
+func (c *cache) set(key string, val interface{}) {
 	c.Data[key] = val
+	delete(c.KeyExpiry, key)
+}
+
+// unset removes a key from the session data, along with its time-to-live. The
+// caller must hold c.mu.
+func (c *cache) unset(key string) {
+	delete(c.Data, key)
+	delete(c.KeyExpiry, key)
+}
+
+// clear removes all of the session data, along with every time-to-live. The
+// caller must hold c.mu.
+func (c *cache) clear() {
+	c.Data = make(map[string]interface{})
+	c.KeyExpiry = nil
+}
+
+// lifetime returns the Lifetime with a random LifetimeJitter applied.
+func (s *Session) lifetime(c *cache) time.Duration {
+	lifetime := s.sessionLifetime(c)
+	if s.LifetimeJitter <= 0 {
+		return lifetime
+	}
+	jitter := (rand.Float64()*2 - 1) * s.LifetimeJitter
+	return lifetime + time.Duration(float64(lifetime)*jitter)
+}
+
+// sessionLifetime returns the RememberLifetime if RememberMe has been called
+// for the session, or the Lifetime otherwise.
+func (s *Session) sessionLifetime(c *cache) time.Duration {
+	if c.Persist == persistRemember && s.RememberLifetime > 0 {
+		return s.RememberLifetime
+	}
+	return s.Lifetime
+}
+
+// resetExpiry sets the expiry of a new or renewed session to Lifetime from
+// now, or to IdleTimeout from now if that is sooner. The caller must hold c.mu.
+func (s *Session) resetExpiry(c *cache) {
+	now := time.Now()
+	c.Expiry = now.Add(s.lifetime(c)).UTC()
+	c.Deadline = time.Time{}
+	if s.IdleTimeout > 0 {
+		c.Deadline = c.Expiry
+		if idle := now.Add(s.IdleTimeout).UTC(); idle.Before(c.Expiry) {
+			c.Expiry = idle
+		}
+	}
+}
+
+// deadline returns the absolute expiry of the session, which the expiry can't
+// be extended past when an IdleTimeout is in use.
+func (c *cache) deadline() time.Time {
+	if c.Deadline.IsZero() {
+		return c.Expiry
+	}
+	return c.Deadline
+}
+
+// renew resets the session expiry, so that a session which changes hands
+// (for example, when a user logs in) gets a full, fresh lifetime. Because a
+// new random nonce is used every time a session cookie is encrypted, the
+// client will also receive an entirely new token. When a Store is in use, the
+// session data is moved to a new session token when it is saved. The caller
+// must hold c.mu.
+func (s *Session) renew(c *cache) {
+	s.resetExpiry(c)
 	c.modified = true
-	c.mu.Unlock()
+	c.renewed = true
+	if c.token != "" {
+		c.oldToken = c.token
+		c.token = ""
+	}
 }
 
 // Get returns the value for a given key from the session data. The return
@@ -87,13 +615,30 @@ func (s *Session) Put(r *http.Request, key string, val interface{}) {
 //
 // Note: Alternatives are the GetString(), GetInt(), GetBytes() and other
 // helper methods which wrap the type conversion for common types.
+//
+// Values which are reference types (such as slices, maps and pointers) are
+// shared with the session data, so mutating them will change the session data
+// without marking it as modified. Use GetCopy() if you need to change the
+// value, and then Put() it back.
 func (s *Session) Get(r *http.Request, key string) interface{} {
+	return s.GetCtx(r.Context(), key)
+}
+
+// GetCopy works like Get, except that it returns a deep copy of the value.
+// Slices, maps, arrays, pointers and the exported fields of structs are copied
+// recursively, so the returned value can be safely mutated without affecting
+// the session data.
+func (s *Session) GetCopy(r *http.Request, key string) interface{} {
 	c := getCacheFromRequestContext(r)
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	return c.Data[key]
+	val, exists := c.Data[key]
+	if !exists || val == nil {
+		return nil
+	}
+	return deepCopy(reflect.ValueOf(val)).Interface()
 }
 
 // Pop acts like a one-time Get. It returns the value for a given key from the
@@ -101,142 +646,398 @@ func (s *Session) Get(r *http.Request, key string) interface{} {
 // return value has the type interface{} so will usually need to be type
 // asserted before you can use it.
 func (s *Session) Pop(r *http.Request, key string) interface{} {
-	c := getCacheFromRequestContext(r)
-
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	val, exists := c.Data[key]
-	if !exists {
-		return nil
-	}
-	delete(c.Data, key)
-	c.modified = true
-
-	return val
+	return s.PopCtx(r.Context(), key)
 }
 
 // Remove deletes the given key and corresponding value from the session data.
 // If the key is not present this operation is a no-op.
 func (s *Session) Remove(r *http.Request, key string) {
+	s.RemoveCtx(r.Context(), key)
+}
+
+// Exists returns true if the given key is present in the session data.
+func (s *Session) Exists(r *http.Request, key string) bool {
+	return s.ExistsCtx(r.Context(), key)
+}
+
+// HasAll returns true if all of the given keys are present in the session
+// data. The check is made under a single lock, so it is consistent even if
+// other goroutines are modifying the session data.
+func (s *Session) HasAll(r *http.Request, keys ...string) bool {
 	c := getCacheFromRequestContext(r)
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	_, exists := c.Data[key]
-	if !exists {
-		return
+	for _, key := range keys {
+		if _, exists := c.Data[key]; !exists {
+			return false
+		}
 	}
-
-	delete(c.Data, key)
-	c.modified = true
+	return true
 }
 
-// Exists returns true if the given key is present in the session data.
-func (s *Session) Exists(r *http.Request, key string) bool {
+// HasAny returns true if at least one of the given keys is present in the
+// session data. The check is made under a single lock, so it is consistent even
+// if other goroutines are modifying the session data.
+func (s *Session) HasAny(r *http.Request, keys ...string) bool {
 	c := getCacheFromRequestContext(r)
 
 	c.mu.Lock()
-	_, exists := c.Data[key]
-	c.mu.Unlock()
+	defer c.mu.Unlock()
 
-	return exists
+	for _, key := range keys {
+		if _, exists := c.Data[key]; exists {
+			return true
+		}
+	}
+	return false
 }
 
 // Keys returns a slice of all key names present in the session data, sorted
 // alphabetically. If the cache contains no data then an empty slice will be
 // returned.
 func (s *Session) Keys(r *http.Request) []string {
+	return s.KeysCtx(r.Context())
+}
+
+// Items returns a copy of all key and value pairs present in the session data.
+// If the cache contains no data then an empty map will be returned. Note that
+// the values themselves are not copied, so changes to reference types (such as
+// slices and maps) will affect the underlying session data.
+func (s *Session) Items(r *http.Request) map[string]interface{} {
 	c := getCacheFromRequestContext(r)
 
 	c.mu.Lock()
-	keys := make([]string, len(c.Data))
-	i := 0
-	for key := range c.Data {
-		keys[i] = key
-		i++
+	items := make(map[string]interface{}, len(c.Data))
+	for key, val := range c.Data {
+		items[key] = val
 	}
 	c.mu.Unlock()
 
+	return items
+}
+
+// Data returns a deep copy of all key and value pairs present in the session
+// data, taken under a single lock, so that it is a consistent snapshot. Values
+// are copied in the same way as GetCopy, so the returned map can be safely
+// mutated without affecting the session data. This is useful for admin and
+// debug pages, and for passing the session data to templates.
+func (s *Session) Data(r *http.Request) map[string]interface{} {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := make(map[string]interface{}, len(c.Data))
+	for key, val := range c.Data {
+		if val == nil {
+			data[key] = nil
+			continue
+		}
+		data[key] = deepCopy(reflect.ValueOf(val)).Interface()
+	}
+	return data
+}
+
+// Iterate calls fn for each key and value pair in a snapshot of the session
+// data taken by Data(), in sorted key order, until fn returns false. The
+// session isn't locked while fn is running, so fn may call other methods on
+// the session, but changes it makes aren't reflected in the iteration.
+func (s *Session) Iterate(r *http.Request, fn func(key string, val interface{}) bool) {
+	data := s.Data(r)
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
 	sort.Strings(keys)
-	return keys
+
+	for _, key := range keys {
+		if !fn(key, data[key]) {
+			return
+		}
+	}
+}
+
+// PopAll acts like a one-time Items. It returns a copy of all key and value
+// pairs present in the session data, and then deletes them all from the session
+// data in the same operation. If the cache contains no data then an empty map
+// will be returned.
+func (s *Session) PopAll(r *http.Request) map[string]interface{} {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	items := c.Data
+	if len(items) > 0 {
+		c.clear()
+		c.modified = true
+	} else {
+		items = make(map[string]interface{})
+	}
+
+	return items
 }
 
 // Destroy deletes the current session. The session data is deleted from memory
 // and the client is instructed to delete the session cookie.
 //
-// Any further operations on the session data *within the same request cycle*
-// will result in a panic.
+// If any data is added to the session later in the same request (for example,
+// a flash message after logging out), then a new session is started in place
+// of the destroyed one, and the client receives a new session cookie instead.
 func (s *Session) Destroy(r *http.Request) {
+	s.DestroyCtx(r.Context())
+}
+
+// Renew resets the session expiry, so that the session gets a full, fresh
+// lifetime, while preserving the session data. When a Store is in use the
+// session data is also moved to a new session token, and the old token is
+// deleted from the store. You should call Renew whenever the privilege level
+// of a session changes (for example, after a password change) to prevent
+// session fixation attacks. Note that LoginUser() and any other change to the
+// PrincipalKey value renew the session automatically.
+func (s *Session) Renew(r *http.Request) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	s.renew(c)
+	c.mu.Unlock()
+}
+
+// Touch marks the session as modified, so that it is saved and the session
+// cookie is sent again at the end of the current request, even if the session
+// data hasn't changed (and even if SkipUnchanged is true). This re-issues the
+// cookie with the current settings, which is useful after attributes such as
+// Secure, SameSite or Domain have been changed, since an unmodified session
+// otherwise keeps its old cookie until its data next changes.
+func (s *Session) Touch(r *http.Request) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	c.modified = true
+	c.touched = true
+	c.mu.Unlock()
+}
+
+// SkipSave instructs the middleware not to save the session data at the end of
+// the current request, even if it has been modified. This is useful for
+// dry-run or preview endpoints where any changes should be thrown away.
+func (s *Session) SkipSave(r *http.Request) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	c.skipSave = true
+	c.mu.Unlock()
+}
+
+// Discard throws away all changes made to the session during the current
+// request (including any call to Destroy), and restores the session as it
+// was when it was loaded at the start of the request, without reading it
+// from the Store again. This is useful when a handler fails part way through,
+// for example because of a validation error or a rolled back database
+// transaction, and no partial session state should be saved. Any callbacks
+// queued with OnCommit are discarded too. Values which were changed in place,
+// such as a slice which was appended to, aren't restored, so use GetCopy for
+// values which you change. If the session was saved with Commit during the
+// request, it is restored as it was committed. Any later changes in the same
+// request are saved as normal.
+func (s *Session) Discard(r *http.Request) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.loaded == nil {
+		return
+	}
+	c.loaded.copyState(c)
+	c.touched = false
+	c.onCommit = nil
+}
+
+// checkpoint records the session's current state for Discard. The caller must
+// hold c.mu.
+func (c *cache) checkpoint() {
+	c.loaded = &cache{}
+	c.copyState(c.loaded)
+}
+
+// copyState copies the session state which a handler can change to dst, with
+// copies of its maps. The caller must hold c.mu.
+func (c *cache) copyState(dst *cache) {
+	dst.Data = make(map[string]interface{}, len(c.Data))
+	for key, val := range c.Data {
+		dst.Data[key] = val
+	}
+	dst.KeyExpiry = nil
+	if c.KeyExpiry != nil {
+		dst.KeyExpiry = make(map[string]time.Time, len(c.KeyExpiry))
+		for key, t := range c.KeyExpiry {
+			dst.KeyExpiry[key] = t
+		}
+	}
+	dst.secureKeys = nil
+	if c.secureKeys != nil {
+		dst.secureKeys = make(map[string]bool, len(c.secureKeys))
+		for key := range c.secureKeys {
+			dst.secureKeys[key] = true
+		}
+	}
+
+	dst.Expiry = c.Expiry
+	dst.Deadline = c.Deadline
+	dst.IssuedAt = c.IssuedAt
+	dst.Version = c.Version
+	dst.Persist = c.Persist
+	dst.Client = c.Client
+	dst.Binding = c.Binding
+	dst.Cert = c.Cert
+	dst.Revision = c.Revision
+	dst.ID = c.ID
+	dst.modified = c.modified
+	dst.destroyed = c.destroyed
+	dst.skipSave = c.skipSave
+	dst.skipRoll = c.skipRoll
+	dst.device = c.device
+	dst.deviceUserID = c.deviceUserID
+	dst.isNew = c.isNew
+	dst.restarted = c.restarted
+	dst.renewed = c.renewed
+	dst.owner = c.owner
+	dst.token = c.token
+	dst.oldToken = c.oldToken
+	dst.spilled = c.spilled
+	dst.previousID = c.previousID
+	dst.migrateTo = c.migrateTo
+	dst.invalid = c.invalid
+}
+
+// OnCommit queues a function to be called once the session has been saved
+// successfully at the end of the current request. This is useful for side
+// effects which must match the saved session state, such as sending a
+// verification email only once a token stored in the session has reached the
+// client. If saving the session fails, the functions are not called.
+// Functions are called in the order they were queued, before the response
+// body is written.
+func (s *Session) OnCommit(r *http.Request, fn func()) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	c.onCommit = append(c.onCommit, fn)
+	c.mu.Unlock()
+}
+
+// SkipRolling stops the session expiry from being extended at the end of the
+// current request when Rolling is true, so that requests which aren't real
+// user actions (such as polling) don't keep an idle session alive.
+func (s *Session) SkipRolling(r *http.Request) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	c.skipRoll = true
+	c.mu.Unlock()
+}
+
+// SetPersist overrides the Persist setting for the current session only. This
+// is useful for honoring a "this is a public computer" or "remember me"
+// checkbox at login. The override is stored with the session data, so it
+// applies to all subsequent requests until the session is destroyed.
+func (s *Session) SetPersist(r *http.Request, persist bool) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	c.Persist = persistOff
+	if persist {
+		c.Persist = persistOn
+	}
+	c.modified = true
+	c.mu.Unlock()
+}
+
+// RememberMe switches the current session between a long-lived persistent
+// session and a browser session, for a "keep me signed in" checkbox at login.
+// When remember is true, the session cookie is made persistent and the session
+// expiry is reset to RememberLifetime from now (and Rolling sessions are
+// extended by RememberLifetime). When it is false, the session cookie is only
+// kept until the browser is closed, and the expiry is reset to Lifetime from
+// now. Like SetPersist, the choice is stored with the session data. It is
+// cleared by LogoutUser.
+func (s *Session) RememberMe(r *http.Request, remember bool) {
 	c := getCacheFromRequestContext(r)
 
 	c.mu.Lock()
-	c.Data = nil
-	c.Expiry = time.Time{}
+	c.Persist = persistOff
+	if remember {
+		c.Persist = persistRemember
+	}
+	s.resetExpiry(c)
 	c.modified = true
-	c.destroyed = true
 	c.mu.Unlock()
 }
 
+// Expiry returns the time that the current session will expire, unless it is
+// extended by Rolling or IdleTimeout, or renewed. This can be used to show
+// "your session expires in N minutes" banners. The zero time is returned if
+// the session has been destroyed.
+func (s *Session) Expiry(r *http.Request) time.Time {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.Expiry
+}
+
+// TimeRemaining returns how long is left until the current session expires.
+// Zero is returned if the session has expired or been destroyed.
+func (s *Session) TimeRemaining(r *http.Request) time.Duration {
+	expiry := s.Expiry(r)
+	if expiry.IsZero() {
+		return 0
+	}
+
+	remaining := time.Until(expiry)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
 // GetString returns the string value for a given key from the session data.
 // The zero value for a string ("") is returned if the key does not exist or the
 // value could not be type asserted to a string.
 func (s *Session) GetString(r *http.Request, key string) string {
-	val := s.Get(r, key)
-	str, ok := val.(string)
-	if !ok {
-		return ""
-	}
-	return str
+	return s.GetStringCtx(r.Context(), key)
 }
 
 // GetBool returns the bool value for a given key from the session data. The
 // zero value for a bool (false) is returned if the key does not exist or the
 // value could not be type asserted to a bool.
 func (s *Session) GetBool(r *http.Request, key string) bool {
-	val := s.Get(r, key)
-	b, ok := val.(bool)
-	if !ok {
-		return false
-	}
-	return b
+	return s.GetBoolCtx(r.Context(), key)
 }
 
 // GetInt returns the int value for a given key from the session data. The
 // zero value for an int (0) is returned if the key does not exist or the
 // value could not be type asserted to an int.
 func (s *Session) GetInt(r *http.Request, key string) int {
-	val := s.Get(r, key)
-	i, ok := val.(int)
-	if !ok {
-		return 0
-	}
-	return i
+	return s.GetIntCtx(r.Context(), key)
 }
 
 // GetFloat returns the float64 value for a given key from the session data. The
 // zero value for an float64 (0) is returned if the key does not exist or the
 // value could not be type asserted to a float64.
 func (s *Session) GetFloat(r *http.Request, key string) float64 {
-	val := s.Get(r, key)
-	f, ok := val.(float64)
-	if !ok {
-		return 0
-	}
-	return f
+	return s.GetFloatCtx(r.Context(), key)
 }
 
 // GetBytes returns the byte slice ([]byte) value for a given key from the session
 // cache. The zero value for a slice (nil) is returned if the key does not exist
 // or could not be type asserted to []byte.
 func (s *Session) GetBytes(r *http.Request, key string) []byte {
-	val := s.Get(r, key)
-	b, ok := val.([]byte)
-	if !ok {
-		return nil
-	}
-	return b
+	return s.GetBytesCtx(r.Context(), key)
 }
 
 // GetTime returns the time.Time value for a given key from the session data. The
@@ -244,12 +1045,73 @@ func (s *Session) GetBytes(r *http.Request, key string) []byte {
 // value could not be type asserted to a time.Time. This can be tested with the
 // time.IsZero() method.
 func (s *Session) GetTime(r *http.Request, key string) time.Time {
+	return s.GetTimeCtx(r.Context(), key)
+}
+
+// GetTimeUTC works like GetTime, except that the returned time is converted
+// to UTC.
+func (s *Session) GetTimeUTC(r *http.Request, key string) time.Time {
+	return s.GetTime(r, key).UTC()
+}
+
+// GetDuration returns the time.Duration value for a given key from the session
+// data. The zero value for a time.Duration (0) is returned if the key does not
+// exist or the value could not be type asserted to a time.Duration.
+func (s *Session) GetDuration(r *http.Request, key string) time.Duration {
 	val := s.Get(r, key)
-	t, ok := val.(time.Time)
+	d, ok := val.(time.Duration)
 	if !ok {
-		return time.Time{}
+		return 0
 	}
-	return t
+	return d
+}
+
+// GetInt64 returns the int64 value for a given key from the session data. The
+// zero value for an int64 (0) is returned if the key does not exist or the
+// value could not be type asserted to an int64.
+func (s *Session) GetInt64(r *http.Request, key string) int64 {
+	val := s.Get(r, key)
+	i, ok := val.(int64)
+	if !ok {
+		return 0
+	}
+	return i
+}
+
+// GetUint64 returns the uint64 value for a given key from the session data.
+// The zero value for a uint64 (0) is returned if the key does not exist or the
+// value could not be type asserted to a uint64.
+func (s *Session) GetUint64(r *http.Request, key string) uint64 {
+	val := s.Get(r, key)
+	i, ok := val.(uint64)
+	if !ok {
+		return 0
+	}
+	return i
+}
+
+// GetStringSlice returns the []string value for a given key from the session
+// data. The zero value for a slice (nil) is returned if the key does not exist
+// or the value could not be type asserted to a []string.
+func (s *Session) GetStringSlice(r *http.Request, key string) []string {
+	val := s.Get(r, key)
+	ss, ok := val.([]string)
+	if !ok {
+		return nil
+	}
+	return ss
+}
+
+// GetMap returns the map[string]string value for a given key from the session
+// data. The zero value for a map (nil) is returned if the key does not exist
+// or the value could not be type asserted to a map[string]string.
+func (s *Session) GetMap(r *http.Request, key string) map[string]string {
+	val := s.Get(r, key)
+	m, ok := val.(map[string]string)
+	if !ok {
+		return nil
+	}
+	return m
 }
 
 // PopString returns the string value for a given key and then deletes it from the
@@ -323,3 +1185,65 @@ func (s *Session) PopTime(r *http.Request, key string) time.Time {
 	}
 	return t
 }
+
+// PopDuration returns the time.Duration value for a given key and then deletes
+// it from the session data. The zero value for a time.Duration (0) is returned
+// if the key does not exist or the value could not be type asserted to a
+// time.Duration.
+func (s *Session) PopDuration(r *http.Request, key string) time.Duration {
+	val := s.Pop(r, key)
+	d, ok := val.(time.Duration)
+	if !ok {
+		return 0
+	}
+	return d
+}
+
+// PopInt64 returns the int64 value for a given key and then deletes it from the
+// session data. The zero value for an int64 (0) is returned if the key does not
+// exist or the value could not be type asserted to an int64.
+func (s *Session) PopInt64(r *http.Request, key string) int64 {
+	val := s.Pop(r, key)
+	i, ok := val.(int64)
+	if !ok {
+		return 0
+	}
+	return i
+}
+
+// PopUint64 returns the uint64 value for a given key and then deletes it from
+// the session data. The zero value for a uint64 (0) is returned if the key does
+// not exist or the value could not be type asserted to a uint64.
+func (s *Session) PopUint64(r *http.Request, key string) uint64 {
+	val := s.Pop(r, key)
+	i, ok := val.(uint64)
+	if !ok {
+		return 0
+	}
+	return i
+}
+
+// PopStringSlice returns the []string value for a given key and then deletes
+// it from the session data. The zero value for a slice (nil) is returned if the
+// key does not exist or the value could not be type asserted to a []string.
+func (s *Session) PopStringSlice(r *http.Request, key string) []string {
+	val := s.Pop(r, key)
+	ss, ok := val.([]string)
+	if !ok {
+		return nil
+	}
+	return ss
+}
+
+// PopMap returns the map[string]string value for a given key and then deletes
+// it from the session data. The zero value for a map (nil) is returned if the
+// key does not exist or the value could not be type asserted to a
+// map[string]string.
+func (s *Session) PopMap(r *http.Request, key string) map[string]string {
+	val := s.Pop(r, key)
+	m, ok := val.(map[string]string)
+	if !ok {
+		return nil
+	}
+	return m
+}
@@ -2,10 +2,17 @@ package sessions
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/golangcollege/sessions/memstore"
 )
 
 func TestGetCacheFromRequestContext(t *testing.T) {
@@ -30,7 +37,7 @@ func TestPut(t *testing.T) {
 	c := newCache(time.Hour)
 	r = addCacheToRequestContext(r, c)
 
-	s := New([]byte("secret"))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
 	s.Put(r, "foo", "bar")
 
 	if c.Data["foo"] != "bar" {
@@ -42,6 +49,338 @@ func TestPut(t *testing.T) {
 	}
 }
 
+func TestPutCheckedSize(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	err = s.PutChecked(r, "foo", strings.Repeat("a", 1000))
+	if err != nil {
+		t.Errorf("got %v: expected %v", err, nil)
+	}
+
+	err = s.PutChecked(r, "bar", strings.Repeat("b", 3000))
+	if err != ErrCookieTooLong {
+		t.Errorf("got %v: expected %v", err, ErrCookieTooLong)
+	}
+	if _, exists := c.Data["bar"]; exists {
+		t.Errorf("got %v: expected %v", exists, false)
+	}
+
+	err = s.PutChecked(r, "foo", strings.Repeat("a", 2000))
+	if err != nil {
+		t.Errorf("got %v: expected %v", err, nil)
+	}
+}
+
+func TestLifetimeJitter(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Lifetime = 100 * time.Hour
+	c := newCache(0)
+
+	if s.lifetime(c) != s.Lifetime {
+		t.Errorf("got %v: expected %v", s.lifetime(c), s.Lifetime)
+	}
+
+	s.LifetimeJitter = 0.05
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		l := s.lifetime(c)
+		if l < 95*time.Hour || l > 105*time.Hour {
+			t.Fatalf("got %v: expected a lifetime between %v and %v", l, 95*time.Hour, 105*time.Hour)
+		}
+		seen[l] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("got %d distinct lifetimes: expected jitter to be applied", len(seen))
+	}
+}
+
+func TestPutPrincipalKey(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	c.Expiry = time.Now().Add(time.Minute)
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.PrincipalKey = "userID"
+
+	s.Put(r, "foo", "bar")
+	if time.Until(c.Expiry) > time.Minute {
+		t.Errorf("session was renewed when a non-principal key was added")
+	}
+
+	s.Put(r, "userID", 1)
+	if time.Until(c.Expiry) < 23*time.Hour {
+		t.Errorf("session was not renewed when the principal key was added")
+	}
+
+	c.Expiry = time.Now().Add(time.Minute)
+	s.Put(r, "userID", 1)
+	if time.Until(c.Expiry) > time.Minute {
+		t.Errorf("session was renewed when the principal key was unchanged")
+	}
+
+	s.Put(r, "userID", 2)
+	if time.Until(c.Expiry) < 23*time.Hour {
+		t.Errorf("session was not renewed when the principal key was changed")
+	}
+}
+
+func TestRenew(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	c.Data["foo"] = "bar"
+	c.Expiry = time.Now().Add(time.Minute)
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Renew(r)
+
+	if time.Until(c.Expiry) < 23*time.Hour {
+		t.Errorf("got %v: expected %v", time.Until(c.Expiry), 24*time.Hour)
+	}
+	if c.modified != true {
+		t.Errorf("got %v: expected %v", c.modified, true)
+	}
+	if c.Data["foo"] != "bar" {
+		t.Errorf("got %v: expected %v", c.Data["foo"], "bar")
+	}
+}
+
+func TestExpiryTimeRemaining(t *testing.T) {
+	r := MockRequest(httptest.NewRequest("GET", "/", nil))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	c := getCacheFromRequestContext(r)
+	c.Expiry = time.Now().Add(30 * time.Minute).UTC()
+
+	if !s.Expiry(r).Equal(c.Expiry) {
+		t.Errorf("got %v: expected %v", s.Expiry(r), c.Expiry)
+	}
+	if remaining := s.TimeRemaining(r); remaining > 30*time.Minute || remaining < 29*time.Minute {
+		t.Errorf("got %v: expected %v", remaining, 30*time.Minute)
+	}
+
+	c.Expiry = time.Now().Add(-time.Minute)
+	if s.TimeRemaining(r) != 0 {
+		t.Errorf("got %v: expected %v", s.TimeRemaining(r), 0)
+	}
+
+	s.Destroy(r)
+	if !s.Expiry(r).IsZero() {
+		t.Errorf("got %v: expected %v", s.Expiry(r), time.Time{})
+	}
+	if s.TimeRemaining(r) != 0 {
+		t.Errorf("got %v: expected %v", s.TimeRemaining(r), 0)
+	}
+}
+
+func TestPutIfAbsent(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	c.Data["foo"] = "bar"
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	if s.PutIfAbsent(r, "foo", "baz") {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+	if c.Data["foo"] != "bar" {
+		t.Errorf("got %q: expected %q", c.Data["foo"], "bar")
+	}
+	if c.modified {
+		t.Errorf("got %v: expected %v", c.modified, false)
+	}
+
+	if !s.PutIfAbsent(r, "woo", "waa") {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+	if c.Data["woo"] != "waa" {
+		t.Errorf("got %q: expected %q", c.Data["woo"], "waa")
+	}
+	if !c.modified {
+		t.Errorf("got %v: expected %v", c.modified, true)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	c.Data["step"] = "cart"
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	if s.CompareAndSwap(r, "step", "shipping", "payment") {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+	if c.Data["step"] != "cart" {
+		t.Errorf("got %q: expected %q", c.Data["step"], "cart")
+	}
+	if c.modified {
+		t.Errorf("got %v: expected %v", c.modified, false)
+	}
+
+	if !s.CompareAndSwap(r, "step", "cart", "shipping") {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+	if c.Data["step"] != "shipping" {
+		t.Errorf("got %q: expected %q", c.Data["step"], "shipping")
+	}
+
+	if !s.CompareAndSwap(r, "visits", nil, 1) {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+	if c.Data["visits"] != 1 {
+		t.Errorf("got %v: expected %v", c.Data["visits"], 1)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	incr := func(old interface{}) interface{} {
+		n, _ := old.(int)
+		return n + 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Update(r, "count", incr)
+		}()
+	}
+	wg.Wait()
+
+	if c.Data["count"] != 100 {
+		t.Errorf("got %v: expected %v", c.Data["count"], 100)
+	}
+	if !c.modified {
+		t.Errorf("got %v: expected %v", c.modified, true)
+	}
+}
+
+func TestIncrementDecrement(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	c.Data["float"] = float64(41)
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.Increment(r, "count", 3)
+		}()
+		go func() {
+			defer wg.Done()
+			s.Decrement(r, "count", 1)
+		}()
+	}
+	wg.Wait()
+
+	if c.Data["count"] != 200 {
+		t.Errorf("got %v: expected %v", c.Data["count"], 200)
+	}
+	if !c.modified {
+		t.Errorf("got %v: expected %v", c.modified, true)
+	}
+
+	if n := s.Increment(r, "float", 1); n != 42 {
+		t.Errorf("got %v: expected %v", n, 42)
+	}
+}
+
+func TestIncrementNotNumber(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	c.Data["name"] = "alice"
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	if n := s.Increment(r, "name", 1); n != 0 {
+		t.Errorf("got %v: expected %v", n, 0)
+	}
+	if c.Data["name"] != "alice" {
+		t.Errorf("got %v: expected %v", c.Data["name"], "alice")
+	}
+	if !errors.Is(c.invalid, ErrNotNumber) {
+		t.Errorf("got %v: expected %v", c.invalid, ErrNotNumber)
+	}
+}
+
+func TestWithLock(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	c.Data["pending"] = "bar"
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.PrincipalKey = "userID"
+
+	s.WithLock(r, func(data map[string]interface{}) {
+		data["confirmed"] = data["pending"]
+		delete(data, "pending")
+	})
+
+	if c.Data["confirmed"] != "bar" {
+		t.Errorf("got %v: expected %v", c.Data["confirmed"], "bar")
+	}
+	if _, exists := c.Data["pending"]; exists {
+		t.Errorf("got %v: expected %v", exists, false)
+	}
+	if !c.modified {
+		t.Errorf("got %v: expected %v", c.modified, true)
+	}
+
+	c.Expiry = time.Now().Add(time.Minute)
+	s.WithLock(r, func(data map[string]interface{}) {
+		data["userID"] = 42
+	})
+	if time.Until(c.Expiry) < 23*time.Hour {
+		t.Errorf("session was not renewed when the principal changed")
+	}
+}
+
 func TestGet(t *testing.T) {
 	r, err := http.NewRequest("GET", "/", nil)
 	if err != nil {
@@ -51,7 +390,7 @@ func TestGet(t *testing.T) {
 	c.Data["foo"] = "bar"
 	r = addCacheToRequestContext(r, c)
 
-	s := New([]byte("secret"))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
 	str, ok := s.Get(r, "foo").(string)
 	if !ok {
 		t.Errorf("could not convert %T to string", s.Get(r, "foo"))
@@ -62,6 +401,86 @@ func TestGet(t *testing.T) {
 	}
 }
 
+func TestGetCopy(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type item struct {
+		Tags  []string
+		Attrs map[string]int
+	}
+
+	c := newCache(time.Hour)
+	c.Data["foo"] = []byte("bar")
+	c.Data["baz"] = &item{Tags: []string{"a"}, Attrs: map[string]int{"a": 1}}
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	b := s.GetCopy(r, "foo").([]byte)
+	b[0] = 'c'
+	if !bytes.Equal(c.Data["foo"].([]byte), []byte("bar")) {
+		t.Errorf("got %q: expected %q", c.Data["foo"], "bar")
+	}
+
+	i := s.GetCopy(r, "baz").(*item)
+	i.Tags[0] = "b"
+	i.Attrs["a"] = 2
+	expected := &item{Tags: []string{"a"}, Attrs: map[string]int{"a": 1}}
+	if !reflect.DeepEqual(c.Data["baz"], expected) {
+		t.Errorf("got %v: expected %v", c.Data["baz"], expected)
+	}
+
+	if c.modified {
+		t.Errorf("got %v: expected %v", c.modified, false)
+	}
+
+	if s.GetCopy(r, "missing") != nil {
+		t.Errorf("got %v: expected %v", s.GetCopy(r, "missing"), nil)
+	}
+}
+
+func TestGetCopyCycle(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type node struct {
+		Name string
+		Next *node
+	}
+
+	ring := &node{Name: "a"}
+	ring.Next = &node{Name: "b", Next: ring}
+	m := map[string]interface{}{"name": "m"}
+	m["self"] = m
+
+	c := newCache(time.Hour)
+	c.Data["ring"] = ring
+	c.Data["map"] = m
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	cp := s.GetCopy(r, "ring").(*node)
+	if cp == ring || cp.Next == ring.Next {
+		t.Errorf("got the original: expected a copy")
+	}
+	if cp.Next.Next != cp {
+		t.Errorf("got %p: expected %p", cp.Next.Next, cp)
+	}
+
+	mcp := s.GetCopy(r, "map").(map[string]interface{})
+	mcp["name"] = "changed"
+	if m["name"] != "m" {
+		t.Errorf("got %v: expected %v", m["name"], "m")
+	}
+	if mcp["self"].(map[string]interface{})["name"] != "changed" {
+		t.Errorf("got %v: expected the copy to refer to itself", mcp["self"])
+	}
+}
+
 func TestPop(t *testing.T) {
 	r, err := http.NewRequest("GET", "/", nil)
 	if err != nil {
@@ -71,7 +490,7 @@ func TestPop(t *testing.T) {
 	c.Data["foo"] = "bar"
 	r = addCacheToRequestContext(r, c)
 
-	s := New([]byte("secret"))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
 	str, ok := s.Pop(r, "foo").(string)
 	if !ok {
 		t.Errorf("could not convert %T to string", s.Get(r, "foo"))
@@ -100,7 +519,7 @@ func TestRemove(t *testing.T) {
 	c.Data["foo"] = "bar"
 	r = addCacheToRequestContext(r, c)
 
-	s := New([]byte("secret"))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
 	s.Remove(r, "foo")
 
 	if c.Data["foo"] != nil {
@@ -121,7 +540,7 @@ func TestExists(t *testing.T) {
 	c.Data["foo"] = "bar"
 	r = addCacheToRequestContext(r, c)
 
-	s := New([]byte("secret"))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
 	if !s.Exists(r, "foo") {
 		t.Errorf("got %v: expected %v", s.Exists(r, "foo"), true)
 	}
@@ -131,6 +550,31 @@ func TestExists(t *testing.T) {
 	}
 }
 
+func TestHasAllHasAny(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	c.Data["foo"] = "bar"
+	c.Data["woo"] = "waa"
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	if !s.HasAll(r, "foo", "woo") {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+	if s.HasAll(r, "foo", "baz") {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+	if !s.HasAny(r, "baz", "woo") {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+	if s.HasAny(r, "baz", "qux") {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+}
+
 func TestKeys(t *testing.T) {
 	r, err := http.NewRequest("GET", "/", nil)
 	if err != nil {
@@ -141,13 +585,111 @@ func TestKeys(t *testing.T) {
 	c.Data["woo"] = "waa"
 	r = addCacheToRequestContext(r, c)
 
-	s := New([]byte("secret"))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
 	keys := s.Keys(r)
 	if !reflect.DeepEqual(keys, []string{"foo", "woo"}) {
 		t.Errorf("got %v: expected %v", keys, []string{"foo", "woo"})
 	}
 }
 
+func TestItems(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	c.Data["foo"] = "bar"
+	c.Data["woo"] = 123
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	items := s.Items(r)
+	expected := map[string]interface{}{"foo": "bar", "woo": 123}
+	if !reflect.DeepEqual(items, expected) {
+		t.Errorf("got %v: expected %v", items, expected)
+	}
+
+	items["foo"] = "baz"
+	if c.Data["foo"] != "bar" {
+		t.Errorf("got %q: expected %q", c.Data["foo"], "bar")
+	}
+}
+
+func TestData(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	c.Data["foo"] = []string{"bar"}
+	c.Data["woo"] = 123
+	c.Data["nil"] = nil
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	data := s.Data(r)
+	expected := map[string]interface{}{"foo": []string{"bar"}, "woo": 123, "nil": nil}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("got %v: expected %v", data, expected)
+	}
+
+	data["foo"].([]string)[0] = "baz"
+	if c.Data["foo"].([]string)[0] != "bar" {
+		t.Errorf("got %q: expected %q", c.Data["foo"].([]string)[0], "bar")
+	}
+}
+
+func TestIterate(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	c.Data["c"] = 3
+	c.Data["a"] = 1
+	c.Data["b"] = 2
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	var keys []string
+	s.Iterate(r, func(key string, val interface{}) bool {
+		keys = append(keys, fmt.Sprint(key, "=", val))
+		s.Put(r, "d", 4)
+		return key != "b"
+	})
+
+	expected := []string{"a=1", "b=2"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("got %v: expected %v", keys, expected)
+	}
+}
+
+func TestPopAll(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	c.Data["foo"] = "bar"
+	c.Data["woo"] = 123
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	items := s.PopAll(r)
+	expected := map[string]interface{}{"foo": "bar", "woo": 123}
+	if !reflect.DeepEqual(items, expected) {
+		t.Errorf("got %v: expected %v", items, expected)
+	}
+
+	if len(c.Data) != 0 {
+		t.Errorf("got %v: expected %v", c.Data, map[string]interface{}{})
+	}
+
+	if !c.modified {
+		t.Errorf("got %v: expected %v", c.modified, true)
+	}
+}
+
 func TestGetString(t *testing.T) {
 	r, err := http.NewRequest("GET", "/", nil)
 	if err != nil {
@@ -157,7 +699,7 @@ func TestGetString(t *testing.T) {
 	c.Data["foo"] = "bar"
 	r = addCacheToRequestContext(r, c)
 
-	s := New([]byte("secret"))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
 	str := s.GetString(r, "foo")
 	if str != "bar" {
 		t.Errorf("got %q: expected %q", str, "bar")
@@ -178,7 +720,7 @@ func TestGetBool(t *testing.T) {
 	c.Data["foo"] = true
 	r = addCacheToRequestContext(r, c)
 
-	s := New([]byte("secret"))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
 	b := s.GetBool(r, "foo")
 	if b != true {
 		t.Errorf("got %v: expected %v", b, true)
@@ -199,7 +741,7 @@ func TestGetInt(t *testing.T) {
 	c.Data["foo"] = 123
 	r = addCacheToRequestContext(r, c)
 
-	s := New([]byte("secret"))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
 	i := s.GetInt(r, "foo")
 	if i != 123 {
 		t.Errorf("got %v: expected %d", i, 123)
@@ -220,7 +762,7 @@ func TestGetFloat(t *testing.T) {
 	c.Data["foo"] = 123.456
 	r = addCacheToRequestContext(r, c)
 
-	s := New([]byte("secret"))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
 	f := s.GetFloat(r, "foo")
 	if f != 123.456 {
 		t.Errorf("got %v: expected %f", f, 123.456)
@@ -241,7 +783,7 @@ func TestGetBytes(t *testing.T) {
 	c.Data["foo"] = []byte("bar")
 	r = addCacheToRequestContext(r, c)
 
-	s := New([]byte("secret"))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
 	b := s.GetBytes(r, "foo")
 	if !bytes.Equal(b, []byte("bar")) {
 		t.Errorf("got %v: expected %v", b, []byte("bar"))
@@ -265,7 +807,7 @@ func TestGetTime(t *testing.T) {
 	c.Data["foo"] = now
 	r = addCacheToRequestContext(r, c)
 
-	s := New([]byte("secret"))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
 	tm := s.GetTime(r, "foo")
 	if tm != now {
 		t.Errorf("got %v: expected %v", tm, now)
@@ -286,7 +828,7 @@ func TestPopString(t *testing.T) {
 	c.Data["foo"] = "bar"
 	r = addCacheToRequestContext(r, c)
 
-	s := New([]byte("secret"))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
 	str := s.PopString(r, "foo")
 	if str != "bar" {
 		t.Errorf("got %q: expected %q", str, "bar")
@@ -306,3 +848,173 @@ func TestPopString(t *testing.T) {
 		t.Errorf("got %q: expected %q", str, "")
 	}
 }
+
+func TestGetTimeUTC(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().In(time.FixedZone("UTC+10", 10*60*60))
+
+	c := newCache(time.Hour)
+	c.Data["foo"] = now
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	tm := s.GetTimeUTC(r, "foo")
+	if !tm.Equal(now) || tm.Location() != time.UTC {
+		t.Errorf("got %v: expected %v", tm, now.UTC())
+	}
+}
+
+func TestGetPopDuration(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "retryAfter", 90*time.Second)
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d := s.GetDuration(r, "retryAfter"); d != 90*time.Second {
+			t.Errorf("got %v: expected %v", d, 90*time.Second)
+		}
+		if d := s.PopDuration(r, "retryAfter"); d != 90*time.Second {
+			t.Errorf("got %v: expected %v", d, 90*time.Second)
+		}
+		if d := s.GetDuration(r, "retryAfter"); d != 0 {
+			t.Errorf("got %v: expected %v", d, 0)
+		}
+	})
+	testRequest(t, s.Enable(h), cookie)
+}
+
+func TestGetPopTypedValues(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.StrictTypes = true
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "id", int64(9007199254740993))
+		s.Put(r, "count", uint64(18446744073709551615))
+		s.Put(r, "roles", []string{"admin", "editor"})
+		s.Put(r, "prefs", map[string]string{"theme": "dark"})
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, s.GetInt64(r, "id"), s.GetUint64(r, "count"), s.GetStringSlice(r, "roles"), s.GetMap(r, "prefs"))
+		fmt.Fprintln(w, s.PopInt64(r, "id"), s.PopUint64(r, "count"), s.PopStringSlice(r, "roles"), s.PopMap(r, "prefs"))
+		fmt.Fprintln(w, s.GetInt64(r, "id"), s.GetUint64(r, "count"), s.GetStringSlice(r, "roles") == nil, s.GetMap(r, "prefs") == nil)
+	})
+	body, _ := testRequest(t, s.Enable(h), cookie)
+
+	expected := "9007199254740993 18446744073709551615 [admin editor] map[theme:dark]\n" +
+		"9007199254740993 18446744073709551615 [admin editor] map[theme:dark]\n" +
+		"0 0 true true\n"
+	if body != expected {
+		t.Errorf("got %q: expected %q", body, expected)
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "changed")
+		s.Put(r, "baz", "qux")
+		s.Destroy(r)
+		s.Discard(r)
+		fmt.Fprint(w, s.GetString(r, "foo"), s.Exists(r, "baz"))
+	})
+	body, updated := testRequest(t, s.Enable(h), cookie)
+	if body != "barfalse" {
+		t.Errorf("got %q: expected %q", body, "barfalse")
+	}
+	if updated != "" {
+		t.Errorf("got %q: expected %q", updated, "")
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "changed")
+		s.Discard(r)
+		fmt.Fprint(w, s.Exists(r, "foo"))
+	})
+	body, updated = testRequest(t, s.Enable(h), "")
+	if body != "false" {
+		t.Errorf("got %q: expected %q", body, "false")
+	}
+	if updated != "" {
+		t.Errorf("got %q: expected %q", updated, "")
+	}
+}
+
+func TestDiscardStored(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = memstore.NewWithCleanupInterval(0)
+	s.SetFieldKey([]byte("9y5Vlur8YvODJEhgOY8m9JVE4u46IpCV"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	// A change saved by a concurrent request isn't pulled in by Discard, and
+	// SkipSave and PutSecure are undone.
+	other := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "other")
+	})
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testRequest(t, s.Enable(other), cookie)
+		s.SkipSave(r)
+		s.PutSecure(r, "secret", "value")
+		s.Discard(r)
+		s.Put(r, "baz", "qux")
+		fmt.Fprint(w, s.GetString(r, "foo"), s.GetSecure(r, "secret"))
+	})
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "bar<nil>" {
+		t.Errorf("got %q: expected %q", body, "bar<nil>")
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"), s.GetString(r, "baz"))
+	})
+	body, _ = testRequest(t, s.Enable(h), cookie)
+	if body != "barqux" {
+		t.Errorf("got %q: expected %q", body, "barqux")
+	}
+}
+
+func TestTouch(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.SkipUnchanged = true
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+	if cookie == "" {
+		t.Fatal("expected a session cookie")
+	}
+
+	s.Secure = true
+	_, header := testRequest(t, s.Enable(h), cookie)
+	if header != "" {
+		t.Errorf("got %q: expected %q", header, "")
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		s.Touch(r)
+	})
+	_, header = testRequest(t, s.Enable(h), cookie)
+	if !strings.Contains(header, "; Secure") {
+		t.Errorf("got %q: expected a secure session cookie", header)
+	}
+}
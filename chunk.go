@@ -0,0 +1,121 @@
+package sessions
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxCookieLength is the maximum length of a cookie that browsers are
+// guaranteed to accept.
+const maxCookieLength = 4096
+
+// chunkName returns the name of the i'th chunk cookie of the named session
+// cookie, counting from 1.
+func chunkName(name string, i int) string {
+	return name + "-" + strconv.Itoa(i)
+}
+
+// chunkedToken reassembles a session token which has been split across chunk
+// cookies by the Chunk option. If the request has no chunk cookies then
+// http.ErrNoCookie is returned.
+func chunkedToken(r *http.Request, name string) (string, error) {
+	n := chunkCount(r, name)
+	if n == 0 {
+		return "", http.ErrNoCookie
+	}
+
+	var token string
+	for i := 1; i <= n; i++ {
+		cookie, _ := r.Cookie(chunkName(name, i))
+		token += cookie.Value
+	}
+	return token, nil
+}
+
+// chunkCount returns the number of consecutive chunk cookies of the named
+// session cookie sent with the request.
+func chunkCount(r *http.Request, name string) int {
+	n := 0
+	for {
+		_, err := r.Cookie(chunkName(name, n+1))
+		if err != nil {
+			return n
+		}
+		n++
+	}
+}
+
+// split splits the session cookie into chunk cookies with the same
+// attributes, each of which is no longer than maxCookieLength.
+func split(cookie *http.Cookie) []*http.Cookie {
+	var chunks []*http.Cookie
+	value := cookie.Value
+	for i := 1; value != ""; i++ {
+		chunk := *cookie
+		chunk.Name = chunkName(cookie.Name, i)
+		chunk.Value = ""
+
+		n := maxCookieLength - len(chunk.String())
+		if n > len(value) {
+			n = len(value)
+		}
+		chunk.Value = value[:n]
+		value = value[n:]
+		chunks = append(chunks, &chunk)
+	}
+	return chunks
+}
+
+// deletionCookie returns a cookie which instructs the client to delete the
+// named cookie.
+func (s *Session) deletionCookie(name string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     s.Path,
+		Domain:   s.Domain,
+		Secure:   s.Secure,
+		HttpOnly: s.HttpOnly,
+		SameSite: s.SameSite,
+		Expires:  time.Unix(1, 0),
+		MaxAge:   -1,
+	}
+}
+
+// writeCookie adds the session cookie to the response. If the cookie is longer
+// than maxCookieLength then ErrCookieTooLong is returned, unless Chunk is
+// enabled, in which case it is split into chunk cookies instead. Any session
+// cookie or chunk cookies sent with the request which aren't replaced are
+// deleted, so that a stale token can't be reassembled.
+func (s *Session) writeCookie(w http.ResponseWriter, r *http.Request, cookie *http.Cookie) error {
+	if len(cookie.String()) <= maxCookieLength {
+		w.Header().Add("Vary", "Cookie")
+		s.setCookie(w, r, cookie)
+		s.deleteChunks(w, r, 0)
+		return nil
+	}
+	if !s.Chunk {
+		return ErrCookieTooLong
+	}
+
+	w.Header().Add("Vary", "Cookie")
+	chunks := split(cookie)
+	for _, chunk := range chunks {
+		s.setCookie(w, r, chunk)
+	}
+	s.deleteChunks(w, r, len(chunks))
+	if _, err := r.Cookie(cookie.Name); err == nil {
+		s.setCookie(w, r, s.deletionCookie(cookie.Name))
+	}
+	return nil
+}
+
+// deleteChunks deletes any chunk cookies sent with the request after the
+// first n.
+func (s *Session) deleteChunks(w http.ResponseWriter, r *http.Request, n int) {
+	name := s.cookieName()
+	for i := chunkCount(r, name); i > n; i-- {
+		s.setCookie(w, r, s.deletionCookie(chunkName(name, i)))
+	}
+}
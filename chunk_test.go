@@ -0,0 +1,99 @@
+package sessions
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	cookie := &http.Cookie{
+		Name:     cookieName,
+		Value:    strings.Repeat("a", 10000),
+		Path:     "/",
+		HttpOnly: true,
+	}
+
+	chunks := split(cookie)
+	if len(chunks) != 3 {
+		t.Fatalf("got %d: expected %d", len(chunks), 3)
+	}
+
+	var value string
+	for i, chunk := range chunks {
+		if chunk.Name != chunkName(cookieName, i+1) {
+			t.Errorf("got %q: expected %q", chunk.Name, chunkName(cookieName, i+1))
+		}
+		if len(chunk.String()) > maxCookieLength {
+			t.Errorf("got %d: expected at most %d", len(chunk.String()), maxCookieLength)
+		}
+		if chunk.Path != "/" || chunk.HttpOnly != true {
+			t.Errorf("chunk %d doesn't have the cookie's attributes", i+1)
+		}
+		value += chunk.Value
+	}
+	if value != cookie.Value {
+		t.Errorf("reassembled value doesn't match the cookie value")
+	}
+}
+
+func TestChunk(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Chunk = true
+
+	data := make([]byte, 5000)
+	rand.Read(data)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/put":
+			err := s.PutChecked(r, "foo", data)
+			if err != nil {
+				t.Fatal(err)
+			}
+		case "/shrink":
+			s.Put(r, "foo", []byte("bar"))
+		case "/grow":
+			s.Put(r, "foo", data)
+		case "/destroy":
+			s.Destroy(r)
+			return
+		}
+		w.Write(s.GetBytes(r, "foo"))
+	})
+
+	agent := NewMockAgent(s)
+	agent.Do(h, httptest.NewRequest("GET", "/put", nil))
+	if agent.Cookie() != nil {
+		t.Errorf("got %v: expected %v", agent.Cookie(), nil)
+	}
+	if len(agent.cookies) != 2 {
+		t.Errorf("got %d: expected %d", len(agent.cookies), 2)
+	}
+
+	rr := agent.Do(h, httptest.NewRequest("GET", "/", nil))
+	if !bytes.Equal(rr.Body.Bytes(), data) {
+		t.Errorf("chunked session data was not reassembled")
+	}
+
+	rr = agent.Do(h, httptest.NewRequest("GET", "/shrink", nil))
+	if rr.Body.String() != "bar" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "bar")
+	}
+	if agent.Cookie() == nil || len(agent.cookies) != 1 {
+		t.Errorf("got %d cookies: expected only the session cookie", len(agent.cookies))
+	}
+
+	agent.Do(h, httptest.NewRequest("GET", "/grow", nil))
+	if agent.Cookie() != nil || len(agent.cookies) != 2 {
+		t.Errorf("got %d cookies: expected only the chunk cookies", len(agent.cookies))
+	}
+
+	agent.Do(h, httptest.NewRequest("GET", "/destroy", nil))
+	if len(agent.cookies) != 0 {
+		t.Errorf("got %d: expected %d", len(agent.cookies), 0)
+	}
+}
@@ -0,0 +1,235 @@
+package sessions
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// Cipher is the interface for encrypting and authenticating the encoded
+// session state before it is added to the session cookie (or committed to the
+// Store). Seal must read any nonce it needs from random, and include it in the
+// returned ciphertext. Open must return ErrInvalidToken if the ciphertext
+// can't be authenticated with the given key.
+type Cipher interface {
+	Seal(plaintext []byte, key [32]byte, random io.Reader) ([]byte, error)
+	Open(ciphertext []byte, key [32]byte) ([]byte, error)
+}
+
+// SecretBox encrypts the session state using nacl/secretbox (XSalsa20 and
+// Poly1305) with a random 24 byte nonce. It is the default Cipher, and
+// produces the same format as Encrypt.
+type SecretBox struct{}
+
+// Seal encrypts and authenticates the plaintext, and returns the nonce followed
+// by the sealed box.
+func (SecretBox) Seal(plaintext []byte, key [32]byte, random io.Reader) ([]byte, error) {
+	// The nonce is read straight into the output, which is allocated once at
+	// its final size.
+	out := make([]byte, 24, 24+len(plaintext)+secretbox.Overhead)
+	_, err := io.ReadFull(random, out)
+	if err != nil {
+		return nil, err
+	}
+	var nonce [24]byte
+	copy(nonce[:], out)
+
+	return secretbox.Seal(out, plaintext, &nonce, &key), nil
+}
+
+// Open decrypts a ciphertext created by Seal.
+func (SecretBox) Open(ciphertext []byte, key [32]byte) ([]byte, error) {
+	if len(ciphertext) < 24 {
+		return nil, ErrInvalidToken
+	}
+	var nonce [24]byte
+	copy(nonce[:], ciphertext[:24])
+
+	out, ok := secretbox.Open(nil, ciphertext[24:], &nonce, &key)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return out, nil
+}
+
+// AESGCM encrypts the session state using AES-256 in Galois/Counter Mode with
+// a random 12 byte nonce, for deployments which require FIPS-approved
+// algorithms.
+type AESGCM struct{}
+
+// Seal encrypts and authenticates the plaintext, and returns the nonce followed
+// by the ciphertext and tag.
+func (AESGCM) Seal(plaintext []byte, key [32]byte, random io.Reader) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	n := aead.NonceSize()
+	out := make([]byte, n, n+len(plaintext)+aead.Overhead())
+	_, err = io.ReadFull(random, out)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(out, out, plaintext, nil), nil
+}
+
+// Open decrypts a ciphertext created by Seal.
+func (AESGCM) Open(ciphertext []byte, key [32]byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	n := aead.NonceSize()
+	if len(ciphertext) < n {
+		return nil, ErrInvalidToken
+	}
+
+	out, err := aead.Open(nil, ciphertext[:n], ciphertext[n:], nil)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return out, nil
+}
+
+// SignedOnly authenticates the session state using HMAC-SHA256, but doesn't
+// encrypt it, so that the session data can be read (but not changed) by other
+// services which don't hold the secret key, such as edge workers or CDN logic
+// which needs a locale or an A/B bucket. The ciphertext is the plaintext
+// followed by its 32 byte HMAC-SHA256, keyed with a subkey derived from the
+// secret key with HKDF, so that the secret key itself is only ever used for
+// encryption. Combine it with JSONCodec to make the session data easy to read in other languages.
+//
+// Only use SignedOnly for sessions which hold no sensitive data. Values for
+// SensitiveKeys are still encrypted, using SecretBox unless an encrypting
+// Cipher has been passed to WithCipher().
+type SignedOnly struct{}
+
+// signedOnlyKeyInfo is the HKDF info string used to derive the SignedOnly MAC
+// key from the secret key.
+const signedOnlyKeyInfo = "github.com/golangcollege/sessions signed-only"
+
+// Seal returns the plaintext followed by its HMAC.
+func (SignedOnly) Seal(plaintext []byte, key [32]byte, random io.Reader) ([]byte, error) {
+	macKey := deriveKey(key[:], signedOnlyKeyInfo)
+	mac := hmac.New(sha256.New, macKey[:])
+	mac.Write(plaintext)
+
+	out := make([]byte, 0, len(plaintext)+sha256.Size)
+	out = append(out, plaintext...)
+	return mac.Sum(out), nil
+}
+
+// Open verifies the HMAC of a ciphertext created by Seal, and returns the
+// plaintext.
+func (SignedOnly) Open(ciphertext []byte, key [32]byte) ([]byte, error) {
+	if len(ciphertext) < sha256.Size {
+		return nil, ErrInvalidToken
+	}
+	n := len(ciphertext) - sha256.Size
+
+	macKey := deriveKey(key[:], signedOnlyKeyInfo)
+	mac := hmac.New(sha256.New, macKey[:])
+	mac.Write(ciphertext[:n])
+	if !hmac.Equal(mac.Sum(nil), ciphertext[n:]) {
+		return nil, ErrInvalidToken
+	}
+	return ciphertext[:n], nil
+}
+
+func newGCM(key [32]byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealToken encrypts the plaintext using the given Cipher and key, and encodes
+// the result using unpadded URL-safe base64.
+func sealToken(c Cipher, in []byte, key [32]byte, random io.Reader) (string, error) {
+	b, err := c.Seal(in, key, random)
+	if err != nil {
+		return "", err
+	}
+
+	// Encode into a pooled buffer, so that the only allocation is the
+	// returned string.
+	buf := getBuffer()
+	defer putBuffer(buf)
+	n := base64.RawURLEncoding.EncodedLen(len(b))
+	buf.Grow(n)
+	dst := buf.Bytes()[:n]
+	base64.RawURLEncoding.Encode(dst, b)
+	return string(dst), nil
+}
+
+// openToken reverses sealToken, trying each of the keys with each of the
+// ciphers in turn. It also returns the indexes of the cipher and the key which
+// opened the token. If none of them can, ErrInvalidToken is returned.
+func openToken(ciphers []Cipher, token string, keys [][32]byte) (out []byte, cipherIndex, keyIndex int, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, 0, 0, ErrInvalidToken
+	}
+
+	for i, c := range ciphers {
+		for j, key := range keys {
+			out, err := c.Open(b, key)
+			if err == nil {
+				return out, i, j, nil
+			}
+		}
+	}
+
+	return nil, 0, 0, ErrInvalidToken
+}
+
+// WithCipher sets the Cipher used to encrypt session cookies, and returns the
+// session so that it can be chained with New(). Session cookies encrypted with
+// any of the oldCiphers are still accepted, and are re-encrypted with the new
+// Cipher when they are next loaded, so that you can switch ciphers without
+// logging everyone out. For example, to switch from the default SecretBox to
+// AES-256-GCM:
+//
+//	session = sessions.New(secretKey, oldSecretKey).WithCipher(sessions.AESGCM{}, sessions.SecretBox{})
+//
+// Old secret keys are tried with each of the ciphers in turn.
+func (s *Session) WithCipher(c Cipher, oldCiphers ...Cipher) *Session {
+	s.Cipher = c
+	s.oldCiphers = oldCiphers
+	return s
+}
+
+// cipher returns the Cipher used to encrypt session cookies.
+func (s *Session) cipher() Cipher {
+	if s.Cipher == nil {
+		return SecretBox{}
+	}
+	return s.Cipher
+}
+
+// fieldCipher returns the Cipher used to encrypt the values for SensitiveKeys.
+// This is the session's Cipher, unless that is SignedOnly, in which case it is
+// the first old Cipher which encrypts, or SecretBox.
+func (s *Session) fieldCipher() Cipher {
+	for _, c := range s.ciphers() {
+		if _, ok := c.(SignedOnly); !ok {
+			return c
+		}
+	}
+	return SecretBox{}
+}
+
+// ciphers returns all of the Ciphers which may be used to decrypt session
+// cookies, starting with the current one.
+func (s *Session) ciphers() []Cipher {
+	return append([]Cipher{s.cipher()}, s.oldCiphers...)
+}
@@ -0,0 +1,159 @@
+package sessions
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCiphers(t *testing.T) {
+	key1 := [32]byte{1}
+	key2 := [32]byte{2}
+
+	for _, c := range []Cipher{SecretBox{}, AESGCM{}} {
+		token, err := sealToken(c, []byte("foo"), key2, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, _, keyIndex, err := openToken([]Cipher{c}, token, [][32]byte{key1, key2})
+		if err != nil {
+			t.Fatalf("%T: %v", c, err)
+		}
+		if string(out) != "foo" {
+			t.Errorf("%T: got %q: expected %q", c, out, "foo")
+		}
+		if keyIndex != 1 {
+			t.Errorf("%T: got %d: expected %d", c, keyIndex, 1)
+		}
+
+		_, _, _, err = openToken([]Cipher{c}, token, [][32]byte{key1})
+		if err != ErrInvalidToken {
+			t.Errorf("%T: got %v: expected %v", c, err, ErrInvalidToken)
+		}
+
+		tampered := []byte(token)
+		tampered[len(tampered)-2] ^= 1
+		_, _, _, err = openToken([]Cipher{c}, string(tampered), [][32]byte{key2})
+		if err != ErrInvalidToken {
+			t.Errorf("%T: got %v: expected %v", c, err, ErrInvalidToken)
+		}
+	}
+}
+
+func TestWithCipher(t *testing.T) {
+	key := []byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4")
+
+	get := func(s *Session, cookie string) (string, string) {
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cookie == "" {
+				s.Put(r, "foo", "bar")
+			}
+			fmt.Fprint(w, s.GetString(r, "foo"))
+		})
+		return testRequest(t, s.Enable(h), cookie)
+	}
+
+	_, cookie := get(New(key), "")
+
+	// A session using AES-GCM alone can't read a SecretBox cookie.
+	body, _ := get(New(key).WithCipher(AESGCM{}), cookie)
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+
+	// With SecretBox as an old cipher, the cookie is read and re-encrypted.
+	body, reissued := get(New(key).WithCipher(AESGCM{}, SecretBox{}), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+	if reissued == "" {
+		t.Fatal("expected the session cookie to be re-encrypted with the new cipher")
+	}
+
+	body, again := get(New(key).WithCipher(AESGCM{}), reissued)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+	if again != "" {
+		t.Errorf("got %q: expected %q", again, "")
+	}
+
+	body, _ = get(New(key), reissued)
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+}
+
+func TestSignedOnlyKey(t *testing.T) {
+	key := [32]byte{1}
+	b, err := SignedOnly{}.Seal([]byte("foo"), key, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The MAC is keyed with a subkey, never with the secret key itself.
+	macKey := deriveKey(key[:], signedOnlyKeyInfo)
+	mac := hmac.New(sha256.New, macKey[:])
+	mac.Write([]byte("foo"))
+	if !bytes.Equal(b[3:], mac.Sum(nil)) {
+		t.Errorf("got %x: expected %x", b[3:], mac.Sum(nil))
+	}
+
+	mac = hmac.New(sha256.New, key[:])
+	mac.Write([]byte("foo"))
+	forged := append([]byte("foo"), mac.Sum(nil)...)
+	_, err = SignedOnly{}.Open(forged, key)
+	if err != ErrInvalidToken {
+		t.Errorf("got %v: expected %v", err, ErrInvalidToken)
+	}
+}
+
+func TestSignedOnly(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Cipher = SignedOnly{}
+	s.Codec = JSONCodec{}
+	s.SetFieldKey([]byte("9y5Vlur8YvODJEhgOY8m9JVE4u46IpCV"))
+	s.SensitiveKeys = []string{"email"}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cookie") == "" {
+			s.Put(r, "locale", "en-GB")
+			s.Put(r, "email", "alice@example.com")
+		}
+		fmt.Fprint(w, s.GetString(r, "locale"), " ", s.GetString(r, "email"))
+	})
+
+	_, cookie := testRequest(t, s.Enable(h), "")
+	value := strings.TrimPrefix(strings.SplitN(cookie, ";", 2)[0], cookieName+"=")
+
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := string(b[:len(b)-32])
+	if !strings.Contains(payload, `"locale":"en-GB"`) {
+		t.Errorf("got %q: expected to contain %q", payload, `"locale":"en-GB"`)
+	}
+	if strings.Contains(payload, "alice") {
+		t.Errorf("got %q: expected not to contain %q", payload, "alice")
+	}
+
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "en-GB alice@example.com" {
+		t.Errorf("got %q: expected %q", body, "en-GB alice@example.com")
+	}
+
+	b[strings.Index(string(b), "en-GB")] = 'f'
+	tampered := cookieName + "=" + base64.RawURLEncoding.EncodeToString(b)
+	body, _ = testRequest(t, s.Enable(h), tampered)
+	if body != " " {
+		t.Errorf("got %q: expected %q", body, " ")
+	}
+}
@@ -0,0 +1,94 @@
+package sessions
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// ClientInfo describes the client which created a session. It is recorded
+// when RecordClientInfo is true, and can be used to power "active sessions"
+// pages and anomaly checks.
+type ClientInfo struct {
+	// IP is the IP address of the client, taken from the request's
+	// RemoteAddr. If your application is behind a proxy, you should use
+	// middleware which sets RemoteAddr from a trusted forwarding header.
+	IP string
+
+	// UserAgent is the value of the request's User-Agent header.
+	UserAgent string
+
+	// CreatedAt is the time that the session was created.
+	CreatedAt time.Time
+}
+
+func newClientInfo(r *http.Request) ClientInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return ClientInfo{
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// DefaultClientChanged reports whether the current client differs
+// significantly from the recorded one. It returns true if the User-Agent has
+// changed, or if the IP address has moved to a different network (a
+// different /24 for IPv4 addresses, or /48 for IPv6 addresses), so that
+// ordinary address churn within a network doesn't trigger it.
+func DefaultClientChanged(recorded, current ClientInfo) bool {
+	if recorded.UserAgent != current.UserAgent {
+		return true
+	}
+	return !sameNetwork(recorded.IP, current.IP)
+}
+
+func sameNetwork(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return a == b
+	}
+
+	mask := net.CIDRMask(48, 128)
+	if ipA.To4() != nil && ipB.To4() != nil {
+		ipA, ipB = ipA.To4(), ipB.To4()
+		mask = net.CIDRMask(24, 32)
+	}
+	return ipA.Mask(mask).Equal(ipB.Mask(mask))
+}
+
+// checkClient calls the OnClientChange hook if the client making the request
+// differs from the one which created the session.
+func (s *Session) checkClient(r *http.Request, c *cache) {
+	if s.OnClientChange == nil || s.ClientChanged == nil {
+		return
+	}
+
+	c.mu.Lock()
+	recorded := c.Client
+	c.mu.Unlock()
+	if recorded.CreatedAt.IsZero() {
+		return
+	}
+
+	current := newClientInfo(r)
+	if s.ClientChanged(recorded, current) {
+		s.OnClientChange(r, recorded, current)
+	}
+}
+
+// ClientInfo returns the details of the client which created the current
+// session. The zero value is returned if RecordClientInfo was false when the
+// session was created.
+func (s *Session) ClientInfo(r *http.Request) ClientInfo {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.Client
+}
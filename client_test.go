@@ -0,0 +1,119 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientInfo(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.RecordClientInfo = true
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.7:41234"
+	r.Header.Set("User-Agent", "Mozilla/5.0")
+	s.Enable(h).ServeHTTP(rr, r)
+	cookie := rr.Header().Get("Set-Cookie")
+
+	var info ClientInfo
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info = s.ClientInfo(r)
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+
+	testRequest(t, s.Enable(h), cookie)
+
+	if info.IP != "203.0.113.7" {
+		t.Errorf("got %q: expected %q", info.IP, "203.0.113.7")
+	}
+	if info.UserAgent != "Mozilla/5.0" {
+		t.Errorf("got %q: expected %q", info.UserAgent, "Mozilla/5.0")
+	}
+	if time.Since(info.CreatedAt) > time.Second {
+		t.Errorf("got %v: expected approximately %v", info.CreatedAt, time.Now())
+	}
+
+	s.RecordClientInfo = false
+	testRequest(t, s.Enable(h), "")
+
+	if info != (ClientInfo{}) {
+		t.Errorf("got %v: expected %v", info, ClientInfo{})
+	}
+}
+
+func TestDefaultClientChanged(t *testing.T) {
+	tests := []struct {
+		recorded ClientInfo
+		current  ClientInfo
+		expected bool
+	}{
+		{ClientInfo{IP: "203.0.113.7", UserAgent: "a"}, ClientInfo{IP: "203.0.113.7", UserAgent: "a"}, false},
+		{ClientInfo{IP: "203.0.113.7", UserAgent: "a"}, ClientInfo{IP: "203.0.113.200", UserAgent: "a"}, false},
+		{ClientInfo{IP: "203.0.113.7", UserAgent: "a"}, ClientInfo{IP: "198.51.100.7", UserAgent: "a"}, true},
+		{ClientInfo{IP: "203.0.113.7", UserAgent: "a"}, ClientInfo{IP: "203.0.113.7", UserAgent: "b"}, true},
+		{ClientInfo{IP: "2001:db8:1::1", UserAgent: "a"}, ClientInfo{IP: "2001:db8:1:ff::1", UserAgent: "a"}, false},
+		{ClientInfo{IP: "2001:db8:1::1", UserAgent: "a"}, ClientInfo{IP: "2001:db8:2::1", UserAgent: "a"}, true},
+		{ClientInfo{IP: "203.0.113.7", UserAgent: "a"}, ClientInfo{IP: "2001:db8:1::1", UserAgent: "a"}, true},
+	}
+
+	for _, test := range tests {
+		changed := DefaultClientChanged(test.recorded, test.current)
+		if changed != test.expected {
+			t.Errorf("%s -> %s: got %v: expected %v", test.recorded.IP, test.current.IP, changed, test.expected)
+		}
+	}
+}
+
+func TestOnClientChange(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.RecordClientInfo = true
+
+	var calls int
+	s.OnClientChange = func(r *http.Request, recorded, current ClientInfo) {
+		calls++
+		if recorded.IP != "203.0.113.7" || current.IP != "198.51.100.7" {
+			t.Errorf("got %q, %q: expected %q, %q", recorded.IP, current.IP, "203.0.113.7", "198.51.100.7")
+		}
+		s.Destroy(r)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls == 0 && !s.Exists(r, "foo") {
+			s.Put(r, "foo", "bar")
+		}
+	})
+
+	do := func(ip, cookie string) string {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = ip + ":41234"
+		if cookie != "" {
+			r.Header.Set("Cookie", cookie)
+		}
+		s.Enable(h).ServeHTTP(rr, r)
+		return rr.Header().Get("Set-Cookie")
+	}
+
+	cookie := do("203.0.113.7", "")
+	do("203.0.113.8", cookie)
+	if calls != 0 {
+		t.Errorf("got %d: expected %d", calls, 0)
+	}
+
+	deleted := do("198.51.100.7", cookie)
+	if calls != 1 {
+		t.Errorf("got %d: expected %d", calls, 1)
+	}
+	if !strings.Contains(deleted, "Max-Age=0") {
+		t.Errorf("got %q: expected the session cookie to be deleted", deleted)
+	}
+}
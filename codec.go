@@ -0,0 +1,288 @@
+package sessions
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"time"
+)
+
+// Codec is the interface for encoding and decoding the session state before
+// it is encrypted. The state is passed to Encode as a map holding the session
+// data under the "data" key, alongside metadata such as the "expiry" and
+// "issued_at" times, and Decode must return an equivalent map.
+type Codec interface {
+	Encode(m map[string]interface{}) ([]byte, error)
+	Decode(b []byte) (map[string]interface{}, error)
+}
+
+// GobCodec encodes the session state using encoding/gob. It is the default
+// Codec. Values with custom types must be registered with RegisterType() (or
+// gob.Register()) before they can be stored in the session data.
+//
+// For compatibility with existing session cookies, when GobCodec is in use the
+// session middleware encodes its internal state struct directly, rather than
+// the map passed to Encode.
+type GobCodec struct{}
+
+// Encode encodes the map using encoding/gob.
+func (GobCodec) Encode(m map[string]interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(m)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Decode decodes a map encoded by Encode.
+func (GobCodec) Decode(b []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// JSONCodec encodes the session state as JSON, so that it can be read by
+// non-Go services which hold the secret key (see Decrypt). Custom types don't
+// need to be registered, but values come back with their JSON types when the
+// session is loaded: numbers are float64, time.Time and []byte values are
+// strings, and structs are map[string]interface{}. Use GetFloat() rather than
+// GetInt() to fetch numbers.
+type JSONCodec struct{}
+
+// Encode encodes the map as JSON.
+func (JSONCodec) Encode(m map[string]interface{}) ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// Decode decodes a JSON object.
+func (JSONCodec) Decode(b []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	err := json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func init() {
+	gob.Register(map[string]interface{}{})
+}
+
+// codec returns the session's Codec, or GobCodec if none is set.
+func (s *Session) codec() Codec {
+	if s.Codec == nil {
+		return GobCodec{}
+	}
+	return s.Codec
+}
+
+// marshal encodes the cache with the codec, appending it to buf, and returns
+// the encoded bytes. The returned slice is only valid until buf is next
+// modified.
+func (c *cache) marshal(codec Codec, buf *bytes.Buffer) ([]byte, error) {
+	start := buf.Len()
+	if _, ok := codec.(GobCodec); ok {
+		// A gob Encoder only sends the description of each type the first
+		// time it is used, so an Encoder can't be reused across sessions:
+		// every token must be decodable on its own.
+		err := gob.NewEncoder(buf).Encode(c)
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes()[start:], nil
+	}
+
+	b, err := codec.Encode(c.toMap())
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(b)
+	return buf.Bytes()[start:], nil
+}
+
+// unmarshal decodes the cache with the codec. If the codec can't decode the
+// state, for example because it was encoded with a different codec or holds a
+// type which is no longer registered, then ErrInvalidToken is returned so
+// that the client isn't stuck with a session which can never be loaded.
+func (c *cache) unmarshal(codec Codec, b []byte) error {
+	if _, ok := codec.(GobCodec); ok {
+		err := gob.NewDecoder(bytes.NewReader(b)).Decode(c)
+		if err != nil {
+			return ErrInvalidToken
+		}
+		return nil
+	}
+
+	m, err := codec.Decode(b)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	return c.fromMap(m)
+}
+
+// toMap returns the encoded fields of the cache as a map for a Codec. Zero
+// values are left out to keep the encoded state small, and any sealed values
+// of SensitiveKeys are moved to the "sealed" key.
+func (c *cache) toMap() map[string]interface{} {
+	data := make(map[string]interface{}, len(c.Data))
+	sealed := make(map[string]interface{})
+	for key, val := range c.Data {
+		if sv, ok := val.(sealedValue); ok {
+			sealed[key] = sv.Token
+			continue
+		}
+		data[key] = val
+	}
+
+	m := map[string]interface{}{
+		"data":      data,
+		"expiry":    c.Expiry,
+		"issued_at": c.IssuedAt,
+	}
+	if len(sealed) > 0 {
+		m["sealed"] = sealed
+	}
+	if !c.Deadline.IsZero() {
+		m["deadline"] = c.Deadline
+	}
+	if c.Version != 0 {
+		m["version"] = c.Version
+	}
+	if c.Persist != persistDefault {
+		m["persist"] = c.Persist
+	}
+	if c.Client != (ClientInfo{}) {
+		m["client"] = map[string]interface{}{
+			"ip":         c.Client.IP,
+			"user_agent": c.Client.UserAgent,
+			"created_at": c.Client.CreatedAt,
+		}
+	}
+	if len(c.Binding) > 0 {
+		m["binding"] = c.Binding
+	}
+	if c.Cert != (CertIdentity{}) {
+		m["cert"] = map[string]interface{}{
+			"fingerprint": c.Cert.Fingerprint,
+			"subject":     c.Cert.Subject,
+		}
+	}
+	if c.Revision != 0 {
+		m["revision"] = c.Revision
+	}
+	if c.ID != "" {
+		m["id"] = c.ID
+	}
+	if len(c.KeyExpiry) > 0 {
+		expiry := make(map[string]interface{}, len(c.KeyExpiry))
+		for key, t := range c.KeyExpiry {
+			expiry[key] = t
+		}
+		m["key_expiry"] = expiry
+	}
+	return m
+}
+
+// fromMap sets the encoded fields of the cache from a map returned by a Codec.
+// If there is no session data then ErrInvalidToken is returned.
+func (c *cache) fromMap(m map[string]interface{}) error {
+	data, ok := m["data"].(map[string]interface{})
+	if !ok {
+		return ErrInvalidToken
+	}
+	c.Data = data
+	if sealed, ok := m["sealed"].(map[string]interface{}); ok {
+		for key, token := range sealed {
+			c.Data[key] = sealedValue{Token: toString(token)}
+		}
+	}
+
+	c.Expiry = toTime(m["expiry"])
+	c.IssuedAt = toTime(m["issued_at"])
+	c.Deadline = toTime(m["deadline"])
+	c.Version = toInt(m["version"])
+	c.Persist = toInt(m["persist"])
+	c.Revision = toInt(m["revision"])
+	c.ID = toString(m["id"])
+	if client, ok := m["client"].(map[string]interface{}); ok {
+		c.Client = ClientInfo{
+			IP:        toString(client["ip"]),
+			UserAgent: toString(client["user_agent"]),
+			CreatedAt: toTime(client["created_at"]),
+		}
+	}
+	c.Binding = toBytes(m["binding"])
+	if cert, ok := m["cert"].(map[string]interface{}); ok {
+		c.Cert = CertIdentity{
+			Fingerprint: toString(cert["fingerprint"]),
+			Subject:     toString(cert["subject"]),
+		}
+	}
+	if expiry, ok := m["key_expiry"].(map[string]interface{}); ok {
+		c.KeyExpiry = make(map[string]time.Time, len(expiry))
+		for key, t := range expiry {
+			c.KeyExpiry[key] = toTime(t)
+		}
+	}
+	return nil
+}
+
+func toString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// toTime converts a time.Time, or a string in RFC 3339 format (as produced by
+// encoding/json), to a time.Time.
+func toTime(v interface{}) time.Time {
+	switch v := v.(type) {
+	case time.Time:
+		return v
+	case string:
+		t, _ := time.Parse(time.RFC3339Nano, v)
+		return t
+	}
+	return time.Time{}
+}
+
+// toInt converts any of the numeric types which a Codec may produce to an int.
+func toInt(v interface{}) int {
+	n, _ := toIntOK(v)
+	return n
+}
+
+// toIntOK works like toInt, and also reports whether v was a number.
+func toIntOK(v interface{}) (int, bool) {
+	switch v := v.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case uint64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	case json.Number:
+		n, err := v.Int64()
+		return int(n), err == nil
+	}
+	return 0, false
+}
+
+// toBytes converts a []byte, or a string in standard base64 encoding (as
+// produced by encoding/json), to a []byte.
+func toBytes(v interface{}) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		b, _ := base64.StdEncoding.DecodeString(v)
+		return b
+	}
+	return nil
+}
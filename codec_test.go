@@ -0,0 +1,99 @@
+package sessions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	c := newCache(time.Hour)
+	c.Data["foo"] = "bar"
+	c.Data["secret"] = sealedValue{Token: "sealed"}
+	c.IssuedAt = time.Now().UTC().Round(0)
+	c.Deadline = c.Expiry.Add(time.Hour)
+	c.Version = 2
+	c.Persist = persistOff
+	c.Client = ClientInfo{IP: "192.0.2.1", UserAgent: "test", CreatedAt: c.IssuedAt}
+	c.Binding = []byte{1, 2, 3}
+	c.Cert = CertIdentity{Fingerprint: "abc", Subject: "CN=test"}
+
+	for _, codec := range []Codec{GobCodec{}, JSONCodec{}} {
+		b, err := c.marshal(codec, new(bytes.Buffer))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded := &cache{}
+		err = decoded.unmarshal(codec, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded.Data, c.Data) {
+			t.Errorf("%T: got %v: expected %v", codec, decoded.Data, c.Data)
+		}
+		if !decoded.Expiry.Equal(c.Expiry) || !decoded.IssuedAt.Equal(c.IssuedAt) || !decoded.Deadline.Equal(c.Deadline) {
+			t.Errorf("%T: times were not preserved", codec)
+		}
+		if decoded.Version != c.Version || decoded.Persist != c.Persist {
+			t.Errorf("%T: got %d, %d: expected %d, %d", codec, decoded.Version, decoded.Persist, c.Version, c.Persist)
+		}
+		if decoded.Client.IP != c.Client.IP || !decoded.Client.CreatedAt.Equal(c.Client.CreatedAt) {
+			t.Errorf("%T: got %v: expected %v", codec, decoded.Client, c.Client)
+		}
+		if !bytes.Equal(decoded.Binding, c.Binding) {
+			t.Errorf("%T: got %v: expected %v", codec, decoded.Binding, c.Binding)
+		}
+		if decoded.Cert != c.Cert {
+			t.Errorf("%T: got %v: expected %v", codec, decoded.Cert, c.Cert)
+		}
+	}
+}
+
+func TestJSONCodec(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Codec = JSONCodec{}
+
+	type user struct {
+		Name string
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/put" {
+			s.Put(r, "count", 42)
+			s.Put(r, "user", user{Name: "alice"})
+			return
+		}
+		u, _ := s.Get(r, "user").(map[string]interface{})
+		fmt.Fprintf(w, "%v %v", s.GetFloat(r, "count"), u["Name"])
+	})
+
+	agent := NewMockAgent(s)
+	agent.Do(h, httptest.NewRequest("GET", "/put", nil))
+
+	b, err := Decrypt(agent.Cookie().Value, s.keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	err = json.Unmarshal(b[envelopeHeaderLen:], &m)
+	if err != nil {
+		t.Fatalf("decrypted payload is not JSON: %v", err)
+	}
+
+	rr := agent.Do(h, httptest.NewRequest("GET", "/", nil))
+	if rr.Body.String() != "42 alice" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "42 alice")
+	}
+
+	s.Codec = GobCodec{}
+	rr = agent.Do(h, httptest.NewRequest("GET", "/", nil))
+	if rr.Body.String() != "42 alice" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "42 alice")
+	}
+}
@@ -0,0 +1,63 @@
+package sessions
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+)
+
+// compressThreshold is the size in bytes above which the encoded session state
+// is compressed when Compress is true. Smaller payloads rarely shrink by more
+// than the size of the gzip header and footer.
+const compressThreshold = 256
+
+// gzipMagic is the start of every gzip stream, using the deflate method. None
+// of the supported codecs produce output which starts with these bytes.
+var gzipMagic = []byte{0x1f, 0x8b, 0x08}
+
+// compress returns the gzip compressed payload, or the payload unchanged if it
+// is below the compressThreshold or wouldn't get any smaller. The compressed
+// payload is appended to buf.
+func compress(b []byte, buf *bytes.Buffer) []byte {
+	if len(b) <= compressThreshold {
+		return b
+	}
+
+	start := buf.Len()
+	zw, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if err != nil {
+		return b
+	}
+	_, err = zw.Write(b)
+	if err != nil {
+		return b
+	}
+	err = zw.Close()
+	if err != nil || buf.Len()-start >= len(b) {
+		return b
+	}
+	return buf.Bytes()[start:]
+}
+
+// decompress reverses compress. Payloads which weren't compressed are returned
+// unchanged, so sessions can still be loaded after Compress is switched on or
+// off.
+func decompress(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, gzipMagic) {
+		return b, nil
+	}
+	return gunzip(b)
+}
+
+// gunzip decompresses a gzip compressed payload.
+func gunzip(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	out, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return out, nil
+}
@@ -0,0 +1,74 @@
+package sessions
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	small := []byte("foo")
+	if got := compress(small, new(bytes.Buffer)); !bytes.Equal(got, small) {
+		t.Errorf("got %q: expected %q", got, small)
+	}
+
+	large := []byte(strings.Repeat("abcdefgh", 100))
+	compressed := compress(large, new(bytes.Buffer))
+	if len(compressed) >= len(large) {
+		t.Errorf("got %d: expected less than %d", len(compressed), len(large))
+	}
+
+	for _, test := range []struct{ in, expected []byte }{
+		{small, small},
+		{large, large},
+		{compressed, large},
+	} {
+		got, err := decompress(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, test.expected) {
+			t.Errorf("got %q: expected %q", got, test.expected)
+		}
+	}
+}
+
+func TestCompressSession(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		w.Write([]byte(err.Error()))
+	}
+
+	items := make([]string, 400)
+	for i := range items {
+		items[i] = fmt.Sprintf("product-%04d", i)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cookie") == "" {
+			s.Put(r, "cart", strings.Join(items, ","))
+		}
+		fmt.Fprint(w, len(s.GetString(r, "cart")))
+	})
+
+	body, _ := testRequest(t, s.Enable(h), "")
+	if !strings.Contains(body, ErrCookieTooLong.Error()) {
+		t.Errorf("got %q: expected to contain %q", body, ErrCookieTooLong.Error())
+	}
+
+	s.Compress = true
+	_, cookie := testRequest(t, s.Enable(h), "")
+	if cookie == "" || len(cookie) > 4096 {
+		t.Fatalf("got %d: expected a session cookie of up to %d bytes", len(cookie), 4096)
+	}
+
+	// Compressed sessions can still be loaded after Compress is switched off.
+	s.Compress = false
+	expected := fmt.Sprint(len(strings.Join(items, ",")))
+	body, _ = testRequest(t, s.Enable(h), cookie)
+	if body != expected {
+		t.Errorf("got %q: expected %q", body, expected)
+	}
+}
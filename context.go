@@ -0,0 +1,181 @@
+package sessions
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// getCacheFromContext returns the session cache from the context, and panics
+// if it isn't present.
+func getCacheFromContext(ctx context.Context) *cache {
+	c, ok := cacheFromContext(ctx)
+	if !ok {
+		panic(errMissingCache)
+	}
+	return c
+}
+
+// PutCtx works like Put(), but takes a context.Context which carries the
+// session instead of a request. This lets service layers and other helpers
+// which only receive a context access the session. The context must come
+// from a request handled by the Enable or LoadAndSave middleware, such as
+// r.Context(), or be derived from one.
+func (s *Session) PutCtx(ctx context.Context, key string, val interface{}) {
+	c := getCacheFromContext(ctx)
+
+	err := s.validate(key, val)
+
+	c.mu.Lock()
+	if err != nil {
+		c.reject(err)
+	} else {
+		s.put(c, key, val)
+	}
+	c.mu.Unlock()
+}
+
+// GetCtx is the context.Context version of Get().
+func (s *Session) GetCtx(ctx context.Context, key string) interface{} {
+	c := getCacheFromContext(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.Data[key]
+}
+
+// PopCtx is the context.Context version of Pop().
+func (s *Session) PopCtx(ctx context.Context, key string) interface{} {
+	c := getCacheFromContext(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	val, exists := c.Data[key]
+	if !exists {
+		return nil
+	}
+	c.unset(key)
+	c.modified = true
+
+	return val
+}
+
+// RemoveCtx is the context.Context version of Remove().
+func (s *Session) RemoveCtx(ctx context.Context, key string) {
+	c := getCacheFromContext(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, exists := c.Data[key]
+	if !exists {
+		return
+	}
+
+	c.unset(key)
+	c.modified = true
+}
+
+// ExistsCtx is the context.Context version of Exists().
+func (s *Session) ExistsCtx(ctx context.Context, key string) bool {
+	c := getCacheFromContext(ctx)
+
+	c.mu.Lock()
+	_, exists := c.Data[key]
+	c.mu.Unlock()
+
+	return exists
+}
+
+// KeysCtx is the context.Context version of Keys().
+func (s *Session) KeysCtx(ctx context.Context) []string {
+	c := getCacheFromContext(ctx)
+
+	c.mu.Lock()
+	keys := make([]string, len(c.Data))
+	i := 0
+	for key := range c.Data {
+		keys[i] = key
+		i++
+	}
+	c.mu.Unlock()
+
+	sort.Strings(keys)
+	return keys
+}
+
+// DestroyCtx is the context.Context version of Destroy().
+func (s *Session) DestroyCtx(ctx context.Context) {
+	c := getCacheFromContext(ctx)
+
+	c.mu.Lock()
+	c.clear()
+	c.Expiry = time.Time{}
+	c.Deadline = time.Time{}
+	c.Persist = persistDefault
+	c.modified = true
+	c.destroyed = true
+	c.mu.Unlock()
+}
+
+// GetStringCtx is the context.Context version of GetString().
+func (s *Session) GetStringCtx(ctx context.Context, key string) string {
+	val := s.GetCtx(ctx, key)
+	str, ok := val.(string)
+	if !ok {
+		return ""
+	}
+	return str
+}
+
+// GetBoolCtx is the context.Context version of GetBool().
+func (s *Session) GetBoolCtx(ctx context.Context, key string) bool {
+	val := s.GetCtx(ctx, key)
+	b, ok := val.(bool)
+	if !ok {
+		return false
+	}
+	return b
+}
+
+// GetIntCtx is the context.Context version of GetInt().
+func (s *Session) GetIntCtx(ctx context.Context, key string) int {
+	val := s.GetCtx(ctx, key)
+	i, ok := val.(int)
+	if !ok {
+		return 0
+	}
+	return i
+}
+
+// GetFloatCtx is the context.Context version of GetFloat().
+func (s *Session) GetFloatCtx(ctx context.Context, key string) float64 {
+	val := s.GetCtx(ctx, key)
+	f, ok := val.(float64)
+	if !ok {
+		return 0
+	}
+	return f
+}
+
+// GetBytesCtx is the context.Context version of GetBytes().
+func (s *Session) GetBytesCtx(ctx context.Context, key string) []byte {
+	val := s.GetCtx(ctx, key)
+	b, ok := val.([]byte)
+	if !ok {
+		return nil
+	}
+	return b
+}
+
+// GetTimeCtx is the context.Context version of GetTime().
+func (s *Session) GetTimeCtx(ctx context.Context, key string) time.Time {
+	val := s.GetCtx(ctx, key)
+	t, ok := val.(time.Time)
+	if !ok {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,65 @@
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContextAPI(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	login := func(ctx context.Context, userID int) {
+		s.PutCtx(ctx, "userID", userID)
+		s.PutCtx(ctx, "name", "alice")
+		s.PutCtx(ctx, "admin", true)
+		s.PutCtx(ctx, "ratio", 0.5)
+		s.PutCtx(ctx, "token", []byte("abc"))
+		s.PutCtx(ctx, "seen", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		s.PutCtx(ctx, "temp", "x")
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if r.URL.Path == "/login" {
+			login(ctx, 42)
+			return
+		}
+		fmt.Fprintln(w, s.GetIntCtx(ctx, "userID"), s.GetStringCtx(ctx, "name"), s.GetBoolCtx(ctx, "admin"),
+			s.GetFloatCtx(ctx, "ratio"), string(s.GetBytesCtx(ctx, "token")), s.GetTimeCtx(ctx, "seen").Year())
+		fmt.Fprintln(w, s.PopCtx(ctx, "temp"), s.ExistsCtx(ctx, "temp"), s.GetCtx(ctx, "name"))
+		s.RemoveCtx(ctx, "token")
+		fmt.Fprintln(w, s.KeysCtx(ctx))
+	})
+
+	agent := NewMockAgent(s)
+	agent.Do(h, httptest.NewRequest("GET", "/login", nil))
+	rr := agent.Do(h, httptest.NewRequest("GET", "/", nil))
+
+	expected := "42 alice true 0.5 abc 2020\nx false alice\n[admin name ratio seen userID]\n"
+	if rr.Body.String() != expected {
+		t.Errorf("got %q: expected %q", rr.Body.String(), expected)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.DestroyCtx(r.Context())
+	})
+	agent.Do(h, httptest.NewRequest("GET", "/", nil))
+	if agent.Cookie() != nil {
+		t.Errorf("got %v: expected %v", agent.Cookie(), nil)
+	}
+}
+
+func TestContextAPIMissingSession(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	defer func() {
+		if r := recover(); r != errMissingCache {
+			t.Errorf("got %v: expected %v", r, errMissingCache)
+		}
+	}()
+	s.GetCtx(context.Background(), "foo")
+}
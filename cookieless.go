@@ -0,0 +1,150 @@
+package sessions
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// cookielessWindow is how long a client is remembered after it was last
+	// issued a new session.
+	cookielessWindow = 10 * time.Minute
+
+	// cookielessMaxClients limits the memory used to track clients.
+	cookielessMaxClients = 10000
+
+	// cookielessProbeSuffix is added to the session cookie's name for the
+	// long-lived probe cookie, which shows that a client has returned a
+	// cookie before.
+	cookielessProbeSuffix = "-probe"
+
+	// cookielessProbeMaxAge is how long the probe cookie lasts.
+	cookielessProbeMaxAge = 365 * 24 * 60 * 60
+)
+
+type cookielessEntry struct {
+	count    int
+	lastSeen time.Time
+}
+
+// cookielessTracker counts how many new sessions in a row have been issued to
+// each client.
+type cookielessTracker struct {
+	mu      sync.Mutex
+	clients map[string]*cookielessEntry
+}
+
+func (t *cookielessTracker) count(client string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.clients[client]
+	if !ok || time.Since(e.lastSeen) > cookielessWindow {
+		return 0
+	}
+	return e.count
+}
+
+func (t *cookielessTracker) increment(client string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.clients == nil {
+		t.clients = make(map[string]*cookielessEntry)
+	}
+
+	now := time.Now()
+	e, ok := t.clients[client]
+	if !ok || now.Sub(e.lastSeen) > cookielessWindow {
+		if len(t.clients) >= cookielessMaxClients {
+			t.prune(now)
+			if len(t.clients) >= cookielessMaxClients {
+				return
+			}
+		}
+		e = &cookielessEntry{}
+		t.clients[client] = e
+	}
+	e.count++
+	e.lastSeen = now
+}
+
+func (t *cookielessTracker) reset(client string) {
+	t.mu.Lock()
+	delete(t.clients, client)
+	t.mu.Unlock()
+}
+
+// prune removes clients which haven't been seen within the window. The caller
+// must hold t.mu.
+func (t *cookielessTracker) prune(now time.Time) {
+	for client, e := range t.clients {
+		if now.Sub(e.lastSeen) > cookielessWindow {
+			delete(t.clients, client)
+		}
+	}
+}
+
+func cookielessClient(r *http.Request) string {
+	info := newClientInfo(r)
+	return info.IP + " " + info.UserAgent
+}
+
+// cookieless reports whether the client making the request appears not to be
+// returning the session cookie.
+func (s *Session) cookieless(r *http.Request, c *cache) bool {
+	if s.CookielessHandler == nil {
+		return false
+	}
+
+	client := cookielessClient(r)
+	if !c.isNew || s.hasProbeCookie(r) {
+		s.cookielessCounts.reset(client)
+		return false
+	}
+	return s.cookielessCounts.count(client) >= s.CookielessThreshold
+}
+
+// trackCookieless records that a new session was issued to the client.
+func (s *Session) trackCookieless(r *http.Request, c *cache) {
+	if s.CookielessHandler == nil {
+		return
+	}
+
+	c.mu.Lock()
+	issued := c.isNew && c.modified && !c.skipSave && !c.destroyed
+	c.mu.Unlock()
+
+	if issued && !s.hasProbeCookie(r) {
+		s.cookielessCounts.increment(cookielessClient(r))
+	}
+}
+
+// hasProbeCookie reports whether the request carries the probe cookie, which
+// means that the client returns cookies, even if its session has expired.
+func (s *Session) hasProbeCookie(r *http.Request) bool {
+	_, err := r.Cookie(s.cookieName() + cookielessProbeSuffix)
+	return err == nil
+}
+
+// writeProbeCookie sends the probe cookie alongside a new session cookie, so
+// that the client isn't mistaken for a cookieless one when it comes back
+// after its session has expired, from the same IP address and User-Agent as
+// other new clients (such as behind a NAT gateway).
+func (s *Session) writeProbeCookie(w http.ResponseWriter, r *http.Request, c *cache, cookie *http.Cookie) {
+	if s.CookielessHandler == nil || s.Transport != nil || !c.isNew || s.hasProbeCookie(r) {
+		return
+	}
+
+	s.setCookie(w, r, &http.Cookie{
+		Name:     s.cookieName() + cookielessProbeSuffix,
+		Value:    "1",
+		Path:     cookie.Path,
+		Domain:   cookie.Domain,
+		Secure:   cookie.Secure,
+		HttpOnly: true,
+		SameSite: cookie.SameSite,
+		MaxAge:   cookielessProbeMaxAge,
+	})
+}
@@ -0,0 +1,101 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCookielessHandler(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.CookielessThreshold = 2
+	s.CookielessHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "cookies required")
+	})
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		fmt.Fprint(w, "ok")
+	})
+
+	do := func(ip, cookie string) (string, string) {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = ip + ":41234"
+		if cookie != "" {
+			r.Header.Set("Cookie", cookie)
+		}
+		s.Enable(h).ServeHTTP(rr, r)
+		return rr.Body.String(), rr.Header().Get("Set-Cookie")
+	}
+
+	for i, expected := range []string{"ok", "ok", "cookies required", "cookies required"} {
+		body, _ := do("203.0.113.7", "")
+		if body != expected {
+			t.Errorf("request %d: got %q: expected %q", i, body, expected)
+		}
+	}
+
+	body, _ := do("198.51.100.7", "")
+	if body != "ok" {
+		t.Errorf("got %q: expected %q", body, "ok")
+	}
+	_, cookie := do("198.51.100.8", "")
+	do("198.51.100.8", cookie)
+	body, _ = do("198.51.100.8", "")
+	if body != "ok" {
+		t.Errorf("got %q: expected %q", body, "ok")
+	}
+}
+
+func TestCookielessProbe(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.CookielessThreshold = 1
+	s.CookielessHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "cookies required")
+	})
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		fmt.Fprint(w, "ok")
+	})
+
+	do := func(cookie string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "203.0.113.7:41234"
+		if cookie != "" {
+			r.Header.Set("Cookie", cookie)
+		}
+		s.Enable(h).ServeHTTP(rr, r)
+		return rr
+	}
+
+	rr := do("")
+	var probe *http.Cookie
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == "session-probe" {
+			probe = cookie
+		}
+	}
+	if probe == nil {
+		t.Fatal("expected a probe cookie")
+	}
+
+	// A returning client whose session has expired, behind the same NAT
+	// gateway as a new one, isn't cookieless.
+	rr = do("session-probe=" + probe.Value)
+	if rr.Body.String() != "ok" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "ok")
+	}
+	if len(rr.Result().Cookies()) != 1 {
+		t.Errorf("got %d cookies: expected %d", len(rr.Result().Cookies()), 1)
+	}
+
+	do("")
+	rr = do("")
+	if rr.Body.String() != "cookies required" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "cookies required")
+	}
+}
@@ -0,0 +1,126 @@
+package sessions
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"io"
+	"net/http"
+)
+
+// keyCSRFToken is the reserved key under which the CSRF token is stored.
+const keyCSRFToken = "_csrfToken"
+
+// csrfTokenLength is the length in bytes of the CSRF token.
+const csrfTokenLength = 32
+
+// CSRFToken returns a token which protects against cross-site request
+// forgery, for embedding in forms (or sending in the CSRFHeader). A random
+// token is generated and stored in the session data the first time it is
+// needed. Each call returns a different, masked, encoding of the same token,
+// so that it can't be recovered from compressed responses by BREACH-style
+// attacks. All of the encodings are accepted by VerifyCSRF and RequireCSRF.
+//
+// The token is removed by LogoutUser() and Destroy(), along with the rest of
+// the session data, unless it is listed in LogoutPreserveKeys.
+func (s *Session) CSRFToken(r *http.Request) string {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token := csrfTokenFrom(c.Data[keyCSRFToken])
+	if token == nil {
+		token = make([]byte, csrfTokenLength)
+		_, err := io.ReadFull(s.random(), token)
+		if err != nil {
+			panic(err)
+		}
+		c.set(keyCSRFToken, base64.RawURLEncoding.EncodeToString(token))
+		c.modified = true
+	}
+
+	masked := make([]byte, 2*csrfTokenLength)
+	_, err := io.ReadFull(s.random(), masked[:csrfTokenLength])
+	if err != nil {
+		panic(err)
+	}
+	for i := range token {
+		masked[csrfTokenLength+i] = masked[i] ^ token[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// VerifyCSRF reports whether the given value is a valid CSRF token for the
+// current session, as returned by CSRFToken(). It returns false if no CSRF
+// token has been generated for the session.
+func (s *Session) VerifyCSRF(r *http.Request, token string) bool {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	expected := csrfTokenFrom(c.Data[keyCSRFToken])
+	c.mu.Unlock()
+	if expected == nil {
+		return false
+	}
+
+	masked, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(masked) != 2*csrfTokenLength {
+		return false
+	}
+	got := make([]byte, csrfTokenLength)
+	for i := range got {
+		got[i] = masked[i] ^ masked[csrfTokenLength+i]
+	}
+	return subtle.ConstantTimeCompare(got, expected) == 1
+}
+
+// csrfTokenFrom decodes the CSRF token stored in the session data. The token is
+// stored as a base64 string, rather than []byte, so that it survives encoding
+// with any Codec. It returns nil if the value isn't a valid token.
+func csrfTokenFrom(val interface{}) []byte {
+	s, ok := val.(string)
+	if !ok {
+		return nil
+	}
+	token, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(token) != csrfTokenLength {
+		return nil
+	}
+	return token
+}
+
+// RequireCSRF is middleware which rejects requests with an unsafe method
+// (anything other than GET, HEAD, OPTIONS or TRACE) unless they carry a valid
+// CSRF token, either in the CSRFHeader or in the CSRFField form value. Rejected
+// requests are passed to the CSRFFailureHandler. It must be used inside the
+// Enable (or LoadAndSave) middleware. For example:
+//
+//	mux.Handle("/account", session.Enable(session.RequireCSRF(accountHandler)))
+func (s *Session) RequireCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := r.Header.Get(s.CSRFHeader)
+		if token == "" && s.CSRFField != "" {
+			token = r.PostFormValue(s.CSRFField)
+		}
+		if !s.VerifyCSRF(r, token) {
+			h := s.CSRFFailureHandler
+			if h == nil {
+				h = http.HandlerFunc(defaultCSRFFailureHandler)
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func defaultCSRFFailureHandler(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+}
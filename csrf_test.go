@@ -0,0 +1,98 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRFToken(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Codec = JSONCodec{}
+
+	var token string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/form" {
+			token = s.CSRFToken(r)
+			if again := s.CSRFToken(r); again == token {
+				t.Errorf("got %q: expected a different masked token", again)
+			}
+			return
+		}
+		fmt.Fprint(w, s.VerifyCSRF(r, r.URL.Query().Get("token")))
+	})
+
+	agent := NewMockAgent(s)
+	rr := agent.Do(h, httptest.NewRequest("GET", "/", nil))
+	if rr.Body.String() != "false" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "false")
+	}
+
+	agent.Do(h, httptest.NewRequest("GET", "/form", nil))
+
+	tests := []struct {
+		token    string
+		expected string
+	}{
+		{token, "true"},
+		{"", "false"},
+		{"foo", "false"},
+		{strings.Repeat("A", len(token)), "false"},
+	}
+	for _, test := range tests {
+		rr = agent.Do(h, httptest.NewRequest("GET", "/?token="+url.QueryEscape(test.token), nil))
+		if rr.Body.String() != test.expected {
+			t.Errorf("%q: got %q: expected %q", test.token, rr.Body.String(), test.expected)
+		}
+	}
+}
+
+func TestRequireCSRF(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	var token string
+	h := s.RequireCSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			token = s.CSRFToken(r)
+		}
+		fmt.Fprint(w, "OK")
+	}))
+
+	agent := NewMockAgent(s)
+	rr := agent.Do(h, httptest.NewRequest("GET", "/", nil))
+	if rr.Body.String() != "OK" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "OK")
+	}
+
+	rr = agent.Do(h, httptest.NewRequest("POST", "/", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusForbidden)
+	}
+
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("X-CSRF-Token", token)
+	rr = agent.Do(h, r)
+	if rr.Body.String() != "OK" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "OK")
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader(url.Values{"csrf_token": {token}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = agent.Do(h, r)
+	if rr.Body.String() != "OK" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "OK")
+	}
+
+	s.CSRFFailureHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	r = httptest.NewRequest("DELETE", "/", nil)
+	r.Header.Set("X-CSRF-Token", "invalid")
+	rr = agent.Do(h, r)
+	if rr.Code != http.StatusTeapot {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusTeapot)
+	}
+}
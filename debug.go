@@ -0,0 +1,82 @@
+package sessions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type debugKey struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	Size  int    `json:"size"`
+	Value string `json:"value"`
+}
+
+type debugInfo struct {
+	Expiry   time.Time  `json:"expiry"`
+	IssuedAt time.Time  `json:"issuedAt"`
+	Version  int        `json:"version"`
+	Client   ClientInfo `json:"client"`
+	Size     int        `json:"size"`
+	Keys     []debugKey `json:"keys"`
+}
+
+// DebugHandler returns a handler which renders the requesting user's decoded
+// session as JSON, including the encoded size of each key. It is intended for
+// use during development, and responds with 404 Not Found unless the session's
+// Debug field is true. The handler can be mounted with or without the Enable
+// middleware. For example:
+//
+//	session.Debug = os.Getenv("APP_ENV") == "development"
+//	mux.Handle("/debug/session", sessions.DebugHandler(session))
+func DebugHandler(s *Session) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.Debug {
+			http.NotFound(w, r)
+			return
+		}
+
+		c, ok := cacheFromContext(r.Context())
+		if !ok {
+			var err error
+			c, err = s.load(r)
+			if err != nil {
+				s.handleError(w, r, withPhase(PhaseLoad, err))
+				return
+			}
+		}
+
+		c.mu.Lock()
+		info := debugInfo{
+			Expiry:   c.Expiry,
+			IssuedAt: c.IssuedAt,
+			Version:  c.Version,
+			Client:   c.Client,
+			Keys:     make([]debugKey, 0, len(c.Data)),
+		}
+		for key, val := range c.Data {
+			b, _ := s.codec().Encode(map[string]interface{}{key: val})
+			info.Keys = append(info.Keys, debugKey{
+				Key:   key,
+				Type:  fmt.Sprintf("%T", val),
+				Size:  len(b),
+				Value: fmt.Sprintf("%v", val),
+			})
+		}
+		c.mu.Unlock()
+		sort.Slice(info.Keys, func(i, j int) bool { return info.Keys[i].Key < info.Keys[j].Key })
+
+		if token, _, err := s.token(r); err == nil {
+			info.Size = len(token)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(info)
+	})
+}
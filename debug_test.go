@@ -0,0 +1,50 @@
+package sessions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		s.Put(r, "count", 3)
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", cookie)
+	DebugHandler(s).ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusNotFound)
+	}
+
+	s.Debug = true
+	rr = httptest.NewRecorder()
+	DebugHandler(s).ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got %d: expected %d", rr.Code, http.StatusOK)
+	}
+
+	var info debugInfo
+	err := json.Unmarshal(rr.Body.Bytes(), &info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Keys) != 2 {
+		t.Fatalf("got %d: expected %d", len(info.Keys), 2)
+	}
+	if info.Keys[1].Key != "foo" || info.Keys[1].Type != "string" || info.Keys[1].Value != "bar" {
+		t.Errorf("got %+v: expected key %q", info.Keys[1], "foo")
+	}
+	if info.Keys[0].Size == 0 || info.Size == 0 {
+		t.Errorf("got %d, %d: expected non-zero sizes", info.Keys[0].Size, info.Size)
+	}
+}
@@ -0,0 +1,135 @@
+package sessions
+
+import (
+	"net/http"
+	"time"
+)
+
+// deviceKeyInfo is used to derive the keys for remember-device cookies from
+// the session keys, so that a remember-device token can never be accepted as
+// a session token or vice versa.
+const deviceKeyInfo = "github.com/golangcollege/sessions remember-device"
+
+const (
+	deviceNone = iota
+	deviceRemember
+	deviceForget
+)
+
+// RememberDevice instructs the middleware to send a long-lived "remember this
+// device" cookie alongside the session cookie, which records the given user
+// ID. The cookie is named RememberDeviceCookieName and is valid for the
+// RememberDeviceLifetime, which is usually much longer than the session
+// Lifetime. It is encrypted with a key derived from (but different to) the
+// session key.
+//
+// When the session later expires, RestoreRememberedUser() can be used to log
+// the user back in from the remember-device cookie.
+func (s *Session) RememberDevice(r *http.Request, userID interface{}) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	c.device = deviceRemember
+	c.deviceUserID = userID
+	c.mu.Unlock()
+}
+
+// ForgetDevice instructs the middleware to delete the remember-device cookie,
+// if there is one. It is usually called when a user logs out.
+func (s *Session) ForgetDevice(r *http.Request) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	c.device = deviceForget
+	c.deviceUserID = nil
+	c.mu.Unlock()
+}
+
+// RememberedUser validates the remember-device cookie sent with the request
+// and returns the user ID that it records. If there is no remember-device
+// cookie, or it is invalid, has expired or was issued before InvalidBefore,
+// then ok will be false.
+func (s *Session) RememberedUser(r *http.Request) (userID interface{}, ok bool) {
+	cookie, err := r.Cookie(s.RememberDeviceCookieName)
+	if err != nil {
+		return nil, false
+	}
+
+	c := &cache{keys: s.tenantKeys(r)}
+	err = c.decode(s.codec(), s.ciphers(), cookie.Value, s.deviceKeys(c))
+	if err != nil || s.expired(c.Expiry) || c.IssuedAt.Before(s.InvalidBefore) {
+		return nil, false
+	}
+
+	userID, ok = c.Data[s.principalKey()]
+	return userID, ok
+}
+
+// RestoreRememberedUser re-establishes a logged in session from a valid
+// remember-device cookie. If the current session has no user ID stored under
+// the PrincipalKey, and the request has a valid remember-device cookie, then
+// the user is logged in with LoginUser() and true is returned. Otherwise the
+// session is unchanged and false is returned.
+func (s *Session) RestoreRememberedUser(r *http.Request) bool {
+	if s.Exists(r, s.principalKey()) {
+		return false
+	}
+
+	userID, ok := s.RememberedUser(r)
+	if !ok {
+		return false
+	}
+
+	// The user hasn't actually authenticated, so the most recent
+	// authentication time isn't recorded.
+	c := getCacheFromRequestContext(r)
+	c.mu.Lock()
+	s.login(c, userID, time.Now().UTC())
+	c.mu.Unlock()
+	return true
+}
+
+func (s *Session) deviceKeys(c *cache) [][32]byte {
+	return s.derivedKeys(c, deviceKeyInfo)
+}
+
+// saveDevice writes or deletes the remember-device cookie if RememberDevice or
+// ForgetDevice was called during the request. The caller must hold c.mu.
+func (s *Session) saveDevice(w http.ResponseWriter, r *http.Request, c *cache) error {
+	cookie := &http.Cookie{
+		Name:     s.RememberDeviceCookieName,
+		Path:     s.Path,
+		Domain:   s.Domain,
+		Secure:   s.Secure,
+		HttpOnly: true,
+		SameSite: s.SameSite,
+	}
+
+	switch c.device {
+	case deviceRemember:
+		dc := newCache(s.RememberDeviceLifetime)
+		dc.Data[s.principalKey()] = c.deviceUserID
+		dc.IssuedAt = time.Now().UTC()
+
+		key := s.encryptionKey(c)
+		token, err := dc.encode(s.codec(), s.Compress, s.LegacyFormat, s.cipher(), deriveKey(key[:], deviceKeyInfo), s.random())
+		if err != nil {
+			return err
+		}
+
+		cookie.Value = token
+		cookie.Expires = time.Unix(dc.Expiry.Unix()+1, 0)
+		cookie.MaxAge = int(time.Until(dc.Expiry).Seconds() + 1)
+	case deviceForget:
+		cookie.Expires = time.Unix(1, 0)
+		cookie.MaxAge = -1
+	default:
+		return nil
+	}
+
+	if len(cookie.String()) > 4096 {
+		return ErrCookieTooLong
+	}
+	s.setCookie(w, r, cookie)
+	return nil
+}
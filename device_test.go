@@ -0,0 +1,102 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRememberDevice(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.LoginUser(r, 42)
+		s.RememberDevice(r, 42)
+	})
+
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range rr.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	device, ok := cookies["remember_device"]
+	if !ok {
+		t.Fatal("expected a remember_device cookie")
+	}
+	if device.MaxAge < 29*24*60*60 {
+		t.Errorf("got %d: expected at least %d", device.MaxAge, 29*24*60*60)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		restored := s.RestoreRememberedUser(r)
+		if restored && !s.NeedsReauth(r) {
+			t.Errorf("a restored session did not need re-authentication")
+		}
+		fmt.Fprintf(w, "%v %d", restored, s.GetInt(r, "userID"))
+	})
+
+	body, _ := testRequest(t, s.Enable(h), device.Name+"="+device.Value)
+	if body != "true 42" {
+		t.Errorf("got %q: expected %q", body, "true 42")
+	}
+
+	body, _ = testRequest(t, s.Enable(h), "remember_device="+cookies[cookieName].Value)
+	if body != "false 0" {
+		t.Errorf("got %q: expected %q", body, "false 0")
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.ForgetDevice(r)
+	})
+
+	rr = httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	cookies = map[string]*http.Cookie{}
+	for _, cookie := range rr.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	if cookies["remember_device"] == nil || cookies["remember_device"].MaxAge != -1 {
+		t.Errorf("expected the remember_device cookie to be deleted")
+	}
+}
+
+func TestRememberDeviceInvalidBefore(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.RememberDevice(r, 42)
+	})
+
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	var device *http.Cookie
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == "remember_device" {
+			device = cookie
+		}
+	}
+	if device == nil {
+		t.Fatal("expected a remember_device cookie")
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.RestoreRememberedUser(r))
+	})
+
+	body, _ := testRequest(t, s.Enable(h), device.Name+"="+device.Value)
+	if body != "true" {
+		t.Errorf("got %q: expected %q", body, "true")
+	}
+
+	s.InvalidBefore = time.Now().Add(time.Second)
+	body, _ = testRequest(t, s.Enable(h), device.Name+"="+device.Value)
+	if body != "false" {
+		t.Errorf("got %q: expected %q", body, "false")
+	}
+}
@@ -0,0 +1,114 @@
+package sessions
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+)
+
+// Diff describes how the session data changed during a request, and is passed
+// to the OnSaveDiff hook. Each slice of key names is sorted alphabetically.
+type Diff struct {
+	Added   []string
+	Changed []string
+	Removed []string
+}
+
+// snapshot records a deep copy of the session data as it was loaded, so that
+// it can later be compared against the data being saved. The caller must hold
+// c.mu.
+func (c *cache) snapshot() {
+	c.snapshotted = true
+	c.origModified = c.modified
+	c.origExpiry = c.Expiry
+	c.origPersist = c.Persist
+	c.original = make(map[string]interface{}, len(c.Data))
+	for key, val := range c.Data {
+		if val == nil {
+			c.original[key] = nil
+			continue
+		}
+		c.original[key] = deepCopy(reflect.ValueOf(val)).Interface()
+	}
+}
+
+// diff compares the current session data against the snapshot taken when it
+// was loaded. The caller must hold c.mu.
+func (c *cache) diff() Diff {
+	var d Diff
+	for key, val := range c.Data {
+		old, exists := c.original[key]
+		if !exists {
+			d.Added = append(d.Added, key)
+		} else if !reflect.DeepEqual(old, val) {
+			d.Changed = append(d.Changed, key)
+		}
+	}
+	for key := range c.original {
+		if _, exists := c.Data[key]; !exists {
+			d.Removed = append(d.Removed, key)
+		}
+	}
+
+	sort.Strings(d.Added)
+	sort.Strings(d.Changed)
+	sort.Strings(d.Removed)
+	return d
+}
+
+// unchanged reports whether the session is exactly the same as when the
+// snapshot was taken, even though it may have been marked as modified (for
+// example, because a handler Put the same value again). The caller must hold
+// c.mu.
+func (c *cache) unchanged() bool {
+	if !c.snapshotted || c.origModified || c.destroyed {
+		return false
+	}
+	if !c.Expiry.Equal(c.origExpiry) || c.Persist != c.origPersist {
+		return false
+	}
+	if len(c.Data) != len(c.original) {
+		return false
+	}
+	for key, val := range c.Data {
+		old, exists := c.original[key]
+		if !exists || !reflect.DeepEqual(old, val) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Session) needsSnapshot() bool {
+	return s.OnSaveDiff != nil || s.SkipUnchanged || (s.MergeConcurrent && s.Store != nil)
+}
+
+// afterSave records any audit events, calls any OnCommit functions, and calls
+// the OnSaveDiff hook if the session data was written to the client.
+func (s *Session) afterSave(r *http.Request, c *cache) {
+	s.trackCookieless(r, c)
+	s.countSessions(c)
+	s.audit(r, c)
+
+	c.mu.Lock()
+	callbacks := c.onCommit
+	c.onCommit = nil
+	c.mu.Unlock()
+	for _, fn := range callbacks {
+		fn()
+	}
+
+	if s.OnSaveDiff == nil {
+		return
+	}
+
+	c.mu.Lock()
+	if !c.modified || c.skipSave {
+		c.mu.Unlock()
+		return
+	}
+	d := c.diff()
+	c.mu.Unlock()
+
+	s.OnSaveDiff(r, d)
+}
@@ -0,0 +1,88 @@
+package sessions
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestOnSaveDiff(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	var diffs []Diff
+	s.OnSaveDiff = func(r *http.Request, diff Diff) {
+		diffs = append(diffs, diff)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		s.Put(r, "baz", []string{"a"})
+		s.Put(r, "qux", 1)
+	})
+
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		tags := s.Get(r, "baz").([]string)
+		tags[0] = "b"
+		s.Put(r, "baz", tags)
+		s.Remove(r, "qux")
+		s.Put(r, "new", true)
+	})
+
+	testRequest(t, s.Enable(h), cookie)
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.GetString(r, "foo")
+	})
+
+	testRequest(t, s.Enable(h), cookie)
+
+	expected := []Diff{
+		{Added: []string{"baz", "foo", "qux"}},
+		{Added: []string{"new"}, Changed: []string{"baz"}, Removed: []string{"qux"}},
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("got %+v: expected %+v", diffs, expected)
+	}
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.SkipUnchanged = true
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		s.Put(r, "tags", []string{"a"})
+	})
+
+	_, cookie := testRequest(t, s.Enable(h), "")
+	if cookie == "" {
+		t.Fatal("expected a session cookie")
+	}
+
+	_, updated := testRequest(t, s.Enable(h), cookie)
+	if updated != "" {
+		t.Errorf("got %q: expected %q", updated, "")
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "tags", []string{"b"})
+	})
+
+	_, updated = testRequest(t, s.Enable(h), cookie)
+	if updated == "" {
+		t.Errorf("expected a session cookie when a value changed")
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		s.SetPersist(r, false)
+	})
+
+	_, updated = testRequest(t, s.Enable(h), cookie)
+	if updated == "" {
+		t.Errorf("expected a session cookie when the persist setting changed")
+	}
+}
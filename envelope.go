@@ -0,0 +1,69 @@
+package sessions
+
+// Session state is encoded in a small envelope before it is encrypted, so that
+// the format can change without invalidating existing sessions. The envelope
+// is a 4 byte header followed by the payload:
+//
+//	0x00, version, codec ID, flags
+//
+// The leading zero byte tells it apart from the legacy format, which is the
+// bare (possibly gzip compressed) payload: none of the supported codecs or
+// gzip produce output which starts with a zero byte.
+const (
+	envelopeMarker    = 0x00
+	envelopeVersion   = 1
+	envelopeHeaderLen = 4
+)
+
+// The codec IDs recorded in the envelope. Sessions encoded with GobCodec or
+// JSONCodec can be decoded whichever Codec is configured, so the Codec can be
+// switched without logging everyone out. Sessions encoded with any other
+// Codec are decoded with the configured Codec.
+const (
+	codecIDOther = iota
+	codecIDGob
+	codecIDJSON
+)
+
+// envelopeCompressed is the flag which is set when the payload is gzip
+// compressed.
+const envelopeCompressed = 1 << 0
+
+// envelopeHeader returns the header for a payload encoded with codec.
+func envelopeHeader(codec Codec, flags byte) []byte {
+	id := byte(codecIDOther)
+	switch codec.(type) {
+	case GobCodec:
+		id = codecIDGob
+	case JSONCodec:
+		id = codecIDJSON
+	}
+	return []byte{envelopeMarker, envelopeVersion, id, flags}
+}
+
+// openEnvelope returns the codec which the payload was encoded with, and the
+// decompressed payload. Payloads in the legacy format are returned with the
+// configured codec. ErrInvalidToken is returned if the envelope was written by
+// a newer version of this package.
+func openEnvelope(codec Codec, b []byte) (Codec, []byte, error) {
+	if len(b) == 0 || b[0] != envelopeMarker {
+		b, err := decompress(b)
+		return codec, b, err
+	}
+	if len(b) < envelopeHeaderLen || b[1] != envelopeVersion {
+		return nil, nil, ErrInvalidToken
+	}
+
+	switch b[2] {
+	case codecIDGob:
+		codec = GobCodec{}
+	case codecIDJSON:
+		codec = JSONCodec{}
+	}
+	payload := b[envelopeHeaderLen:]
+	if b[3]&envelopeCompressed == 0 {
+		return codec, payload, nil
+	}
+	payload, err := gunzip(payload)
+	return codec, payload, err
+}
@@ -0,0 +1,106 @@
+package sessions
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEnvelopeHeader(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	tests := []struct {
+		codec    Codec
+		compress bool
+		expected []byte
+	}{
+		{GobCodec{}, false, []byte{0, 1, codecIDGob, 0}},
+		{JSONCodec{}, false, []byte{0, 1, codecIDJSON, 0}},
+		{JSONCodec{}, true, []byte{0, 1, codecIDJSON, envelopeCompressed}},
+	}
+
+	for _, test := range tests {
+		s.Codec = test.codec
+		s.Compress = test.compress
+
+		c := newCache(0)
+		c.Data["foo"] = strings.Repeat("bar", 100)
+		token, err := s.encode(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := Decrypt(token, s.keys...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(b, test.expected) {
+			t.Errorf("got %v: expected %v", b[:envelopeHeaderLen], test.expected)
+		}
+	}
+}
+
+func TestEnvelopeLegacy(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+		s.Compress = compress
+		s.LegacyFormat = true
+
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/put" {
+				s.Put(r, "foo", strings.Repeat("bar", 100))
+				return
+			}
+			fmt.Fprint(w, len(s.GetString(r, "foo")))
+		})
+
+		agent := NewMockAgent(s)
+		agent.Do(h, httptest.NewRequest("GET", "/put", nil))
+
+		b, err := Decrypt(agent.Cookie().Value, s.keys...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b[0] == envelopeMarker {
+			t.Errorf("got %v: expected no envelope", b[:envelopeHeaderLen])
+		}
+
+		s.LegacyFormat = false
+		rr := agent.Do(h, httptest.NewRequest("GET", "/", nil))
+		if rr.Body.String() != "300" {
+			t.Errorf("got %q: expected %q", rr.Body.String(), "300")
+		}
+	}
+}
+
+func TestEnvelopeCodecSwitch(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/put" {
+			s.Put(r, "foo", "bar")
+			return
+		}
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+
+	agent := NewMockAgent(s)
+	agent.Do(h, httptest.NewRequest("GET", "/put", nil))
+
+	s.Codec = JSONCodec{}
+	rr := agent.Do(h, httptest.NewRequest("GET", "/", nil))
+	if rr.Body.String() != "bar" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "bar")
+	}
+}
+
+func TestEnvelopeUnknownVersion(t *testing.T) {
+	for _, b := range [][]byte{{0}, {0, 1, 1}, {0, 2, 1, 0, 1, 2, 3}} {
+		_, _, err := openEnvelope(GobCodec{}, b)
+		if err != ErrInvalidToken {
+			t.Errorf("got %v: expected %v", err, ErrInvalidToken)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package sessions
+
+import "errors"
+
+var (
+	// ErrDecodeFailed is wrapped by the error passed to the ErrorHandler when
+	// session data was decrypted successfully but couldn't be decoded.
+	ErrDecodeFailed = errors.New("session: failed to decode session data")
+
+	// ErrEncodeFailed is wrapped by the error passed to the ErrorHandler when
+	// the session data couldn't be encoded, for example because it contains a
+	// value of a type which hasn't been registered with encoding/gob.
+	ErrEncodeFailed = errors.New("session: failed to encode session data")
+
+	// ErrEncryptFailed is wrapped by the error passed to the ErrorHandler when
+	// the session data couldn't be encrypted, for example because the source
+	// of randomness failed or no field key has been set.
+	ErrEncryptFailed = errors.New("session: failed to encrypt session data")
+
+	// ErrStoreFailed is wrapped by the error passed to the ErrorHandler when a
+	// call to the session Store returns an error.
+	ErrStoreFailed = errors.New("session: session store failed")
+)
+
+// Phase identifies whether an error occurred while loading or saving a
+// session.
+type Phase int
+
+const (
+	// PhaseLoad is the phase in which the session is loaded from the
+	// request, before the handler is called.
+	PhaseLoad Phase = iota + 1
+
+	// PhaseSave is the phase in which the session is saved and the session
+	// cookie is added to the response.
+	PhaseSave
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseLoad:
+		return "load"
+	case PhaseSave:
+		return "save"
+	}
+	return "unknown"
+}
+
+// Error is the type of the errors passed to the ErrorHandler. Phase records
+// whether the session was being loaded or saved. Use errors.Is to check for
+// one of the sentinel errors, such as ErrDecodeFailed, ErrEncryptFailed or
+// ErrCookieTooLong, and errors.As to get at the Phase. For example, a handler
+// could silently clear a session cookie which can't be decoded, but raise an
+// alert when encryption fails:
+//
+//	session.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+//		var serr *sessions.Error
+//		if errors.As(err, &serr) && serr.Phase == sessions.PhaseLoad && errors.Is(err, sessions.ErrDecodeFailed) {
+//			http.SetCookie(w, &http.Cookie{Name: "session", Path: "/", MaxAge: -1})
+//			http.Redirect(w, r, r.URL.String(), http.StatusSeeOther)
+//			return
+//		}
+//		if errors.Is(err, sessions.ErrEncryptFailed) {
+//			alert(err)
+//		}
+//		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+//	}
+type Error struct {
+	// Phase is the phase in which the error occurred.
+	Phase Phase
+
+	// Kind is the sentinel error which describes the failure, such as
+	// ErrEncryptFailed. It is nil if the failure doesn't fall into one of the
+	// defined kinds.
+	Kind error
+
+	// Err is the underlying error. It is nil if Kind describes the failure
+	// completely.
+	Err error
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Kind == nil:
+		return e.Err.Error()
+	case e.Err == nil:
+		return e.Kind.Error()
+	}
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the Kind of the error.
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// wrapError returns err wrapped in an *Error of the given kind, or nil if err
+// is nil. The phase is filled in later by withPhase.
+func wrapError(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// withPhase returns err as an *Error with the given phase.
+func withPhase(phase Phase, err error) error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*Error); ok {
+		cp := *e
+		cp.Phase = phase
+		return &cp
+	}
+	return &Error{Phase: phase, Err: err}
+}
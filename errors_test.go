@@ -0,0 +1,92 @@
+package sessions
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type failingStore struct{}
+
+func (failingStore) Find(token string) ([]byte, bool, error) {
+	return nil, false, io.ErrUnexpectedEOF
+}
+
+func (failingStore) Commit(token string, b []byte, expiry time.Time) error {
+	return io.ErrUnexpectedEOF
+}
+
+func (failingStore) Delete(token string) error {
+	return io.ErrUnexpectedEOF
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+func TestErrorPhaseAndKind(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(s *Session)
+		cookie string
+		phase  Phase
+		kind   error
+	}{
+		{"cookie too long", func(s *Session) {}, "", PhaseSave, ErrCookieTooLong},
+		{"encrypt failed", func(s *Session) { s.Rand = failingReader{} }, "", PhaseSave, ErrEncryptFailed},
+		{"missing field key", func(s *Session) { s.SensitiveKeys = []string{"foo"} }, "", PhaseSave, ErrEncryptFailed},
+		{"store save", func(s *Session) { s.Store = failingStore{} }, "", PhaseSave, ErrStoreFailed},
+		{"store load", func(s *Session) { s.Store = failingStore{} }, "session=abc", PhaseLoad, ErrStoreFailed},
+	}
+
+	for _, test := range tests {
+		s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+		test.setup(s)
+
+		var got error
+		s.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			got = err
+		}
+
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.Put(r, "foo", strings.Repeat("a", 5000))
+		})
+		testRequest(t, s.Enable(h), test.cookie)
+
+		var serr *Error
+		if !errors.As(got, &serr) {
+			t.Errorf("%s: got %T: expected %T", test.name, got, serr)
+			continue
+		}
+		if serr.Phase != test.phase {
+			t.Errorf("%s: got %v: expected %v", test.name, serr.Phase, test.phase)
+		}
+		if !errors.Is(got, test.kind) {
+			t.Errorf("%s: got %v: expected %v", test.name, got, test.kind)
+		}
+	}
+}
+
+func TestErrorUnwrap(t *testing.T) {
+	err := withPhase(PhaseSave, wrapError(ErrStoreFailed, io.ErrUnexpectedEOF))
+
+	if !errors.Is(err, ErrStoreFailed) {
+		t.Errorf("got %v: expected %v", errors.Is(err, ErrStoreFailed), true)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v: expected %v", errors.Is(err, io.ErrUnexpectedEOF), true)
+	}
+	if errors.Is(err, ErrDecodeFailed) {
+		t.Errorf("got %v: expected %v", errors.Is(err, ErrDecodeFailed), false)
+	}
+
+	expected := "session: session store failed: unexpected EOF"
+	if err.Error() != expected {
+		t.Errorf("got %q: expected %q", err.Error(), expected)
+	}
+}
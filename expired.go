@@ -0,0 +1,39 @@
+package sessions
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DefaultIsBackgroundRequest reports whether the request was made by script
+// rather than by the user navigating. It returns true for htmx requests (with
+// an HX-Request header), requests with an 'X-Requested-With: XMLHttpRequest'
+// header, fetch requests which aren't navigations (according to the
+// Sec-Fetch-Mode header), and requests which accept JSON but not HTML.
+func DefaultIsBackgroundRequest(r *http.Request) bool {
+	if r.Header.Get("HX-Request") == "true" {
+		return true
+	}
+	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		return true
+	}
+	if mode := r.Header.Get("Sec-Fetch-Mode"); mode != "" && mode != "navigate" && mode != "nested-navigate" {
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// ExpiredResponse returns a handler for use as an ExpiredHandler. It responds
+// with 401 Unauthorized and an 'X-Session-Expired: true' header. For htmx
+// requests, an HX-Redirect header is also added so that htmx sends the user to
+// the given login URL. If loginURL is empty, no HX-Redirect header is added.
+func ExpiredResponse(loginURL string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Session-Expired", "true")
+		if loginURL != "" && r.Header.Get("HX-Request") == "true" {
+			w.Header().Set("HX-Redirect", loginURL)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,94 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDefaultIsBackgroundRequest(t *testing.T) {
+	tests := []struct {
+		header   string
+		value    string
+		expected bool
+	}{
+		{"HX-Request", "true", true},
+		{"X-Requested-With", "XMLHttpRequest", true},
+		{"Sec-Fetch-Mode", "cors", true},
+		{"Sec-Fetch-Mode", "navigate", false},
+		{"Accept", "application/json", true},
+		{"Accept", "text/html,application/xhtml+xml,application/json;q=0.9", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+		}
+		got := DefaultIsBackgroundRequest(r)
+		if got != test.expected {
+			t.Errorf("%s: %s: got %v: expected %v", test.header, test.value, got, test.expected)
+		}
+	}
+}
+
+func TestExpiredHandler(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Lifetime = time.Second
+	s.ExpiredHandler = ExpiredResponse("/login")
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		fmt.Fprint(w, "ok")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	do := func(cookie string, htmx bool) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		if cookie != "" {
+			r.Header.Set("Cookie", cookie)
+		}
+		if htmx {
+			r.Header.Set("HX-Request", "true")
+		}
+		s.Enable(h).ServeHTTP(rr, r)
+		return rr
+	}
+
+	rr := do(cookie, true)
+	if rr.Code != http.StatusOK {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusOK)
+	}
+
+	rr = do("", true)
+	if rr.Code != http.StatusOK {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusOK)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	rr = do(cookie, false)
+	if rr.Code != http.StatusOK {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusOK)
+	}
+
+	rr = do(cookie, true)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusUnauthorized)
+	}
+	if rr.Header().Get("X-Session-Expired") != "true" {
+		t.Errorf("got %q: expected %q", rr.Header().Get("X-Session-Expired"), "true")
+	}
+	if rr.Header().Get("HX-Redirect") != "/login" {
+		t.Errorf("got %q: expected %q", rr.Header().Get("HX-Redirect"), "/login")
+	}
+
+	rr = do("session=invalid", true)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusUnauthorized)
+	}
+}
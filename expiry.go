@@ -0,0 +1,39 @@
+package sessions
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// writeExpiryCookie adds the companion expiry cookie to the response, if
+// ExpiryCookieName is set, with the same attributes as the session cookie
+// except that it isn't HttpOnly. Its value is the session's expiry time as a
+// Unix timestamp in seconds. The caller must hold c.mu.
+func (s *Session) writeExpiryCookie(w http.ResponseWriter, r *http.Request, c *cache, cookie *http.Cookie) {
+	if s.ExpiryCookieName == "" || s.Transport != nil {
+		return
+	}
+
+	s.setCookie(w, r, &http.Cookie{
+		Name:     s.ExpiryCookieName,
+		Value:    strconv.FormatInt(c.Expiry.Unix(), 10),
+		Path:     cookie.Path,
+		Domain:   cookie.Domain,
+		Secure:   cookie.Secure,
+		SameSite: cookie.SameSite,
+		Expires:  cookie.Expires,
+		MaxAge:   cookie.MaxAge,
+	})
+}
+
+// deleteExpiryCookie deletes the companion expiry cookie, if ExpiryCookieName
+// is set.
+func (s *Session) deleteExpiryCookie(w http.ResponseWriter, r *http.Request) {
+	if s.ExpiryCookieName == "" || s.Transport != nil {
+		return
+	}
+
+	cookie := s.deletionCookie(s.ExpiryCookieName)
+	cookie.HttpOnly = false
+	s.setCookie(w, r, cookie)
+}
@@ -0,0 +1,75 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExpiryCookie(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.ExpiryCookieName = "session_exp"
+
+	var expiry time.Time
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		expiry = s.Expiry(r)
+	})
+
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	cookies := cookiesByName(rr.Result().Cookies())
+	session, exp := cookies["session"], cookies["session_exp"]
+	if session == nil || exp == nil {
+		t.Fatalf("got %v: expected session and session_exp cookies", rr.Header()["Set-Cookie"])
+	}
+	if exp.Value != strconv.FormatInt(expiry.Unix(), 10) {
+		t.Errorf("got %q: expected %q", exp.Value, strconv.FormatInt(expiry.Unix(), 10))
+	}
+	if exp.HttpOnly {
+		t.Errorf("got %v: expected %v", exp.HttpOnly, false)
+	}
+	if exp.MaxAge != session.MaxAge || exp.Path != session.Path {
+		t.Errorf("got %v: expected the same attributes as %v", exp, session)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Destroy(r)
+	})
+	rr2 := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(session)
+	s.Enable(h).ServeHTTP(rr2, r)
+
+	exp = cookiesByName(rr2.Result().Cookies())["session_exp"]
+	if exp == nil || exp.MaxAge >= 0 {
+		t.Errorf("got %v: expected session_exp to be deleted", exp)
+	}
+}
+
+func TestExpiryCookieTransport(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.ExpiryCookieName = "session_exp"
+	s.Transport = HeaderTransport{}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	if v := rr.Header().Get("Set-Cookie"); v != "" {
+		t.Errorf("got %q: expected no cookies", v)
+	}
+}
+
+func cookiesByName(cookies []*http.Cookie) map[string]*http.Cookie {
+	m := make(map[string]*http.Cookie, len(cookies))
+	for _, cookie := range cookies {
+		m[cookie.Name] = cookie
+	}
+	return m
+}
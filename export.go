@@ -0,0 +1,95 @@
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrSnapshotExpired is returned by Import when the exported session has
+// expired.
+var ErrSnapshotExpired = errors.New("session: exported session has expired")
+
+// exportKeyInfo is used to derive the keys for exported session state from the
+// secret keys, so that exported state can't be used as a session cookie.
+const exportKeyInfo = "github.com/golangcollege/sessions export"
+
+// Snapshot is a read-only copy of a session's state, as returned by Import.
+type Snapshot struct {
+	// Data contains the session data.
+	Data map[string]interface{}
+
+	// Expiry is the time that the session expires.
+	Expiry time.Time
+
+	// IssuedAt is the time that the session state was last saved.
+	IssuedAt time.Time
+
+	// Client describes the client which created the session, if
+	// RecordClientInfo was enabled.
+	Client ClientInfo
+}
+
+// Export serializes and encrypts the full state of the current session, so
+// that it can be handed to a job queue or another process which holds the
+// same secret key. Use Import() to decrypt it again. The exported state is
+// encrypted in the same format as the session cookie, but with a key derived
+// from the secret key, so it can't be used as a session cookie and is safe to
+// pass through untrusted channels.
+func (s *Session) Export(r *http.Request) ([]byte, error) {
+	token, err := s.export(r, exportKeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(token), nil
+}
+
+// export encrypts the full state of the current session, like Export, but with
+// a key derived from the current secret key using info.
+func (s *Session) export(r *http.Request, info string) (string, error) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sealed, err := s.sealFields(c.clone())
+	if err != nil {
+		return "", err
+	}
+
+	key := s.encryptionKey(c)
+	return sealed.encode(s.codec(), s.Compress, s.LegacyFormat, s.cipher(), deriveKey(key[:], info), s.random())
+}
+
+// Import decrypts session state created by Export(), running any Migrations
+// needed to bring it up to the current SchemaVersion. ErrInvalidToken is
+// returned if it can't be decrypted with any of the session's keys, and
+// ErrSnapshotExpired is returned if the session has expired.
+func (s *Session) Import(b []byte) (Snapshot, error) {
+	c := &cache{}
+	err := c.decode(s.codec(), s.ciphers(), string(b), s.derivedKeys(c, exportKeyInfo))
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	err = s.openFields(c)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	if s.expired(c.Expiry) {
+		return Snapshot{}, ErrSnapshotExpired
+	}
+
+	err = s.migrate(c)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	return Snapshot{
+		Data:     c.Data,
+		Expiry:   c.Expiry,
+		IssuedAt: c.IssuedAt,
+		Client:   c.Client,
+	}, nil
+}
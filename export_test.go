@@ -0,0 +1,92 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImport(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.SensitiveKeys = []string{"email"}
+	s.SetFieldKey([]byte("Fq7sGn4BtnEWh2kSYQz1LRd0bH3uaX6c"))
+
+	s.Put(r, "userID", 42)
+	s.Put(r, "email", "alice@example.com")
+
+	b, err := s.Export(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := s.Import(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Data["userID"] != 42 {
+		t.Errorf("got %v: expected %v", snapshot.Data["userID"], 42)
+	}
+	if snapshot.Data["email"] != "alice@example.com" {
+		t.Errorf("got %v: expected %v", snapshot.Data["email"], "alice@example.com")
+	}
+	if !snapshot.Expiry.Equal(c.Expiry) {
+		t.Errorf("got %v: expected %v", snapshot.Expiry, c.Expiry)
+	}
+
+	other := New([]byte("Fq7sGn4BtnEWh2kSYQz1LRd0bH3uaX6c"))
+	_, err = other.Import(b)
+	if err != ErrInvalidToken {
+		t.Errorf("got %v: expected %v", err, ErrInvalidToken)
+	}
+
+	c.Expiry = time.Now().Add(-time.Second)
+	b, err = s.Export(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Import(b)
+	if err != ErrSnapshotExpired {
+		t.Errorf("got %v: expected %v", err, ErrSnapshotExpired)
+	}
+}
+
+func TestExportNotCookie(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	var exported []byte
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/export" {
+			s.Put(r, "userID", 42)
+			var err error
+			exported, err = s.Export(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+		fmt.Fprint(w, s.GetInt(r, "userID"))
+	})
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/export", nil))
+
+	body, _ := testRequest(t, s.Enable(h), "session="+string(exported))
+	if body != "0" {
+		t.Errorf("got %q: expected %q", body, "0")
+	}
+
+	cookie := strings.TrimPrefix(strings.Split(rr.Header().Get("Set-Cookie"), ";")[0], "session=")
+	_, err := s.Import([]byte(cookie))
+	if err != ErrInvalidToken {
+		t.Errorf("got %v: expected %v", err, ErrInvalidToken)
+	}
+}
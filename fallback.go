@@ -0,0 +1,95 @@
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// inlinePrefix starts the value of a session cookie which carries the
+// encrypted session data itself, because the Store was unavailable when the
+// session was saved. Like spillPrefix, it can't appear at the start of an
+// encrypted token or a store token, which are base64 encoded.
+const inlinePrefix = "inline."
+
+// errStoreSkipped is returned, wrapping ErrStoreFailed, when the Store is
+// being skipped after a recent failure and the session data doesn't fit in
+// the session cookie.
+var errStoreSkipped = errors.New("session: store skipped after a recent failure")
+
+// storeBreaker remembers that the Store has failed, so that it is skipped
+// until the cool-down has passed instead of every request waiting for it to
+// fail again.
+type storeBreaker struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// open reports whether the Store should be skipped.
+func (b *storeBreaker) open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Now().Before(b.until)
+}
+
+// trip skips the Store for the cool-down d.
+func (b *storeBreaker) trip(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.until = time.Now().Add(d)
+}
+
+// storeCookie saves the session data to the Store, and returns the session
+// cookie carrying its token. If StoreFallback is set and the Store fails, or
+// has failed within StoreFallbackCooldown, the encrypted session data is put
+// in the session cookie instead, as long as it fits. The caller must hold
+// c.mu.
+func (s *Session) storeCookie(r *http.Request, c *cache) (*http.Cookie, error) {
+	var storeErr error
+	if !s.StoreFallback || !s.breaker.open() {
+		token := c.token
+		storeErr = s.merge(r, c)
+		if storeErr == nil && c.token == "" && s.TokenHint != nil {
+			c.token, storeErr = s.hintedToken(r)
+			if storeErr == errInvalidHint {
+				return nil, storeErr
+			}
+		}
+		if storeErr == nil {
+			storeErr = s.commit(s.Store, c)
+		}
+		if storeErr == nil {
+			return s.newCookie(c, c.token), nil
+		}
+		if !s.StoreFallback || !errors.Is(storeErr, ErrStoreFailed) {
+			return nil, storeErr
+		}
+		s.breaker.trip(s.StoreFallbackCooldown)
+		c.token = token
+	}
+
+	cookie, err := s.cookie(c)
+	if err != nil {
+		return nil, err
+	}
+	cookie.Value = inlinePrefix + cookie.Value
+	if s.oversized(cookie) {
+		if storeErr != nil {
+			return nil, storeErr
+		}
+		return nil, wrapError(ErrStoreFailed, errStoreSkipped)
+	}
+	return cookie, nil
+}
+
+// loadInline decodes session data which was put in the session cookie while
+// the Store was unavailable. Once the Store is back, the session is marked as
+// modified so that it is moved back to the Store when it is saved.
+func (s *Session) loadInline(c *cache, token string) error {
+	err := c.decode(s.codec(), s.ciphers(), token, s.decryptionKeys(c))
+	if err == nil && !s.breaker.open() {
+		c.modified = true
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golangcollege/sessions/memstore"
+)
+
+type downStore struct {
+	*memstore.MemStore
+	down bool
+}
+
+func (ds *downStore) Find(token string) ([]byte, bool, error) {
+	if ds.down {
+		return nil, false, errors.New("store is down")
+	}
+	return ds.MemStore.Find(token)
+}
+
+func (ds *downStore) Commit(token string, b []byte, expiry time.Time) error {
+	if ds.down {
+		return errors.New("store is down")
+	}
+	return ds.MemStore.Commit(token, b, expiry)
+}
+
+func TestStoreFallback(t *testing.T) {
+	store := &downStore{MemStore: memstore.NewWithCleanupInterval(0), down: true}
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = store
+	s.StoreFallback = true
+	s.StoreFallbackCooldown = time.Hour
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+	if !strings.HasPrefix(cookie, cookieName+"="+inlinePrefix) {
+		t.Fatalf("got %q: expected an inline session cookie", cookie)
+	}
+
+	// The Store is skipped during the cool-down, even though it's back.
+	store.down = false
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+		s.Put(r, "baz", "qux")
+	})
+	body, cookie2 := testRequest(t, s.Enable(h), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+	if !strings.HasPrefix(cookie2, cookieName+"="+inlinePrefix) {
+		t.Errorf("got %q: expected an inline session cookie", cookie2)
+	}
+
+	// After the cool-down the session is moved back to the Store.
+	s.breaker.trip(0)
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"), s.GetString(r, "baz"))
+	})
+	body, cookie3 := testRequest(t, s.Enable(h), cookie2)
+	if body != "barqux" {
+		t.Errorf("got %q: expected %q", body, "barqux")
+	}
+	token := strings.TrimPrefix(strings.SplitN(cookie3, ";", 2)[0], cookieName+"=")
+	_, found, err := store.Find(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != true {
+		t.Errorf("got %v: expected %v", found, true)
+	}
+}
+
+func TestStoreFallbackTooLong(t *testing.T) {
+	store := &downStore{MemStore: memstore.NewWithCleanupInterval(0), down: true}
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = store
+	s.StoreFallback = true
+	var got error
+	s.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		got = err
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", strings.Repeat("a", 5000))
+	})
+	testRequest(t, s.Enable(h), "")
+	if !errors.Is(got, ErrStoreFailed) {
+		t.Errorf("got %v: expected %v", got, ErrStoreFailed)
+	}
+}
@@ -0,0 +1,171 @@
+package sessions
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"net/http"
+)
+
+var errMissingFieldKey = errors.New("session: sensitive keys are set but no field key has been provided")
+
+// sealedValue holds the encrypted form of a sensitive value within the session
+// data.
+type sealedValue struct {
+	Token string
+}
+
+// sealedPayload wraps a value so that it can be gob encoded on its own, while
+// preserving its concrete type.
+type sealedPayload struct {
+	Value interface{}
+}
+
+func init() {
+	gob.Register(sealedValue{})
+}
+
+// SetFieldKey sets the secret used to encrypt the values of any SensitiveKeys.
+// It must be exactly 32 bytes long, and should be different from the main
+// session key so that it can be held and controlled separately (for example,
+// fetched from a key management service at startup). Optionally, the variadic
+// oldKeys parameter can be used to provide old field keys during key rotation.
+//
+// SetFieldKey will panic if any of the keys are not 32 bytes long.
+func (s *Session) SetFieldKey(key []byte, oldKeys ...[]byte) {
+	keys, err := toKeys(append([][]byte{key}, oldKeys...))
+	if err != nil {
+		panic(err)
+	}
+	s.fieldKeys = keys
+}
+
+// PutSecure adds a key and corresponding value to the session data, like
+// Put, but the value is encrypted a second time using the field key set with
+// SetFieldKey(), as if the key were one of the SensitiveKeys. Use it for
+// individual values such as OAuth refresh tokens which must stay encrypted at
+// rest even when the session cookie is only signed (with SignedOnly) or the
+// session data is kept in a Store. The key stays encrypted, even if it is
+// later changed with Put, for as long as it is in the session data.
+//
+// PutSecure will panic if no field key has been set. If any of the Validators
+// reject the value, the error is handled as it is by Put.
+func (s *Session) PutSecure(r *http.Request, key string, val interface{}) {
+	if len(s.fieldKeys) == 0 {
+		panic(errMissingFieldKey)
+	}
+	c := getCacheFromRequestContext(r)
+
+	err := s.validate(key, val)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.reject(err)
+		return
+	}
+
+	if c.secureKeys == nil {
+		c.secureKeys = make(map[string]bool)
+	}
+	c.secureKeys[key] = true
+	s.put(c, key, val)
+}
+
+// GetSecure returns the value for a given key from the session data, if it is
+// stored encrypted with the field key, because it was added with PutSecure or
+// is one of the SensitiveKeys. Otherwise it returns nil.
+func (s *Session) GetSecure(r *http.Request, key string) interface{} {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.secureKeys[key] && !s.sensitive(key) {
+		return nil
+	}
+	return c.Data[key]
+}
+
+// sensitive reports whether the key is one of the SensitiveKeys.
+func (s *Session) sensitive(key string) bool {
+	for _, k := range s.SensitiveKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// sealFields returns a copy of the cache in which the values of any sensitive
+// keys, and any keys added with PutSecure, have been encrypted with the field
+// key.
+func (s *Session) sealFields(c *cache) (*cache, error) {
+	if len(s.SensitiveKeys) == 0 && len(c.secureKeys) == 0 {
+		return c, nil
+	}
+	if len(s.fieldKeys) == 0 {
+		return nil, wrapError(ErrEncryptFailed, errMissingFieldKey)
+	}
+
+	sealed := c.clone()
+
+	keys := append([]string(nil), s.SensitiveKeys...)
+	for key := range c.secureKeys {
+		if !s.sensitive(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		val, exists := c.Data[key]
+		if !exists {
+			continue
+		}
+
+		var b bytes.Buffer
+		err := gob.NewEncoder(&b).Encode(sealedPayload{Value: val})
+		if err != nil {
+			return nil, wrapError(ErrEncodeFailed, err)
+		}
+
+		token, err := sealToken(s.fieldCipher(), b.Bytes(), s.fieldKeys[0], s.random())
+		if err != nil {
+			return nil, wrapError(ErrEncryptFailed, err)
+		}
+		sealed.Data[key] = sealedValue{Token: token}
+	}
+
+	return sealed, nil
+}
+
+// openFields decrypts any sealed values in the cache in place, and records
+// their keys so that they are sealed again when the session is saved.
+func (s *Session) openFields(c *cache) error {
+	ciphers := append([]Cipher{s.fieldCipher()}, s.ciphers()...)
+	for key, val := range c.Data {
+		sv, ok := val.(sealedValue)
+		if !ok {
+			continue
+		}
+
+		b, _, _, err := openToken(ciphers, sv.Token, s.fieldKeys)
+		if err != nil {
+			return err
+		}
+
+		var p sealedPayload
+		err = gob.NewDecoder(bytes.NewReader(b)).Decode(&p)
+		if err != nil {
+			return wrapError(ErrDecodeFailed, err)
+		}
+		c.Data[key] = p.Value
+		if c.secureKeys == nil {
+			c.secureKeys = make(map[string]bool)
+		}
+		c.secureKeys[key] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package sessions
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSensitiveKeys(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.SensitiveKeys = []string{"email"}
+	s.SetFieldKey([]byte("3j4a0lniSrNb4xMdkYjsgG74mjRCF75u"))
+
+	c := newCache(time.Hour)
+	c.Data["email"] = "alice@example.com"
+	c.Data["theme"] = "dark"
+
+	sealed, err := s.sealFields(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sealed.Data["email"].(sealedValue); !ok {
+		t.Errorf("got %T: expected %T", sealed.Data["email"], sealedValue{})
+	}
+	if sealed.Data["theme"] != "dark" {
+		t.Errorf("got %q: expected %q", sealed.Data["theme"], "dark")
+	}
+	if c.Data["email"] != "alice@example.com" {
+		t.Errorf("got %q: expected %q", c.Data["email"], "alice@example.com")
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "email", "alice@example.com")
+		w.WriteHeader(200)
+	})
+
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "email"))
+	})
+
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "alice@example.com" {
+		t.Errorf("got %q: expected %q", body, "alice@example.com")
+	}
+
+	s2 := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s2.SetFieldKey([]byte("9y5Vlur8YvODJEhgOY8m9JVE4u46IpCV"))
+
+	body, _ = testRequest(t, s2.Enable(h), cookie)
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+}
+
+func TestMissingFieldKey(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.SensitiveKeys = []string{"email"}
+	s.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		w.Write([]byte(err.Error()))
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "email", "alice@example.com")
+		w.WriteHeader(200)
+	})
+
+	body, _ := testRequest(t, s.Enable(h), "")
+	if !strings.Contains(body, errMissingFieldKey.Error()) {
+		t.Errorf("got %q: expected to contain %q", body, errMissingFieldKey.Error())
+	}
+}
+
+func TestPutSecure(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4")).WithCipher(SignedOnly{})
+	s.SetFieldKey([]byte("3j4a0lniSrNb4xMdkYjsgG74mjRCF75u"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.PutSecure(r, "refreshToken", "s3cr3t-r3fr3sh")
+		s.Put(r, "theme", "dark")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	// Saving the session again must keep the value encrypted.
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "theme", "light")
+	})
+	_, cookie = testRequest(t, s.Enable(h), cookie)
+
+	token := strings.TrimPrefix(strings.SplitN(cookie, ";", 2)[0], "session=")
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte("light")) {
+		t.Errorf("expected the signed cookie to contain %q", "light")
+	}
+	if bytes.Contains(b, []byte("s3cr3t-r3fr3sh")) {
+		t.Errorf("expected the signed cookie not to contain %q", "s3cr3t-r3fr3sh")
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%v %v %v", s.GetSecure(r, "refreshToken"), s.GetSecure(r, "theme"), s.Get(r, "refreshToken"))
+	})
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	expected := "s3cr3t-r3fr3sh <nil> s3cr3t-r3fr3sh"
+	if body != expected {
+		t.Errorf("got %q: expected %q", body, expected)
+	}
+}
+
+func TestPutSecureMissingFieldKey(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != errMissingFieldKey {
+				t.Errorf("got %v: expected %v", err, errMissingFieldKey)
+			}
+		}()
+		s.PutSecure(r, "refreshToken", "s3cr3t-r3fr3sh")
+	})
+	testRequest(t, s.Enable(h), "")
+}
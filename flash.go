@@ -0,0 +1,214 @@
+package sessions
+
+import (
+	"encoding/gob"
+	"net/http"
+)
+
+// keyFlashes is the reserved key under which flash messages are stored, as a
+// map of category to messages.
+const keyFlashes = "_flashes"
+
+// keyFlashValues is the reserved key under which structured flash messages
+// are stored, as a map of category to FlashMessage values.
+const keyFlashValues = "_flash_values"
+
+func init() {
+	gob.Register(map[string][]string{})
+	gob.Register(map[string][]FlashMessage{})
+}
+
+// FlashMessage is a structured flash message, added with FlashValue, for UI
+// layers which render banners with a level and extra details rather than a
+// plain string.
+type FlashMessage struct {
+	// Message is the text to display.
+	Message string
+	// Level is the severity of the message, such as "success", "warning" or
+	// "error".
+	Level string
+	// Meta holds any extra details, such as a link or the field which the
+	// message is about. It is a map of strings so that it can be encoded by
+	// every Codec.
+	Meta map[string]string
+}
+
+// Flash adds a one-time message in the given category (such as "error" or
+// "success") to the session data, to be displayed on the next page that the
+// user sees. Messages are kept in the order they were added, and are removed
+// from the session data once they have been read with Flashes() or
+// AllFlashes().
+func (s *Session) Flash(r *http.Request, category, msg string) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flashes := flashesFrom(c.Data[keyFlashes])
+	flashes[category] = append(flashes[category], msg)
+	c.set(keyFlashes, flashes)
+	c.modified = true
+}
+
+// Flashes returns the flash messages in the given category, and removes them
+// from the session data. A nil slice is returned if there are none.
+func (s *Session) Flashes(r *http.Request, category string) []string {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flashes := flashesFrom(c.Data[keyFlashes])
+	msgs, exists := flashes[category]
+	if !exists {
+		return nil
+	}
+
+	delete(flashes, category)
+	if len(flashes) == 0 {
+		c.unset(keyFlashes)
+	} else {
+		c.set(keyFlashes, flashes)
+	}
+	c.modified = true
+	return msgs
+}
+
+// AllFlashes returns the flash messages in every category, keyed by category,
+// and removes them from the session data. An empty map is returned if there
+// are none.
+func (s *Session) AllFlashes(r *http.Request) map[string][]string {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flashes := flashesFrom(c.Data[keyFlashes])
+	if _, exists := c.Data[keyFlashes]; exists {
+		c.unset(keyFlashes)
+		c.modified = true
+	}
+	return flashes
+}
+
+// FlashValue adds a one-time structured message in the given category to the
+// session data, to be displayed on the next page that the user sees. Messages
+// are kept in the order they were added, and are removed from the session
+// data once they have been read with FlashValues() or AllFlashValues(). They
+// are kept apart from the plain messages added with Flash().
+func (s *Session) FlashValue(r *http.Request, category string, msg FlashMessage) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flashes := flashValuesFrom(c.Data[keyFlashValues])
+	flashes[category] = append(flashes[category], msg)
+	c.set(keyFlashValues, flashes)
+	c.modified = true
+}
+
+// FlashValues returns the structured flash messages in the given category, and
+// removes them from the session data. A nil slice is returned if there are
+// none.
+func (s *Session) FlashValues(r *http.Request, category string) []FlashMessage {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flashes := flashValuesFrom(c.Data[keyFlashValues])
+	msgs, exists := flashes[category]
+	if !exists {
+		return nil
+	}
+
+	delete(flashes, category)
+	if len(flashes) == 0 {
+		c.unset(keyFlashValues)
+	} else {
+		c.set(keyFlashValues, flashes)
+	}
+	c.modified = true
+	return msgs
+}
+
+// AllFlashValues returns the structured flash messages in every category,
+// keyed by category, and removes them from the session data. An empty map is
+// returned if there are none.
+func (s *Session) AllFlashValues(r *http.Request) map[string][]FlashMessage {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flashes := flashValuesFrom(c.Data[keyFlashValues])
+	if _, exists := c.Data[keyFlashValues]; exists {
+		c.unset(keyFlashValues)
+		c.modified = true
+	}
+	return flashes
+}
+
+// flashesFrom returns a copy of the stored flash messages. As well as the
+// map[string][]string stored by Flash, it accepts the generic maps and slices
+// produced when the session data is decoded by codecs such as JSONCodec.
+func flashesFrom(v interface{}) map[string][]string {
+	flashes := make(map[string][]string)
+	switch v := v.(type) {
+	case map[string][]string:
+		for category, msgs := range v {
+			flashes[category] = append([]string(nil), msgs...)
+		}
+	case map[string]interface{}:
+		for category, msgs := range v {
+			list, _ := msgs.([]interface{})
+			for _, msg := range list {
+				if str, ok := msg.(string); ok {
+					flashes[category] = append(flashes[category], str)
+				}
+			}
+		}
+	}
+	return flashes
+}
+
+// flashValuesFrom returns a copy of the stored structured flash messages. Like
+// flashesFrom, it accepts the generic maps and slices produced by codecs such
+// as JSONCodec.
+func flashValuesFrom(v interface{}) map[string][]FlashMessage {
+	flashes := make(map[string][]FlashMessage)
+	switch v := v.(type) {
+	case map[string][]FlashMessage:
+		for category, msgs := range v {
+			flashes[category] = append([]FlashMessage(nil), msgs...)
+		}
+	case map[string]interface{}:
+		for category, msgs := range v {
+			list, _ := msgs.([]interface{})
+			for _, msg := range list {
+				if fields, ok := msg.(map[string]interface{}); ok {
+					flashes[category] = append(flashes[category], flashMessageFrom(fields))
+				}
+			}
+		}
+	}
+	return flashes
+}
+
+// flashMessageFrom converts a generic map decoded by a codec such as JSONCodec
+// back into a FlashMessage.
+func flashMessageFrom(fields map[string]interface{}) FlashMessage {
+	var msg FlashMessage
+	msg.Message, _ = fields["Message"].(string)
+	msg.Level, _ = fields["Level"].(string)
+	if meta, ok := fields["Meta"].(map[string]interface{}); ok {
+		msg.Meta = make(map[string]string, len(meta))
+		for key, val := range meta {
+			if str, ok := val.(string); ok {
+				msg.Meta[key] = str
+			}
+		}
+	}
+	return msg
+}
@@ -0,0 +1,130 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFlash(t *testing.T) {
+	r := MockRequest(httptest.NewRequest("GET", "/", nil))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	s.Flash(r, "error", "foo")
+	s.Flash(r, "error", "bar")
+	s.Flash(r, "success", "baz")
+
+	msgs := s.Flashes(r, "error")
+	if !reflect.DeepEqual(msgs, []string{"foo", "bar"}) {
+		t.Errorf("got %v: expected %v", msgs, []string{"foo", "bar"})
+	}
+	msgs = s.Flashes(r, "error")
+	if msgs != nil {
+		t.Errorf("got %v: expected %v", msgs, nil)
+	}
+
+	all := s.AllFlashes(r)
+	if !reflect.DeepEqual(all, map[string][]string{"success": {"baz"}}) {
+		t.Errorf("got %v: expected %v", all, map[string][]string{"success": {"baz"}})
+	}
+	if s.Exists(r, keyFlashes) {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+
+	all = s.AllFlashes(r)
+	if len(all) != 0 {
+		t.Errorf("got %v: expected %v", all, map[string][]string{})
+	}
+}
+
+func TestFlashAcrossRequests(t *testing.T) {
+	for _, codec := range []Codec{GobCodec{}, JSONCodec{}} {
+		s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+		s.Codec = codec
+
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/flash" {
+				s.Flash(r, "info", "saved")
+				return
+			}
+			fmt.Fprint(w, s.Flashes(r, "info"))
+		})
+
+		agent := NewMockAgent(s)
+		agent.Do(h, httptest.NewRequest("GET", "/flash", nil))
+
+		rr := agent.Do(h, httptest.NewRequest("GET", "/", nil))
+		if rr.Body.String() != "[saved]" {
+			t.Errorf("%T: got %q: expected %q", codec, rr.Body.String(), "[saved]")
+		}
+		rr = agent.Do(h, httptest.NewRequest("GET", "/", nil))
+		if rr.Body.String() != "[]" {
+			t.Errorf("%T: got %q: expected %q", codec, rr.Body.String(), "[]")
+		}
+	}
+}
+
+func TestFlashValue(t *testing.T) {
+	r := MockRequest(httptest.NewRequest("GET", "/", nil))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	saved := FlashMessage{Message: "Saved", Level: "success", Meta: map[string]string{"href": "/posts/1"}}
+	failed := FlashMessage{Message: "Invalid email", Level: "error"}
+	s.FlashValue(r, "form", saved)
+	s.FlashValue(r, "form", failed)
+	s.FlashValue(r, "banner", saved)
+	s.Flash(r, "form", "plain")
+
+	msgs := s.FlashValues(r, "form")
+	if !reflect.DeepEqual(msgs, []FlashMessage{saved, failed}) {
+		t.Errorf("got %v: expected %v", msgs, []FlashMessage{saved, failed})
+	}
+	msgs = s.FlashValues(r, "form")
+	if msgs != nil {
+		t.Errorf("got %v: expected %v", msgs, nil)
+	}
+
+	all := s.AllFlashValues(r)
+	if !reflect.DeepEqual(all, map[string][]FlashMessage{"banner": {saved}}) {
+		t.Errorf("got %v: expected %v", all, map[string][]FlashMessage{"banner": {saved}})
+	}
+	if s.Exists(r, keyFlashValues) {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+
+	plain := s.Flashes(r, "form")
+	if !reflect.DeepEqual(plain, []string{"plain"}) {
+		t.Errorf("got %v: expected %v", plain, []string{"plain"})
+	}
+}
+
+func TestFlashValueAcrossRequests(t *testing.T) {
+	saved := FlashMessage{Message: "Saved", Level: "success", Meta: map[string]string{"href": "/posts/1"}}
+	for _, codec := range []Codec{GobCodec{}, JSONCodec{}} {
+		s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+		s.Codec = codec
+
+		var got []FlashMessage
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/flash" {
+				s.FlashValue(r, "info", saved)
+				return
+			}
+			got = s.FlashValues(r, "info")
+		})
+
+		agent := NewMockAgent(s)
+		agent.Do(h, httptest.NewRequest("GET", "/flash", nil))
+
+		agent.Do(h, httptest.NewRequest("GET", "/", nil))
+		if !reflect.DeepEqual(got, []FlashMessage{saved}) {
+			t.Errorf("%T: got %v: expected %v", codec, got, []FlashMessage{saved})
+		}
+		agent.Do(h, httptest.NewRequest("GET", "/", nil))
+		if got != nil {
+			t.Errorf("%T: got %v: expected %v", codec, got, nil)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package sessions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// forwardKeyInfo is used to derive the keys for signing forwarded claims from
+// the session keys.
+const forwardKeyInfo = "github.com/golangcollege/sessions forwarded-claims"
+
+// ErrInvalidClaims is returned by ForwardedClaims when the forwarded claims
+// header is missing, has an invalid signature or has expired.
+var ErrInvalidClaims = errors.New("session: invalid forwarded claims")
+
+type forwardedClaims struct {
+	Claims map[string]interface{} `json:"claims"`
+	Expiry int64                  `json:"exp"`
+}
+
+// forward removes any forwarded claims header sent by the client, and then
+// adds a signed header containing the values of the ForwardKeys from the
+// session data.
+func (s *Session) forward(r *http.Request, c *cache) {
+	if len(s.ForwardKeys) == 0 {
+		return
+	}
+	r.Header.Del(s.ForwardHeader)
+
+	c.mu.Lock()
+	fc := forwardedClaims{
+		Claims: make(map[string]interface{}, len(s.ForwardKeys)),
+		Expiry: c.Expiry.Unix(),
+	}
+	for _, key := range s.ForwardKeys {
+		if val, exists := c.Data[key]; exists {
+			fc.Claims[key] = val
+		}
+	}
+	c.mu.Unlock()
+
+	if len(fc.Claims) == 0 {
+		return
+	}
+
+	b, err := json.Marshal(fc)
+	if err != nil {
+		return
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+
+	key := deriveKey(s.requestKeys(r)[0][:], forwardKeyInfo)
+	r.Header.Set(s.ForwardHeader, payload+"."+sign(payload, key))
+}
+
+func sign(payload string, key [32]byte) string {
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ForwardedClaims verifies the signed claims header added by a gateway which
+// uses the same secret key and ForwardHeader, and returns the claims. It is
+// intended for use by upstream services which sit behind the gateway.
+// ErrInvalidClaims is returned if the header is missing, has been tampered
+// with, or the session it was created from has expired. Note that values are
+// decoded from JSON, so numbers will be float64 values.
+func (s *Session) ForwardedClaims(r *http.Request) (map[string]interface{}, error) {
+	parts := strings.Split(r.Header.Get(s.ForwardHeader), ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidClaims
+	}
+
+	valid := false
+	for _, key := range s.requestKeys(r) {
+		expected := sign(parts[0], deriveKey(key[:], forwardKeyInfo))
+		if hmac.Equal([]byte(expected), []byte(parts[1])) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, ErrInvalidClaims
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidClaims
+	}
+
+	var fc forwardedClaims
+	err = json.Unmarshal(b, &fc)
+	if err != nil {
+		return nil, ErrInvalidClaims
+	}
+	if s.expired(time.Unix(fc.Expiry, 0)) {
+		return nil, ErrInvalidClaims
+	}
+
+	return fc.Claims, nil
+}
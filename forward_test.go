@@ -0,0 +1,58 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardKeys(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.ForwardKeys = []string{"userID", "roles"}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "userID", 42)
+		s.Put(r, "roles", []string{"admin"})
+		s.Put(r, "cart", "secret")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	upstream := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	var header string
+	var claims map[string]interface{}
+	var claimsErr error
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Session-Claims")
+		claims, claimsErr = upstream.ForwardedClaims(r)
+	})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", cookie)
+	r.Header.Set("X-Session-Claims", "forged")
+	s.Enable(h).ServeHTTP(httptest.NewRecorder(), r)
+
+	if claimsErr != nil {
+		t.Fatal(claimsErr)
+	}
+	if claims["userID"] != float64(42) {
+		t.Errorf("got %v: expected %v", claims["userID"], 42)
+	}
+	if _, exists := claims["cart"]; exists {
+		t.Errorf("got %v: expected %v", exists, false)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Session-Claims", header+"x")
+	_, err := upstream.ForwardedClaims(r)
+	if err != ErrInvalidClaims {
+		t.Errorf("got %v: expected %v", err, ErrInvalidClaims)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Session-Claims", "forged")
+	s.Enable(h).ServeHTTP(httptest.NewRecorder(), r)
+	if header != "" {
+		t.Errorf("got %q: expected %q", header, "")
+	}
+}
@@ -1,5 +1,10 @@
 module github.com/golangcollege/sessions
 
-require golang.org/x/crypto v0.0.0-20200317142112-1b76d66859c6
+require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
+	github.com/gomodule/redigo v1.8.9
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	golang.org/x/crypto v0.0.0-20200317142112-1b76d66859c6
+)
 
 go 1.13
@@ -0,0 +1,60 @@
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// maxHintLength is the longest routing hint which TokenHint may return.
+const maxHintLength = 32
+
+// errInvalidHint is returned when TokenHint returns a hint which can't be
+// put in front of a session token.
+var errInvalidHint = errors.New("session: token hint must be 1-32 letters, digits, '-' or '_'")
+
+// hintedToken returns a new session token for use with the Store, starting
+// with the routing hint for the request if TokenHint is set.
+func (s *Session) hintedToken(r *http.Request) (string, error) {
+	token, err := newToken(s.random())
+	if err != nil || s.TokenHint == nil {
+		return token, err
+	}
+	hint := s.TokenHint(r)
+	if hint == "" {
+		return token, nil
+	}
+	if !validHint(hint) {
+		return "", errInvalidHint
+	}
+	return hint + "." + token, nil
+}
+
+// validHint reports whether the hint only uses the characters of a base64url
+// encoded token, and can't be mistaken for the prefix of an inline or spilled
+// session cookie.
+func validHint(hint string) bool {
+	if len(hint) > maxHintLength || hint+"." == inlinePrefix || hint+"." == spillPrefix {
+		return false
+	}
+	for _, ch := range hint {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9', ch == '-', ch == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ParseTokenHint returns the routing hint at the start of a session token
+// which was created while TokenHint was set, or "" if it has none. It doesn't
+// decrypt or check the token, so load balancers and stores can use it to
+// route a request, but it mustn't be trusted for anything else.
+func ParseTokenHint(token string) string {
+	i := strings.IndexByte(token, '.')
+	if i <= 0 {
+		return ""
+	}
+	return token[:i]
+}
@@ -0,0 +1,80 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golangcollege/sessions/memstore"
+)
+
+func TestTokenHint(t *testing.T) {
+	store := memstore.NewWithCleanupInterval(0)
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = store
+	s.TokenHint = func(r *http.Request) string {
+		return r.Header.Get("X-Region")
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Region", "eu-west")
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, req)
+	cookie := rr.Header().Get("Set-Cookie")
+	token := strings.TrimPrefix(strings.SplitN(cookie, ";", 2)[0], cookieName+"=")
+	if hint := ParseTokenHint(token); hint != "eu-west" {
+		t.Errorf("got %q: expected %q", hint, "eu-west")
+	}
+	_, found, err := store.Find(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != true {
+		t.Errorf("got %v: expected %v", found, true)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(s.GetString(r, "foo")))
+	})
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+
+	_, cookie = testRequest(t, s.Enable(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})), "")
+	token = strings.TrimPrefix(strings.SplitN(cookie, ";", 2)[0], cookieName+"=")
+	if hint := ParseTokenHint(token); hint != "" {
+		t.Errorf("got %q: expected %q", hint, "")
+	}
+}
+
+func TestTokenHintInvalid(t *testing.T) {
+	for _, hint := range []string{"eu.west", "inline", "spill", "a/b", strings.Repeat("a", 33)} {
+		if validHint(hint) {
+			t.Errorf("%q: got %v: expected %v", hint, true, false)
+		}
+	}
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = memstore.NewWithCleanupInterval(0)
+	s.TokenHint = func(r *http.Request) string { return "inline" }
+	var got error
+	s.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		got = err
+	}
+	testRequest(t, s.Enable(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})), "")
+	if got == nil || !strings.Contains(got.Error(), errInvalidHint.Error()) {
+		t.Errorf("got %v: expected %v", got, errInvalidHint)
+	}
+}
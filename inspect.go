@@ -0,0 +1,70 @@
+package sessions
+
+import (
+	"sort"
+	"time"
+)
+
+// TokenInfo describes the contents of a session token, as returned by
+// Inspect.
+type TokenInfo struct {
+	// Expiry is the time that the session expires.
+	Expiry time.Time
+
+	// IssuedAt is the time that the token was created. It will be the zero
+	// time for tokens issued by older versions of this package.
+	IssuedAt time.Time
+
+	// Size is the length of the token in bytes.
+	Size int
+
+	// Keys contains the session data key names, sorted alphabetically.
+	Keys []string
+
+	// Values contains the session data. It is nil unless the includeValues
+	// parameter to Inspect is true.
+	Values map[string]interface{}
+}
+
+// Inspect decrypts a session token (such as the value of a session cookie
+// copied from a support ticket or a log) and describes its contents. Unless
+// includeValues is true, only the key names are returned and the session data
+// values are not exposed.
+//
+// Unlike the Enable middleware, Inspect does not reject expired tokens, so you
+// should check the returned Expiry if that matters. An error is returned if the
+// token cannot be decrypted and decoded with any of the session's keys.
+func (s *Session) Inspect(token string, includeValues bool) (*TokenInfo, error) {
+	c := &cache{}
+	err := c.decode(s.codec(), s.ciphers(), token, s.decryptionKeys(c))
+	if err != nil {
+		return nil, err
+	}
+
+	info := &TokenInfo{
+		Expiry:   c.Expiry,
+		IssuedAt: c.IssuedAt,
+		Size:     len(token),
+		Keys:     sortedKeys(c.Data),
+	}
+
+	if includeValues {
+		err = s.openFields(c)
+		if err != nil {
+			return nil, err
+		}
+		info.Values = c.Data
+	}
+
+	return info, nil
+}
+
+// sortedKeys returns the keys of the session data, sorted alphabetically.
+func sortedKeys(data map[string]interface{}) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
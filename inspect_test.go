@@ -0,0 +1,55 @@
+package sessions
+
+import (
+	"crypto/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInspect(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	c := newCache(time.Hour)
+	c.Data["foo"] = "bar"
+	c.Data["baz"] = 123
+	c.IssuedAt = time.Now().UTC()
+
+	token, err := c.encode(s.codec(), false, false, s.cipher(), s.keys[0], rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := s.Inspect(token, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Expiry.Equal(c.Expiry) {
+		t.Errorf("got %v: expected %v", info.Expiry, c.Expiry)
+	}
+	if !info.IssuedAt.Equal(c.IssuedAt) {
+		t.Errorf("got %v: expected %v", info.IssuedAt, c.IssuedAt)
+	}
+	if info.Size != len(token) {
+		t.Errorf("got %d: expected %d", info.Size, len(token))
+	}
+	if !reflect.DeepEqual(info.Keys, []string{"baz", "foo"}) {
+		t.Errorf("got %v: expected %v", info.Keys, []string{"baz", "foo"})
+	}
+	if info.Values != nil {
+		t.Errorf("got %v: expected %v", info.Values, nil)
+	}
+
+	info, err = s.Inspect(token, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Values["foo"] != "bar" {
+		t.Errorf("got %v: expected %v", info.Values["foo"], "bar")
+	}
+
+	_, err = s.Inspect("invalid", false)
+	if err != ErrInvalidToken {
+		t.Errorf("got %v: expected %v", err, ErrInvalidToken)
+	}
+}
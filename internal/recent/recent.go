@@ -0,0 +1,65 @@
+// Package recent tracks which session tokens were written recently, for the
+// stores which read from replicas that may lag behind the primary.
+package recent
+
+import (
+	"sync"
+	"time"
+)
+
+// Set is a set of recently written tokens. Tokens are kept in two
+// generations, which are rotated every window, so a token is remembered for
+// between one and two windows after it was added and nothing needs to be
+// pruned one token at a time.
+type Set struct {
+	mu       sync.Mutex
+	window   time.Duration
+	rotated  time.Time
+	current  map[string]bool
+	previous map[string]bool
+}
+
+// New returns an empty Set which remembers tokens for at least window.
+func New(window time.Duration) *Set {
+	return &Set{
+		window:   window,
+		rotated:  time.Now(),
+		current:  make(map[string]bool),
+		previous: make(map[string]bool),
+	}
+}
+
+// Add records that the token has just been written.
+func (s *Set) Add(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rotate(time.Now())
+	s.current[token] = true
+}
+
+// Contains reports whether the token was written within the window.
+func (s *Set) Contains(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rotate(time.Now())
+	return s.current[token] || s.previous[token]
+}
+
+// rotate starts a new generation if the current one is a window old, and
+// forgets both generations if the set hasn't been used for two windows. The
+// caller must hold s.mu.
+func (s *Set) rotate(now time.Time) {
+	elapsed := now.Sub(s.rotated)
+	if elapsed < s.window {
+		return
+	}
+	if elapsed < 2*s.window {
+		s.previous = s.current
+	} else {
+		s.previous = make(map[string]bool)
+	}
+	s.current = make(map[string]bool)
+	s.rotated = now
+}
@@ -0,0 +1,35 @@
+package recent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSet(t *testing.T) {
+	s := New(time.Minute)
+	s.Add("foo")
+	if s.Contains("foo") != true {
+		t.Errorf("got %v: expected %v", s.Contains("foo"), true)
+	}
+	if s.Contains("bar") != false {
+		t.Errorf("got %v: expected %v", s.Contains("bar"), false)
+	}
+
+	// After one window the token is in the previous generation.
+	s.rotated = s.rotated.Add(-time.Minute)
+	if s.Contains("foo") != true {
+		t.Errorf("got %v: expected %v", s.Contains("foo"), true)
+	}
+
+	// After another window it is forgotten.
+	s.rotated = s.rotated.Add(-time.Minute)
+	if s.Contains("foo") != false {
+		t.Errorf("got %v: expected %v", s.Contains("foo"), false)
+	}
+
+	s.Add("baz")
+	s.rotated = s.rotated.Add(-3 * time.Minute)
+	if s.Contains("baz") != false {
+		t.Errorf("got %v: expected %v", s.Contains("baz"), false)
+	}
+}
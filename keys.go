@@ -0,0 +1,312 @@
+package sessions
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// ErrInvalidKeyLength is returned (or used as a panic value) when a secret key
+// is not exactly 32 bytes long.
+var ErrInvalidKeyLength = errors.New("session: secret key must be exactly 32 bytes long")
+
+// kdfInfo binds derived keys to this package, so that the same secret used
+// elsewhere in an application produces unrelated keys.
+const kdfInfo = "github.com/golangcollege/sessions"
+
+// SetCandidateKey allows a new secret key to be rolled out gradually. The
+// candidate key will be used to encrypt the given percentage (from 0 to 100)
+// of session cookies when they are saved, and the primary key passed to New()
+// is used for the rest. Cookies encrypted with any of the primary, old or
+// candidate keys can be decrypted.
+//
+// To roll back, set the percentage to 0. The candidate key will no longer be
+// used to encrypt cookies, but cookies already encrypted with it will continue
+// to work until they next change. Once the rollout is complete, promote the
+// candidate to be the primary key in New(). SetCandidateKey will panic if the
+// key is not 32 bytes long.
+func (s *Session) SetCandidateKey(key []byte, percent int) {
+	if len(key) != 32 {
+		panic(ErrInvalidKeyLength)
+	}
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+
+	var candidate [32]byte
+	copy(candidate[:], key)
+	s.candidateKey = &candidate
+	s.candidatePercent = percent
+}
+
+// encryptionKey returns the key to use when encrypting the session cookie for
+// c.
+func (s *Session) encryptionKey(c *cache) [32]byte {
+	if c.keys != nil {
+		return c.keys[0]
+	}
+	if s.candidateKey != nil && rand.Intn(100) < s.candidatePercent {
+		return *s.candidateKey
+	}
+	return s.secretKeys()[0]
+}
+
+// decryptionKeys returns all of the keys which may be used to decrypt the
+// session cookie for c. The primary and old keys come first, followed by the
+// candidate key if there is one.
+func (s *Session) decryptionKeys(c *cache) [][32]byte {
+	if c.keys != nil {
+		return c.keys
+	}
+	keys := s.secretKeys()
+	if s.candidateKey == nil {
+		return keys
+	}
+	return append(keys[:len(keys):len(keys)], *s.candidateKey)
+}
+
+// KeyProvider supplies the secret keys for a session, so that they can be
+// rotated without restarting the application. Keys returns the current key,
+// which is used to encrypt session cookies, followed by any old keys which are
+// still accepted when decrypting them. Keys is called on every request, so
+// it should be fast and safe for concurrent use. Each key must be exactly 32
+// bytes long.
+type KeyProvider interface {
+	Keys() (current []byte, old [][]byte)
+}
+
+// KeyRing is a KeyProvider whose keys can be rotated at runtime. It is safe
+// for concurrent use. For example, to rotate the key every week while still
+// accepting cookies encrypted with the previous two keys:
+//
+//	ring := sessions.NewKeyRing(key)
+//	session.KeyProvider = ring
+//	go func() {
+//		for range time.Tick(7 * 24 * time.Hour) {
+//			ring.Rotate(newRandomKey(), 2)
+//		}
+//	}()
+//
+// In a multi-instance deployment, every instance must be given the same keys,
+// for example by loading them from a shared secret store.
+type KeyRing struct {
+	mu   sync.RWMutex
+	keys [][]byte
+}
+
+// NewKeyRing returns a KeyRing holding the given current and old keys. It will
+// panic if any of the keys are not 32 bytes long.
+func NewKeyRing(current []byte, old ...[]byte) *KeyRing {
+	keys := append([][]byte{current}, old...)
+	for _, key := range keys {
+		if len(key) != 32 {
+			panic(ErrInvalidKeyLength)
+		}
+	}
+	return &KeyRing{keys: keys}
+}
+
+// Keys implements the KeyProvider interface.
+func (kr *KeyRing) Keys() ([]byte, [][]byte) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.keys[0], kr.keys[1:]
+}
+
+// Rotate makes key the current key. The previous current key becomes an old
+// key, and only the keep most recent old keys are retained. It will panic if
+// the key is not 32 bytes long.
+func (kr *KeyRing) Rotate(key []byte, keep int) {
+	if len(key) != 32 {
+		panic(ErrInvalidKeyLength)
+	}
+	if keep < 0 {
+		keep = 0
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	keys := append([][]byte{key}, kr.keys...)
+	if len(keys) > keep+1 {
+		keys = keys[:keep+1]
+	}
+	kr.keys = keys
+}
+
+// secretKeys returns the primary key followed by any old keys, from the
+// KeyProvider if one is set. It will panic if the KeyProvider returns a key
+// which is not 32 bytes long.
+func (s *Session) secretKeys() [][32]byte {
+	if s.KeyProvider == nil {
+		return s.keys
+	}
+
+	current, old := s.KeyProvider.Keys()
+	keys, err := toKeys(append([][]byte{current}, old...))
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}
+
+// tenantKeys returns the keys returned by KeysFor for the request, or nil if
+// the session's usual keys should be used. It will panic if KeysFor returns a
+// key which is not 32 bytes long.
+func (s *Session) tenantKeys(r *http.Request) [][32]byte {
+	if s.KeysFor == nil {
+		return nil
+	}
+
+	current, old := s.KeysFor(r)
+	if current == nil {
+		return nil
+	}
+	keys, err := toKeys(append([][]byte{current}, old...))
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}
+
+// requestKeys returns the primary key followed by any old keys for the
+// request, taking KeysFor into account.
+func (s *Session) requestKeys(r *http.Request) [][32]byte {
+	if keys := s.tenantKeys(r); keys != nil {
+		return keys
+	}
+	return s.secretKeys()
+}
+
+// staleKey reports whether the session was decrypted with one of the old keys
+// (rather than the primary or candidate key) or one of the old ciphers, and so
+// should be re-encrypted.
+func (s *Session) staleKey(c *cache) bool {
+	keys := c.keys
+	if keys == nil {
+		keys = s.secretKeys()
+	}
+	return c.cipherIndex > 0 || (c.keyIndex > 0 && c.keyIndex < len(keys))
+}
+
+func toKeys(secrets [][]byte) ([][32]byte, error) {
+	keys := make([][32]byte, len(secrets))
+	for i, secret := range secrets {
+		if len(secret) != 32 {
+			return nil, ErrInvalidKeyLength
+		}
+		copy(keys[i][:], secret)
+	}
+	return keys, nil
+}
+
+// NewWithDerivedKey works like New, except that the secret and any old secrets
+// may be of any length. The 32 byte keys used to encrypt session cookies are
+// derived from them using HKDF with SHA-256. Note that HKDF does not stretch
+// low-entropy secrets, so passphrases should still be long and random.
+//
+// Cookies created by a session using NewWithDerivedKey can only be read by
+// sessions created with NewWithDerivedKey and the same secret.
+func NewWithDerivedKey(secret []byte, oldSecrets ...[]byte) *Session {
+	keys := make([][32]byte, 0, len(oldSecrets)+1)
+	for _, secret := range append([][]byte{secret}, oldSecrets...) {
+		keys = append(keys, deriveKey(secret, kdfInfo))
+	}
+	return newSession(keys)
+}
+
+func deriveKey(secret []byte, info string) [32]byte {
+	var key [32]byte
+	kdf := hkdf.New(sha256.New, secret, nil, []byte(info))
+	_, err := io.ReadFull(kdf, key[:])
+	if err != nil {
+		// Reading 32 bytes from HKDF-SHA256 can only fail if more than
+		// 255*32 bytes are requested.
+		panic(err)
+	}
+	return key
+}
+
+// derivedKeys returns the keys derived using info from each of the keys which
+// may be used to decrypt the session cookie for c.
+func (s *Session) derivedKeys(c *cache, info string) [][32]byte {
+	keys := s.decryptionKeys(c)
+	derived := make([][32]byte, len(keys))
+	for i, key := range keys {
+		derived[i] = deriveKey(key[:], info)
+	}
+	return derived
+}
+
+// KeyFromHex decodes a hex-encoded secret key, and returns an error if it is
+// not valid hex or does not decode to exactly 32 bytes.
+func KeyFromHex(s string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("session: invalid hex key: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, ErrInvalidKeyLength
+	}
+	return key, nil
+}
+
+// KeyFromBase64 decodes a base64-encoded secret key, and returns an error if
+// it is not valid base64 or does not decode to exactly 32 bytes. Both the
+// standard and URL-safe alphabets are accepted, with or without padding.
+func KeyFromBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "=")
+
+	key, err := base64.RawStdEncoding.DecodeString(s)
+	if err != nil {
+		key, err = base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("session: invalid base64 key: %v", err)
+		}
+	}
+	if len(key) != 32 {
+		return nil, ErrInvalidKeyLength
+	}
+	return key, nil
+}
+
+// KeyFromEnv reads a secret key from the named environment variable. The value
+// may be a 64 character hex string, a base64 string which decodes to 32 bytes,
+// or a raw 32 character string. An error is returned if the variable is not
+// set or the value is not a valid key in any of these formats. For example:
+//
+//	key, err := sessions.KeyFromEnv("SESSION_KEY")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	session = sessions.New(key)
+func KeyFromEnv(name string) ([]byte, error) {
+	val := strings.TrimSpace(os.Getenv(name))
+	if val == "" {
+		return nil, fmt.Errorf("session: environment variable %q is not set", name)
+	}
+
+	switch {
+	case len(val) == 64:
+		return KeyFromHex(val)
+	case len(val) == 32:
+		return []byte(val), nil
+	}
+
+	key, err := KeyFromBase64(val)
+	if err != nil {
+		return nil, fmt.Errorf("session: environment variable %q does not contain a valid key", name)
+	}
+	return key, nil
+}
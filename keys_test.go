@@ -0,0 +1,258 @@
+package sessions
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNewInvalidKeyLength(t *testing.T) {
+	for _, keys := range [][][]byte{
+		{[]byte("secret")},
+		{[]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4-too-long")},
+		{[]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"), []byte("old")},
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r != ErrInvalidKeyLength {
+					t.Errorf("got %v: expected %v", r, ErrInvalidKeyLength)
+				}
+			}()
+			New(keys[0], keys[1:]...)
+		}()
+	}
+}
+
+func TestNewWithDerivedKey(t *testing.T) {
+	s := NewWithDerivedKey([]byte("correct horse battery staple"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		w.WriteHeader(200)
+	})
+
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	s2 := NewWithDerivedKey([]byte("new secret"), []byte("correct horse battery staple"))
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s2.GetString(r, "foo"))
+	})
+
+	body, _ := testRequest(t, s2.Enable(h), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+
+	key := deriveKey([]byte("correct horse battery staple"), kdfInfo)
+	if key == deriveKey([]byte("new secret"), kdfInfo) {
+		t.Errorf("expected different secrets to derive different keys")
+	}
+	if key != s.keys[0] {
+		t.Errorf("got %x: expected %x", s.keys[0], key)
+	}
+}
+
+func TestKeyFromEnv(t *testing.T) {
+	raw := []byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4")
+
+	tests := []struct {
+		val   string
+		valid bool
+	}{
+		{hex.EncodeToString(raw), true},
+		{base64.StdEncoding.EncodeToString(raw), true},
+		{base64.RawURLEncoding.EncodeToString(raw), true},
+		{string(raw), true},
+		{"", false},
+		{"too short", false},
+		{hex.EncodeToString(raw[:20]), false},
+		{strings.Repeat("z", 64), false},
+	}
+
+	for _, tt := range tests {
+		os.Setenv("SESSIONS_TEST_KEY", tt.val)
+		key, err := KeyFromEnv("SESSIONS_TEST_KEY")
+		if tt.valid {
+			if err != nil {
+				t.Errorf("%q: got %v: expected %v", tt.val, err, nil)
+			} else if !bytes.Equal(key, raw) {
+				t.Errorf("%q: got %q: expected %q", tt.val, key, raw)
+			}
+		} else if err == nil {
+			t.Errorf("%q: expected an error", tt.val)
+		}
+	}
+	os.Unsetenv("SESSIONS_TEST_KEY")
+}
+
+func TestSetCandidateKey(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.SetCandidateKey([]byte("9y5Vlur8YvODJEhgOY8m9JVE4u46IpCV"), 100)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		w.WriteHeader(200)
+	})
+
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	get := func(s *Session) string {
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, s.GetString(r, "foo"))
+		})
+		body, _ := testRequest(t, s.Enable(h), cookie)
+		return body
+	}
+
+	if body := get(New([]byte("9y5Vlur8YvODJEhgOY8m9JVE4u46IpCV"))); body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+	if body := get(New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))); body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+
+	s.SetCandidateKey([]byte("9y5Vlur8YvODJEhgOY8m9JVE4u46IpCV"), 0)
+	if body := get(s); body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+
+	_, cookie = testRequest(t, s.Enable(h), "")
+	if body := get(New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))); body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+}
+
+func TestKeyProviderRotation(t *testing.T) {
+	oldKey := []byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4")
+	newKey := []byte("9y5Vlur8YvODJEhgOY8m9JVE4u46IpCV")
+
+	ring := NewKeyRing(oldKey)
+	s := New([]byte("ZmJ0QXhmNkVhbjFkTkxXVFNIc0FzZm5r"))
+	s.KeyProvider = ring
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("put") != "" {
+			s.Put(r, "foo", "bar")
+		}
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/?put=1", nil))
+	cookie := rr.Header().Get("Set-Cookie")
+
+	ring.Rotate(newKey, 1)
+
+	body, reissued := testRequest(t, s.Enable(h), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+	if reissued == "" {
+		t.Fatal("expected the session cookie to be re-encrypted with the new key")
+	}
+
+	// The re-encrypted cookie can be read with the new key alone, and isn't
+	// re-encrypted again.
+	ring.Rotate(newKey, 0)
+	body, again := testRequest(t, s.Enable(h), reissued)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+	if again != "" {
+		t.Errorf("got %q: expected %q", again, "")
+	}
+
+	// The original cookie is no longer accepted once the old key is dropped.
+	body, _ = testRequest(t, s.Enable(h), cookie)
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+}
+
+func TestOldKeyReencrypted(t *testing.T) {
+	key := []byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4")
+	oldKey := []byte("9y5Vlur8YvODJEhgOY8m9JVE4u46IpCV")
+
+	get := func(s *Session, cookie string) (string, string) {
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cookie == "" {
+				s.Put(r, "foo", "bar")
+			}
+			fmt.Fprint(w, s.GetString(r, "foo"))
+		})
+		return testRequest(t, s.Enable(h), cookie)
+	}
+
+	_, cookie := get(New(oldKey), "")
+
+	body, reissued := get(New(key, oldKey), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+	if reissued == "" {
+		t.Fatal("expected the session cookie to be re-encrypted with the new key")
+	}
+
+	body, _ = get(New(key), reissued)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+}
+
+func TestKeysFor(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	tenants := map[string][]byte{
+		"a.example.com": []byte("A6IpCV9y5Vlur8YvODJEhgOY8m9JVE4a"),
+		"b.example.com": []byte("B6IpCV9y5Vlur8YvODJEhgOY8m9JVE4b"),
+	}
+	s.KeysFor = func(r *http.Request) ([]byte, [][]byte) {
+		return tenants[r.Host], nil
+	}
+
+	put := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", r.Host)
+	})
+	get := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+
+	request := func(h http.Handler, host, cookie string) (string, string) {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "http://"+host+"/", nil)
+		if cookie != "" {
+			r.Header.Set("Cookie", cookie)
+		}
+		h.ServeHTTP(rr, r)
+		return rr.Body.String(), rr.Header().Get("Set-Cookie")
+	}
+
+	_, cookie := request(s.Enable(put), "a.example.com", "")
+
+	for _, test := range []struct {
+		host     string
+		expected string
+	}{
+		{"a.example.com", "a.example.com"},
+		{"b.example.com", ""},
+		{"other.example.com", ""},
+	} {
+		body, _ := request(s.Enable(get), test.host, cookie)
+		if body != test.expected {
+			t.Errorf("%s: got %q: expected %q", test.host, body, test.expected)
+		}
+	}
+
+	_, cookie = request(s.Enable(put), "other.example.com", "")
+	token := strings.SplitN(strings.TrimPrefix(cookie, "session="), ";", 2)[0]
+	_, err := s.Inspect(token, false)
+	if err != nil {
+		t.Errorf("got %v: expected %v", err, nil)
+	}
+}
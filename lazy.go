@@ -0,0 +1,80 @@
+package sessions
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// lazyCache stands in for the session in the request context when Lazy is
+// true, and loads it the first time that it is used.
+type lazyCache struct {
+	mu      sync.Mutex
+	session *Session
+	request *http.Request
+	c       *cache
+	err     error
+}
+
+// get returns the session, loading it if it hasn't been loaded yet. If the
+// session can't be loaded, the error is recorded so that the middleware can
+// pass it to the ErrorHandler at the end of the request, and a new session
+// which won't be saved is returned in its place.
+func (l *lazyCache) get() *cache {
+	l.mu.Lock()
+	if l.c != nil {
+		c := l.c
+		l.mu.Unlock()
+		return c
+	}
+
+	s, r := l.session, l.request
+	c, err := s.load(r)
+	if err != nil {
+		l.err = withPhase(PhaseLoad, err)
+		c = s.emptyCache(r)
+		c.skipSave = true
+	}
+	l.c = c
+	l.mu.Unlock()
+
+	if err == nil {
+		s.prepare(r, c)
+	}
+	return c
+}
+
+// loaded returns the session if it has been loaded, or nil if it hasn't, along
+// with any error from loading it.
+func (l *lazyCache) loaded() (*cache, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.c, l.err
+}
+
+// lazy reports whether the middleware should load sessions lazily. Sessions
+// are always loaded up front when a feature which needs the session data
+// before the handler runs is enabled.
+func (s *Session) lazy() bool {
+	return s.Lazy && len(s.ForwardKeys) == 0 && s.CookielessHandler == nil && s.ExpiredHandler == nil
+}
+
+func addLazyCacheToRequestContext(r *http.Request, l *lazyCache) *http.Request {
+	ctx := context.WithValue(r.Context(), contextKeyCache, l)
+	r = r.WithContext(ctx)
+	l.request = r
+	return r
+}
+
+// cacheFromContext returns the session carried by the context, loading it if
+// it is being loaded lazily.
+func cacheFromContext(ctx context.Context) (*cache, bool) {
+	switch v := ctx.Value(contextKeyCache).(type) {
+	case *cache:
+		return v, true
+	case *lazyCache:
+		return v.get(), true
+	}
+	return nil, false
+}
@@ -0,0 +1,109 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLazy(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Lazy = true
+	m := &testMetrics{}
+	s.Metrics = m
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+	if cookie == "" {
+		t.Fatal("got no cookie: expected a session cookie")
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("untouched"))
+	})
+	body, setCookie := testRequest(t, s.Enable(h), cookie)
+	if body != "untouched" {
+		t.Errorf("got %q: expected %q", body, "untouched")
+	}
+	if setCookie != "" {
+		t.Errorf("got %q: expected no cookie", setCookie)
+	}
+	if m.loaded != 0 {
+		t.Errorf("got %d: expected %d", m.loaded, 0)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(s.GetString(r, "foo")))
+	})
+	body, _ = testRequest(t, s.Enable(h), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+	if m.loaded != 1 {
+		t.Errorf("got %d: expected %d", m.loaded, 1)
+	}
+}
+
+func TestLazyInvalidCookie(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Lazy = true
+	m := &testMetrics{}
+	s.Metrics = m
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("untouched"))
+	})
+	testRequest(t, s.Enable(h), "session=invalid")
+	if m.invalid != 0 {
+		t.Errorf("got %d: expected %d", m.invalid, 0)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(s.GetString(r, "foo")))
+	})
+	body, _ := testRequest(t, s.Enable(h), "session=invalid")
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+	if m.invalid != 1 {
+		t.Errorf("got %d: expected %d", m.invalid, 1)
+	}
+}
+
+func TestLazyDisabled(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Lazy = true
+	s.ForwardKeys = []string{"foo"}
+
+	if s.lazy() {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+}
+
+func TestSkip(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Skip = func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, "/static/")
+	}
+
+	var skipped bool
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := cacheFromContext(r.Context())
+		skipped = !ok
+	})
+
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/static/app.css", nil))
+	if !skipped {
+		t.Errorf("got %v: expected %v", skipped, true)
+	}
+
+	rr = httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if skipped {
+		t.Errorf("got %v: expected %v", skipped, false)
+	}
+}
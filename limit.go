@@ -0,0 +1,127 @@
+package sessions
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimiterMaxClients is the number of clients a RateLimiter created with
+// NewRateLimiter tracks, which limits the memory it uses.
+const rateLimiterMaxClients = 10000
+
+// Limiter is the interface for limiting how often new sessions are issued.
+// Allow is called each time a new session is about to be saved, and reports
+// whether the client making the request may be issued it.
+type Limiter interface {
+	Allow(r *http.Request) bool
+}
+
+type rateLimiterEntry struct {
+	client string
+	count  int
+	start  time.Time
+}
+
+// RateLimiter is a Limiter which allows each client IP address to be issued a
+// fixed number of new sessions in each window of time. The IP address is
+// taken from the request's RemoteAddr, so if your application is behind a
+// proxy you should use middleware which sets RemoteAddr from a trusted
+// forwarding header. Create one with NewRateLimiter.
+//
+// A RateLimiter tracks a bounded number of clients. When more clients than
+// that have been issued sessions within one window, the client whose window
+// started longest ago is forgotten to make room, and its count starts again
+// from zero. So an attacker who can send requests from more IP addresses than
+// the limiter tracks can get past it, but the limiter never grows without
+// bound. Use NewRateLimiterWithMaxClients to track more clients.
+type RateLimiter struct {
+	limit      int
+	window     time.Duration
+	maxClients int
+
+	mu      sync.Mutex
+	clients map[string]*list.Element
+	order   *list.List
+}
+
+// NewRateLimiter returns a RateLimiter which allows each client IP address to
+// be issued limit new sessions in every window. It tracks up to 10,000
+// clients.
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return NewRateLimiterWithMaxClients(limit, window, rateLimiterMaxClients)
+}
+
+// NewRateLimiterWithMaxClients returns a RateLimiter which allows each client
+// IP address to be issued limit new sessions in every window, and tracks up to
+// maxClients clients.
+func NewRateLimiterWithMaxClients(limit int, window time.Duration, maxClients int) *RateLimiter {
+	return &RateLimiter{
+		limit:      limit,
+		window:     window,
+		maxClients: maxClients,
+		clients:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Allow reports whether the client has been issued fewer than the limit of new
+// sessions in the current window, and if so counts the new session.
+func (l *RateLimiter) Allow(r *http.Request) bool {
+	client := newClientInfo(r).IP
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+
+	elem, ok := l.clients[client]
+	if !ok {
+		if l.order.Len() >= l.maxClients {
+			l.remove(l.order.Front())
+		}
+		elem = l.order.PushBack(&rateLimiterEntry{client: client, start: now})
+		l.clients[client] = elem
+	}
+	e := elem.Value.(*rateLimiterEntry)
+	if now.Sub(e.start) >= l.window {
+		e.count = 0
+		e.start = now
+		l.order.MoveToBack(elem)
+	}
+	if e.count >= l.limit {
+		return false
+	}
+	e.count++
+	return true
+}
+
+// prune removes clients whose window has ended. The clients are kept in the
+// order their windows started, so only the ended windows at the front are
+// visited. The caller must hold l.mu.
+func (l *RateLimiter) prune(now time.Time) {
+	for elem := l.order.Front(); elem != nil; elem = l.order.Front() {
+		if now.Sub(elem.Value.(*rateLimiterEntry).start) < l.window {
+			return
+		}
+		l.remove(elem)
+	}
+}
+
+// remove stops tracking the client. The caller must hold l.mu.
+func (l *RateLimiter) remove(elem *list.Element) {
+	l.order.Remove(elem)
+	delete(l.clients, elem.Value.(*rateLimiterEntry).client)
+}
+
+// limitCreation reports whether a new session must not be saved, because the
+// CreationLimiter doesn't allow the client to be issued one. The caller must
+// hold c.mu.
+func (s *Session) limitCreation(r *http.Request, c *cache) bool {
+	if s.CreationLimiter == nil || !c.isNew || c.destroyed {
+		return false
+	}
+	return !s.CreationLimiter.Allow(r)
+}
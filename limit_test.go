@@ -0,0 +1,107 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCreationLimiter(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.CreationLimiter = NewRateLimiter(2, time.Hour)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		w.Write([]byte("ok"))
+	})
+
+	var cookies []string
+	for i := 0; i < 3; i++ {
+		body, cookie := testRequest(t, s.Enable(h), "")
+		if body != "ok" {
+			t.Errorf("got %q: expected %q", body, "ok")
+		}
+		cookies = append(cookies, cookie)
+	}
+	if cookies[0] == "" || cookies[1] == "" {
+		t.Errorf("expected the first two sessions to be issued")
+	}
+	if cookies[2] != "" {
+		t.Errorf("got %q: expected %q", cookies[2], "")
+	}
+
+	_, cookie := testRequest(t, s.Enable(h), cookies[0])
+	if cookie == "" {
+		t.Errorf("expected an existing session to be saved")
+	}
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.2:1234"
+	s.Enable(h).ServeHTTP(rr, r)
+	if rr.Header().Get("Set-Cookie") == "" {
+		t.Errorf("expected a session to be issued to a different client")
+	}
+}
+
+func TestRateLimiterWindow(t *testing.T) {
+	l := NewRateLimiter(1, time.Minute)
+	r := httptest.NewRequest("GET", "/", nil)
+
+	if !l.Allow(r) {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+	if l.Allow(r) {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+
+	l.clients["192.0.2.1"].Value.(*rateLimiterEntry).start = time.Now().Add(-time.Minute)
+	if !l.Allow(r) {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+}
+
+func TestRateLimiterMaxClients(t *testing.T) {
+	l := NewRateLimiterWithMaxClients(1, time.Minute, 2)
+	request := func(ip string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = ip + ":1234"
+		return r
+	}
+
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+		if !l.Allow(request(ip)) {
+			t.Errorf("got %v: expected %v", false, true)
+		}
+	}
+
+	// A third client evicts the client whose window started first, and the
+	// limiter stays within its bound.
+	if !l.Allow(request("192.0.2.3")) {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+	if len(l.clients) != 2 || l.order.Len() != 2 {
+		t.Errorf("got %d: expected %d", len(l.clients), 2)
+	}
+	if _, ok := l.clients["192.0.2.1"]; ok {
+		t.Errorf("got %v: expected %v", ok, false)
+	}
+	if l.Allow(request("192.0.2.2")) {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+	if l.Allow(request("192.0.2.3")) {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+
+	// Clients whose window has ended are pruned from the front.
+	for _, elem := range l.clients {
+		elem.Value.(*rateLimiterEntry).start = time.Now().Add(-time.Minute)
+	}
+	if !l.Allow(request("192.0.2.4")) {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+	if len(l.clients) != 1 {
+		t.Errorf("got %d: expected %d", len(l.clients), 1)
+	}
+}
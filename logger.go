@@ -0,0 +1,66 @@
+package sessions
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Logger is the interface for structured logging of session errors. It is
+// satisfied by *slog.Logger, and is easily adapted to other structured
+// loggers such as zap. Error is passed a message followed by alternating keys
+// and values.
+type Logger interface {
+	Error(msg string, args ...interface{})
+}
+
+// errorKinds names the sentinel errors for logging.
+var errorKinds = []struct {
+	err  error
+	name string
+}{
+	{ErrDecodeFailed, "decode"},
+	{ErrEncodeFailed, "encode"},
+	{ErrEncryptFailed, "encrypt"},
+	{ErrStoreFailed, "store"},
+	{ErrCookieTooLong, "cookie_too_long"},
+}
+
+// errorKind returns the name of the kind of error, or "other".
+func errorKind(err error) string {
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind.err) {
+			return kind.name
+		}
+	}
+	return "other"
+}
+
+// handleError logs the error with the Logger, if one is set, and then calls
+// the ErrorHandler.
+func (s *Session) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	s.logError(r, "session error", err)
+	s.ErrorHandler(w, r, err)
+}
+
+// logError logs the error with the Logger, along with the request method and
+// path, and the phase and kind of the error. It does nothing if no Logger is
+// set.
+func (s *Session) logError(r *http.Request, msg string, err error) {
+	if s.Logger == nil {
+		return
+	}
+
+	phase := "unknown"
+	var serr *Error
+	if errors.As(err, &serr) && serr.Phase != 0 {
+		phase = serr.Phase.String()
+	}
+
+	s.Logger.Error(msg,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"phase", phase,
+		"kind", errorKind(err),
+		"error", err.Error(),
+	)
+}
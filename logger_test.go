@@ -0,0 +1,64 @@
+package sessions
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testLogger struct {
+	msg  string
+	args []interface{}
+}
+
+func (l *testLogger) Error(msg string, args ...interface{}) {
+	l.msg = msg
+	l.args = args
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	l := &testLogger{}
+	s.Logger = l
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "big", strings.Repeat("x", 5000))
+	})
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("POST", "/profile", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusInternalServerError)
+	}
+	expected := []interface{}{
+		"method", "POST",
+		"path", "/profile",
+		"phase", "save",
+		"kind", "cookie_too_long",
+		"error", ErrCookieTooLong.Error(),
+	}
+	if l.msg != "session error" {
+		t.Errorf("got %q: expected %q", l.msg, "session error")
+	}
+	if !reflect.DeepEqual(l.args, expected) {
+		t.Errorf("got %v: expected %v", l.args, expected)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("got %q: expected nothing written to the standard logger", buf.String())
+	}
+
+	s.Store = failingStore{}
+	testRequest(t, s.Enable(h), "session=abc")
+	if l.args[5] != "load" || l.args[7] != "store" {
+		t.Errorf("got %v: expected a load store error", l.args)
+	}
+}
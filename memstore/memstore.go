@@ -0,0 +1,183 @@
+// Package memstore provides an in-memory session store for use with the
+// github.com/golangcollege/sessions package. Session data is lost when the
+// process exits, and isn't shared between processes, so it is most useful for
+// development, testing and single-instance deployments.
+package memstore
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type item struct {
+	b      []byte
+	expiry time.Time
+}
+
+// MemStore represents the session store.
+type MemStore struct {
+	items       map[string]item
+	mu          sync.RWMutex
+	stopCleanup chan bool
+	stopped     chan bool
+	stopOnce    sync.Once
+}
+
+// New returns a new MemStore instance, with a background cleanup goroutine that
+// runs every minute to remove expired session data.
+func New() *MemStore {
+	return NewWithCleanupInterval(time.Minute)
+}
+
+// NewWithCleanupInterval returns a new MemStore instance. The cleanupInterval
+// parameter controls how frequently expired session data is removed by the
+// background cleanup goroutine. Setting it to 0 prevents the cleanup goroutine
+// from running (i.e. expired sessions will not be removed).
+func NewWithCleanupInterval(cleanupInterval time.Duration) *MemStore {
+	m := &MemStore{
+		items: make(map[string]item),
+	}
+
+	if cleanupInterval > 0 {
+		m.stopCleanup = make(chan bool)
+		m.stopped = make(chan bool)
+		go m.startCleanup(cleanupInterval)
+	}
+
+	return m
+}
+
+// Find returns the data for a given session token from the MemStore instance.
+// If the session token is not found or is expired, the returned found value
+// will be false.
+func (m *MemStore) Find(token string) ([]byte, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	it, found := m.items[token]
+	if !found || time.Now().After(it.expiry) {
+		return nil, false, nil
+	}
+	return it.b, true, nil
+}
+
+// Commit adds a session token and data to the MemStore instance with the given
+// expiry time. If the session token already exists, then the data and expiry
+// time are updated.
+func (m *MemStore) Commit(token string, b []byte, expiry time.Time) error {
+	m.mu.Lock()
+	m.items[token] = item{b: b, expiry: expiry}
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Delete removes a session token and corresponding data from the MemStore
+// instance.
+func (m *MemStore) Delete(token string) error {
+	m.mu.Lock()
+	delete(m.items, token)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// FindMany returns the data for each of the given session tokens which is in
+// the MemStore instance and hasn't expired, keyed by token.
+func (m *MemStore) FindMany(tokens []string) (map[string][]byte, error) {
+	now := time.Now()
+	found := make(map[string][]byte, len(tokens))
+	m.mu.RLock()
+	for _, token := range tokens {
+		it, ok := m.items[token]
+		if ok && !now.After(it.expiry) {
+			found[token] = it.b
+		}
+	}
+	m.mu.RUnlock()
+	return found, nil
+}
+
+// List returns up to limit session tokens from the MemStore instance, in
+// order, after the cursor, which is the last token of the previous page. The
+// returned next cursor is "" after the last page. If limit isn't positive, all
+// of the tokens are returned. Expired sessions are left out.
+func (m *MemStore) List(cursor string, limit int) ([]string, string, error) {
+	now := time.Now()
+	m.mu.RLock()
+	tokens := make([]string, 0, len(m.items))
+	for token, it := range m.items {
+		if token > cursor && !now.After(it.expiry) {
+			tokens = append(tokens, token)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Strings(tokens)
+	if limit <= 0 || len(tokens) <= limit {
+		return tokens, "", nil
+	}
+	return tokens[:limit], tokens[limit-1], nil
+}
+
+// Count returns the number of unexpired sessions in the MemStore instance.
+func (m *MemStore) Count() (int, error) {
+	now := time.Now()
+	n := 0
+	m.mu.RLock()
+	for _, it := range m.items {
+		if !now.After(it.expiry) {
+			n++
+		}
+	}
+	m.mu.RUnlock()
+	return n, nil
+}
+
+// StopCleanup terminates the background cleanup goroutine for the MemStore
+// instance. It's rare to terminate this; generally MemStore instances and
+// their cleanup goroutines are intended to be long-lived and run for the
+// lifetime of your application. StopCleanup waits for a cleanup which is in
+// progress to finish, and can safely be called more than once.
+func (m *MemStore) StopCleanup() {
+	if m.stopCleanup == nil {
+		return
+	}
+	m.stopOnce.Do(func() {
+		close(m.stopCleanup)
+	})
+	<-m.stopped
+}
+
+// Close stops the background cleanup goroutine. It always returns nil, and
+// lets Session.Close() shut the MemStore down along with the session.
+func (m *MemStore) Close() error {
+	m.StopCleanup()
+	return nil
+}
+
+func (m *MemStore) startCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer close(m.stopped)
+	for {
+		select {
+		case <-ticker.C:
+			m.deleteExpired()
+		case <-m.stopCleanup:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+func (m *MemStore) deleteExpired() {
+	now := time.Now()
+	m.mu.Lock()
+	for token, it := range m.items {
+		if now.After(it.expiry) {
+			delete(m.items, token)
+		}
+	}
+	m.mu.Unlock()
+}
@@ -0,0 +1,183 @@
+package memstore
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golangcollege/sessions/storetest"
+)
+
+func TestFind(t *testing.T) {
+	m := NewWithCleanupInterval(0)
+	m.items["session_token"] = item{b: []byte("encoded_data"), expiry: time.Now().Add(time.Minute)}
+
+	b, found, err := m.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != true {
+		t.Fatalf("got %v: expected %v", found, true)
+	}
+	if bytes.Equal(b, []byte("encoded_data")) == false {
+		t.Fatalf("got %v: expected %v", b, []byte("encoded_data"))
+	}
+}
+
+func TestFindMissing(t *testing.T) {
+	m := NewWithCleanupInterval(0)
+
+	_, found, err := m.Find("missing_session_token")
+	if err != nil {
+		t.Fatalf("got %v: expected %v", err, nil)
+	}
+	if found != false {
+		t.Fatalf("got %v: expected %v", found, false)
+	}
+}
+
+func TestFindExpired(t *testing.T) {
+	m := NewWithCleanupInterval(0)
+	m.items["session_token"] = item{b: []byte("encoded_data"), expiry: time.Now().Add(-time.Minute)}
+
+	_, found, err := m.Find("session_token")
+	if err != nil {
+		t.Fatalf("got %v: expected %v", err, nil)
+	}
+	if found != false {
+		t.Fatalf("got %v: expected %v", found, false)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	m := NewWithCleanupInterval(0)
+
+	err := m.Commit("session_token", []byte("encoded_data"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	it, found := m.items["session_token"]
+	if found != true {
+		t.Fatalf("got %v: expected %v", found, true)
+	}
+	if bytes.Equal(it.b, []byte("encoded_data")) == false {
+		t.Fatalf("got %v: expected %v", it.b, []byte("encoded_data"))
+	}
+}
+
+func TestDelete(t *testing.T) {
+	m := NewWithCleanupInterval(0)
+	m.items["session_token"] = item{b: []byte("encoded_data"), expiry: time.Now().Add(time.Minute)}
+
+	err := m.Delete("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, found := m.items["session_token"]
+	if found != false {
+		t.Fatalf("got %v: expected %v", found, false)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	m := NewWithCleanupInterval(200 * time.Millisecond)
+	defer m.StopCleanup()
+
+	err := m.Commit("session_token", []byte("encoded_data"), time.Now().Add(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	m.mu.RLock()
+	_, found := m.items["session_token"]
+	m.mu.RUnlock()
+	if found != false {
+		t.Fatalf("got %v: expected %v", found, false)
+	}
+}
+
+func TestStopNilCleanup(t *testing.T) {
+	m := NewWithCleanupInterval(0)
+	time.Sleep(100 * time.Millisecond)
+	// A send to a nil channel will block forever
+	m.StopCleanup()
+}
+
+func TestClose(t *testing.T) {
+	m := NewWithCleanupInterval(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		err := m.Close()
+		if err != nil {
+			t.Errorf("got %v: expected %v", err, nil)
+		}
+	}
+
+	err := NewWithCleanupInterval(0).Close()
+	if err != nil {
+		t.Errorf("got %v: expected %v", err, nil)
+	}
+}
+
+func TestList(t *testing.T) {
+	m := NewWithCleanupInterval(0)
+	m.items["c"] = item{expiry: time.Now().Add(time.Minute)}
+	m.items["a"] = item{expiry: time.Now().Add(time.Minute)}
+	m.items["b"] = item{expiry: time.Now().Add(-time.Minute)}
+	m.items["d"] = item{expiry: time.Now().Add(time.Minute)}
+
+	var all []string
+	cursor := ""
+	for {
+		tokens, next, err := m.List(cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, tokens...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if !reflect.DeepEqual(all, []string{"a", "c", "d"}) {
+		t.Errorf("got %v: expected %v", all, []string{"a", "c", "d"})
+	}
+}
+
+func TestCount(t *testing.T) {
+	m := NewWithCleanupInterval(0)
+	m.items["a"] = item{expiry: time.Now().Add(time.Minute)}
+	m.items["b"] = item{expiry: time.Now().Add(-time.Minute)}
+	m.items["c"] = item{expiry: time.Now().Add(time.Minute)}
+
+	n, err := m.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got %d: expected %d", n, 2)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, NewWithCleanupInterval(0))
+}
+
+func TestFindMany(t *testing.T) {
+	m := NewWithCleanupInterval(0)
+	m.items["a"] = item{b: []byte("a"), expiry: time.Now().Add(time.Minute)}
+	m.items["b"] = item{b: []byte("b"), expiry: time.Now().Add(-time.Minute)}
+
+	found, err := m.FindMany([]string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(found, map[string][]byte{"a": []byte("a")}) {
+		t.Errorf("got %v: expected %v", found, map[string][]byte{"a": []byte("a")})
+	}
+}
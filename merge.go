@@ -0,0 +1,101 @@
+package sessions
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// merge folds the changes made to the session data during the request into
+// the data currently held in the Store, if another request for the same
+// session has saved it since it was loaded. Keys which this request added,
+// changed or removed take its values, and all other keys keep the values in
+// the Store. Keys which both requests changed are passed to OnConflict. If
+// the session in the Store can't be decoded, an error wrapping
+// ErrDecodeFailed is returned rather than overwriting data which can't be
+// merged.
+//
+// The Store is read and then written in two separate operations, with no
+// compare-and-swap, so two requests which save at the same moment can both
+// read the same revision, both skip the merge, and the last to write wins.
+// The caller must hold c.mu.
+func (s *Session) merge(r *http.Request, c *cache) error {
+	if !s.MergeConcurrent || !c.snapshotted || c.isNew {
+		return nil
+	}
+	token := c.token
+	if token == "" {
+		token = c.oldToken
+	}
+	if token == "" {
+		return nil
+	}
+
+	b, found, err := s.storeFind(s.Store, token)
+	if err != nil {
+		return wrapError(ErrStoreFailed, err)
+	}
+	if !found {
+		return nil
+	}
+	stored := &cache{keys: c.keys}
+	err = stored.decode(s.codec(), s.ciphers(), string(b), s.decryptionKeys(stored))
+	if err == nil {
+		err = s.openFields(stored)
+	}
+	if err != nil {
+		return wrapError(ErrDecodeFailed, err)
+	}
+	if stored.Revision == c.Revision {
+		return nil
+	}
+
+	d := c.diff()
+	var conflicts []string
+	changed := func(key string) {
+		old, existed := c.original[key]
+		val, exists := stored.Data[key]
+		if existed != exists || !reflect.DeepEqual(old, val) {
+			conflicts = append(conflicts, key)
+		}
+	}
+
+	ours := make(map[string]bool, len(d.Added)+len(d.Changed)+len(d.Removed))
+	for _, key := range append(append(d.Added, d.Changed...), d.Removed...) {
+		changed(key)
+		ours[key] = true
+	}
+	for key, val := range stored.Data {
+		if ours[key] {
+			continue
+		}
+		c.Data[key] = val
+		if expiry, ok := stored.KeyExpiry[key]; ok {
+			if c.KeyExpiry == nil {
+				c.KeyExpiry = make(map[string]time.Time)
+			}
+			c.KeyExpiry[key] = expiry
+		} else {
+			delete(c.KeyExpiry, key)
+		}
+		if stored.secureKeys[key] {
+			if c.secureKeys == nil {
+				c.secureKeys = make(map[string]bool)
+			}
+			c.secureKeys[key] = true
+		}
+	}
+	for key := range c.Data {
+		if _, exists := stored.Data[key]; !exists && !ours[key] {
+			c.unset(key)
+		}
+	}
+	c.Revision = stored.Revision
+
+	if len(conflicts) > 0 && s.OnConflict != nil {
+		sort.Strings(conflicts)
+		s.OnConflict(r, conflicts)
+	}
+	return nil
+}
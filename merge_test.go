@@ -0,0 +1,126 @@
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golangcollege/sessions/memstore"
+)
+
+func TestMergeConcurrent(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = memstore.NewWithCleanupInterval(0)
+	s.MergeConcurrent = true
+
+	var conflicts []string
+	s.OnConflict = func(r *http.Request, keys []string) {
+		conflicts = keys
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "a", "1")
+		s.Put(r, "x", "0")
+		s.Put(r, "gone", "0")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	// The second request loads the session, and then the first request
+	// loads and saves it before the second request finishes.
+	first := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "b", "2")
+		s.Put(r, "x", "first")
+		s.Remove(r, "gone")
+	})
+	second := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "c", "3")
+		s.Put(r, "x", "second")
+		testRequest(t, s.Enable(first), cookie)
+	})
+	testRequest(t, s.Enable(second), cookie)
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.Keys(r), " ", s.GetString(r, "x"))
+	})
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "[a b c x] second" {
+		t.Errorf("got %q: expected %q", body, "[a b c x] second")
+	}
+	if !reflect.DeepEqual(conflicts, []string{"x"}) {
+		t.Errorf("got %v: expected %v", conflicts, []string{"x"})
+	}
+}
+
+func TestMergeConcurrentDisabled(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = memstore.NewWithCleanupInterval(0)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "a", "1")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	first := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "b", "2")
+	})
+	second := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "c", "3")
+		testRequest(t, s.Enable(first), cookie)
+	})
+	testRequest(t, s.Enable(second), cookie)
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.Keys(r))
+	})
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "[a c]" {
+		t.Errorf("got %q: expected %q", body, "[a c]")
+	}
+}
+
+func TestMergeConcurrentDecodeFailed(t *testing.T) {
+	store := memstore.NewWithCleanupInterval(0)
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = store
+	s.MergeConcurrent = true
+
+	var got error
+	s.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		got = err
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "a", "1")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+	tokens, _, err := store.List("", 0)
+	if err != nil || len(tokens) != 1 {
+		t.Fatalf("got %v, %v: expected one token", tokens, err)
+	}
+
+	// Another writer replaces the stored session with data which can't be
+	// decoded while the request is running.
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "b", "2")
+		err := store.Commit(tokens[0], []byte("corrupt"), time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	testRequest(t, s.Enable(h), cookie)
+	if !errors.Is(got, ErrDecodeFailed) {
+		t.Errorf("got %v: expected %v", got, ErrDecodeFailed)
+	}
+
+	b, _, err := store.Find(tokens[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "corrupt" {
+		t.Errorf("got %q: expected %q", b, "corrupt")
+	}
+}
@@ -0,0 +1,174 @@
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Metrics is the interface for instrumenting sessions, for example with
+// Prometheus counters and histograms. Its methods are called synchronously
+// while requests are being handled, so they should be fast and must be safe
+// for concurrent use.
+type Metrics interface {
+	// SessionLoaded is called by the Enable middleware when an existing
+	// session has been loaded from a request.
+	SessionLoaded()
+
+	// SessionCreated is called when a new session has been saved for the
+	// first time.
+	SessionCreated()
+
+	// InvalidToken is called when a request carries a session token which
+	// can't be authenticated, for example because it was encrypted with a
+	// retired key or has been tampered with.
+	InvalidToken()
+
+	// DecodeFailed is called when a session token was authenticated but the
+	// session data couldn't be decoded, for example because it was encoded
+	// with a different Codec or holds a type which is no longer registered.
+	DecodeFailed()
+
+	// CookieSize is called with the length in bytes of each session cookie
+	// before it is added to the response, including its attributes. Browsers
+	// only accept cookies up to 4096 bytes long.
+	CookieSize(n int)
+
+	// EncodeLatency is called with the time taken to encode and encrypt the
+	// session data each time it is saved.
+	EncodeLatency(d time.Duration)
+}
+
+// StoreMetrics can be implemented by a Metrics to instrument the session's
+// stores, so that (for example) Redis slowness which affects sessions can be
+// alerted on. It is optional, so that existing Metrics keep working.
+type StoreMetrics interface {
+	// StoreOperation is called after each call to the Find, Commit or Delete
+	// method of the Store or OversizeStore, and each call to the FindMany
+	// method of a BatchFinder, with the type of the store (such as
+	// "*redisstore.RedisStore"), the operation ("find", "commit", "delete" or
+	// "find_many"), how long it took and the error that it returned, if any.
+	StoreOperation(store, op string, d time.Duration, err error)
+}
+
+// DestroyMetrics can be implemented by a Metrics to count destroyed sessions
+// as well as created ones, so that the number of active sessions can be
+// estimated across all of your instances by subtracting one counter from the
+// other. It is optional, so that existing Metrics keep working.
+type DestroyMetrics interface {
+	// SessionDestroyed is called when an existing session has been
+	// destroyed, or replaced by a new session after being destroyed.
+	SessionDestroyed()
+}
+
+// Counter is implemented by stores which can count the sessions they hold,
+// such as memstore, slabstore and sqlstore. It is used by ActiveSessions().
+type Counter interface {
+	// Count returns the number of unexpired sessions in the store.
+	Count() (int, error)
+}
+
+// ErrCountUnsupported is returned by a Counter which wraps another Store,
+// such as an EncryptedStore, when the wrapped Store can't count its sessions.
+// ActiveSessions() falls back to its estimate instead.
+var ErrCountUnsupported = errors.New("session: the store can't count sessions")
+
+// sessionCounts counts the sessions created and destroyed by a Session.
+type sessionCounts struct {
+	mu        sync.Mutex
+	created   int64
+	destroyed int64
+}
+
+// ActiveSessions returns the number of active sessions, for a gauge in your
+// metrics. If the Store implements Counter, the count is exact and exact is
+// true. Otherwise, including for cookie-only sessions, it is an estimate: the
+// number of sessions this Session has created since it was initialized, less
+// the number it has destroyed. The estimate only covers this instance of your
+// application, counts sessions which expired without being destroyed until
+// the process restarts, and doesn't count sessions created before it started.
+// For an estimate across instances, use the SessionCreated and
+// SessionDestroyed counters of your Metrics instead.
+func (s *Session) ActiveSessions() (n int64, exact bool, err error) {
+	if c, ok := s.Store.(Counter); ok {
+		count, err := c.Count()
+		if err == nil {
+			return int64(count), true, nil
+		}
+		if !errors.Is(err, ErrCountUnsupported) {
+			return 0, false, err
+		}
+	}
+
+	s.counts.mu.Lock()
+	defer s.counts.mu.Unlock()
+	n = s.counts.created - s.counts.destroyed
+	if n < 0 {
+		n = 0
+	}
+	return n, false, nil
+}
+
+// observeStore reports a store operation which started at start to the
+// Metrics, if they implement StoreMetrics.
+func (s *Session) observeStore(st Store, op string, start time.Time, err error) {
+	m, ok := s.Metrics.(StoreMetrics)
+	if !ok {
+		return
+	}
+	m.StoreOperation(fmt.Sprintf("%T", st), op, time.Since(start), err)
+}
+
+// encode seals any sensitive fields, and then encodes and encrypts the session
+// data, reporting how long it took to the Metrics. The caller must hold c.mu.
+func (s *Session) encode(c *cache) (string, error) {
+	start := time.Now()
+
+	sealed, err := s.sealFields(c)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := sealed.encode(s.codec(), s.Compress, s.LegacyFormat, s.cipher(), s.encryptionKey(c), s.random())
+	if err != nil {
+		return "", err
+	}
+
+	if s.Metrics != nil {
+		s.Metrics.EncodeLatency(time.Since(start))
+	}
+	return token, nil
+}
+
+// countSessions counts a newly saved or destroyed session for
+// ActiveSessions(), and reports it to the Metrics.
+func (s *Session) countSessions(c *cache) {
+	c.mu.Lock()
+	saved := c.modified && !c.skipSave
+	created := saved && c.isNew && !c.destroyed
+	destroyed := saved && (c.restarted || (c.destroyed && !c.isNew))
+	c.mu.Unlock()
+
+	if !created && !destroyed {
+		return
+	}
+	s.counts.mu.Lock()
+	if created {
+		s.counts.created++
+	}
+	if destroyed {
+		s.counts.destroyed++
+	}
+	s.counts.mu.Unlock()
+
+	if s.Metrics == nil {
+		return
+	}
+	if created {
+		s.Metrics.SessionCreated()
+	}
+	if m, ok := s.Metrics.(DestroyMetrics); ok && destroyed {
+		m.SessionDestroyed()
+	}
+}
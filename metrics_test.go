@@ -0,0 +1,188 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golangcollege/sessions/memstore"
+)
+
+type testMetrics struct {
+	mu      sync.Mutex
+	loaded  int
+	created int
+	invalid int
+	failed  int
+	sizes   []int
+	encodes int
+}
+
+func (m *testMetrics) SessionLoaded()  { m.mu.Lock(); m.loaded++; m.mu.Unlock() }
+func (m *testMetrics) SessionCreated() { m.mu.Lock(); m.created++; m.mu.Unlock() }
+func (m *testMetrics) InvalidToken()   { m.mu.Lock(); m.invalid++; m.mu.Unlock() }
+func (m *testMetrics) DecodeFailed()   { m.mu.Lock(); m.failed++; m.mu.Unlock() }
+
+func (m *testMetrics) CookieSize(n int) {
+	m.mu.Lock()
+	m.sizes = append(m.sizes, n)
+	m.mu.Unlock()
+}
+
+func (m *testMetrics) EncodeLatency(d time.Duration) {
+	m.mu.Lock()
+	m.encodes++
+	m.mu.Unlock()
+}
+
+func TestMetrics(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	m := &testMetrics{}
+	s.Metrics = m
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+	_, cookie = testRequest(t, s.Enable(h), cookie)
+	testRequest(t, s.Enable(h), "session=invalid")
+
+	if m.loaded != 1 {
+		t.Errorf("got %d: expected %d", m.loaded, 1)
+	}
+	if m.created != 2 {
+		t.Errorf("got %d: expected %d", m.created, 2)
+	}
+	if m.invalid != 1 {
+		t.Errorf("got %d: expected %d", m.invalid, 1)
+	}
+	if m.encodes != 3 {
+		t.Errorf("got %d: expected %d", m.encodes, 3)
+	}
+	if len(m.sizes) != 3 || m.sizes[1] != len(cookie) {
+		t.Errorf("got %v: expected 3 sizes, the second %d", m.sizes, len(cookie))
+	}
+
+	other := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	other.Codec = JSONCodec{}
+	other.LegacyFormat = true
+	_, cookie = testRequest(t, other.Enable(h), "")
+	testRequest(t, s.Enable(h), cookie)
+	if m.failed != 1 {
+		t.Errorf("got %d: expected %d", m.failed, 1)
+	}
+}
+
+type storeOp struct {
+	store, op string
+	err       error
+}
+
+type testStoreMetrics struct {
+	testMetrics
+	ops []storeOp
+}
+
+func (m *testStoreMetrics) StoreOperation(store, op string, d time.Duration, err error) {
+	m.mu.Lock()
+	m.ops = append(m.ops, storeOp{store, op, err})
+	m.mu.Unlock()
+}
+
+func TestStoreMetrics(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = memstore.NewWithCleanupInterval(0)
+	m := &testStoreMetrics{}
+	s.Metrics = m
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/destroy" {
+			s.Destroy(r)
+			return
+		}
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/destroy", nil)
+	r.Header.Set("Cookie", cookie)
+	s.Enable(h).ServeHTTP(rr, r)
+
+	expected := []storeOp{
+		{"*memstore.MemStore", "commit", nil},
+		{"*memstore.MemStore", "find", nil},
+		{"*memstore.MemStore", "delete", nil},
+	}
+	if !reflect.DeepEqual(m.ops, expected) {
+		t.Errorf("got %v: expected %v", m.ops, expected)
+	}
+}
+
+type destroyMetrics struct {
+	testMetrics
+	destroyed int
+}
+
+func (m *destroyMetrics) SessionDestroyed() { m.mu.Lock(); m.destroyed++; m.mu.Unlock() }
+
+func TestActiveSessions(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	m := &destroyMetrics{}
+	s.Metrics = m
+
+	put := s.Enable(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	}))
+	destroy := s.Enable(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Destroy(r)
+	}))
+	restart := s.Enable(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Destroy(r)
+		s.Put(r, "foo", "baz")
+	}))
+
+	_, cookie := testRequest(t, put, "")
+	testRequest(t, put, "")
+	testRequest(t, put, cookie)
+	testRequest(t, destroy, cookie)
+	testRequest(t, restart, cookie)
+
+	n, exact, err := s.ActiveSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || exact {
+		t.Errorf("got %d, %v: expected %d, %v", n, exact, 1, false)
+	}
+	if m.created != 3 || m.destroyed != 2 {
+		t.Errorf("got %d, %d: expected %d, %d", m.created, m.destroyed, 3, 2)
+	}
+
+	s = New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = memstore.NewWithCleanupInterval(0)
+	put = s.Enable(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	}))
+	testRequest(t, put, "")
+	testRequest(t, put, "")
+	n, exact, err = s.ActiveSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || !exact {
+		t.Errorf("got %d, %v: expected %d, %v", n, exact, 2, true)
+	}
+
+	s.Store = NewEncryptedStore(struct{ Store }{memstore.NewWithCleanupInterval(0)}, []byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	n, exact, err = s.ActiveSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || exact {
+		t.Errorf("got %d, %v: expected %d, %v", n, exact, 2, false)
+	}
+}
@@ -0,0 +1,94 @@
+package sessions
+
+import "net/http"
+
+// MigrationFunc upgrades session data from one schema version to the next, by
+// modifying the data in place.
+type MigrationFunc func(data map[string]interface{}) error
+
+// migrate runs any migrations needed to bring the session data up to the
+// current SchemaVersion. If a migration returns an error then the error is
+// returned and the session data should be discarded.
+func (s *Session) migrate(c *cache) error {
+	if c.Version >= s.SchemaVersion {
+		return nil
+	}
+
+	for v := c.Version; v < s.SchemaVersion; v++ {
+		fn, ok := s.Migrations[v]
+		if !ok {
+			continue
+		}
+		err := fn(c.Data)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.Version = s.SchemaVersion
+	c.modified = true
+	return nil
+}
+
+// Migrate arranges for the current session to be saved using the
+// configuration of dst, rather than s, at the end of the request. This moves
+// the session to dst's cookie attributes (such as Path and Domain), keys,
+// Cipher, Codec and Store without logging the user out. Once the session has
+// been saved, the old session cookie is deleted if its Path or Domain was
+// different, and the session data is deleted from s's Store if there is one.
+//
+// Migrate only moves sessions which are seen by s. To move every session
+// while the application is serving requests with dst's middleware, set dst's
+// MigrateFrom field instead.
+func (s *Session) Migrate(r *http.Request, dst *Session) {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	c.migrateTo = dst
+	c.modified = true
+	c.mu.Unlock()
+}
+
+// loadMigrated loads the session from MigrateFrom, for a request with a
+// session token which s couldn't use. It returns nil if MigrateFrom can't use
+// the token either.
+func (s *Session) loadMigrated(r *http.Request, reload bool) *cache {
+	src := s.MigrateFrom
+	if src == nil || src == s {
+		return nil
+	}
+
+	c, err := src.loadToken(r, reload)
+	if err != nil || c.isNew || c.rejected {
+		return nil
+	}
+	c.migrateFrom = src
+	c.modified = true
+	return c
+}
+
+// finishMigration deletes the old session cookie and any session data left in
+// the old Store after a session which was loaded by another Session has been
+// saved by s. The caller must hold c.mu.
+func (s *Session) finishMigration(w http.ResponseWriter, r *http.Request, c *cache, oldTokens []string) error {
+	src := c.migrateFrom
+	if src == nil {
+		return nil
+	}
+	c.migrateFrom = nil
+
+	for _, token := range oldTokens {
+		if token == "" {
+			continue
+		}
+		err := src.storeDelete(src.Store, token)
+		if err != nil {
+			return wrapError(ErrStoreFailed, err)
+		}
+	}
+
+	if src.Transport == nil && (s.Transport != nil || src.cookieName() != s.cookieName() || src.Path != s.Path || src.Domain != s.Domain) {
+		src.deleteToken(w, r)
+	}
+	return nil
+}
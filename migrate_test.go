@@ -0,0 +1,153 @@
+package sessions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golangcollege/sessions/memstore"
+)
+
+func TestMigrations(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "user_id", 42)
+	})
+
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	s.SchemaVersion = 2
+	s.Migrations[0] = func(data map[string]interface{}) error {
+		data["userID"] = data["user_id"]
+		delete(data, "user_id")
+		return nil
+	}
+	s.Migrations[1] = func(data map[string]interface{}) error {
+		data["userID"] = int64(data["userID"].(int))
+		return nil
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%v %T", s.Keys(r), s.Get(r, "userID"))
+	})
+
+	body, newCookie := testRequest(t, s.Enable(h), cookie)
+	if body != "[userID] int64" {
+		t.Errorf("got %q: expected %q", body, "[userID] int64")
+	}
+	if newCookie == "" {
+		t.Errorf("expected the migrated session to be saved")
+	}
+
+	body, newCookie = testRequest(t, s.Enable(h), newCookie)
+	if body != "[userID] int64" {
+		t.Errorf("got %q: expected %q", body, "[userID] int64")
+	}
+	if newCookie != "" {
+		t.Errorf("got %q: expected %q", newCookie, "")
+	}
+
+	s.Migrations[1] = func(data map[string]interface{}) error {
+		return errors.New("boom")
+	}
+
+	body, _ = testRequest(t, s.Enable(h), cookie)
+	if body != "[] <nil>" {
+		t.Errorf("got %q: expected %q", body, "[] <nil>")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	src := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	dst := New([]byte("9y5Vlur8YvODJEhgOY8m9JVE4u46IpCV"))
+	dst.Path = "/app"
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cookie") == "" {
+			src.Put(r, "foo", "bar")
+			return
+		}
+		src.Migrate(r, dst)
+	})
+	_, cookie := testRequest(t, src.Enable(h), "")
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", cookie)
+	src.Enable(h).ServeHTTP(rr, r)
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 2 {
+		t.Fatalf("got %d: expected %d", len(cookies), 2)
+	}
+	if cookies[0].Path != "/app" || cookies[0].MaxAge <= 0 {
+		t.Errorf("got %q: expected a new session cookie for /app", cookies[0])
+	}
+	if cookies[1].Path != "/" || cookies[1].MaxAge >= 0 {
+		t.Errorf("got %q: expected the old session cookie to be deleted", cookies[1])
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, dst.GetString(r, "foo"))
+	})
+	body, _ := testRequest(t, dst.Enable(h), cookies[0].String())
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+}
+
+func TestMigrateFrom(t *testing.T) {
+	src := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	store := memstore.NewWithCleanupInterval(0)
+	dst := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	dst.Store = store
+	dst.MigrateFrom = src
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		src.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, src.Enable(h), "")
+
+	get := func(s *Session) http.Handler {
+		return s.Enable(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, s.GetString(r, "foo"))
+		}))
+	}
+	body, cookie := testRequest(t, get(dst), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+
+	token := strings.TrimPrefix(strings.SplitN(cookie, ";", 2)[0], cookieName+"=")
+	_, found, err := store.Find(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Errorf("got %v: expected %v", found, true)
+	}
+
+	// Moving back from the store to cookies deletes the data from the store.
+	back := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	back.MigrateFrom = dst
+	body, cookie = testRequest(t, get(back), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+	_, found, err = store.Find(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Errorf("got %v: expected %v", found, false)
+	}
+
+	body, _ = testRequest(t, get(src), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+}
@@ -0,0 +1,144 @@
+package sessions
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+)
+
+// errMigrateVerify is returned, wrapping ErrStoreFailed, when session data
+// which MigrateStore committed to the destination store can't be read back.
+var errMigrateVerify = errors.New("session: migrated session data doesn't match")
+
+// MigrateStoreOptions configures MigrateStore.
+type MigrateStoreOptions struct {
+	// PageSize is the number of session tokens which are listed from the
+	// source Store at a time. The default is 1000.
+	PageSize int
+
+	// DeleteSource deletes each session from the source Store once its copy
+	// has been verified.
+	DeleteSource bool
+}
+
+// MigrateStoreResult counts the sessions seen by MigrateStore.
+type MigrateStoreResult struct {
+	// Copied is the number of sessions which were copied and verified.
+	Copied int
+
+	// Skipped is the number of sessions which weren't copied, because they
+	// were already in the destination store, had expired, couldn't be
+	// decoded with the session's keys, or were changed or deleted in the
+	// source Store while they were being copied.
+	Skipped int
+}
+
+// MigrateStore copies every live session from the session's Store to dst,
+// keeping their tokens, data and expiry times, so that the application can
+// move to another backend (such as from Redis to PostgreSQL) without logging
+// anyone out. The session's Store must implement Lister, or
+// ErrListUnsupported is returned. Each copy is read back from dst to verify
+// it. MigrateStore stops early if ctx is done, and can be run again to carry
+// on.
+//
+// Sessions which are changed in the source Store after they have been copied
+// aren't copied again, so switch the application to dst first, with a Session
+// whose MigrateFrom is the old Session, and then run MigrateStore with the
+// old Session. Sessions which the application moves while MigrateStore is
+// running are skipped, and a copy is deleted again if the session was changed
+// or deleted in the source Store while it was being copied.
+func (s *Session) MigrateStore(ctx context.Context, dst Store, opts MigrateStoreOptions) (MigrateStoreResult, error) {
+	var result MigrateStoreResult
+	l, ok := s.Store.(Lister)
+	if !ok {
+		return result, ErrListUnsupported
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = 1000
+	}
+
+	cursor := ""
+	for {
+		tokens, next, err := l.List(cursor, opts.PageSize)
+		if err != nil {
+			return result, wrapError(ErrStoreFailed, err)
+		}
+		for _, token := range tokens {
+			err = ctx.Err()
+			if err != nil {
+				return result, err
+			}
+			copied, err := s.migrateToken(dst, token, opts.DeleteSource)
+			if err != nil {
+				return result, err
+			}
+			if copied {
+				result.Copied++
+			} else {
+				result.Skipped++
+			}
+		}
+		if next == "" {
+			return result, nil
+		}
+		cursor = next
+	}
+}
+
+// migrateToken copies the session with the given token to dst, and reports
+// whether it was copied.
+func (s *Session) migrateToken(dst Store, token string, deleteSource bool) (bool, error) {
+	b, found, err := s.storeFind(s.Store, token)
+	if err != nil {
+		return false, wrapError(ErrStoreFailed, err)
+	}
+	if !found {
+		return false, nil
+	}
+	c := &cache{}
+	if s.decodeStored(c, token, b) != nil || !time.Now().Before(c.Expiry) {
+		return false, nil
+	}
+
+	_, found, err = s.storeFind(dst, token)
+	if err != nil {
+		return false, wrapError(ErrStoreFailed, err)
+	}
+	if found {
+		return false, nil
+	}
+	err = s.storeCommit(dst, token, b, c.Expiry)
+	if err != nil {
+		return false, wrapError(ErrStoreFailed, err)
+	}
+	copied, found, err := s.storeFind(dst, token)
+	if err != nil {
+		return false, wrapError(ErrStoreFailed, err)
+	}
+	if !found || !bytes.Equal(copied, b) {
+		return false, wrapError(ErrStoreFailed, errMigrateVerify)
+	}
+
+	// Undo the copy if the session changed while it was being copied, as
+	// the application may have moved or revoked it in the meantime.
+	current, found, err := s.storeFind(s.Store, token)
+	if err != nil {
+		return false, wrapError(ErrStoreFailed, err)
+	}
+	if !found || !bytes.Equal(current, b) {
+		err = s.storeDelete(dst, token)
+		if err != nil {
+			return false, wrapError(ErrStoreFailed, err)
+		}
+		return false, nil
+	}
+
+	if deleteSource {
+		err = s.storeDelete(s.Store, token)
+		if err != nil {
+			return false, wrapError(ErrStoreFailed, err)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,99 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golangcollege/sessions/memstore"
+)
+
+// corruptStore is a Store which commits different data than it was given.
+type corruptStore struct {
+	*memstore.MemStore
+}
+
+func (cs corruptStore) Commit(token string, b []byte, expiry time.Time) error {
+	return cs.MemStore.Commit(token, append(b, 'x'), expiry)
+}
+
+func TestMigrateStore(t *testing.T) {
+	src := memstore.NewWithCleanupInterval(0)
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = src
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	var cookies []string
+	for i := 0; i < 3; i++ {
+		_, cookie := testRequest(t, s.Enable(h), "")
+		cookies = append(cookies, cookie)
+	}
+	err := src.Commit("undecodable", []byte("garbage"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := memstore.NewWithCleanupInterval(0)
+	result, err := s.MigrateStore(context.Background(), dst, MigrateStoreOptions{PageSize: 2, DeleteSource: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (MigrateStoreResult{Copied: 3, Skipped: 1}) {
+		t.Errorf("got %+v: expected %+v", result, MigrateStoreResult{Copied: 3, Skipped: 1})
+	}
+	n, _ := src.Count()
+	if n != 1 {
+		t.Errorf("got %d: expected %d", n, 1)
+	}
+
+	// The sessions can be loaded from the new store.
+	s.Store = dst
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+	for _, cookie := range cookies {
+		body, _ := testRequest(t, s.Enable(h), cookie)
+		if body != "bar" {
+			t.Errorf("got %q: expected %q", body, "bar")
+		}
+	}
+
+	// Running it again skips the sessions which are already there.
+	result, err = s.MigrateStore(context.Background(), memstore.NewWithCleanupInterval(0), MigrateStoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Copied != 3 {
+		t.Errorf("got %d: expected %d", result.Copied, 3)
+	}
+	result, err = s.MigrateStore(context.Background(), dst, MigrateStoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (MigrateStoreResult{Skipped: 3}) {
+		t.Errorf("got %+v: expected %+v", result, MigrateStoreResult{Skipped: 3})
+	}
+
+	_, err = s.MigrateStore(context.Background(), corruptStore{memstore.NewWithCleanupInterval(0)}, MigrateStoreOptions{})
+	if !errors.Is(err, errMigrateVerify) {
+		t.Errorf("got %v: expected %v", err, errMigrateVerify)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.MigrateStore(ctx, memstore.NewWithCleanupInterval(0), MigrateStoreOptions{})
+	if err != context.Canceled {
+		t.Errorf("got %v: expected %v", err, context.Canceled)
+	}
+
+	s.Store = struct{ Store }{dst}
+	_, err = s.MigrateStore(context.Background(), memstore.NewWithCleanupInterval(0), MigrateStoreOptions{})
+	if err != ErrListUnsupported {
+		t.Errorf("got %v: expected %v", err, ErrListUnsupported)
+	}
+}
@@ -2,10 +2,74 @@ package sessions
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
 	"time"
 )
 
+// MockRequest returns a copy of r with a new, empty session in its context, so
+// that handlers which use the session can be called without the Enable
+// middleware in tests. See also the sessionstest package.
 func MockRequest(r *http.Request) *http.Request {
 	c := newCache(time.Hour)
+	c.checkpoint()
 	return addCacheToRequestContext(r, c)
 }
+
+// MockAgent runs requests through a session's Enable middleware and records
+// the responses, carrying the session cookie from each response over to the
+// next request in the same way that a browser would. It is intended for use in
+// tests. For example:
+//
+//	agent := sessions.NewMockAgent(session)
+//	agent.Do(putHandler, httptest.NewRequest("GET", "/put", nil))
+//	rr := agent.Do(getHandler, httptest.NewRequest("GET", "/get", nil))
+type MockAgent struct {
+	session *Session
+	cookies map[string]*http.Cookie
+}
+
+// NewMockAgent returns a new MockAgent for the given session.
+func NewMockAgent(s *Session) *MockAgent {
+	return &MockAgent{session: s, cookies: make(map[string]*http.Cookie)}
+}
+
+// Do adds the current session cookie (if any) to the request, passes it to the
+// handler wrapped with the Enable middleware, and returns the recorded response.
+// If the response sets or deletes the session cookie (or its chunk cookies, if
+// Chunk is enabled), then the cookies sent with future requests are updated
+// accordingly.
+func (a *MockAgent) Do(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	names := make([]string, 0, len(a.cookies))
+	for name := range a.cookies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.AddCookie(a.cookies[name])
+	}
+
+	rr := httptest.NewRecorder()
+	a.session.Enable(h).ServeHTTP(rr, r)
+
+	for _, cookie := range rr.Result().Cookies() {
+		name := a.session.cookieName()
+		if cookie.Name != name && !strings.HasPrefix(cookie.Name, name+"-") {
+			continue
+		}
+		if cookie.MaxAge < 0 || cookie.Value == "" {
+			delete(a.cookies, cookie.Name)
+		} else {
+			a.cookies[cookie.Name] = &http.Cookie{Name: cookie.Name, Value: cookie.Value}
+		}
+	}
+
+	return rr
+}
+
+// Cookie returns the session cookie that will be sent with the next request,
+// or nil if there isn't one.
+func (a *MockAgent) Cookie() *http.Cookie {
+	return a.cookies[a.session.cookieName()]
+}
@@ -0,0 +1,43 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMockAgent(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	agent := NewMockAgent(s)
+
+	put := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	get := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+	destroy := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Destroy(r)
+	})
+
+	agent.Do(put, httptest.NewRequest("GET", "/", nil))
+	if agent.Cookie() == nil {
+		t.Fatal("expected a session cookie")
+	}
+
+	rr := agent.Do(get, httptest.NewRequest("GET", "/", nil))
+	if rr.Body.String() != "bar" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "bar")
+	}
+
+	agent.Do(destroy, httptest.NewRequest("GET", "/", nil))
+	if agent.Cookie() != nil {
+		t.Errorf("got %v: expected %v", agent.Cookie(), nil)
+	}
+
+	rr = agent.Do(get, httptest.NewRequest("GET", "/", nil))
+	if rr.Body.String() != "" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "")
+	}
+}
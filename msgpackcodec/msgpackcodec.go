@@ -0,0 +1,73 @@
+// Package msgpackcodec provides a MessagePack codec for use with the
+// github.com/golangcollege/sessions package. MessagePack is a compact binary
+// format, so it typically makes session cookies 30-50% smaller than the
+// default gob encoding, leaving more room for session data. For example:
+//
+//	session.Codec = msgpackcodec.Codec{}
+//
+// Strings, floats, []byte and time.Time values are decoded with the same type
+// that they were encoded with. Integers are always decoded as int, so that
+// they can be fetched with GetInt(). Custom types don't need to be registered,
+// but structs are decoded as map[string]interface{}.
+package msgpackcodec
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes session state using MessagePack.
+type Codec struct{}
+
+// Encode encodes the map using MessagePack.
+func (Codec) Encode(m map[string]interface{}) ([]byte, error) {
+	return msgpack.Marshal(m)
+}
+
+// Decode decodes a map encoded by Encode.
+func (Codec) Decode(b []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	err := msgpack.NewDecoder(bytes.NewReader(b)).Decode(&m)
+	if err != nil {
+		return nil, err
+	}
+	normalizeMap(m)
+	return m, nil
+}
+
+// normalizeMap converts the integers in a decoded map, which are decoded with
+// the smallest type that can hold them, to int, in place.
+func normalizeMap(m map[string]interface{}) {
+	for key, val := range m {
+		m[key] = normalize(val)
+	}
+}
+
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case uint8:
+		return int(v)
+	case uint16:
+		return int(v)
+	case uint32:
+		return int(v)
+	case uint64:
+		return int(v)
+	case map[string]interface{}:
+		normalizeMap(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = normalize(v[i])
+		}
+	}
+	return v
+}
@@ -0,0 +1,93 @@
+package msgpackcodec
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golangcollege/sessions"
+)
+
+func TestRoundTrip(t *testing.T) {
+	now := time.Now()
+	m := map[string]interface{}{
+		"data": map[string]interface{}{
+			"string": "foo",
+			"int":    42,
+			"float":  1.5,
+			"bytes":  []byte("bar"),
+			"time":   now,
+			"slice":  []interface{}{1, "two"},
+		},
+	}
+
+	b, err := Codec{}.Encode(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Codec{}.Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := decoded["data"].(map[string]interface{})
+	if data["string"] != "foo" {
+		t.Errorf("got %v: expected %v", data["string"], "foo")
+	}
+	if data["int"] != 42 {
+		t.Errorf("got %#v: expected %#v", data["int"], 42)
+	}
+	if data["float"] != 1.5 {
+		t.Errorf("got %#v: expected %#v", data["float"], 1.5)
+	}
+	if b, _ := data["bytes"].([]byte); !bytes.Equal(b, []byte("bar")) {
+		t.Errorf("got %v: expected %v", data["bytes"], []byte("bar"))
+	}
+	if !data["time"].(time.Time).Equal(now) {
+		t.Errorf("got %v: expected %v", data["time"], now)
+	}
+	if !reflect.DeepEqual(data["slice"], []interface{}{1, "two"}) {
+		t.Errorf("got %#v: expected %#v", data["slice"], []interface{}{1, "two"})
+	}
+}
+
+func TestSession(t *testing.T) {
+	s := sessions.New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/put" {
+			s.Put(r, "userID", 1234)
+			s.Put(r, "name", "alice")
+			s.Put(r, "balance", 12.5)
+			s.Put(r, "avatar", []byte(strings.Repeat("x", 64)))
+			s.Put(r, "seen", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+			return
+		}
+		fmt.Fprintf(w, "%d %s %v %d %s", s.GetInt(r, "userID"), s.GetString(r, "name"),
+			s.GetFloat(r, "balance"), len(s.GetBytes(r, "avatar")), s.GetTime(r, "seen").UTC().Format(time.RFC3339))
+	})
+
+	agent := sessions.NewMockAgent(s)
+	agent.Do(h, httptest.NewRequest("GET", "/put", nil))
+	gobSize := len(agent.Cookie().Value)
+
+	s.Codec = Codec{}
+	agent = sessions.NewMockAgent(s)
+	agent.Do(h, httptest.NewRequest("GET", "/put", nil))
+	msgpackSize := len(agent.Cookie().Value)
+
+	rr := agent.Do(h, httptest.NewRequest("GET", "/", nil))
+	expected := "1234 alice 12.5 64 2020-01-02T03:04:05Z"
+	if rr.Body.String() != expected {
+		t.Errorf("got %q: expected %q", rr.Body.String(), expected)
+	}
+
+	if float64(msgpackSize) > 0.7*float64(gobSize) {
+		t.Errorf("got %d bytes: expected at most 70%% of the gob size of %d bytes", msgpackSize, gobSize)
+	}
+}
@@ -0,0 +1,122 @@
+package sessions
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+var (
+	// ErrObjectNotFound is returned by GetObject and PopObject when there is
+	// no object stored under the key.
+	ErrObjectNotFound = errors.New("session: no object stored under key")
+
+	// ErrObjectTypeMismatch is returned by GetObject and PopObject when the
+	// destination has a different type to the stored object.
+	ErrObjectTypeMismatch = errors.New("session: object type mismatch")
+
+	errInvalidObjectDst = errors.New("session: object destination must be a non-nil pointer")
+)
+
+// PutObject encodes an arbitrary value, such as a user profile or a shopping
+// cart struct, and adds it to the session data as a []byte under the given
+// key. Unlike Put, the type of the value doesn't need to be registered with
+// RegisterType() or gob.Register(), but it must only have exported fields. Use
+// GetObject() or PopObject() to decode it again.
+//
+// An error is returned if the value can't be encoded, or if it is rejected in
+// the same way as by PutChecked(), in which case the session data is left
+// unchanged.
+func (s *Session) PutObject(r *http.Request, key string, v interface{}) error {
+	var b bytes.Buffer
+	enc := gob.NewEncoder(&b)
+	err := enc.Encode(objectType(reflect.TypeOf(v)))
+	if err == nil {
+		err = enc.Encode(v)
+	}
+	if err != nil {
+		return fmt.Errorf("session: encoding object %q: %w", key, err)
+	}
+
+	return s.PutChecked(r, key, b.Bytes())
+}
+
+// GetObject decodes the object stored under the given key by PutObject() into
+// dst, which must be a non-nil pointer to a value of the same type as the
+// stored object. ErrObjectNotFound is returned if there is no object stored
+// under the key, and an error wrapping ErrObjectTypeMismatch (which names both
+// types) is returned if dst has a different type.
+func (s *Session) GetObject(r *http.Request, key string, dst interface{}) error {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return decodeObject(c, key, dst)
+}
+
+// PopObject works like GetObject, and then removes the object from the session
+// data. If the object can't be decoded into dst then it is left in place.
+func (s *Session) PopObject(r *http.Request, key string, dst interface{}) error {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := decodeObject(c, key, dst)
+	if err != nil {
+		return err
+	}
+
+	c.unset(key)
+	c.modified = true
+	return nil
+}
+
+// decodeObject decodes the object stored under the key into dst. The caller
+// must hold c.mu.
+func decodeObject(c *cache, key string, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errInvalidObjectDst
+	}
+
+	b := toBytes(c.Data[key])
+	if b == nil {
+		return ErrObjectNotFound
+	}
+
+	dec := gob.NewDecoder(bytes.NewReader(b))
+	var stored string
+	err := dec.Decode(&stored)
+	if err != nil {
+		return fmt.Errorf("session: decoding object %q: %w", key, err)
+	}
+	if want := objectType(rv.Type().Elem()); stored != want {
+		return fmt.Errorf("%w: %q holds %s, not %s", ErrObjectTypeMismatch, key, stored, want)
+	}
+
+	err = dec.Decode(dst)
+	if err != nil {
+		return fmt.Errorf("session: decoding object %q: %w", key, err)
+	}
+	return nil
+}
+
+// objectType returns the name of a type, qualified with its package path, for
+// comparing the types of stored objects.
+func objectType(t reflect.Type) string {
+	if t == nil {
+		return "nil"
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.PkgPath() == "" {
+		return t.String()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
@@ -0,0 +1,123 @@
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type testProfile struct {
+	Name  string
+	Roles []string
+}
+
+type testCart struct {
+	Items map[string]int
+}
+
+func TestPutGetObject(t *testing.T) {
+	r := MockRequest(httptest.NewRequest("GET", "/", nil))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	profile := testProfile{Name: "alice", Roles: []string{"admin"}}
+	err := s.PutObject(r, "profile", &profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Get(r, "profile").([]byte); !ok {
+		t.Errorf("got %T: expected %T", s.Get(r, "profile"), []byte(nil))
+	}
+
+	var got testProfile
+	err = s.GetObject(r, "profile", &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, profile) {
+		t.Errorf("got %v: expected %v", got, profile)
+	}
+
+	var cart testCart
+	err = s.GetObject(r, "profile", &cart)
+	if !errors.Is(err, ErrObjectTypeMismatch) {
+		t.Errorf("got %v: expected %v", err, ErrObjectTypeMismatch)
+	}
+
+	err = s.GetObject(r, "missing", &got)
+	if err != ErrObjectNotFound {
+		t.Errorf("got %v: expected %v", err, ErrObjectNotFound)
+	}
+
+	err = s.GetObject(r, "profile", got)
+	if err != errInvalidObjectDst {
+		t.Errorf("got %v: expected %v", err, errInvalidObjectDst)
+	}
+
+	err = s.PutObject(r, "bad", make(chan int))
+	if err == nil {
+		t.Errorf("got %v: expected an error", err)
+	}
+}
+
+func TestPopObject(t *testing.T) {
+	r := MockRequest(httptest.NewRequest("GET", "/", nil))
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	err := s.PutObject(r, "cart", testCart{Items: map[string]int{"apple": 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var profile testProfile
+	err = s.PopObject(r, "cart", &profile)
+	if !errors.Is(err, ErrObjectTypeMismatch) {
+		t.Errorf("got %v: expected %v", err, ErrObjectTypeMismatch)
+	}
+	if !s.Exists(r, "cart") {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+
+	var cart testCart
+	err = s.PopObject(r, "cart", &cart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cart.Items["apple"] != 2 {
+		t.Errorf("got %v: expected %v", cart.Items["apple"], 2)
+	}
+	if s.Exists(r, "cart") {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+}
+
+func TestObjectAcrossRequests(t *testing.T) {
+	for _, codec := range []Codec{GobCodec{}, JSONCodec{}} {
+		s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+		s.Codec = codec
+
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/put" {
+				err := s.PutObject(r, "profile", testProfile{Name: "alice"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var profile testProfile
+			err := s.GetObject(r, "profile", &profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write([]byte(profile.Name))
+		})
+
+		agent := NewMockAgent(s)
+		agent.Do(h, httptest.NewRequest("GET", "/put", nil))
+		rr := agent.Do(h, httptest.NewRequest("GET", "/", nil))
+		if rr.Body.String() != "alice" {
+			t.Errorf("%T: got %q: expected %q", codec, rr.Body.String(), "alice")
+		}
+	}
+}
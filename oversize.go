@@ -0,0 +1,139 @@
+package sessions
+
+import (
+	"net/http"
+	"sort"
+)
+
+// OversizePolicy decides what happens when the session cookie would be longer
+// than 4096 bytes. It only applies when neither Store, Transport nor Chunk are
+// set, as there is no limit on the length of the session token otherwise.
+type OversizePolicy int
+
+const (
+	// OversizeError fails to save the session with ErrCookieTooLong, and
+	// the ErrorHandler is called. This is the default.
+	OversizeError OversizePolicy = iota
+
+	// OversizeDrop removes keys from the session data, in the order given by
+	// DropPriority, until the session cookie is short enough.
+	OversizeDrop
+
+	// OversizeSpill keeps the encrypted session data in the OversizeStore,
+	// and the session cookie carries an opaque token instead, as if Store
+	// were set for that session alone. Once the data fits in the session
+	// cookie again, it is moved back and deleted from the OversizeStore.
+	OversizeSpill
+)
+
+// spillPrefix starts the value of a session cookie whose data has been
+// spilled to the OversizeStore. It can't appear at the start of an encrypted
+// token, which is base64 encoded.
+const spillPrefix = "spill."
+
+// oversized reports whether the session cookie is too long to be sent.
+func (s *Session) oversized(cookie *http.Cookie) bool {
+	return s.Transport == nil && !s.Chunk && len(cookie.String()) > maxCookieLength
+}
+
+// fitCookie applies the OnOversize policy if the session cookie is too long,
+// and returns the cookie which should be sent instead. If the cookie is still
+// too long, it is returned as it is and writeCookie reports ErrCookieTooLong.
+// The caller must hold c.mu.
+func (s *Session) fitCookie(c *cache, cookie *http.Cookie) (*http.Cookie, error) {
+	var err error
+	if s.oversized(cookie) {
+		switch s.OnOversize {
+		case OversizeDrop:
+			cookie, err = s.dropKeys(c, cookie)
+			if err != nil || s.oversized(cookie) {
+				return cookie, err
+			}
+		case OversizeSpill:
+			return s.spill(c, cookie)
+		default:
+			return cookie, nil
+		}
+	}
+	return cookie, s.unspill(c)
+}
+
+// dropKeys removes keys from the session data in order of DropPriority, lowest
+// first, until the session cookie is short enough. Keys with the same priority
+// are dropped in alphabetical order. The caller must hold c.mu.
+func (s *Session) dropKeys(c *cache, cookie *http.Cookie) (*http.Cookie, error) {
+	if s.DropPriority == nil {
+		return cookie, nil
+	}
+
+	keys := make([]string, 0, len(c.Data))
+	priorities := make(map[string]int, len(c.Data))
+	for key := range c.Data {
+		keys = append(keys, key)
+		priorities[key] = s.DropPriority(key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if priorities[keys[i]] != priorities[keys[j]] {
+			return priorities[keys[i]] < priorities[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, key := range keys {
+		c.unset(key)
+		delete(c.secureKeys, key)
+
+		var err error
+		cookie, err = s.cookie(c)
+		if err != nil || !s.oversized(cookie) {
+			return cookie, err
+		}
+	}
+	return cookie, nil
+}
+
+// spill commits the session data to the OversizeStore, and returns a session
+// cookie carrying its token. The caller must hold c.mu.
+func (s *Session) spill(c *cache, cookie *http.Cookie) (*http.Cookie, error) {
+	if s.OversizeStore == nil {
+		return cookie, nil
+	}
+
+	err := s.commit(s.OversizeStore, c)
+	if err != nil {
+		return nil, err
+	}
+	c.spilled = true
+	return s.newCookie(c, spillPrefix+c.token), nil
+}
+
+// unspill deletes the session data from the OversizeStore once it fits in the
+// session cookie again. The caller must hold c.mu.
+func (s *Session) unspill(c *cache) error {
+	if !c.spilled {
+		return nil
+	}
+
+	err := s.deleteSpilled(c)
+	if err != nil {
+		return err
+	}
+	c.spilled = false
+	return nil
+}
+
+// deleteSpilled deletes the session's current and previous tokens from the
+// OversizeStore. The caller must hold c.mu.
+func (s *Session) deleteSpilled(c *cache) error {
+	for _, token := range []string{c.token, c.oldToken} {
+		if token == "" || s.OversizeStore == nil {
+			continue
+		}
+		err := s.storeDelete(s.OversizeStore, token)
+		if err != nil {
+			return wrapError(ErrStoreFailed, err)
+		}
+	}
+	c.token, c.oldToken = "", ""
+	return nil
+}
@@ -0,0 +1,122 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golangcollege/sessions/memstore"
+)
+
+func TestOversizeError(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	var got error
+	s.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		got = err
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", strings.Repeat("a", 5000))
+	})
+	testRequest(t, s.Enable(h), "")
+	if got == nil || !strings.Contains(got.Error(), ErrCookieTooLong.Error()) {
+		t.Errorf("got %v: expected %v", got, ErrCookieTooLong)
+	}
+}
+
+func TestOversizeDrop(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.OnOversize = OversizeDrop
+	s.DropPriority = func(key string) int {
+		if key == "userID" {
+			return 10
+		}
+		return 0
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "userID", 42)
+		s.Put(r, "history", strings.Repeat("a", 2000))
+		s.Put(r, "recent", strings.Repeat("b", 2000))
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+	if cookie == "" {
+		t.Fatal("got no cookie: expected a session cookie")
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.Keys(r))
+	})
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "[recent userID]" {
+		t.Errorf("got %q: expected %q", body, "[recent userID]")
+	}
+}
+
+func TestOversizeSpill(t *testing.T) {
+	store := memstore.NewWithCleanupInterval(0)
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.OnOversize = OversizeSpill
+	s.OversizeStore = store
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", strings.Repeat("a", 5000))
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+	value := strings.TrimPrefix(strings.SplitN(cookie, ";", 2)[0], cookieName+"=")
+	if !strings.HasPrefix(value, spillPrefix) {
+		t.Fatalf("got %q: expected a spilled token", value)
+	}
+	token := strings.TrimPrefix(value, spillPrefix)
+	_, found, err := store.Find(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != true {
+		t.Fatalf("got %v: expected %v", found, true)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, len(s.GetString(r, "foo")))
+		s.Put(r, "foo", "bar")
+	})
+	body, cookie := testRequest(t, s.Enable(h), cookie)
+	if body != "5000" {
+		t.Errorf("got %q: expected %q", body, "5000")
+	}
+	value = strings.TrimPrefix(strings.SplitN(cookie, ";", 2)[0], cookieName+"=")
+	if strings.HasPrefix(value, spillPrefix) {
+		t.Errorf("got %q: expected the session data in the cookie", value)
+	}
+	_, found, err = store.Find(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != false {
+		t.Errorf("got %v: expected %v", found, false)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+	body, _ = testRequest(t, s.Enable(h), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+}
+
+func TestOversizeSpillPutChecked(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.OnOversize = OversizeSpill
+	s.OversizeStore = memstore.NewWithCleanupInterval(0)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := s.PutChecked(r, "foo", strings.Repeat("a", 5000))
+		if err != nil {
+			t.Errorf("got %v: expected %v", err, nil)
+		}
+	})
+	testRequest(t, s.Enable(h), "")
+}
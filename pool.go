@@ -0,0 +1,35 @@
+package sessions
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBufferSize is the capacity in bytes above which a buffer is left
+// for the garbage collector rather than returned to the pool, so that one
+// unusually large response doesn't pin its memory for the life of the
+// process.
+const maxPooledBufferSize = 64 << 10
+
+// bufferPool holds the buffers used for response bodies and for encoding the
+// session data, to save allocating new ones for every request.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns a buffer to the pool. The caller must not use the buffer,
+// or any slice returned by its Bytes method, afterwards.
+func putBuffer(b *bytes.Buffer) {
+	if b.Cap() > maxPooledBufferSize {
+		return
+	}
+	b.Reset()
+	bufferPool.Put(b)
+}
@@ -0,0 +1,42 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPutBuffer(t *testing.T) {
+	b := getBuffer()
+	b.WriteString("foo")
+	putBuffer(b)
+
+	b = getBuffer()
+	if b.Len() != 0 {
+		t.Errorf("got %d: expected %d", b.Len(), 0)
+	}
+	putBuffer(b)
+}
+
+func TestPooledResponse(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		w.Write([]byte(r.URL.Query().Get("body")))
+	})
+
+	for _, body := range []string{"first", "second", strings.Repeat("x", maxPooledBufferSize+1), ""} {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/?body="+body, nil)
+		s.Enable(h).ServeHTTP(rr, r)
+		if rr.Body.String() != body {
+			t.Errorf("got %d bytes: expected %d bytes", rr.Body.Len(), len(body))
+		}
+		if rr.Header().Get("Content-Length") != strconv.Itoa(len(body)) {
+			t.Errorf("got %q: expected %q", rr.Header().Get("Content-Length"), strconv.Itoa(len(body)))
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package sessions
+
+import "strings"
+
+const (
+	// SecurePrefix is the cookie name prefix which tells browsers to only
+	// accept the session cookie if it is Secure.
+	SecurePrefix = "__Secure-"
+
+	// HostPrefix is the cookie name prefix which tells browsers to only
+	// accept the session cookie if it is Secure, has a Path of "/" and has no
+	// Domain, so that it can't be set or overwritten by a subdomain.
+	HostPrefix = "__Host-"
+)
+
+// cookieName returns the name of the session cookie, including any
+// CookiePrefix.
+func (s *Session) cookieName() string {
+	return s.CookiePrefix + cookieName
+}
+
+// checkCookiePrefix reports whether the cookie settings are compatible with
+// the CookiePrefix, so that browsers will accept the session cookie.
+func (s *Session) checkCookiePrefix() error {
+	switch s.CookiePrefix {
+	case "":
+		return nil
+	case SecurePrefix:
+		if !s.Secure {
+			return ErrInvalidCookiePrefix
+		}
+		return nil
+	case HostPrefix:
+		if !s.Secure || s.Path != "/" || s.Domain != "" {
+			return ErrInvalidCookiePrefix
+		}
+		return nil
+	}
+	if strings.HasPrefix(strings.ToLower(s.CookiePrefix), "__") {
+		return ErrInvalidCookiePrefix
+	}
+	return nil
+}
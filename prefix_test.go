@@ -0,0 +1,71 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCookiePrefix(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.CookiePrefix = HostPrefix
+	s.Secure = true
+	s.Partitioned = true
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+	if !strings.HasPrefix(cookie, "__Host-session=") {
+		t.Errorf("got %q: expected prefix %q", cookie, "__Host-session=")
+	}
+	if !strings.HasSuffix(cookie, "; Partitioned") {
+		t.Errorf("got %q: expected suffix %q", cookie, "; Partitioned")
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+
+	body, _ = testRequest(t, s.Enable(h), strings.TrimPrefix(cookie, "__Host-"))
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+}
+
+func TestCheckCookiePrefix(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		secure   bool
+		path     string
+		domain   string
+		expected error
+	}{
+		{"", false, "/", "", nil},
+		{SecurePrefix, true, "/admin", "example.com", nil},
+		{SecurePrefix, false, "/", "", ErrInvalidCookiePrefix},
+		{HostPrefix, true, "/", "", nil},
+		{HostPrefix, false, "/", "", ErrInvalidCookiePrefix},
+		{HostPrefix, true, "/admin", "", ErrInvalidCookiePrefix},
+		{HostPrefix, true, "/", "example.com", ErrInvalidCookiePrefix},
+		{"__host-", true, "/", "", ErrInvalidCookiePrefix},
+		{"app-", false, "/", "", nil},
+	}
+
+	for _, test := range tests {
+		s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+		s.CookiePrefix = test.prefix
+		s.Secure = test.secure
+		s.Path = test.path
+		s.Domain = test.domain
+
+		if err := s.CheckConfig(); err != test.expected {
+			t.Errorf("%+v: got %v: expected %v", test, err, test.expected)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Preload finds the sessions with the given tokens in the Store, with their
+// values, for background jobs which read many sessions at once (such as
+// emailing users who left items in their carts). If the Store implements
+// BatchFinder, they are fetched in one round trip; otherwise they are found
+// one at a time, stopping early if ctx is done. Sessions which aren't in the
+// Store, or can't be decoded with the session's keys, are left out, so the
+// result may be shorter than tokens.
+func (s *Session) Preload(ctx context.Context, tokens []string) ([]StoredSession, error) {
+	if s.Store == nil {
+		return nil, ErrInvalidToken
+	}
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	bf, ok := s.Store.(BatchFinder)
+	if !ok {
+		return s.preloadEach(ctx, tokens)
+	}
+
+	var found map[string][]byte
+	err = s.retryStore(func() error {
+		start := time.Now()
+		found, err = bf.FindMany(tokens)
+		s.observeStore(s.Store, "find_many", start, err)
+		return err
+	})
+	if err != nil {
+		return nil, wrapError(ErrStoreFailed, err)
+	}
+
+	list := make([]StoredSession, 0, len(found))
+	for _, token := range tokens {
+		b, ok := found[token]
+		if !ok {
+			continue
+		}
+		c := &cache{}
+		err = s.decodeStored(c, token, b)
+		if err != nil {
+			continue
+		}
+		ss, err := s.storedSession(c, token, true)
+		if err != nil {
+			continue
+		}
+		list = append(list, *ss)
+	}
+	return list, nil
+}
+
+// preloadEach finds the sessions one at a time, for stores which don't
+// implement BatchFinder.
+func (s *Session) preloadEach(ctx context.Context, tokens []string) ([]StoredSession, error) {
+	list := make([]StoredSession, 0, len(tokens))
+	for _, token := range tokens {
+		err := ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+		ss, err := s.InspectSession(token, true)
+		if errors.Is(err, ErrStoreFailed) {
+			return nil, err
+		} else if err != nil {
+			continue
+		}
+		list = append(list, *ss)
+	}
+	return list, nil
+}
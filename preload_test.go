@@ -0,0 +1,47 @@
+package sessions
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golangcollege/sessions/memstore"
+)
+
+func TestPreload(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = memstore.NewWithCleanupInterval(0)
+
+	var tokens []string
+	for _, user := range []string{"alice", "bob"} {
+		user := user
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.Put(r, "cart", user+"'s cart")
+		})
+		_, cookie := testRequest(t, s.Enable(h), "")
+		tokens = append(tokens, strings.TrimPrefix(strings.SplitN(cookie, ";", 2)[0], cookieName+"="))
+	}
+	tokens = append(tokens, "missing_token")
+
+	for _, st := range []Store{s.Store, struct{ Store }{s.Store}} {
+		s.Store = st
+		list, err := s.Preload(context.Background(), tokens)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 2 {
+			t.Fatalf("got %d: expected %d", len(list), 2)
+		}
+		if list[1].Token != tokens[1] || list[1].Values["cart"] != "bob's cart" {
+			t.Errorf("got %q, %v: expected %q, %v", list[1].Token, list[1].Values["cart"], tokens[1], "bob's cart")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.Preload(ctx, tokens)
+	if err != context.Canceled {
+		t.Errorf("got %v: expected %v", err, context.Canceled)
+	}
+}
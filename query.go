@@ -0,0 +1,104 @@
+package sessions
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// queryKeyInfo is used to derive the keys for query string tokens from the
+// secret keys, so that a query string token can't be used as a session cookie
+// to get around the check that it is only used once.
+const queryKeyInfo = "github.com/golangcollege/sessions query-token"
+
+// token returns the session token for the request, from the Transport if one
+// is set, or else from the session cookie (or its chunk cookies, if Chunk is
+// enabled), or, if AcceptQueryToken allows it, from the query string. If
+// there is no token then http.ErrNoCookie is returned.
+func (s *Session) token(r *http.Request) (token string, fromQuery bool, err error) {
+	if s.Transport != nil {
+		token, err = s.Transport.Token(r)
+	} else {
+		var cookie *http.Cookie
+		cookie, err = r.Cookie(s.cookieName())
+		if err == nil {
+			token = cookie.Value
+		}
+	}
+	if err == nil {
+		return token, false, nil
+	}
+	if err == http.ErrNoCookie && s.Transport == nil && s.Chunk {
+		token, err = chunkedToken(r, s.cookieName())
+		if err == nil {
+			return token, false, nil
+		}
+	}
+	if err != http.ErrNoCookie || s.AcceptQueryToken == nil || !s.AcceptQueryToken(r) {
+		return "", false, err
+	}
+
+	token = r.URL.Query().Get(s.QueryTokenParam)
+	if token == "" {
+		return "", false, http.ErrNoCookie
+	}
+	return token, true, nil
+}
+
+// QueryToken returns a token for the current session which can be added to a
+// URL (for example, the redirect URL of an OAuth flow) using the
+// QueryTokenParam query string parameter. It will only be accepted by a
+// request for which AcceptQueryToken returns true, and only once.
+//
+// Any changes made to the session data after QueryToken is called will not be
+// included in the token. The token is encrypted with a key derived from the
+// secret key, so it can't be used as a session cookie.
+func (s *Session) QueryToken(r *http.Request) (string, error) {
+	return s.export(r, queryKeyInfo)
+}
+
+// usedTokensPruneInterval is how often usedTokens removes the expired tokens,
+// so that accepting a token doesn't have to look at every other one.
+const usedTokensPruneInterval = time.Minute
+
+// usedTokens remembers query string tokens which have already been accepted,
+// until they expire. It only covers this process: a token can be accepted once
+// by each instance of an application, and again after a restart.
+type usedTokens struct {
+	mu     sync.Mutex
+	tokens map[[32]byte]time.Time
+	pruned time.Time
+}
+
+// use records that the token has been used, and returns false if it had
+// already been used.
+func (u *usedTokens) use(token string, expiry time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	if u.tokens == nil {
+		u.tokens = make(map[[32]byte]time.Time)
+	}
+	if now.Sub(u.pruned) >= usedTokensPruneInterval {
+		u.prune(now)
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	if exp, used := u.tokens[sum]; used && !now.After(exp) {
+		return false
+	}
+	u.tokens[sum] = expiry
+	return true
+}
+
+// prune removes the expired tokens. The caller must hold u.mu.
+func (u *usedTokens) prune(now time.Time) {
+	for sum, exp := range u.tokens {
+		if now.After(exp) {
+			delete(u.tokens, sum)
+		}
+	}
+	u.pruned = now
+}
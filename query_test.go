@@ -0,0 +1,114 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryToken(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	var token string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "state", "xyz")
+		var err error
+		token, err = s.QueryToken(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	testRequest(t, s.Enable(h), "")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "state"))
+	})
+
+	do := func(path string) (string, string) {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path+"?session_token="+url.QueryEscape(token), nil)
+		s.Enable(h).ServeHTTP(rr, r)
+		return rr.Body.String(), rr.Header().Get("Set-Cookie")
+	}
+
+	body, _ := do("/callback")
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+
+	s.AcceptQueryToken = func(r *http.Request) bool {
+		return r.URL.Path == "/callback"
+	}
+
+	body, _ = do("/other")
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+
+	body, cookie := do("/callback")
+	if body != "xyz" {
+		t.Errorf("got %q: expected %q", body, "xyz")
+	}
+	if cookie == "" {
+		t.Errorf("expected a session cookie")
+	}
+
+	body, _ = do("/callback")
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+
+	body, _ = testRequest(t, s.Enable(h), "session="+token)
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+}
+
+func TestQueryTokenNotCookie(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.AcceptQueryToken = func(r *http.Request) bool { return true }
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "state", "xyz")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+	token := strings.TrimPrefix(strings.Split(cookie, ";")[0], "session=")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "state"))
+	})
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/?session_token="+url.QueryEscape(token), nil))
+	if rr.Body.String() != "" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "")
+	}
+}
+
+func TestUsedTokens(t *testing.T) {
+	var u usedTokens
+	if !u.use("a", time.Now().Add(time.Hour)) {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+	if u.use("a", time.Now().Add(time.Hour)) {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+	u.use("b", time.Now().Add(-time.Second))
+
+	// Expired tokens are only removed once the prune interval has passed.
+	u.use("c", time.Now().Add(time.Hour))
+	if len(u.tokens) != 3 {
+		t.Errorf("got %d: expected %d", len(u.tokens), 3)
+	}
+	u.pruned = time.Now().Add(-usedTokensPruneInterval)
+	u.use("d", time.Now().Add(time.Hour))
+	if len(u.tokens) != 3 {
+		t.Errorf("got %d: expected %d", len(u.tokens), 3)
+	}
+	if u.use("a", time.Now().Add(time.Hour)) {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+}
@@ -0,0 +1,88 @@
+package sessions
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrNonceReused is wrapped by the error returned when the session's Rand
+// returns the same bytes as one of its recent reads. Encrypting two sessions
+// with the same key and nonce breaks the confidentiality and authenticity of
+// both, so the session isn't saved. This usually means that Rand is a fixed
+// reader left over from a test, or a DRBG which is being reseeded with the
+// same seed.
+var ErrNonceReused = errors.New("session: source of randomness returned a repeated nonce")
+
+// minGuardedRead is the length in bytes of the shortest read which is checked
+// for repeats. Every nonce and token is at least this long, while shorter
+// reads may legitimately repeat.
+const minGuardedRead = 12
+
+// randomGuardSize is the number of recent reads of each length which are
+// remembered by a randomGuard.
+const randomGuardSize = 16
+
+// randomGuard remembers digests of the recent reads of each length from the
+// session's Rand. It is a sanity check, not a test of randomness: it catches
+// a reader which is constant or cycles through a few outputs, but not one
+// which repeats an output from further back.
+type randomGuard struct {
+	mu     sync.Mutex
+	recent map[int]*randomHistory
+}
+
+// randomHistory is a ring of the digests of recent reads of one length.
+type randomHistory struct {
+	sums [randomGuardSize][sha256.Size]byte
+	n    int
+}
+
+// check returns ErrNonceReused if b is the same as one of the recent reads of
+// its length.
+func (g *randomGuard) check(b []byte) error {
+	if len(b) < minGuardedRead {
+		return nil
+	}
+	sum := sha256.Sum256(b)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.recent == nil {
+		g.recent = make(map[int]*randomHistory)
+	}
+	h := g.recent[len(b)]
+	if h == nil {
+		h = &randomHistory{}
+		g.recent[len(b)] = h
+	}
+	for i := 0; i < h.n && i < randomGuardSize; i++ {
+		if h.sums[i] == sum {
+			return ErrNonceReused
+		}
+	}
+	h.sums[h.n%randomGuardSize] = sum
+	h.n++
+	return nil
+}
+
+// guardedReader fills each read completely from r, and fails it if the bytes
+// repeat the previous read.
+type guardedReader struct {
+	r     io.Reader
+	guard *randomGuard
+}
+
+func (r guardedReader) Read(p []byte) (int, error) {
+	n, err := io.ReadFull(r.r, p)
+	if err != nil {
+		return n, err
+	}
+	err = r.guard.check(p)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
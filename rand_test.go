@@ -0,0 +1,144 @@
+package sessions
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestRandDeterministic(t *testing.T) {
+	nonces := make([][]byte, 2)
+	for i := range nonces {
+		s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+		s.Rand = rand.New(rand.NewSource(1))
+
+		c := newCache(0)
+		c.Data["foo"] = "bar"
+		token, err := s.encode(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		box, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonces[i] = box[:24]
+	}
+
+	if !bytes.Equal(nonces[0], nonces[1]) {
+		t.Errorf("got %x: expected %x", nonces[1], nonces[0])
+	}
+}
+
+func TestRandRepeated(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Rand = zeroReader{}
+
+	var got error
+	s.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		got = err
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if got != nil {
+		t.Fatalf("got %v: expected %v", got, nil)
+	}
+
+	rr = httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if !errors.Is(got, ErrNonceReused) {
+		t.Errorf("got %v: expected %v", got, ErrNonceReused)
+	}
+	if !errors.Is(got, ErrEncryptFailed) {
+		t.Errorf("got %v: expected %v", got, ErrEncryptFailed)
+	}
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+type cycleReader struct {
+	mu sync.Mutex
+	n  byte
+}
+
+func (r *cycleReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range p {
+		p[i] = r.n
+	}
+	r.n = (r.n + 1) % 3
+	return len(p), nil
+}
+
+func TestRandomGuardCycle(t *testing.T) {
+	var g randomGuard
+	r := guardedReader{r: &cycleReader{}, guard: &g}
+
+	for i := 0; i < 3; i++ {
+		_, err := r.Read(make([]byte, 24))
+		if err != nil {
+			t.Fatalf("got %v: expected %v", err, nil)
+		}
+	}
+	_, err := r.Read(make([]byte, 24))
+	if err != ErrNonceReused {
+		t.Errorf("got %v: expected %v", err, ErrNonceReused)
+	}
+}
+
+func TestRandUnguarded(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Rand = zeroReader{}
+	s.UnguardedRand = true
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+
+	// Both sessions are saved, with the same nonce.
+	for i := 0; i < 2; i++ {
+		_, cookie := testRequest(t, s.Enable(h), "")
+		prefix := cookieName + "=" + strings.Repeat("A", 32)
+		if !strings.HasPrefix(cookie, prefix) {
+			t.Errorf("got %q: expected prefix %q", cookie, prefix)
+		}
+	}
+}
+
+func TestRandomGuardLengths(t *testing.T) {
+	var g randomGuard
+
+	for _, b := range [][]byte{make([]byte, 24), make([]byte, 32), make([]byte, 4), make([]byte, 4)} {
+		err := g.check(b)
+		if err != nil {
+			t.Errorf("got %v: expected %v", err, nil)
+		}
+	}
+	err := g.check(make([]byte, 24))
+	if err != ErrNonceReused {
+		t.Errorf("got %v: expected %v", err, ErrNonceReused)
+	}
+}
@@ -0,0 +1,38 @@
+package redisstore
+
+import (
+	"encoding/json"
+
+	"github.com/golangcollege/sessions"
+	"github.com/gomodule/redigo/redis"
+)
+
+// Publisher publishes session events to a Redis channel as JSON, for other
+// services to SUBSCRIBE to. Use it as the Session's Publisher.
+type Publisher struct {
+	pool    *redis.Pool
+	channel string
+}
+
+// NewPublisher returns a new Publisher which publishes to the given channel.
+// The pool parameter should be a pointer to a redigo connection pool.
+func NewPublisher(pool *redis.Pool, channel string) *Publisher {
+	return &Publisher{
+		pool:    pool,
+		channel: channel,
+	}
+}
+
+// Publish sends the event to the channel.
+func (p *Publisher) Publish(event sessions.AuditEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	conn := p.pool.Get()
+	defer conn.Close()
+
+	_, err = conn.Do("PUBLISH", p.channel, b)
+	return err
+}
@@ -0,0 +1,53 @@
+package redisstore
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golangcollege/sessions"
+	"github.com/gomodule/redigo/redis"
+)
+
+// publishConn is a redis.Conn which records the PUBLISH commands sent to it.
+type publishConn struct {
+	fakeConn
+	published *[][]interface{}
+}
+
+func (c publishConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "PUBLISH" {
+		*c.published = append(*c.published, args)
+	}
+	return int64(1), nil
+}
+
+func TestPublisher(t *testing.T) {
+	var published [][]interface{}
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return publishConn{published: &published}, nil
+		},
+	}
+	defer pool.Close()
+
+	p := NewPublisher(pool, "session-events")
+	err := p.Publish(sessions.AuditEvent{Type: sessions.AuditDestroyed, SessionID: "session_id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(published) != 1 {
+		t.Fatalf("got %d: expected %d", len(published), 1)
+	}
+	if published[0][0] != "session-events" {
+		t.Errorf("got %v: expected %v", published[0][0], "session-events")
+	}
+	var event sessions.AuditEvent
+	err = json.Unmarshal(published[0][1].([]byte), &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != sessions.AuditDestroyed || event.SessionID != "session_id" {
+		t.Errorf("got %+v: expected a destroyed event for %q", event, "session_id")
+	}
+}
@@ -0,0 +1,330 @@
+// Package redisstore provides a Redis-based session store for use with the
+// github.com/golangcollege/sessions package. It uses the redigo client.
+package redisstore
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/golangcollege/sessions/internal/recent"
+	"github.com/gomodule/redigo/redis"
+)
+
+// Consistency sets which sessions a RedisStore with a Replica reads from the
+// replica.
+type Consistency int
+
+const (
+	// ReadYourWrites reads sessions which this RedisStore has committed or
+	// deleted within the last ReplicaLag from the primary, so that a request
+	// sees the changes made by the previous one, and a deleted session can't
+	// be found on a replica which hasn't caught up yet. Other sessions are
+	// read from the replica, and from the primary if they aren't found on
+	// the replica, in case another instance of your application has just
+	// written them. Sessions which another instance has just deleted may
+	// still be found on the replica. This is the default.
+	ReadYourWrites Consistency = iota
+
+	// Eventual reads every session from the replica, so a session may be
+	// read as it was before its latest change, or after it was deleted, until
+	// the replica catches up.
+	Eventual
+)
+
+// Options configures a RedisStore created with NewWithOptions.
+type Options struct {
+	// Prefix controls the Redis key prefix. New uses "sessions:".
+	Prefix string
+
+	// Replica, if set, is a connection pool for a Redis replica which
+	// sessions are found in, according to Consistency, to take load off the
+	// primary. Sessions are always committed and deleted on the primary.
+	Replica *redis.Pool
+
+	// Consistency sets which sessions are read from the Replica. The default
+	// is ReadYourWrites.
+	Consistency Consistency
+
+	// ReplicaLag sets how far the Replica may fall behind the primary with
+	// ReadYourWrites. The default is 1 second.
+	ReplicaLag time.Duration
+
+	// Timeout, if set, limits how long each operation waits for a
+	// connection from the pool, and for Redis to reply, so that a slow Redis
+	// fails requests quickly instead of holding them up. It needs
+	// connections which support read timeouts, as those made by redis.Dial
+	// do. The pool sizes and the dial, read and write timeouts of the
+	// connections themselves are set on the redis.Pool and in its Dial
+	// function. The default is 0, which means no timeout.
+	Timeout time.Duration
+}
+
+// RedisStore represents the session store.
+type RedisStore struct {
+	pool    *redis.Pool
+	replica *redis.Pool
+	written *recent.Set
+	prefix  string
+	timeout time.Duration
+}
+
+// New returns a new RedisStore instance. The pool parameter should be a
+// pointer to a redigo connection pool. See
+// https://godoc.org/github.com/gomodule/redigo/redis#Pool.
+func New(pool *redis.Pool) *RedisStore {
+	return NewWithPrefix(pool, "sessions:")
+}
+
+// NewWithPrefix returns a new RedisStore instance. The pool parameter should
+// be a pointer to a redigo connection pool. The prefix parameter controls the
+// Redis key prefix, which can be used to avoid naming clashes if necessary.
+func NewWithPrefix(pool *redis.Pool, prefix string) *RedisStore {
+	return NewWithOptions(pool, Options{Prefix: prefix})
+}
+
+// NewWithOptions returns a new RedisStore instance using the given Options.
+// The pool parameter should be a pointer to a redigo connection pool for the
+// primary.
+func NewWithOptions(pool *redis.Pool, opts Options) *RedisStore {
+	r := &RedisStore{
+		pool:    pool,
+		replica: opts.Replica,
+		prefix:  opts.Prefix,
+		timeout: opts.Timeout,
+	}
+	if r.replica != nil && opts.Consistency == ReadYourWrites {
+		lag := opts.ReplicaLag
+		if lag <= 0 {
+			lag = time.Second
+		}
+		r.written = recent.New(lag)
+	}
+	return r
+}
+
+// Find returns the data for a given session token from the RedisStore
+// instance. If the session token is not found or is expired, the returned
+// found value will be false.
+func (r *RedisStore) Find(token string) (b []byte, found bool, err error) {
+	pool := r.reader(token)
+	b, found, err = r.find(pool, token)
+	if err == nil && !found && pool != r.pool && r.written != nil {
+		// The session may have been written by another instance of the
+		// application, and not have reached the replica yet.
+		return r.find(r.pool, token)
+	}
+	return b, found, err
+}
+
+func (r *RedisStore) find(pool *redis.Pool, token string) ([]byte, bool, error) {
+	conn, err := r.get(pool)
+	if err != nil {
+		return nil, false, err
+	}
+	defer conn.Close()
+
+	b, err := redis.Bytes(r.do(conn, "GET", r.prefix+token))
+	if err == redis.ErrNil {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+// Commit adds a session token and data to the RedisStore instance with the
+// given expiry time. If the session token already exists then the data and
+// expiry time are updated.
+func (r *RedisStore) Commit(token string, b []byte, expiry time.Time) error {
+	r.wrote(token)
+	conn, err := r.get(r.pool)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.Send("MULTI")
+	if err != nil {
+		return err
+	}
+	err = conn.Send("SET", r.prefix+token, b)
+	if err != nil {
+		return err
+	}
+	err = conn.Send("PEXPIREAT", r.prefix+token, makeMillisecondTimestamp(expiry))
+	if err != nil {
+		return err
+	}
+	_, err = r.do(conn, "EXEC")
+	return err
+}
+
+// Delete removes a session token and corresponding data from the RedisStore
+// instance.
+func (r *RedisStore) Delete(token string) error {
+	r.wrote(token)
+	conn, err := r.get(r.pool)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = r.do(conn, "DEL", r.prefix+token)
+	return err
+}
+
+// FindMany returns the data for each of the given session tokens which is in
+// the RedisStore instance, keyed by token, using a single MGET command. It
+// reads from the Replica unless one of the tokens has to be read from the
+// primary.
+func (r *RedisStore) FindMany(tokens []string) (map[string][]byte, error) {
+	found := make(map[string][]byte, len(tokens))
+	if len(tokens) == 0 {
+		return found, nil
+	}
+
+	pool := r.replica
+	keys := make([]interface{}, len(tokens))
+	for i, token := range tokens {
+		keys[i] = r.prefix + token
+		if r.reader(token) == r.pool {
+			pool = r.pool
+		}
+	}
+	conn, err := r.get(pool)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	values, err := redis.ByteSlices(r.do(conn, "MGET", keys...))
+	if err != nil {
+		return nil, err
+	}
+	for i, b := range values {
+		if b != nil {
+			found[tokens[i]] = b
+		}
+	}
+	return found, nil
+}
+
+// List returns session tokens from the RedisStore instance using SCAN, with
+// limit as its COUNT hint, so a page may hold more or fewer than limit tokens.
+// The cursor is SCAN's cursor, and the returned next cursor is "" after the
+// last page. A token may be listed more than once. List reads from the
+// Replica, if there is one.
+func (r *RedisStore) List(cursor string, limit int) ([]string, string, error) {
+	if cursor == "" {
+		cursor = "0"
+	}
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	pool := r.pool
+	if r.replica != nil {
+		pool = r.replica
+	}
+	conn, err := r.get(pool)
+	if err != nil {
+		return nil, "", err
+	}
+	defer conn.Close()
+
+	reply, err := redis.Values(r.do(conn, "SCAN", cursor, "MATCH", escapePattern(r.prefix)+"*", "COUNT", limit))
+	if err != nil {
+		return nil, "", err
+	}
+	var keys []string
+	_, err = redis.Scan(reply, &cursor, &keys)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tokens := make([]string, len(keys))
+	for i, key := range keys {
+		tokens[i] = strings.TrimPrefix(key, r.prefix)
+	}
+	if cursor == "0" {
+		cursor = ""
+	}
+	return tokens, cursor, nil
+}
+
+// escapePattern escapes the characters which have a special meaning in the
+// glob-style patterns used by SCAN.
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, ch := range s {
+		switch ch {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(ch)
+	}
+	return b.String()
+}
+
+// Ping sends a PING command to Redis, and to the Replica if there is one, and
+// returns an error if a connection can't be made or the command fails before
+// ctx is done.
+func (r *RedisStore) Ping(ctx context.Context) error {
+	err := ping(ctx, r.pool)
+	if err == nil && r.replica != nil {
+		err = ping(ctx, r.replica)
+	}
+	return err
+}
+
+func ping(ctx context.Context, pool *redis.Pool) error {
+	conn, err := pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = redis.DoContext(conn, ctx, "PING")
+	return err
+}
+
+// get returns a connection from the pool, waiting for up to the Timeout for
+// one to become free if the pool has a MaxActive limit and Wait is set.
+func (r *RedisStore) get(pool *redis.Pool) (redis.Conn, error) {
+	if r.timeout <= 0 {
+		return pool.Get(), nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	return pool.GetContext(ctx)
+}
+
+// do sends a command on the connection, and waits for up to the Timeout for
+// its reply.
+func (r *RedisStore) do(conn redis.Conn, cmd string, args ...interface{}) (interface{}, error) {
+	if r.timeout <= 0 {
+		return conn.Do(cmd, args...)
+	}
+	return redis.DoWithTimeout(conn, r.timeout, cmd, args...)
+}
+
+// reader returns the pool which the session token should be found in.
+func (r *RedisStore) reader(token string) *redis.Pool {
+	if r.replica == nil || (r.written != nil && r.written.Contains(token)) {
+		return r.pool
+	}
+	return r.replica
+}
+
+// wrote records that the session token is being written to the primary, so
+// that ReadYourWrites reads it from there until the replica has caught up.
+func (r *RedisStore) wrote(token string) {
+	if r.written != nil {
+		r.written.Add(token)
+	}
+}
+
+func makeMillisecondTimestamp(t time.Time) int64 {
+	return t.UnixNano() / (int64(time.Millisecond) / int64(time.Nanosecond))
+}
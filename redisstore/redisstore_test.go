@@ -0,0 +1,406 @@
+package redisstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// newTestPool returns a connection pool for the Redis server at the address in
+// the SESSIONS_TEST_REDIS_ADDR environment variable, after flushing its
+// current database. The test is skipped if the variable isn't set.
+func newTestPool(t *testing.T) *redis.Pool {
+	addr := os.Getenv("SESSIONS_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("SESSIONS_TEST_REDIS_ADDR not set")
+	}
+
+	pool := &redis.Pool{
+		MaxIdle: 5,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr)
+		},
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("FLUSHDB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func TestCommitAndFind(t *testing.T) {
+	pool := newTestPool(t)
+	defer pool.Close()
+	r := New(pool)
+
+	err := r.Commit("session_token", []byte("encoded_data"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, found, err := r.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != true {
+		t.Fatalf("got %v: expected %v", found, true)
+	}
+	if bytes.Equal(b, []byte("encoded_data")) == false {
+		t.Fatalf("got %v: expected %v", b, []byte("encoded_data"))
+	}
+}
+
+func TestFindMissing(t *testing.T) {
+	pool := newTestPool(t)
+	defer pool.Close()
+	r := New(pool)
+
+	_, found, err := r.Find("missing_session_token")
+	if err != nil {
+		t.Fatalf("got %v: expected %v", err, nil)
+	}
+	if found != false {
+		t.Fatalf("got %v: expected %v", found, false)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	pool := newTestPool(t)
+	defer pool.Close()
+	r := New(pool)
+
+	err := r.Commit("session_token", []byte("encoded_data"), time.Now().Add(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	_, found, err := r.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != false {
+		t.Fatalf("got %v: expected %v", found, false)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	pool := newTestPool(t)
+	defer pool.Close()
+	r := New(pool)
+
+	err := r.Commit("session_token", []byte("encoded_data"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Delete("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, found, err := r.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != false {
+		t.Fatalf("got %v: expected %v", found, false)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	pool := newTestPool(t)
+	defer pool.Close()
+	r := NewWithPrefix(pool, "myapp:")
+
+	err := r.Commit("session_token", []byte("encoded_data"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+	exists, err := redis.Bool(conn.Do("EXISTS", "myapp:session_token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists != true {
+		t.Fatalf("got %v: expected %v", exists, true)
+	}
+}
+
+func TestPing(t *testing.T) {
+	pool := newTestPool(t)
+	defer pool.Close()
+
+	err := New(pool).Ping(context.Background())
+	if err != nil {
+		t.Errorf("got %v: expected %v", err, nil)
+	}
+}
+
+func TestPingUnreachable(t *testing.T) {
+	errDial := errors.New("connection refused")
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return nil, errDial
+		},
+	}
+	defer pool.Close()
+
+	err := New(pool).Ping(context.Background())
+	if err != errDial {
+		t.Errorf("got %v: expected %v", err, errDial)
+	}
+}
+
+// fakeConn is a redis.Conn which answers GET commands from its data, and
+// accepts every other command, so that tests can see which pool was used
+// without a Redis server.
+type fakeConn struct {
+	data map[string][]byte
+	gets *int
+}
+
+func (c fakeConn) Close() error { return nil }
+func (c fakeConn) Err() error   { return nil }
+func (c fakeConn) Flush() error { return nil }
+
+func (c fakeConn) Send(cmd string, args ...interface{}) error { return nil }
+
+func (c fakeConn) Receive() (interface{}, error) { return nil, nil }
+
+func (c fakeConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd != "GET" {
+		return "OK", nil
+	}
+	*c.gets++
+	b, ok := c.data[args[0].(string)]
+	if !ok {
+		return nil, nil
+	}
+	return b, nil
+}
+
+func newFakePool(data map[string][]byte, gets *int) *redis.Pool {
+	return &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return fakeConn{data: data, gets: gets}, nil
+		},
+	}
+}
+
+func TestReplica(t *testing.T) {
+	var primaryGets, replicaGets int
+	primary := newFakePool(map[string][]byte{"sessions:session_token": []byte("new_data")}, &primaryGets)
+	defer primary.Close()
+	replica := newFakePool(map[string][]byte{"sessions:session_token": []byte("old_data")}, &replicaGets)
+	defer replica.Close()
+
+	r := NewWithOptions(primary, Options{Prefix: "sessions:", Replica: replica})
+	b, _, err := r.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(b, []byte("old_data")) == false {
+		t.Errorf("got %q: expected %q", b, "old_data")
+	}
+
+	err = r.Commit("session_token", []byte("new_data"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err = r.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(b, []byte("new_data")) == false {
+		t.Errorf("got %q: expected %q", b, "new_data")
+	}
+	if primaryGets != 1 || replicaGets != 1 {
+		t.Errorf("got %d, %d: expected %d, %d", primaryGets, replicaGets, 1, 1)
+	}
+
+	r = NewWithOptions(primary, Options{Prefix: "sessions:", Replica: replica, Consistency: Eventual})
+	err = r.Delete("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, found, err := r.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != true {
+		t.Errorf("got %v: expected %v", found, true)
+	}
+	if replicaGets != 2 {
+		t.Errorf("got %d: expected %d", replicaGets, 2)
+	}
+}
+
+func TestReplicaMiss(t *testing.T) {
+	var primaryGets, replicaGets int
+	primary := newFakePool(map[string][]byte{"sessions:session_token": []byte("encoded_data")}, &primaryGets)
+	defer primary.Close()
+	replica := newFakePool(map[string][]byte{}, &replicaGets)
+	defer replica.Close()
+
+	// A session written by another instance is found on the primary when it
+	// hasn't reached the replica yet.
+	r := NewWithOptions(primary, Options{Prefix: "sessions:", Replica: replica})
+	b, found, err := r.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != true || !bytes.Equal(b, []byte("encoded_data")) {
+		t.Errorf("got %v, %q: expected %v, %q", found, b, true, "encoded_data")
+	}
+	if primaryGets != 1 || replicaGets != 1 {
+		t.Errorf("got %d, %d: expected %d, %d", primaryGets, replicaGets, 1, 1)
+	}
+}
+
+// scanConn is a redis.Conn which answers SCAN commands from its pages, keyed
+// by cursor.
+type scanConn struct {
+	fakeConn
+	pages map[string][]interface{}
+	match *string
+}
+
+func (c scanConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd != "SCAN" {
+		return "OK", nil
+	}
+	*c.match = args[2].(string)
+	return c.pages[args[0].(string)], nil
+}
+
+func TestList(t *testing.T) {
+	var match string
+	pages := map[string][]interface{}{
+		"0":  {[]byte("17"), []interface{}{[]byte("s[1]:a"), []byte("s[1]:b")}},
+		"17": {[]byte("0"), []interface{}{[]byte("s[1]:c")}},
+	}
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return scanConn{pages: pages, match: &match}, nil
+		},
+	}
+	defer pool.Close()
+
+	r := NewWithPrefix(pool, "s[1]:")
+	tokens, next, err := r.List("", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tokens, []string{"a", "b"}) || next != "17" {
+		t.Errorf("got %v, %q: expected %v, %q", tokens, next, []string{"a", "b"}, "17")
+	}
+	if match != `s\[1\]:*` {
+		t.Errorf("got %q: expected %q", match, `s\[1\]:*`)
+	}
+
+	tokens, next, err = r.List(next, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tokens, []string{"c"}) || next != "" {
+		t.Errorf("got %v, %q: expected %v, %q", tokens, next, []string{"c"}, "")
+	}
+}
+
+// mgetConn is a redis.Conn which answers MGET commands from its data.
+type mgetConn struct {
+	fakeConn
+}
+
+func (c mgetConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd != "MGET" {
+		return "OK", nil
+	}
+	*c.gets++
+	values := make([]interface{}, len(args))
+	for i, key := range args {
+		if b, ok := c.data[key.(string)]; ok {
+			values[i] = b
+		}
+	}
+	return values, nil
+}
+
+func TestFindMany(t *testing.T) {
+	var gets int
+	data := map[string][]byte{"sessions:a": []byte("a"), "sessions:c": []byte("c")}
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return mgetConn{fakeConn{data: data, gets: &gets}}, nil
+		},
+	}
+	defer pool.Close()
+
+	r := New(pool)
+	found, err := r.FindMany([]string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]byte{"a": []byte("a"), "c": []byte("c")}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("got %v: expected %v", found, expected)
+	}
+	if gets != 1 {
+		t.Errorf("got %d: expected %d", gets, 1)
+	}
+}
+
+// timeoutConn is a fakeConn which supports read timeouts, and records them.
+type timeoutConn struct {
+	fakeConn
+	timeouts *[]time.Duration
+}
+
+func (c timeoutConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	*c.timeouts = append(*c.timeouts, timeout)
+	return c.fakeConn.Do(cmd, args...)
+}
+
+func (c timeoutConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return c.fakeConn.Receive()
+}
+
+func TestTimeout(t *testing.T) {
+	var gets int
+	var timeouts []time.Duration
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return timeoutConn{fakeConn{data: map[string][]byte{"sessions:session_token": []byte("encoded_data")}, gets: &gets}, &timeouts}, nil
+		},
+	}
+	defer pool.Close()
+
+	r := NewWithOptions(pool, Options{Prefix: "sessions:", Timeout: 50 * time.Millisecond})
+	_, found, err := r.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != true {
+		t.Errorf("got %v: expected %v", found, true)
+	}
+	err = r.Commit("session_token", []byte("encoded_data"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []time.Duration{50 * time.Millisecond, 50 * time.Millisecond}
+	if !reflect.DeepEqual(timeouts, expected) {
+		t.Errorf("got %v: expected %v", timeouts, expected)
+	}
+}
@@ -0,0 +1,78 @@
+package sessions
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+var (
+	iosVersion       = regexp.MustCompile(`\(iP.+; CPU .*OS (\d+)[_\d]*.*\) AppleWebKit/`)
+	macosxVersion    = regexp.MustCompile(`\(Macintosh;.*Mac OS X (\d+)_(\d+)[_\d]*.*\) AppleWebKit/`)
+	safari           = regexp.MustCompile(`Version/.* Safari/`)
+	macEmbedded      = regexp.MustCompile(`^Mozilla/[\.\d]+ \(Macintosh;.*Mac OS X [_\d]+\) AppleWebKit/[\.\d]+ \(KHTML, like Gecko\)$`)
+	chromiumBased    = regexp.MustCompile(`Chrom(e|ium)`)
+	chromiumVersion  = regexp.MustCompile(`Chrom[^ /]+/(\d+)[\.\d]* `)
+	ucBrowserVersion = regexp.MustCompile(`UCBrowser/(\d+)\.(\d+)\.(\d+)[\.\d]* `)
+)
+
+// sameSiteNoneIncompatible reports whether the user agent is known to
+// mishandle cookies with the 'SameSite=None' attribute, either by rejecting
+// them or by treating them as 'SameSite=Strict'. The checks are based on the
+// list of incompatible clients published by the Chromium project.
+func sameSiteNoneIncompatible(ua string) bool {
+	// iOS 12 and macOS 10.14 treat SameSite=None as SameSite=Strict.
+	if m := iosVersion.FindStringSubmatch(ua); m != nil && m[1] == "12" {
+		return true
+	}
+	if m := macosxVersion.FindStringSubmatch(ua); m != nil && m[1] == "10" && m[2] == "14" {
+		if (safari.MatchString(ua) && !chromiumBased.MatchString(ua)) || macEmbedded.MatchString(ua) {
+			return true
+		}
+	}
+
+	// Chrome 51 to 66 reject cookies with SameSite=None.
+	if m := chromiumVersion.FindStringSubmatch(ua); m != nil && chromiumBased.MatchString(ua) {
+		v, _ := strconv.Atoi(m[1])
+		if v >= 51 && v <= 66 {
+			return true
+		}
+	}
+
+	// UC Browser before 12.13.2 rejects cookies with SameSite=None.
+	if m := ucBrowserVersion.FindStringSubmatch(ua); m != nil {
+		major, _ := strconv.Atoi(m[1])
+		minor, _ := strconv.Atoi(m[2])
+		build, _ := strconv.Atoi(m[3])
+		if major != 12 {
+			return major < 12
+		}
+		if minor != 13 {
+			return minor < 13
+		}
+		return build < 2
+	}
+
+	return false
+}
+
+// setCookie adds the cookie to the response, first removing the 'SameSite'
+// attribute if it is 'None' and LegacySameSite is enabled and the client is
+// known to mishandle it, and adding the 'Partitioned' attribute if Partitioned
+// is enabled. If CacheControl is set, the Cache-Control header is replaced so
+// that the response isn't stored by shared caches.
+func (s *Session) setCookie(w http.ResponseWriter, r *http.Request, cookie *http.Cookie) {
+	if s.LegacySameSite && cookie.SameSite == http.SameSiteNoneMode && r != nil && sameSiteNoneIncompatible(r.UserAgent()) {
+		cookie.SameSite = 0
+	}
+	if s.CacheControl != "" {
+		w.Header().Set("Cache-Control", s.CacheControl)
+	}
+	if !s.Partitioned {
+		http.SetCookie(w, cookie)
+		return
+	}
+	if v := cookie.String(); v != "" {
+		w.Header().Add("Set-Cookie", v+"; Partitioned")
+	}
+}
@@ -2,44 +2,50 @@ package sessions
 
 import (
 	"crypto/rand"
-	"encoding/base64"
 	"errors"
-
-	"golang.org/x/crypto/nacl/secretbox"
+	"io"
 )
 
-var errInvalidToken = errors.New("session: invalid token")
-
-func encrypt(in []byte, key [32]byte) (string, error) {
-	var nonce [24]byte
-	_, err := rand.Read(nonce[:])
-	if err != nil {
-		return "", err
-	}
-
-	box := secretbox.Seal(nonce[:], in, &nonce, &key)
+// ErrInvalidToken is returned when a token cannot be decrypted with any of the
+// given keys, or is not in the expected format.
+var ErrInvalidToken = errors.New("session: invalid token")
+
+// Encrypt encrypts and authenticates the plaintext using nacl/secretbox with
+// the given key and a random 24 byte nonce. The returned token is the nonce
+// followed by the sealed box, encoded using unpadded URL-safe base64 (RFC 4648
+// section 5). This is the same format used for session cookies, so Encrypt and
+// Decrypt can be used to interoperate with other services which hold the same
+// key. Note that the plaintext of a session cookie is a 4 byte envelope header
+// followed by the session state encoded with the session's Codec, which is gob
+// by default.
+func Encrypt(plaintext []byte, key [32]byte) (string, error) {
+	return encrypt(plaintext, key, rand.Reader)
+}
 
-	return base64.RawURLEncoding.EncodeToString(box), nil
+// Decrypt reverses Encrypt, trying each of the given keys in turn. If the token
+// can't be opened with any of the keys then ErrInvalidToken is returned.
+func Decrypt(token string, keys ...[32]byte) ([]byte, error) {
+	return decrypt(token, keys)
 }
 
-func decrypt(token string, keys [][32]byte) ([]byte, error) {
-	box, err := base64.RawURLEncoding.DecodeString(token)
-	if err != nil {
-		return nil, errInvalidToken
+// random returns the source of randomness used for nonces. Reads from a
+// custom Rand are checked for repeats, unless UnguardedRand is set, as
+// crypto/rand.Reader can be trusted not to produce them.
+func (s *Session) random() io.Reader {
+	if s.Rand != nil && s.UnguardedRand {
+		return s.Rand
 	}
-
-	if len(box) < 24 {
-		return nil, errInvalidToken
+	if s.Rand != nil {
+		return guardedReader{r: s.Rand, guard: &s.randGuard}
 	}
-	var nonce [24]byte
-	copy(nonce[:], box[:24])
+	return rand.Reader
+}
 
-	for _, key := range keys {
-		out, ok := secretbox.Open(nil, box[24:], &nonce, &key)
-		if ok {
-			return out, nil
-		}
-	}
+func encrypt(in []byte, key [32]byte, random io.Reader) (string, error) {
+	return sealToken(SecretBox{}, in, key, random)
+}
 
-	return nil, errInvalidToken
+func decrypt(token string, keys [][32]byte) ([]byte, error) {
+	out, _, _, err := openToken([]Cipher{SecretBox{}}, token, keys)
+	return out, err
 }
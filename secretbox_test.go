@@ -2,9 +2,28 @@ package sessions
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/nacl/secretbox"
 )
 
+// seal encrypts in with a fixed nonce, so that the result can be compared with
+// the test vectors.
+func seal(in []byte, nonce [24]byte, key [32]byte) string {
+	box := secretbox.Seal(nonce[:], in, &nonce, &key)
+
+	return base64.RawURLEncoding.EncodeToString(box)
+}
+
 func TestEncryptDecrypt(t *testing.T) {
 	key1 := [32]byte{}
 	copy(key1[:], []byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
@@ -13,7 +32,7 @@ func TestEncryptDecrypt(t *testing.T) {
 	copy(key2[:], []byte("3j4a0lniSrNb4xMdkYjsgG74mjRCF75u"))
 
 	message1 := []byte("foo bar baz")
-	token, err := encrypt(message1, key2)
+	token, err := encrypt(message1, key2, rand.Reader)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -27,7 +46,148 @@ func TestEncryptDecrypt(t *testing.T) {
 	}
 
 	_, err = decrypt(token, [][32]byte{key1})
-	if err != errInvalidToken {
-		t.Errorf("got %v: expect %q", err, errInvalidToken)
+	if err != ErrInvalidToken {
+		t.Errorf("got %v: expect %q", err, ErrInvalidToken)
+	}
+}
+
+func TestTokenVectors(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "token_vectors.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var vectors []struct {
+		Key       string
+		Nonce     string
+		Plaintext string
+		Token     string
+	}
+	err = json.NewDecoder(f).Decode(&vectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range vectors {
+		var key [32]byte
+		var nonce [24]byte
+		hex.Decode(key[:], []byte(v.Key))
+		hex.Decode(nonce[:], []byte(v.Nonce))
+		plaintext, err := hex.DecodeString(v.Plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token := seal(plaintext, nonce, key)
+		if token != v.Token {
+			t.Errorf("got %q: expected %q", token, v.Token)
+		}
+
+		out, err := Decrypt(v.Token, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, plaintext) {
+			t.Errorf("got %q: expected %q", out, plaintext)
+		}
+	}
+}
+
+func TestSessionVectors(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "session_vectors.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var vectors []struct {
+		Description string
+		Key         string
+		Token       string
+		Plaintext   string
+		Values      map[string]interface{}
+		Expiry      time.Time
+	}
+	err = json.NewDecoder(f).Decode(&vectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range vectors {
+		var key [32]byte
+		hex.Decode(key[:], []byte(v.Key))
+		plaintext, err := hex.DecodeString(v.Plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := Decrypt(v.Token, key)
+		if err != nil {
+			t.Fatalf("%s: %v", v.Description, err)
+		}
+		if !bytes.Equal(out, plaintext) {
+			t.Errorf("%s: got %x: expected %x", v.Description, out, plaintext)
+		}
+		box, err := base64.RawURLEncoding.DecodeString(v.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var nonce [24]byte
+		copy(nonce[:], box)
+		if token := seal(plaintext, nonce, key); token != v.Token {
+			t.Errorf("%s: got %q: expected %q", v.Description, token, v.Token)
+		}
+
+		// The configured codec doesn't matter, as the envelope names it.
+		c := newCache(time.Hour)
+		err = c.decode(GobCodec{}, []Cipher{SecretBox{}}, v.Token, [][32]byte{key})
+		if err != nil {
+			t.Fatalf("%s: %v", v.Description, err)
+		}
+		if !c.Expiry.Equal(v.Expiry) {
+			t.Errorf("%s: got %v: expected %v", v.Description, c.Expiry, v.Expiry)
+		}
+		// Compare the values as JSON, which has a single number type.
+		got, err := json.Marshal(c.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var values map[string]interface{}
+		json.Unmarshal(got, &values)
+		if !reflect.DeepEqual(values, v.Values) {
+			t.Errorf("%s: got %v: expected %v", v.Description, values, v.Values)
+		}
+	}
+}
+
+func TestRand(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Put(r, "foo", "bar")
+
+	s.Rand = bytes.NewReader(bytes.Repeat([]byte{7}, 24))
+	token, err := s.Export(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	box, err := base64.RawURLEncoding.DecodeString(string(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(box[:24], bytes.Repeat([]byte{7}, 24)) {
+		t.Errorf("got %x: expected %x", box[:24], bytes.Repeat([]byte{7}, 24))
+	}
+
+	_, err = s.Export(r)
+	if err == nil {
+		t.Errorf("got %v: expected an error when the random source is exhausted", err)
 	}
 }
@@ -3,6 +3,7 @@
 // nacl/secretbox.
 //
 // Example usage:
+//
 //	package main
 //
 //	import (
@@ -34,16 +35,19 @@
 //		msg := session.GetString(r, "msg")
 //		w.Write([]byte(msg))
 //	}
-//
 package sessions
 
 import (
 	"bufio"
 	"bytes"
 	"errors"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -62,11 +66,79 @@ type Session struct {
 	HttpOnly bool
 
 	// Lifetime sets the maximum length of time that a session is valid for
-	// before it expires. The lifetime is an 'absolute expiry' which is set when
-	// the session is first created and does not change. The default value is 24
-	// hours.
+	// before it expires. Unless Rolling is true, the lifetime is an 'absolute
+	// expiry' which is set when the session is first created and does not
+	// change. The default value is 24 hours.
 	Lifetime time.Duration
 
+	// LifetimeJitter sets the maximum fraction of the Lifetime by which the
+	// expiry of a new or renewed session is randomly adjusted. For example, a
+	// value of 0.05 gives each session a lifetime within ±5% of Lifetime, so
+	// that sessions created at the same moment (such as when many users log
+	// in from a marketing email) don't all expire at once. The default value
+	// is 0, which means that no jitter is applied.
+	LifetimeJitter float64
+
+	// ClockSkew sets how long after its expiry time a session is still
+	// accepted. When a fleet of servers have slightly desynchronized clocks,
+	// setting this to a few seconds stops users from being logged out early
+	// or just-expired sessions being accepted inconsistently. The same
+	// tolerance applies to remembered devices and pending two-factor
+	// authentication deadlines. The default value is 0.
+	ClockSkew time.Duration
+
+	// InvalidBefore causes all session tokens which were issued before the
+	// given time to be rejected, as if they were invalid. Operators can use
+	// it to instantly invalidate every existing session (for example, after a
+	// compromise) without rotating the secret keys. Note that a token is
+	// re-issued whenever its session data is saved, so this applies to the
+	// time that the token was last issued, not when the session began.
+	// Remember-device cookies issued before the given time are rejected too.
+	// The default value is the zero time, which means that no tokens are
+	// rejected.
+	InvalidBefore time.Time
+
+	// Rolling sets whether the session expiry should be extended on each
+	// request, so that the session expires after Lifetime without any
+	// activity rather than Lifetime after it was created. The default value
+	// is false.
+	Rolling bool
+
+	// RollingThreshold controls how often the session cookie is re-issued when
+	// Rolling is true. The expiry is only extended (and the cookie only re-sent)
+	// once it would move by more than this fraction of the Lifetime, so that
+	// every request doesn't trigger a Set-Cookie header. The default value is
+	// 0.1, which means the cookie is re-issued at most once every 10% of the
+	// Lifetime.
+	RollingThreshold float64
+
+	// RollingFilter, if set, is called for each request when Rolling is true,
+	// and the session expiry is only extended if it returns true. This can be
+	// used to stop polling or heartbeat endpoints from keeping idle sessions
+	// alive forever. SkipRolling() can be used to make the same decision from
+	// within a handler. The default value is nil, which means that the expiry
+	// is extended on every request.
+	RollingFilter func(r *http.Request) bool
+
+	// IdleTimeout sets how long a session can go without any requests before
+	// it expires, in addition to the absolute Lifetime. The expiry is slid
+	// forward on each request, but never past Lifetime after the session was
+	// created (or last renewed), so active users stay logged in without the
+	// Lifetime having to be enormous. As with Rolling, the session cookie is
+	// only re-issued once the expiry would move by more than RollingThreshold
+	// (here, a fraction of the IdleTimeout), and RollingFilter and
+	// SkipRolling() decide which requests count as activity. The default
+	// value is 0, which means that there is no idle timeout.
+	IdleTimeout time.Duration
+
+	// MaxBufferSize sets the maximum number of bytes of the response body that
+	// the Enable middleware will hold in memory. Once a handler writes more than
+	// this, the session cookie is sent and the rest of the response is streamed
+	// directly to the client. Any changes made to the session data after that
+	// point will not be saved. The default value is 0, which means that the
+	// whole response is buffered.
+	MaxBufferSize int
+
 	// Path sets the 'Path' attribute on the session cookie. The default value
 	// is "/". Passing the empty string "" will result in it being set to the
 	// path that the cookie was issued from.
@@ -76,9 +148,16 @@ type Session struct {
 	// (i.e. whether it should be retained after a user closes their browser).
 	// The default value is true, which means that the session cookie will not
 	// be destroyed when the user closes their browser and the appropriate
-	// 'Expires' and 'MaxAge' values will be added to the session cookie.
+	// 'Expires' and 'MaxAge' values will be added to the session cookie. It
+	// can be overridden for an individual session with SetPersist() or
+	// RememberMe().
 	Persist bool
 
+	// RememberLifetime sets the lifetime of sessions for which RememberMe()
+	// has been called with true, in place of Lifetime. The default value is
+	// 30 days.
+	RememberLifetime time.Duration
+
 	// Secure sets the 'Secure' attribute on the session cookie. The default
 	// value is false. It's recommended that you set this to true and serve all
 	// requests over HTTPS in production environments.
@@ -89,45 +168,628 @@ type Session struct {
 	// attribute or value in the session cookie then you should set this to 0.
 	SameSite http.SameSite
 
+	// Partitioned sets whether the 'Partitioned' attribute is added to the
+	// session cookie, so that browsers which partition third-party cookies
+	// (CHIPS) keep it when the application is embedded on another site.
+	// Partitioned cookies must also be Secure. The default value is false.
+	Partitioned bool
+
+	// CookiePrefix is added to the start of the session cookie's name. Use
+	// SecurePrefix ("__Secure-") or HostPrefix ("__Host-") to have browsers
+	// enforce the cookie's Secure, Path and Domain attributes; CheckConfig
+	// reports settings which are incompatible with the prefix. Note that
+	// changing the CookiePrefix invalidates all existing sessions, unless
+	// they are moved with MigrateFrom. The default value is "".
+	CookiePrefix string
+
+	// ExpiryCookieName, if set, is the name of a companion cookie which is
+	// sent alongside the session cookie whenever it is saved, and holds only
+	// the session's expiry time as a Unix timestamp in seconds. Unlike the
+	// session cookie it isn't HttpOnly or encrypted, so front-end code can
+	// read it to warn users before their session expires. It is deleted when
+	// the session is destroyed, and isn't sent when a Transport is set. The
+	// default value is "".
+	ExpiryCookieName string
+
 	// ErrorHandler allows you to control behaviour when an error is encountered
 	// loading or writing the session cookie. By default the client is sent a
 	// generic "500 Internal Server Error" response and the actual error message
 	// is logged using the standard logger. If a custom ErrorHandler function is
-	// provided then control will be passed to this instead.
+	// provided then control will be passed to this instead. The error is an
+	// *Error, which records whether the session was being loaded or saved.
 	ErrorHandler func(http.ResponseWriter, *http.Request, error)
-	keys         [][32]byte
+
+	// Logger, if set, is sent a structured event for every error encountered
+	// loading or saving a session, with the request method and path and the
+	// phase and kind of the error, before the ErrorHandler is called. A
+	// *slog.Logger can be used directly. When a Logger is set, the default
+	// ErrorHandler no longer writes to the standard logger. By default there
+	// is no Logger.
+	Logger Logger
+
+	// OnExpire is called when a request arrives with a session cookie which
+	// is still valid but whose session has expired, and is passed the data
+	// from the expired session. It can be used to release any resources tied
+	// to the session. Note that browsers will normally delete persistent
+	// session cookies themselves when they expire, so it is not guaranteed to
+	// be called for every session. By default it is nil.
+	OnExpire func(r *http.Request, data map[string]interface{})
+
+	// OnLoad is called by the Enable middleware after an existing session has
+	// been loaded and decoded, and is passed its data. It can be used for
+	// metrics or last-seen tracking. The session is already available from the
+	// request, so use methods such as Put() rather than changing the data map
+	// directly if you want changes to be saved. By default it is nil.
+	OnLoad func(r *http.Request, data map[string]interface{})
+
+	// OnSave is called immediately before the session data is encoded and
+	// saved, and is passed the data. It is only called when the session is
+	// going to be saved, and not when it has been destroyed. Any changes that
+	// it makes to the data map are included in the saved session, but it must
+	// not call any of the session's methods. By default it is nil.
+	OnSave func(r *http.Request, data map[string]interface{})
+
+	// AfterResponse is called by the Enable middleware once the response has
+	// been written, and is passed the status code and the number of bytes of
+	// response body sent to the client. The session is still available from
+	// the request, so it can be used for session-aware access logging and
+	// metrics without wrapping the response again. It isn't called if the
+	// session couldn't be loaded. By default it is nil.
+	AfterResponse func(w http.ResponseWriter, r *http.Request, status int, bytes int)
+
+	// SchemaVersion is the version number of the structure of your session
+	// data. When you rename keys or change the shape of values, increment the
+	// version and add a corresponding function to Migrations. The default value
+	// is 0.
+	SchemaVersion int
+
+	// Migrations holds functions which upgrade session data from the schema
+	// version given by the map key to the next version. When a session cookie
+	// with an older schema version is loaded, the necessary migrations are run
+	// in order before any handlers see the data. If a migration returns an
+	// error then the session data is discarded and a new session is started.
+	Migrations map[int]MigrationFunc
+
+	// StrictTypes sets whether only basic types and types registered with
+	// RegisterType() may be added to the session data. When it is true, adding
+	// a value of any other type will fail with an error naming the key and the
+	// type, rather than the whole response failing when the session data is
+	// encoded. The default value is false.
+	StrictTypes bool
+
+	// CheckEncoding sets whether values are trial encoded when they are added
+	// to the session data. When it is true, adding a value which can't be
+	// encoded (such as a channel, a function or an unregistered struct) will
+	// fail at the call site with an error naming the key, rather than the
+	// whole response failing when the session data is saved. This has a
+	// performance cost, so is intended for use during development and
+	// testing. The default value is false.
+	CheckEncoding bool
+
+	// SkipUnchanged sets whether the session data should be compared against
+	// the data that was loaded at the start of the request, so that the
+	// session cookie isn't re-sent when a handler has only Put the same values
+	// again. This avoids needless Set-Cookie headers (which can stop responses
+	// from being cached) from idempotent handlers, at the cost of taking a deep
+	// copy of the session data on each request. The default value is false.
+	SkipUnchanged bool
+
+	// Binding, if set, returns a value identifying the client's connection
+	// (such as TLS exported keying material, see TLSExporterBinding) which
+	// the session is bound to. A hash of the value is stored with the session
+	// data when the session is created, and a session cookie presented with a
+	// different value is rejected as if it were invalid, so a stolen cookie
+	// can't be replayed by another TLS client. UserAgentBinding binds to a
+	// fingerprint of the User-Agent instead, and CombineBindings binds to
+	// several values at once. If the function returns nil, the session is not
+	// bound. The default value is nil.
+	Binding func(r *http.Request) []byte
+
+	// BindClientCert sets whether sessions should be bound to the TLS client
+	// certificate used by a server which requires mutual TLS. The SHA-256
+	// fingerprint and subject of the certificate are recorded when the session
+	// is created and can be retrieved with ClientCert(). A session cookie
+	// presented with a different client certificate (or none) is rejected as
+	// if it were invalid. The default value is false.
+	BindClientCert bool
+
+	// LegacySameSite sets whether the 'SameSite=None' attribute should be
+	// left off cookies sent to clients which are known to mishandle it (such
+	// as iOS 12, Safari on macOS 10.14 and Chrome 51 to 66). Those clients
+	// either reject such cookies or treat them as 'SameSite=Strict', which
+	// silently breaks cross-site sessions. It has no effect unless SameSite is
+	// http.SameSiteNoneMode. The default value is false.
+	LegacySameSite bool
+
+	// AcceptQueryToken, if set, is called for requests which don't have a
+	// session cookie. If it returns true, the session token is read from the
+	// query string parameter named by QueryTokenParam instead. This is useful
+	// for OAuth-style redirects and webhook callbacks from third parties which
+	// strip cookies. Tokens for use in URLs can be created with QueryToken(),
+	// and each one is only accepted once by this Session. Used tokens are
+	// remembered in memory until they expire, so the one-time check only
+	// holds within a single process: if your application runs on several
+	// instances, a token can be replayed once against each of them, and once
+	// more after a restart, unless the callbacks are routed to one instance.
+	// The session cookie is sent with the response to a request which used a
+	// query string token. The default value is nil, which means
+	// that query string tokens are never accepted.
+	AcceptQueryToken func(r *http.Request) bool
+
+	// QueryTokenParam sets the name of the query string parameter which holds
+	// the session token when AcceptQueryToken returns true. The default value
+	// is "session_token".
+	QueryTokenParam string
+
+	// ForwardKeys lists the session data keys (such as a user ID or roles)
+	// which should be forwarded to upstream services when the Enable
+	// middleware is used in a reverse proxy or gateway. After the session is
+	// loaded, the values are added to the request in a signed ForwardHeader,
+	// and any ForwardHeader sent by the client is removed. Upstream services
+	// which hold the same secret key can verify and read the values with
+	// ForwardedClaims(). The default value is nil, which means that nothing
+	// is forwarded.
+	ForwardKeys []string
+
+	// ForwardHeader sets the name of the header used for ForwardKeys. The
+	// default value is "X-Session-Claims".
+	ForwardHeader string
+
+	// SkipSaveMethods lists HTTP methods (such as "HEAD", "OPTIONS" and
+	// "TRACE") for which changes to the session data are never saved, as if
+	// SkipSave() had been called. This avoids cookies being issued in response
+	// to preflight requests and health checks. The default value is nil.
+	SkipSaveMethods []string
+
+	// Audit, if set, records session creation, renewal, destruction and
+	// changes of the user who owns the session (the value of the
+	// PrincipalKey), after the session has been saved successfully. Use
+	// NewAuditLog() to write the events to an append-only log file, or
+	// implement AuditSink to send them elsewhere. The default value is nil.
+	Audit AuditSink
+
+	// OnCreate, OnRenew and OnDestroy are called after the session has been
+	// saved successfully at the end of a request in which it was created,
+	// renewed or destroyed, and are passed the same event that is sent to the
+	// Audit sink. They can be used to write application audit logs or push
+	// security events without wrapping every handler. By default they are
+	// nil.
+	OnCreate  func(r *http.Request, event AuditEvent)
+	OnRenew   func(r *http.Request, event AuditEvent)
+	OnDestroy func(r *http.Request, event AuditEvent)
+
+	// Publisher, if set, is sent the same events as the Audit sink, so that
+	// other services, such as WebSocket gateways, can react to logins and
+	// logouts as they happen. redisstore.NewPublisher() publishes them to a
+	// Redis channel. While Audit or Publisher is set, each session is given a
+	// random ID, which is sent with its events. The default value is nil.
+	Publisher Publisher
+
+	// Metrics, if set, is notified of sessions being loaded and created,
+	// session tokens which are rejected, and the size of session cookies and
+	// how long they take to encode. If it also implements StoreMetrics, it is
+	// notified of the latency and errors of each store operation, and if it
+	// implements DestroyMetrics, of sessions being destroyed. The default
+	// value is nil.
+	Metrics Metrics
+
+	// ExpiredHandler, if set, is served instead of the wrapped handler when a
+	// request for which IsBackgroundRequest returns true (such as an AJAX,
+	// fetch or htmx request) presents a session token which has expired or
+	// is invalid. Without it, such requests silently get a new anonymous
+	// session, which can break the assumptions of a single-page app. Use
+	// ExpiredResponse() for a standard 401 response. The default value is
+	// nil.
+	ExpiredHandler http.Handler
+
+	// IsBackgroundRequest decides whether a request was made by script rather
+	// than by the user navigating, for ExpiredHandler. The default is
+	// DefaultIsBackgroundRequest.
+	IsBackgroundRequest func(r *http.Request) bool
+
+	// CookielessHandler, if set, is served instead of the wrapped handler
+	// when a client appears not to be returning the session cookie (for
+	// example, a bot or a browser which blocks cookies). A client is treated
+	// as cookieless once CookielessThreshold new sessions in a row have been
+	// issued to the same IP address and User-Agent without the cookie coming
+	// back. A long-lived probe cookie, named after the session cookie with a
+	// "-probe" suffix, is sent with each new session, and clients which
+	// return it are never treated as cookieless. Even so, several new
+	// visitors behind one NAT gateway or proxy, using the same browser, look
+	// like a single cookieless client on their first visits, so the handler
+	// should let the client carry on (for example, a warning page with a
+	// link back) rather than block it. Clients are tracked in memory, so the
+	// detection is per process. The default value is nil, which means that
+	// clients are not tracked.
+	CookielessHandler http.Handler
+
+	// CookielessThreshold sets how many new sessions in a row must be issued
+	// to a client before CookielessHandler is used. The default value is 3.
+	CookielessThreshold int
+
+	// CreationLimiter, if set, limits how often new sessions are issued, so
+	// that bots which never return the session cookie can't force a fresh
+	// session to be encoded, encrypted (and committed to the Store) on every
+	// request. When it doesn't allow a new session, the session is not saved
+	// and no session cookie is sent, but the response is otherwise unchanged.
+	// Existing sessions are never limited. Use NewRateLimiter for a
+	// per-IP-address limit. The default value is nil.
+	CreationLimiter Limiter
+
+	// CacheControl, if set, is used to replace the Cache-Control header of any
+	// response which sets a cookie, so that CDNs and other shared caches never
+	// store a page with a user's session cookie attached. A typical value is
+	// "private, no-store". Responses which don't set a cookie are not
+	// affected. The default value is "", which means that the Cache-Control
+	// header is left unchanged.
+	CacheControl string
+
+	// Rand is the source of randomness used to generate nonces when
+	// encrypting session cookies. It can be set to use a specific DRBG, or to
+	// make tokens deterministic in tests. It must be safe for concurrent use.
+	// If it fails, or returns the same bytes as one of its last 16 reads of
+	// the same length, the session isn't saved and the ErrorHandler is called
+	// with an error wrapping ErrEncryptFailed. The check only catches a reader
+	// which is constant or cycles through a few outputs. A seeded math/rand
+	// source passes it, and gives deterministic tokens for each new Session.
+	// The default value is nil, which means that crypto/rand.Reader is used.
+	Rand io.Reader
+
+	// UnguardedRand turns off the check for repeated reads from Rand, so that
+	// a constant reader can be used in tests which need identical tokens
+	// across several saves. Never set it in production: a repeated nonce
+	// exposes the session data. The default value is false.
+	UnguardedRand bool
+
+	// Debug sets whether the handler returned by DebugHandler() renders the
+	// session data. It should only be enabled during development. The default
+	// value is false.
+	Debug bool
+
+	// Validators holds functions which are used to check values when they are
+	// added to the session data, keyed by the name of the session data key that
+	// they apply to. Validators registered under the empty key "" are applied
+	// to all keys. If a value is rejected, the session isn't saved and the
+	// ErrorHandler is called with a *ValidationError, unless the value was added
+	// with PutChecked(), which returns the error instead. By default there are
+	// no validators.
+	Validators map[string][]ValidatorFunc
+
+	// PrincipalKey is the name of the session data key which holds the
+	// identity of the authenticated user (for example "userID"). Whenever the
+	// value for this key is added or changed with Put(), the session is
+	// renewed: it gets a fresh expiry time and a new token, which protects
+	// against session fixation attacks. By default it is empty, meaning that
+	// sessions are never renewed automatically.
+	PrincipalKey string
+
+	// LogoutPreserveKeys lists session data keys which should be kept when
+	// LogoutUser() is called, such as non-sensitive user preferences. All other
+	// session data is removed on logout. By default it is empty.
+	LogoutPreserveKeys []string
+
+	// OnSaveDiff is called after the session data has been successfully saved,
+	// and is passed the keys which were added, changed or removed during the
+	// request. It can be used for analytics, or to debug unexpected cookie
+	// churn. By default it is nil.
+	OnSaveDiff func(r *http.Request, diff Diff)
+
+	// OnImpersonate is called whenever Impersonate() or StopImpersonating()
+	// changes the effective user, and can be used to record an audit trail.
+	// By default it is nil.
+	OnImpersonate func(r *http.Request, event ImpersonationEvent)
+
+	// Pending2FATimeout sets how long a user has to complete a second
+	// authentication factor after StartPending2FA() is called. The default
+	// value is 5 minutes.
+	Pending2FATimeout time.Duration
+
+	// RecordClientInfo sets whether the IP address and User-Agent of the
+	// request which creates a new session are recorded, along with the
+	// creation time. They are stored alongside (but separately from) the
+	// session data, so handlers can't overwrite them, and can be retrieved
+	// with ClientInfo(). The default value is false.
+	RecordClientInfo bool
+
+	// OnClientChange is called at the start of each request if the client
+	// appears to differ significantly from the one recorded when the session
+	// was created (see RecordClientInfo and ClientChanged). The request
+	// passed to it has the session data in its context, so the hook can
+	// destroy the session, require step-up authentication or notify the user.
+	// It is called on every request for which the client differs. By default
+	// it is nil.
+	OnClientChange func(r *http.Request, recorded, current ClientInfo)
+
+	// ClientChanged decides whether the current client differs significantly
+	// from the recorded one, and can be replaced to implement custom checks
+	// (such as comparing ASNs). The default is DefaultClientChanged.
+	ClientChanged func(recorded, current ClientInfo) bool
+
+	// ReauthTimeout sets how long after the user last authenticated (with
+	// LoginUser() or Reauthenticate()) NeedsReauth() starts returning true.
+	// It should be shorter than the Lifetime. The default value is 15 minutes.
+	ReauthTimeout time.Duration
+
+	// RememberDeviceCookieName sets the name of the long-lived cookie used by
+	// RememberDevice(). The default value is "remember_device".
+	RememberDeviceCookieName string
+
+	// RememberDeviceLifetime sets how long a remember-device cookie is valid
+	// for. The default value is 30 days.
+	RememberDeviceLifetime time.Duration
+
+	// SensitiveKeys lists session data keys which hold particularly sensitive
+	// information, such as email addresses or government ID numbers. The values
+	// for these keys are encrypted a second time, using the separate key set
+	// with SetFieldKey(), before the session data is encoded. By default there
+	// are no sensitive keys.
+	SensitiveKeys []string
+
+	// Codec sets how the session state is encoded before it is encrypted. Use
+	// JSONCodec if non-Go services need to read the decrypted session data.
+	// Sessions encoded with GobCodec or JSONCodec can still be loaded after
+	// switching between the two, but switching to or from any other Codec
+	// invalidates all existing sessions. The default value is GobCodec.
+	Codec Codec
+
+	// ManualSave sets whether the middleware leaves saving the session to the
+	// handler. When it is true, the session is only saved when the handler
+	// calls Commit(), and the response body is not buffered. The default
+	// value is false.
+	ManualSave bool
+
+	// Lazy sets whether the middleware waits until the session is first used
+	// before loading it from the request, so that requests which never touch
+	// the session don't pay to decrypt and decode the cookie. A session which
+	// is never used is never saved. Lazy has no effect when ForwardKeys,
+	// ExpiredHandler or CookielessHandler are set, as they need the session
+	// before the handler runs. The default value is false.
+	Lazy bool
+
+	// Skip, if set, is called by the Enable middleware with each request, and
+	// if it returns true the request is passed straight to the next handler
+	// without a session, for example for static assets or health checks. The
+	// session must not be used by handlers for skipped requests.
+	Skip func(r *http.Request) bool
+
+	// Chunk sets whether a session cookie which would be longer than 4096
+	// bytes is split across several cookies, named "session-1", "session-2"
+	// and so on, instead of the session failing to save with
+	// ErrCookieTooLong. The chunks are reassembled when the session is loaded.
+	// Bear in mind that browsers limit the number of cookies per domain, and
+	// servers limit the total size of request headers (often to 8KB), so this
+	// is only suitable for modest amounts of extra data. The default value is
+	// false.
+	Chunk bool
+
+	// Store sets a server-side store for the session data. When it is set, the
+	// session cookie only carries an opaque session token, and the encrypted
+	// session data is kept in the store instead, so it isn't limited to 4096
+	// bytes and a session can be revoked by deleting it from the store. By
+	// default there is no store, and all of the session data is kept in the
+	// session cookie.
+	Store Store
+
+	// TokenHint, if set, returns a short routing hint, such as a shard or
+	// region name, which is put in front of each new Store token, separated
+	// by a ".", so that load balancers and stores can route a request using
+	// ParseTokenHint without decrypting anything. A hint may be up to 32
+	// letters, digits, '-' or '_', and the session fails to save with any
+	// other hint. The hint isn't encrypted or authenticated, so a client can
+	// change it, but the token after it is still looked up as a whole. By
+	// default it is nil, and Store tokens have no hint.
+	TokenHint func(r *http.Request) string
+
+	// MergeConcurrent sets whether changes made by concurrent requests for
+	// the same session (such as AJAX requests from several tabs) are merged
+	// when the session is saved, instead of the last request to finish
+	// overwriting the others' changes. Each saved session carries a revision
+	// number, and if the session in the Store has been saved by another
+	// request since it was loaded, only the keys which this request added,
+	// changed or removed are applied on top of it. It needs a Store, as with
+	// cookies alone the server never sees the other requests' changes.
+	//
+	// The merge narrows rather than closes the race between requests: the
+	// Store is read and written in separate operations, so if two requests
+	// save at the same moment they can both read the same revision, and the
+	// last to write still wins. If the session in the Store can't be decoded,
+	// the session isn't saved and the ErrorHandler is called with an error
+	// wrapping ErrDecodeFailed. The default value is false.
+	MergeConcurrent bool
+
+	// OnConflict is called when MergeConcurrent merges the session data, and
+	// is passed the keys which both this request and another request changed.
+	// This request's values are saved for those keys. By default it is nil.
+	OnConflict func(r *http.Request, keys []string)
+
+	// StoreRetries sets how many times a Store operation which fails is
+	// retried before the error is returned, so that a brief blip on the
+	// connection to the backend doesn't fail the request. Bear in mind that
+	// the request waits while the operation is retried. The default value is
+	// 0, which means that failed operations aren't retried.
+	StoreRetries int
+
+	// StoreRetryBackoff sets how long to wait before the first retry of a
+	// failed Store operation. The wait is doubled for each further retry. The
+	// default value is 50 milliseconds.
+	StoreRetryBackoff time.Duration
+
+	// StoreRetryable reports whether a Store error is transient and so worth
+	// retrying. By default it is nil, and every error is retried.
+	StoreRetryable func(err error) bool
+
+	// StoreFallback sets whether sessions are kept in the session cookie while
+	// the Store is unavailable, so that users can carry on during an outage.
+	// When saving to the Store fails, the encrypted session data is sent in
+	// the session cookie instead, as long as it fits in 4096 bytes, and the
+	// Store is skipped for StoreFallbackCooldown. Sessions which were saved
+	// in the cookie are moved back to the Store the next time they are loaded
+	// after the cool-down. Sessions which were saved in the Store before the
+	// outage can't be loaded until it is over. The default value is false.
+	StoreFallback bool
+
+	// StoreFallbackCooldown sets how long the Store is skipped for after it
+	// fails when StoreFallback is set. The default value is 30 seconds.
+	StoreFallbackCooldown time.Duration
+
+	// Transport, if set, carries the session token between the client and
+	// the server instead of the session cookie. Use HeaderTransport for
+	// clients, such as mobile apps, which call JSON APIs and can't rely on
+	// cookies. The session token is still encrypted in the same way, and the
+	// cookie settings (other than the Lifetime) are ignored. By default the
+	// session cookie is used.
+	Transport Transport
+
+	// KeyProvider supplies the secret keys used to encrypt and decrypt session
+	// cookies, instead of the keys passed to New(), so that keys can be
+	// rotated while the application is running. Whichever way the keys are
+	// set, a session cookie which was encrypted with one of the old keys is
+	// re-encrypted with the current key when it is next loaded, so that old
+	// keys can be retired once every active session has been seen. By default
+	// there is no KeyProvider.
+	KeyProvider KeyProvider
+
+	// OnOversize decides what happens when the session cookie would be
+	// longer than 4096 bytes: OversizeError fails to save the session with
+	// ErrCookieTooLong, OversizeDrop removes keys in the order given by
+	// DropPriority until it fits, and OversizeSpill keeps the session data in
+	// the OversizeStore instead of the cookie. It has no effect when Store,
+	// Transport or Chunk are set. The default value is OversizeError.
+	OnOversize OversizePolicy
+
+	// DropPriority is used by OversizeDrop, and returns the priority of a
+	// session data key. Keys with the lowest priority are dropped first, so
+	// give the keys which must be kept (such as the PrincipalKey) a high
+	// priority. If it is nil, no keys are dropped.
+	DropPriority func(key string) int
+
+	// OversizeStore is used by OversizeSpill to hold the data of sessions
+	// which are too large for the session cookie.
+	OversizeStore Store
+
+	// KeysFor, if set, is called with each request and returns the secret
+	// keys for it, in the same form as KeyProvider, so that a single Session
+	// can encrypt the cookies of each tenant of a multi-tenant application
+	// (for example, selected by r.Host) with that tenant's own keys. If it
+	// returns a nil current key, the session's usual keys are used. The
+	// candidate key set by SetCandidateKey() isn't used for tenant keys. It
+	// will panic if it returns a key which isn't 32 bytes long. By default it
+	// is nil.
+	KeysFor func(r *http.Request) (current []byte, old [][]byte)
+
+	// MigrateFrom, if set, is the Session which was previously used to
+	// manage sessions, for moving them to this Session's configuration (for
+	// example, from cookie storage to a Store, or to a new Path or Domain)
+	// without logging everyone out. When a session token can't be used by
+	// this Session, MigrateFrom is given the chance to load it instead, and
+	// the session is then saved using this Session, as if Migrate() had been
+	// called. By default there is no MigrateFrom.
+	MigrateFrom *Session
+
+	// Compress sets whether the encoded session data is compressed with gzip
+	// before it is encrypted, when that makes it smaller. This lets larger
+	// structured data fit within the 4096 byte cookie limit. Sessions can be
+	// loaded whether or not they were compressed, so this can be switched on
+	// and off freely. Bear in mind that compression leaks information about
+	// the session data through the length of the cookie, so don't enable it
+	// if an attacker can control part of the session data which is stored
+	// alongside secrets. The default value is false.
+	Compress bool
+
+	// LegacyFormat sets whether the session data is encoded without the
+	// envelope which records the version, codec and compression of the
+	// encoding. Sessions are loaded whether or not they have the envelope, so
+	// set this while rolling out an upgrade, until no instance running an
+	// older version of this package remains. The default value is false.
+	LegacyFormat bool
+
+	// Cipher sets the algorithm used to encrypt and authenticate session
+	// cookies. Use AESGCM if FIPS-approved algorithms are required, or
+	// SignedOnly if the session data should be readable by other services
+	// without the secret key. Note that changing the Cipher invalidates all
+	// existing sessions, unless the old Cipher is passed to WithCipher(). The
+	// default value is SecretBox.
+	Cipher Cipher
+
+	// CSRFHeader sets the name of the request header which RequireCSRF checks
+	// for a CSRF token. The default value is "X-CSRF-Token".
+	CSRFHeader string
+
+	// CSRFField sets the name of the form field which RequireCSRF checks for
+	// a CSRF token, if the CSRFHeader isn't present. The default value is
+	// "csrf_token".
+	CSRFField string
+
+	// CSRFFailureHandler, if set, is served by RequireCSRF instead of the
+	// wrapped handler when a request doesn't carry a valid CSRF token. By
+	// default the client is sent a "403 Forbidden" response.
+	CSRFFailureHandler http.Handler
+
+	keys             [][32]byte
+	oldCiphers       []Cipher
+	fieldKeys        [][32]byte
+	strict           bool
+	types            map[reflect.Type]bool
+	candidateKey     *[32]byte
+	candidatePercent int
+	usedTokens       usedTokens
+	breaker          storeBreaker
+	counts           sessionCounts
+	randGuard        randomGuard
+	cookielessCounts cookielessTracker
 }
 
 // New initializes a new Session object to hold the configuration settings for
 // your sessions.
 //
 // The key parameter is the secret you want to use to authenticate and encrypt
-// session cookies. It should be exactly 32 bytes long.
+// session cookies. It must be exactly 32 bytes long, and New will panic if it
+// isn't. If your secret is a different length (for example, a passphrase) use
+// NewWithDerivedKey() instead.
 //
 // Optionally, the variadic oldKeys parameter can be used to provide an arbitrary
 // number of old Keys. This can be used to ensure that valid cookies continue
 // to work correctly after key rotation.
 func New(key []byte, oldKeys ...[]byte) *Session {
-	keys := make([][32]byte, 1)
-	copy(keys[0][:], key)
-
-	for _, key := range oldKeys {
-		var newKey [32]byte
-		copy(newKey[:], key)
-		keys = append(keys, newKey)
+	keys, err := toKeys(append([][]byte{key}, oldKeys...))
+	if err != nil {
+		panic(err)
 	}
+	return newSession(keys)
+}
+
+func newSession(keys [][32]byte) *Session {
+	s := &Session{
+		Domain:           "",
+		HttpOnly:         true,
+		Lifetime:         24 * time.Hour,
+		Path:             "/",
+		RollingThreshold: 0.1,
+		Persist:          true,
+		Secure:           false,
+		SameSite:         http.SameSiteLaxMode,
+		Codec:            GobCodec{},
+		Validators:       make(map[string][]ValidatorFunc),
+		Migrations:       make(map[int]MigrationFunc),
+		keys:             keys,
 
-	return &Session{
-		Domain:       "",
-		HttpOnly:     true,
-		Lifetime:     24 * time.Hour,
-		Path:         "/",
-		Persist:      true,
-		Secure:       false,
-		SameSite:     http.SameSiteLaxMode,
-		ErrorHandler: defaultErrorHandler,
-		keys:         keys,
+		ClientChanged:            DefaultClientChanged,
+		Pending2FATimeout:        5 * time.Minute,
+		QueryTokenParam:          "session_token",
+		ForwardHeader:            "X-Session-Claims",
+		CookielessThreshold:      3,
+		IsBackgroundRequest:      DefaultIsBackgroundRequest,
+		ReauthTimeout:            15 * time.Minute,
+		RememberDeviceCookieName: "remember_device",
+		RememberDeviceLifetime:   30 * 24 * time.Hour,
+		RememberLifetime:         30 * 24 * time.Hour,
+		CSRFHeader:               "X-CSRF-Token",
+		CSRFField:                "csrf_token",
+		StoreRetryBackoff:        50 * time.Millisecond,
+		StoreFallbackCooldown:    30 * time.Second,
 	}
+	s.ErrorHandler = s.defaultErrorHandler
+	return s
 }
 
 // Enable is middleware which loads and saves session data to and from the
@@ -137,122 +799,606 @@ func New(key []byte, oldKeys ...[]byte) *Session {
 //
 // Note that session cookies are only sent to the client when the session data
 // has been modified.
+//
+// Because the response body is buffered, Enable will set the Content-Length
+// header automatically unless the handler has already set it, has declared
+// trailers, or has called Flush to start streaming the response.
+//
+// Requests to upgrade the connection, such as WebSocket handshakes, aren't
+// buffered, and the session is saved just before the connection is hijacked.
+// See UpgradeHeader for using the session with gorilla/websocket.
 func (s *Session) Enable(next http.Handler) http.Handler {
+	return s.middleware(next, false)
+}
+
+// LoadAndSave is an alternative to Enable which doesn't buffer the response
+// body. Instead, the session is saved and the session cookie is added to the
+// response headers just before the handler first calls WriteHeader, Write or
+// Flush, and everything the handler writes is passed straight through to the
+// client. This suits streaming responses and large downloads, but has some
+// trade-offs:
+//
+// Any changes made to the session data after the handler has started writing
+// the response will not be saved, so handlers must make all their changes
+// first. The Content-Length header is not set automatically, and
+// MaxBufferSize has no effect. If the session can't be saved then the
+// ErrorHandler is called and the handler's response is discarded, as with
+// Enable.
+func (s *Session) LoadAndSave(next http.Handler) http.Handler {
+	return s.middleware(next, true)
+}
+
+// middleware returns the handler for Enable and LoadAndSave. If passthrough is
+// true then the response is committed as soon as the handler starts writing
+// it, rather than being buffered.
+func (s *Session) middleware(next http.Handler, passthrough bool) http.Handler {
+	if s.strict {
+		err := s.CheckConfig()
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Skip != nil && s.Skip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		var err error
+		var lc *lazyCache
+		h := next
 
-		c, ok := r.Context().Value(contextKeyCache).(*cache)
-		if !ok {
+		c, ok := cacheFromContext(r.Context())
+		if !ok && s.lazy() {
+			lc = &lazyCache{session: s}
+			r = addLazyCacheToRequestContext(r, lc)
+		} else if !ok {
 			c, err = s.load(r)
 			if err != nil {
-				s.ErrorHandler(w, r, err)
+				s.handleError(w, r, withPhase(PhaseLoad, err))
 				return
 			}
 			r = addCacheToRequestContext(r, c)
+			s.prepare(r, c)
+			if s.cookieless(r, c) {
+				h = s.CookielessHandler
+			}
+			if c.rejected && s.ExpiredHandler != nil && s.IsBackgroundRequest != nil && s.IsBackgroundRequest(r) {
+				h = s.ExpiredHandler
+			}
 		}
 
-		bw := &bufferedResponseWriter{ResponseWriter: w}
-		next.ServeHTTP(bw, r)
-
-		err = s.save(w, c)
-		if err != nil {
-			s.ErrorHandler(w, r, err)
-			return
+		bw := &bufferedResponseWriter{
+			ResponseWriter: w,
+			session:        s,
+			cache:          c,
+			lazy:           lc,
+			passthrough:    passthrough || s.ManualSave || isUpgrade(r),
 		}
+		r = addWriterToRequestContext(r, bw)
+		bw.request = r
+
+		h.ServeHTTP(bw, r)
+		bw.commit(false)
+		bw.release()
 
-		if bw.code != 0 {
-			w.WriteHeader(bw.code)
+		if s.AfterResponse != nil {
+			status := bw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			s.AfterResponse(w, r, status, bw.written)
 		}
-		w.Write(bw.buf.Bytes())
 	})
 }
 
+// prepare runs the hooks for a session which has just been loaded from the
+// request, before it is used by the handler.
+func (s *Session) prepare(r *http.Request, c *cache) {
+	if s.needsSnapshot() {
+		c.snapshot()
+	}
+	if s.OnLoad != nil && !c.isNew {
+		s.OnLoad(r, c.Data)
+	}
+	if s.Metrics != nil && !c.isNew {
+		s.Metrics.SessionLoaded()
+	}
+	s.checkClient(r, c)
+	s.forward(r, c)
+	c.owner = c.Data[s.principalKey()]
+	for _, method := range s.SkipSaveMethods {
+		if r.Method == method {
+			c.skipSave = true
+		}
+	}
+	c.mu.Lock()
+	c.checkpoint()
+	c.mu.Unlock()
+}
+
+// Stream switches the current request from buffered to pass-through mode.
+// The session cookie is committed immediately, and everything the handler
+// writes afterwards is sent directly to the client. This is useful for
+// downloads, server-sent events and long-polling endpoints. Stream should be
+// called before the handler writes anything to the response.
+//
+// Any changes made to the session data after calling Stream will not be saved.
+// If the session cannot be saved then the ErrorHandler is called and the error
+// is returned. If the request isn't being handled by the Enable middleware then
+// Stream is a no-op.
+func (s *Session) Stream(r *http.Request) error {
+	bw, ok := r.Context().Value(contextKeyWriter).(*bufferedResponseWriter)
+	if !ok {
+		return nil
+	}
+	return bw.commit(true)
+}
+
+// Commit saves the session immediately, adding the session cookie to the
+// headers of w, rather than waiting for the middleware to save it at the end
+// of the request. This is useful before hijacking the connection or starting
+// long-running work, and is the only way that the session is saved when
+// ManualSave is true. If the session data is changed again after Commit, the
+// middleware saves it again as normal. The ErrorHandler is not called if the
+// session can't be saved; the error is returned instead.
+func (s *Session) Commit(w http.ResponseWriter, r *http.Request) error {
+	c := getCacheFromRequestContext(r)
+
+	err := withPhase(PhaseSave, s.save(w, r, c))
+	if err != nil {
+		return err
+	}
+	s.afterSave(r, c)
+
+	c.mu.Lock()
+	c.modified = false
+	c.touched = false
+	c.isNew = false
+	c.renewed = false
+	c.restarted = false
+	c.device = deviceNone
+	if c.snapshotted {
+		c.snapshot()
+	}
+	c.checkpoint()
+	c.mu.Unlock()
+	return nil
+}
+
 func (s *Session) load(r *http.Request) (*cache, error) {
-	cookie, err := r.Cookie(cookieName)
+	return s.loadToken(r, false)
+}
+
+// loadToken loads the session data for the request. If reload is true, then
+// the session has already been loaded once during the request, so hooks are
+// not called again and a query string token is accepted even though it has
+// been used.
+func (s *Session) loadToken(r *http.Request, reload bool) (*cache, error) {
+	token, fromQuery, err := s.token(r)
 	if err == http.ErrNoCookie {
-		return newCache(s.Lifetime), nil
+		return s.emptyCache(r), nil
 	} else if err != nil {
 		return nil, err
 	}
 
-	c := &cache{}
-	err = c.decode(cookie.Value, s.keys)
-	if err == errInvalidToken {
-		return newCache(s.Lifetime), nil
+	c := &cache{keys: s.tenantKeys(r)}
+	if s.Store != nil && s.StoreFallback && !fromQuery && strings.HasPrefix(token, inlinePrefix) {
+		err = s.loadInline(c, strings.TrimPrefix(token, inlinePrefix))
+	} else if s.Store != nil && !fromQuery {
+		err = s.find(s.Store, c, token)
+		if s.StoreFallback && errors.Is(err, ErrStoreFailed) {
+			s.breaker.trip(s.StoreFallbackCooldown)
+		}
+	} else if s.OversizeStore != nil && !fromQuery && strings.HasPrefix(token, spillPrefix) {
+		err = s.find(s.OversizeStore, c, strings.TrimPrefix(token, spillPrefix))
+		c.spilled = err == nil
+	} else if fromQuery {
+		err = c.decode(s.codec(), s.ciphers(), token, s.derivedKeys(c, queryKeyInfo))
+	} else {
+		err = c.decode(s.codec(), s.ciphers(), token, s.decryptionKeys(c))
+	}
+	if err == nil {
+		err = s.openFields(c)
+	}
+	if err == nil {
+		c.expireKeys(time.Now())
+	}
+	if err == nil && s.staleKey(c) {
+		// Re-encrypt the session with the current key when it is saved.
+		c.modified = true
+	}
+	if err == ErrInvalidToken {
+		if mc := s.loadMigrated(r, reload); mc != nil {
+			return mc, nil
+		}
+		if s.Metrics != nil && !reload {
+			if c.undecodable {
+				s.Metrics.DecodeFailed()
+			} else {
+				s.Metrics.InvalidToken()
+			}
+		}
+		return s.rejectedCache(r), nil
 	} else if err != nil {
+		if s.Metrics != nil && !reload && errors.Is(err, ErrDecodeFailed) {
+			s.Metrics.DecodeFailed()
+		}
 		return nil, err
 	}
 
-	if time.Now().After(c.Expiry) {
-		return newCache(s.Lifetime), nil
+	if s.expired(c.Expiry) {
+		if s.OnExpire != nil && !reload {
+			s.OnExpire(r, c.Data)
+		}
+		return s.rejectedCache(r), nil
+	}
+
+	if c.IssuedAt.Before(s.InvalidBefore) {
+		return s.rejectedCache(r), nil
+	}
+
+	if !s.bind(r, c) || !s.checkCert(r, c) {
+		return s.rejectedCache(r), nil
+	}
+
+	err = s.migrate(c)
+	if err != nil {
+		return s.rejectedCache(r), nil
+	}
+
+	if fromQuery {
+		if !reload && !s.usedTokens.use(token, c.Expiry) {
+			return s.rejectedCache(r), nil
+		}
+		// Send the session cookie to the client with the response.
+		c.modified = true
 	}
 
+	s.prunePending2FA(c)
+
 	return c, nil
 }
 
-func (s *Session) save(w http.ResponseWriter, c *cache) error {
+// rejectedCache returns the cache for a new session which replaces a session
+// token that was presented but couldn't be used.
+func (s *Session) rejectedCache(r *http.Request) *cache {
+	c := s.emptyCache(r)
+	c.rejected = true
+	return c
+}
+
+// expired reports whether the given expiry time has passed, allowing for the
+// ClockSkew tolerance. Both times are compared in UTC.
+func (s *Session) expired(expiry time.Time) bool {
+	return time.Now().UTC().After(expiry.UTC().Add(s.ClockSkew))
+}
+
+// roll extends the expiry of a rolling session, or a session with an
+// IdleTimeout, if it would move by more than the RollingThreshold.
+func (s *Session) roll(c *cache) {
+	if !s.Rolling && s.IdleTimeout <= 0 {
+		return
+	}
+
+	now := time.Now()
+	deadline := c.deadline()
+	if s.Rolling {
+		deadline = now.Add(s.sessionLifetime(c)).UTC()
+	}
+
+	expiry := deadline
+	window := s.sessionLifetime(c)
+	if s.IdleTimeout > 0 {
+		window = s.IdleTimeout
+		if idle := now.Add(s.IdleTimeout).UTC(); idle.Before(expiry) {
+			expiry = idle
+		}
+	}
+
+	if expiry.Sub(c.Expiry) > time.Duration(float64(window)*s.RollingThreshold) {
+		c.Expiry = expiry
+		if s.IdleTimeout > 0 {
+			c.Deadline = deadline
+		}
+		c.modified = true
+		c.renewed = true
+	}
+}
+
+func (s *Session) save(w http.ResponseWriter, r *http.Request, c *cache) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if dst := c.migrateTo; dst != nil && dst != s {
+		c.migrateTo = nil
+		c.migrateFrom = s
+		return dst.saveLocked(w, r, c)
+	}
+	return s.saveLocked(w, r, c)
+}
+
+// saveLocked saves the session. The caller must hold c.mu.
+func (s *Session) saveLocked(w http.ResponseWriter, r *http.Request, c *cache) error {
+	if c.skipSave {
+		return nil
+	}
+	if c.invalid != nil {
+		return c.invalid
+	}
+
+	err := s.saveDevice(w, r, c)
+	if err != nil {
+		return err
+	}
+
+	if !c.skipRoll && (s.RollingFilter == nil || s.RollingFilter(r)) {
+		s.roll(c)
+	}
+
+	if s.SkipUnchanged && c.modified && !c.touched && c.unchanged() {
+		c.modified = false
+	}
+	if c.migrateFrom != nil {
+		c.modified = true
+	}
 	if !c.modified {
 		return nil
 	}
 
-	if c.destroyed {
-		http.SetCookie(w, &http.Cookie{
-			Name:     cookieName,
-			Value:    "",
-			Path:     s.Path,
-			Domain:   s.Domain,
-			Secure:   s.Secure,
-			HttpOnly: s.HttpOnly,
-			SameSite: s.SameSite,
-			Expires:  time.Unix(1, 0),
-			MaxAge:   -1,
-		})
+	if s.limitCreation(r, c) {
+		c.skipSave = true
 		return nil
 	}
 
-	token, err := c.encode(s.keys[0])
+	// Session data migrated from another Session's Store is moved to a new
+	// token, and the old tokens are deleted once the session has been saved.
+	var oldTokens []string
+	if c.migrateFrom != nil && c.migrateFrom.Store != nil {
+		oldTokens = []string{c.token, c.oldToken}
+		c.token, c.oldToken = "", ""
+	}
+
+	if c.destroyed {
+		if s.Store != nil {
+			for _, token := range []string{c.token, c.oldToken} {
+				if token == "" {
+					continue
+				}
+				err = s.storeDelete(s.Store, token)
+				if err != nil {
+					return wrapError(ErrStoreFailed, err)
+				}
+			}
+		} else if c.spilled {
+			err = s.unspill(c)
+			if err != nil {
+				return err
+			}
+		}
+		if len(c.Data) == 0 {
+			s.deleteToken(w, r)
+			s.deleteExpiryCookie(w, r)
+			return s.finishMigration(w, r, c, oldTokens)
+		}
+
+		// Data was added after the session was destroyed, so a new session
+		// takes its place, with a new cookie replacing the old one.
+		c.token, c.oldToken = "", ""
+		c.previousID, c.ID = c.ID, ""
+		s.resetExpiry(c)
+		c.restarted = !c.isNew
+		c.isNew = true
+		c.destroyed = false
+	}
+
+	if c.ID == "" && (s.Audit != nil || s.Publisher != nil) {
+		c.ID, err = newID(s.random())
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.OnSave != nil {
+		s.OnSave(r, c.Data)
+	}
+
+	c.IssuedAt = time.Now().UTC()
+	c.expireKeys(c.IssuedAt)
+
+	var cookie *http.Cookie
+	if s.Store != nil {
+		cookie, err = s.storeCookie(r, c)
+		if err != nil {
+			return err
+		}
+	} else {
+		cookie, err = s.cookie(c)
+		if err == nil {
+			cookie, err = s.fitCookie(c, cookie)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if s.Metrics != nil {
+		s.Metrics.CookieSize(len(cookie.String()))
+	}
+	err = s.writeToken(w, r, cookie)
 	if err != nil {
 		return err
 	}
+	s.writeExpiryCookie(w, r, c, cookie)
+	s.writeProbeCookie(w, r, c, cookie)
+	return s.finishMigration(w, r, c, oldTokens)
+}
 
+// cookie encodes the session data and returns the session cookie which should
+// be sent to the client. The caller must hold c.mu.
+func (s *Session) cookie(c *cache) (*http.Cookie, error) {
+	token, err := s.encode(c)
+	if err != nil {
+		return nil, err
+	}
+	return s.newCookie(c, token), nil
+}
+
+// newCookie returns the session cookie with the given value, and with its
+// expiry set according to Persist.
+func (s *Session) newCookie(c *cache, value string) *http.Cookie {
 	cookie := &http.Cookie{
-		Name:     cookieName,
-		Value:    token,
+		Name:     s.cookieName(),
+		Value:    value,
 		Path:     s.Path,
 		Domain:   s.Domain,
 		Secure:   s.Secure,
 		HttpOnly: s.HttpOnly,
 		SameSite: s.SameSite,
 	}
-	if s.Persist {
+	persist := s.Persist
+	if c.Persist != persistDefault {
+		persist = c.Persist == persistOn || c.Persist == persistRemember
+	}
+	if persist {
 		cookie.Expires = time.Unix(c.Expiry.Unix()+1, 0)        // Round up to the nearest second.
 		cookie.MaxAge = int(time.Until(c.Expiry).Seconds() + 1) // Round up to the nearest second.
 	}
-
-	if len(cookie.String()) > 4096 {
-		return ErrCookieTooLong
-	}
-	w.Header().Add("Vary", "Cookie")
-	http.SetCookie(w, cookie)
-
-	return nil
+	return cookie
 }
 
 type bufferedResponseWriter struct {
 	http.ResponseWriter
-	buf  bytes.Buffer
-	code int
+	buf       *bytes.Buffer
+	code      int
+	committed bool
+	err       error
+	session   *Session
+	request   *http.Request
+	cache     *cache
+
+	// lazy holds the session instead of cache when it is loaded lazily. If
+	// it hasn't been loaded by the time the response is committed, there is
+	// nothing to save.
+	lazy *lazyCache
+
+	// passthrough is true when the response is committed as soon as the
+	// handler starts writing it, for LoadAndSave and upgrade requests.
+	passthrough bool
+
+	// status and written record the status code and the number of body
+	// bytes sent to the client, for AfterResponse.
+	status  int
+	written int
 }
 
 func (bw *bufferedResponseWriter) Write(b []byte) (int, error) {
-	return bw.buf.Write(b)
+	if bw.passthrough && !bw.committed {
+		bw.commit(true)
+	}
+	if bw.committed {
+		if bw.err != nil {
+			return 0, bw.err
+		}
+		return bw.send(b)
+	}
+
+	if bw.buf == nil {
+		bw.buf = getBuffer()
+	}
+	n, err := bw.buf.Write(b)
+	if err != nil {
+		return n, err
+	}
+
+	if bw.session.MaxBufferSize > 0 && bw.buf.Len() > bw.session.MaxBufferSize {
+		err = bw.commit(true)
+	}
+	return n, err
+}
+
+// commit saves the session data, and then writes the buffered status code
+// and response body to the underlying http.ResponseWriter. If streaming is
+// true then any subsequent writes will be passed straight through to the
+// underlying http.ResponseWriter.
+func (bw *bufferedResponseWriter) commit(streaming bool) error {
+	if bw.committed {
+		return bw.err
+	}
+	bw.committed = true
+
+	w := bw.ResponseWriter
+	c := bw.cache
+	if bw.lazy != nil {
+		var err error
+		c, err = bw.lazy.loaded()
+		if err != nil {
+			bw.err = err
+			bw.session.handleError(sentWriter{bw}, bw.request, err)
+			return err
+		}
+	}
+	if !bw.session.ManualSave && c != nil {
+		err := withPhase(PhaseSave, bw.session.save(w, bw.request, c))
+		if err != nil {
+			bw.err = err
+			bw.session.handleError(sentWriter{bw}, bw.request, err)
+			return err
+		}
+		bw.session.afterSave(bw.request, c)
+	}
+
+	// Any declared trailers which the handler has already set must be held
+	// back until after the body has been written, otherwise they will be
+	// sent to the client as regular headers.
+	trailers := popTrailers(w.Header())
+
+	var body []byte
+	if bw.buf != nil {
+		body = bw.buf.Bytes()
+	}
+
+	if !streaming && len(trailers) == 0 && bw.request.Method != http.MethodHead && bodyAllowed(bw.code) {
+		h := w.Header()
+		if h.Get("Content-Length") == "" && h.Get("Transfer-Encoding") == "" {
+			h.Set("Content-Length", strconv.Itoa(len(body)))
+		}
+	}
+
+	if bw.code != 0 {
+		bw.sendHeader(bw.code)
+	}
+	if !streaming || len(body) > 0 {
+		bw.send(body)
+	}
+	bw.release()
+
+	for key, vals := range trailers {
+		w.Header()[key] = vals
+	}
+	return nil
 }
 
 func (bw *bufferedResponseWriter) WriteHeader(code int) {
+	// Informational (1xx) responses such as 103 Early Hints are sent to the
+	// client immediately and don't affect the final status code, so there's
+	// no need to buffer them. The 101 Switching Protocols status is the
+	// exception, because it terminates the response.
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		bw.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	if bw.committed {
+		if bw.err == nil {
+			bw.sendHeader(code)
+		}
+		return
+	}
 	bw.code = code
+	if bw.passthrough {
+		bw.commit(true)
+	}
 }
 
 func (bw *bufferedResponseWriter) Push(target string, opts *http.PushOptions) error {
@@ -262,21 +1408,160 @@ func (bw *bufferedResponseWriter) Push(target string, opts *http.PushOptions) er
 	return http.ErrNotSupported
 }
 
+// Hijack saves the session, adding the session cookie to the headers of the
+// underlying http.ResponseWriter (where a reverse proxy forwarding an upgraded
+// connection will find it), and then hijacks the connection. Nothing is
+// written to the response afterwards.
 func (bw *bufferedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	hj := bw.ResponseWriter.(http.Hijacker)
-	return hj.Hijack()
+	hj, ok := bw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	err := bw.commit(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, brw, err := hj.Hijack()
+	if err == nil && bw.status == 0 {
+		bw.status = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
 }
 
+// ReadFrom copies src to the response. Once the response has been committed,
+// it is handed to the underlying http.ResponseWriter's ReadFrom method (if it
+// has one), so that io.Copy can still use sendfile. Until then, src is
+// buffered as with Write.
+func (bw *bufferedResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if bw.passthrough && !bw.committed {
+		bw.commit(true)
+	}
+	if bw.committed && bw.err == nil {
+		if rf, ok := bw.ResponseWriter.(io.ReaderFrom); ok {
+			if bw.status == 0 {
+				bw.status = http.StatusOK
+			}
+			n, err := rf.ReadFrom(src)
+			bw.written += int(n)
+			return n, err
+		}
+	}
+	return io.Copy(writerOnly{bw}, src)
+}
+
+// CloseNotify implements the deprecated http.CloseNotifier interface, for
+// handlers which still use it. If the underlying http.ResponseWriter doesn't
+// support it, the returned channel never receives a value.
+func (bw *bufferedResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := bw.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return make(chan bool)
+}
+
+// Unwrap returns the underlying http.ResponseWriter, so that
+// http.ResponseController can reach methods such as SetWriteDeadline.
+func (bw *bufferedResponseWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
+
+// release returns the response buffer to the pool. Once the response has
+// been committed, any further writes bypass the buffer.
+func (bw *bufferedResponseWriter) release() {
+	if bw.buf != nil {
+		putBuffer(bw.buf)
+		bw.buf = nil
+	}
+}
+
+// sendHeader writes the status code to the underlying http.ResponseWriter.
+func (bw *bufferedResponseWriter) sendHeader(code int) {
+	if bw.status == 0 {
+		bw.status = code
+	}
+	bw.ResponseWriter.WriteHeader(code)
+}
+
+// send writes b to the underlying http.ResponseWriter.
+func (bw *bufferedResponseWriter) send(b []byte) (int, error) {
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	n, err := bw.ResponseWriter.Write(b)
+	bw.written += n
+	return n, err
+}
+
+// sentWriter is passed to the ErrorHandler when the session can't be saved,
+// so that the error response is recorded for AfterResponse.
+type sentWriter struct {
+	bw *bufferedResponseWriter
+}
+
+func (w sentWriter) Header() http.Header {
+	return w.bw.ResponseWriter.Header()
+}
+
+func (w sentWriter) Write(b []byte) (int, error) {
+	return w.bw.send(b)
+}
+
+func (w sentWriter) WriteHeader(code int) {
+	w.bw.sendHeader(code)
+}
+
+// writerOnly hides the ReadFrom method of a writer, so that io.Copy doesn't
+// call it recursively.
+type writerOnly struct {
+	io.Writer
+}
+
+// Flush commits the response in streaming mode, so that the session cookie
+// and the recorded status code are sent before any buffered bytes, and then
+// flushes the underlying http.ResponseWriter.
 func (bw *bufferedResponseWriter) Flush() {
 	f, ok := bw.ResponseWriter.(http.Flusher)
-	if ok == true {
-		bw.ResponseWriter.Write(bw.buf.Bytes())
-		f.Flush()
-		bw.buf.Reset()
+	if !ok {
+		return
+	}
+
+	err := bw.commit(true)
+	if err != nil {
+		return
 	}
+	f.Flush()
 }
 
-func defaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
-	log.Output(2, err.Error())
+func bodyAllowed(code int) bool {
+	switch {
+	case code >= 100 && code <= 199:
+		return false
+	case code == http.StatusNoContent, code == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+func popTrailers(h http.Header) http.Header {
+	trailers := make(http.Header)
+	for _, declared := range h["Trailer"] {
+		for _, key := range strings.Split(declared, ",") {
+			key = http.CanonicalHeaderKey(strings.TrimSpace(key))
+			if vals, ok := h[key]; ok {
+				trailers[key] = vals
+				delete(h, key)
+			}
+		}
+	}
+	return trailers
+}
+
+// defaultErrorHandler writes the error to the standard logger, unless a Logger
+// is set, and sends the client a "500 Internal Server Error" response.
+func (s *Session) defaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if s.Logger == nil {
+		log.Output(2, err.Error())
+	}
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
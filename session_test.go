@@ -3,8 +3,13 @@ package sessions
 import (
 	"crypto/rand"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"net/http/httptrace"
+	"net/textproto"
 	"strings"
 	"testing"
 	"time"
@@ -80,18 +85,32 @@ func TestDestroy(t *testing.T) {
 		t.Errorf("got %q: expected to contain %q", cookie, "Max-Age=0")
 	}
 
+	// Data added after Destroy starts a new session in its place.
 	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		s.Destroy(r)
 		s.Put(r, "foo", "bar")
-		w.WriteHeader(200)
 	})
+	_, cookie = testRequest(t, s.Enable(h), "")
 
-	defer func() {
-		if r := recover(); r == nil {
-			t.Errorf("The code did not panic")
-		}
-	}()
-	testRequest(t, s.Enable(h), "")
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Destroy(r)
+		fmt.Fprint(w, s.Exists(r, "foo"))
+		s.Put(r, "flash", "logged out")
+	})
+	body, cookie := testRequest(t, s.Enable(h), cookie)
+	if body != "false" {
+		t.Errorf("got %q: expected %q", body, "false")
+	}
+	if !strings.Contains(cookie, "Max-Age=86400") {
+		t.Errorf("got %q: expected a new session cookie", cookie)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"), "|", s.GetString(r, "flash"))
+	})
+	body, _ = testRequest(t, s.Enable(h), cookie)
+	if body != "|logged out" {
+		t.Errorf("got %q: expected %q", body, "|logged out")
+	}
 }
 
 func TestKeyCycling(t *testing.T) {
@@ -185,3 +204,897 @@ func TestOnlySendCookieIfModified(t *testing.T) {
 		t.Errorf("got %q: expected %q", cookie, "")
 	}
 }
+
+func TestInformationalResponses(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		s.Put(r, "foo", "bar")
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	ts := httptest.NewServer(s.Enable(h))
+	defer ts.Close()
+
+	var informational []int
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			informational = append(informational, code)
+			return nil
+		},
+	}
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if len(informational) != 1 || informational[0] != http.StatusEarlyHints {
+		t.Errorf("got %v: expected %v", informational, []int{http.StatusEarlyHints})
+	}
+	if res.StatusCode != http.StatusTeapot {
+		t.Errorf("got %d: expected %d", res.StatusCode, http.StatusTeapot)
+	}
+	if res.Header.Get("Set-Cookie") == "" {
+		t.Errorf("expected a Set-Cookie header")
+	}
+}
+
+func TestTrailers(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		s.Put(r, "foo", "bar")
+		w.Write([]byte("OK"))
+		w.Header().Set("X-Checksum", "abc123")
+		w.Header().Set(http.TrailerPrefix+"X-Undeclared", "def456")
+	})
+
+	ts := httptest.NewServer(s.Enable(h))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "OK" {
+		t.Errorf("got %q: expected %q", body, "OK")
+	}
+	if res.Header.Get("X-Checksum") != "" {
+		t.Errorf("got %q: expected %q", res.Header.Get("X-Checksum"), "")
+	}
+	if res.Trailer.Get("X-Checksum") != "abc123" {
+		t.Errorf("got %q: expected %q", res.Trailer.Get("X-Checksum"), "abc123")
+	}
+	if res.Trailer.Get("X-Undeclared") != "def456" {
+		t.Errorf("got %q: expected %q", res.Trailer.Get("X-Undeclared"), "def456")
+	}
+}
+
+func TestContentLength(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	body := strings.Repeat("a", 5000)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	})
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	s.Enable(h).ServeHTTP(rr, r)
+
+	if rr.Header().Get("Content-Length") != "5000" {
+		t.Errorf("got %q: expected %q", rr.Header().Get("Content-Length"), "5000")
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+		w.(http.Flusher).Flush()
+		fmt.Fprint(w, body)
+	})
+
+	rr = httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, r)
+
+	if rr.Header().Get("Content-Length") != "" {
+		t.Errorf("got %q: expected %q", rr.Header().Get("Content-Length"), "")
+	}
+	if rr.Body.Len() != 10000 {
+		t.Errorf("got %d: expected %d", rr.Body.Len(), 10000)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	rr = httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, r)
+
+	if rr.Header().Get("Content-Length") != "" {
+		t.Errorf("got %q: expected %q", rr.Header().Get("Content-Length"), "")
+	}
+}
+
+func TestMaxBufferSize(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.MaxBufferSize = 10
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, strings.Repeat("a", 8))
+		if _, ok := w.Header()["Set-Cookie"]; ok {
+			t.Errorf("cookie was sent before the buffer size was exceeded")
+		}
+		fmt.Fprint(w, strings.Repeat("a", 8))
+		if _, ok := w.Header()["Set-Cookie"]; !ok {
+			t.Errorf("cookie was not sent after the buffer size was exceeded")
+		}
+		fmt.Fprint(w, strings.Repeat("a", 8))
+	})
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	s.Enable(h).ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusAccepted)
+	}
+	if rr.Body.String() != strings.Repeat("a", 24) {
+		t.Errorf("got %q: expected %q", rr.Body.String(), strings.Repeat("a", 24))
+	}
+	if rr.Header().Get("Content-Length") != "" {
+		t.Errorf("got %q: expected %q", rr.Header().Get("Content-Length"), "")
+	}
+}
+
+func TestFlushStatusCode(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "foo")
+		w.(http.Flusher).Flush()
+		if _, ok := w.Header()["Set-Cookie"]; !ok {
+			t.Errorf("cookie was not sent when the response was flushed")
+		}
+		fmt.Fprint(w, "bar")
+	})
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	s.Enable(h).ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusNotFound)
+	}
+	if rr.Body.String() != "foobar" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "foobar")
+	}
+	if !rr.Flushed {
+		t.Errorf("got %v: expected %v", rr.Flushed, true)
+	}
+}
+
+func TestStream(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		err := s.Stream(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := w.Header()["Set-Cookie"]; !ok {
+			t.Errorf("cookie was not sent when streaming started")
+		}
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, "foo")
+		w.(http.Flusher).Flush()
+		s.Put(r, "baz", "qux")
+		fmt.Fprint(w, "bar")
+	})
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	s.Enable(h).ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusAccepted)
+	}
+	if rr.Body.String() != "foobar" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "foobar")
+	}
+	if !rr.Flushed {
+		t.Errorf("got %v: expected %v", rr.Flushed, true)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"), s.GetString(r, "baz"))
+	})
+
+	body, _ := testRequest(t, s.Enable(h), rr.Header().Get("Set-Cookie"))
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+}
+
+func TestSkipSave(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		s.SkipSave(r)
+		w.WriteHeader(200)
+	})
+
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	if cookie != "" {
+		t.Errorf("got %q: expected %q", cookie, "")
+	}
+}
+
+func TestSkipSaveMethods(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.SkipSaveMethods = []string{"HEAD", "OPTIONS"}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+
+	for method, expected := range map[string]bool{"GET": true, "HEAD": false, "OPTIONS": false} {
+		rr := httptest.NewRecorder()
+		s.Enable(h).ServeHTTP(rr, httptest.NewRequest(method, "/", nil))
+
+		_, ok := rr.Header()["Set-Cookie"]
+		if ok != expected {
+			t.Errorf("%s: got %v: expected %v", method, ok, expected)
+		}
+	}
+}
+
+func TestOnCommit(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {}
+
+	var calls []string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "token", r.URL.Query().Get("token"))
+		s.OnCommit(r, func() { calls = append(calls, "first") })
+		s.OnCommit(r, func() { calls = append(calls, "second") })
+		if len(calls) != 0 {
+			t.Errorf("callbacks were called before the session was saved")
+		}
+	})
+
+	s.Enable(h).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/?token=abc", nil))
+	if !reflect.DeepEqual(calls, []string{"first", "second"}) {
+		t.Errorf("got %v: expected %v", calls, []string{"first", "second"})
+	}
+
+	calls = nil
+	long := strings.Repeat("a", 5000)
+	s.Enable(h).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/?token="+long, nil))
+	if len(calls) != 0 {
+		t.Errorf("got %v: expected no calls when the save fails", calls)
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.CacheControl = "private, no-store"
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		if r.URL.Path == "/put" {
+			s.Put(r, "foo", "bar")
+		}
+	})
+
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/put", nil))
+	if rr.Header().Get("Cache-Control") != "private, no-store" {
+		t.Errorf("got %q: expected %q", rr.Header().Get("Cache-Control"), "private, no-store")
+	}
+
+	rr = httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Header().Get("Cache-Control") != "public, max-age=3600" {
+		t.Errorf("got %q: expected %q", rr.Header().Get("Cache-Control"), "public, max-age=3600")
+	}
+}
+
+func TestSetPersist(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		s.SetPersist(r, false)
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	if strings.Contains(cookie, "Expires=") || strings.Contains(cookie, "Max-Age=") {
+		t.Errorf("got %q: expected a session cookie", cookie)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "baz", "qux")
+	})
+	_, cookie = testRequest(t, s.Enable(h), cookie)
+
+	if strings.Contains(cookie, "Expires=") || strings.Contains(cookie, "Max-Age=") {
+		t.Errorf("got %q: expected a session cookie", cookie)
+	}
+
+	_, cookie = testRequest(t, s.Enable(h), "")
+
+	if !strings.Contains(cookie, "Expires=") || !strings.Contains(cookie, "Max-Age=") {
+		t.Errorf("got %q: expected a persistent cookie", cookie)
+	}
+}
+
+func TestRememberMe(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Lifetime = time.Hour
+	s.Persist = false
+	s.RememberLifetime = 30 * 24 * time.Hour
+
+	var expiry time.Time
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			s.RememberMe(r, r.URL.Query().Get("remember") == "1")
+		case "/logout":
+			s.LogoutUser(r)
+		}
+		expiry = s.Expiry(r)
+	})
+
+	agent := NewMockAgent(s)
+	rr := agent.Do(h, httptest.NewRequest("GET", "/login?remember=1", nil))
+	cookie := rr.Header().Get("Set-Cookie")
+	if !strings.Contains(cookie, "Max-Age=") {
+		t.Errorf("got %q: expected a persistent cookie", cookie)
+	}
+	if d := time.Until(expiry); d < 29*24*time.Hour {
+		t.Errorf("got %v: expected about %v", d, s.RememberLifetime)
+	}
+
+	agent.Do(h, httptest.NewRequest("GET", "/", nil))
+	if d := time.Until(expiry); d < 29*24*time.Hour {
+		t.Errorf("got %v: expected about %v", d, s.RememberLifetime)
+	}
+
+	rr = agent.Do(h, httptest.NewRequest("GET", "/logout", nil))
+	cookie = rr.Header().Get("Set-Cookie")
+	if strings.Contains(cookie, "Max-Age=") {
+		t.Errorf("got %q: expected a session cookie", cookie)
+	}
+	if d := time.Until(expiry); d > time.Hour {
+		t.Errorf("got %v: expected about %v", d, s.Lifetime)
+	}
+
+	rr = agent.Do(h, httptest.NewRequest("GET", "/login?remember=0", nil))
+	cookie = rr.Header().Get("Set-Cookie")
+	if strings.Contains(cookie, "Max-Age=") {
+		t.Errorf("got %q: expected a session cookie", cookie)
+	}
+	if d := time.Until(expiry); d > time.Hour {
+		t.Errorf("got %v: expected about %v", d, s.Lifetime)
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	expiry := time.Now().Add(-2 * time.Second)
+	if !s.expired(expiry) {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+
+	s.ClockSkew = 5 * time.Second
+	if s.expired(expiry) {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+	if s.expired(expiry.In(time.FixedZone("UTC+10", 10*60*60))) {
+		t.Errorf("got %v: expected %v", true, false)
+	}
+	if !s.expired(time.Now().Add(-10 * time.Second)) {
+		t.Errorf("got %v: expected %v", false, true)
+	}
+}
+
+func TestInvalidBefore(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+
+	s.InvalidBefore = time.Now().Add(-time.Minute)
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+
+	s.InvalidBefore = time.Now().Add(time.Second)
+	body, _ = testRequest(t, s.Enable(h), cookie)
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+}
+
+func TestRolling(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Lifetime = time.Hour
+
+	c := newCache(30 * time.Minute)
+	s.roll(c)
+	if c.modified {
+		t.Errorf("got %v: expected %v", c.modified, false)
+	}
+
+	s.Rolling = true
+
+	c = newCache(57 * time.Minute)
+	s.roll(c)
+	if c.modified {
+		t.Errorf("got %v: expected %v", c.modified, false)
+	}
+
+	c = newCache(30 * time.Minute)
+	s.roll(c)
+	if !c.modified {
+		t.Errorf("got %v: expected %v", c.modified, true)
+	}
+	if time.Until(c.Expiry) < 59*time.Minute {
+		t.Errorf("got %v: expected %v", time.Until(c.Expiry), time.Hour)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+	_, cookie = testRequest(t, s.Enable(h), cookie)
+	if cookie != "" {
+		t.Errorf("got %q: expected %q", cookie, "")
+	}
+}
+
+func TestRollingFilter(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Lifetime = time.Hour
+	s.Rolling = true
+	s.RollingThreshold = 0
+	s.RollingFilter = func(r *http.Request) bool {
+		return r.URL.Path != "/poll"
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			s.Put(r, "foo", "bar")
+		}
+		if r.URL.Path == "/heartbeat" {
+			s.SkipRolling(r)
+		}
+	})
+
+	do := func(path, cookie string) string {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Cookie", cookie)
+		s.Enable(h).ServeHTTP(rr, r)
+		return rr.Header().Get("Set-Cookie")
+	}
+
+	cookie := do("/", "")
+	time.Sleep(10 * time.Millisecond)
+
+	if updated := do("/poll", cookie); updated != "" {
+		t.Errorf("got %q: expected %q", updated, "")
+	}
+	if updated := do("/heartbeat", cookie); updated != "" {
+		t.Errorf("got %q: expected %q", updated, "")
+	}
+	if updated := do("/page", cookie); updated == "" {
+		t.Errorf("expected the session cookie to be re-issued")
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Lifetime = time.Hour
+	s.IdleTimeout = 10 * time.Minute
+
+	c := s.emptyCache(httptest.NewRequest("GET", "/", nil))
+	if time.Until(c.Expiry) > 10*time.Minute {
+		t.Errorf("got %v: expected %v", time.Until(c.Expiry), 10*time.Minute)
+	}
+	if time.Until(c.Deadline) < 59*time.Minute {
+		t.Errorf("got %v: expected %v", time.Until(c.Deadline), time.Hour)
+	}
+
+	c.modified = false
+	s.roll(c)
+	if c.modified {
+		t.Errorf("got %v: expected %v", c.modified, false)
+	}
+
+	c.Expiry = time.Now().Add(5 * time.Minute).UTC()
+	s.roll(c)
+	if !c.modified {
+		t.Errorf("got %v: expected %v", c.modified, true)
+	}
+	if time.Until(c.Expiry) < 9*time.Minute {
+		t.Errorf("got %v: expected %v", time.Until(c.Expiry), 10*time.Minute)
+	}
+
+	c.modified = false
+	c.Expiry = time.Now().Add(time.Minute).UTC()
+	c.Deadline = time.Now().Add(3 * time.Minute).UTC()
+	s.roll(c)
+	if !c.modified {
+		t.Errorf("got %v: expected %v", c.modified, true)
+	}
+	if !c.Expiry.Equal(c.Deadline) {
+		t.Errorf("got %v: expected %v", c.Expiry, c.Deadline)
+	}
+
+	s.IdleTimeout = 100 * time.Millisecond
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/put" {
+			s.Put(r, "foo", "bar")
+		}
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+	agent := NewMockAgent(s)
+	agent.Do(h, httptest.NewRequest("GET", "/put", nil))
+	for i := 0; i < 3; i++ {
+		time.Sleep(60 * time.Millisecond)
+		rr := agent.Do(h, httptest.NewRequest("GET", "/", nil))
+		if rr.Body.String() != "bar" {
+			t.Fatalf("got %q: expected %q", rr.Body.String(), "bar")
+		}
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	rr := agent.Do(h, httptest.NewRequest("GET", "/", nil))
+	if rr.Body.String() != "" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "")
+	}
+}
+
+func TestOnExpire(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Lifetime = time.Second
+
+	var expired map[string]interface{}
+	s.OnExpire = func(r *http.Request, data map[string]interface{}) {
+		expired = data
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		w.WriteHeader(200)
+	})
+
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+
+	testRequest(t, s.Enable(h), cookie)
+	if expired != nil {
+		t.Errorf("got %v: expected %v", expired, nil)
+	}
+
+	time.Sleep(time.Second)
+
+	testRequest(t, s.Enable(h), cookie)
+	if expired["foo"] != "bar" {
+		t.Errorf("got %v: expected %v", expired["foo"], "bar")
+	}
+}
+
+func TestOnLoadOnSave(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	var loaded []interface{}
+	s.OnLoad = func(r *http.Request, data map[string]interface{}) {
+		loaded = append(loaded, data["foo"])
+		s.Put(r, "seen", true)
+	}
+	saves := 0
+	s.OnSave = func(r *http.Request, data map[string]interface{}) {
+		saves++
+		data["saves"] = saves
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/put" {
+			s.Put(r, "foo", "bar")
+		}
+		if r.URL.Path == "/destroy" {
+			s.Destroy(r)
+			return
+		}
+		fmt.Fprint(w, s.GetBool(r, "seen"), s.GetInt(r, "saves"))
+	})
+
+	agent := NewMockAgent(s)
+	agent.Do(h, httptest.NewRequest("GET", "/put", nil))
+	if len(loaded) != 0 {
+		t.Errorf("got %d: expected %d", len(loaded), 0)
+	}
+	if saves != 1 {
+		t.Errorf("got %d: expected %d", saves, 1)
+	}
+
+	rr := agent.Do(h, httptest.NewRequest("GET", "/", nil))
+	if !reflect.DeepEqual(loaded, []interface{}{"bar"}) {
+		t.Errorf("got %v: expected %v", loaded, []interface{}{"bar"})
+	}
+	if rr.Body.String() != "true 1" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "true 1")
+	}
+	if saves != 2 {
+		t.Errorf("got %d: expected %d", saves, 2)
+	}
+
+	agent.Do(h, httptest.NewRequest("GET", "/destroy", nil))
+	if saves != 2 {
+		t.Errorf("got %d: expected %d", saves, 2)
+	}
+}
+
+func TestLoadAndSave(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	var headerOnWrite string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		w.WriteHeader(http.StatusAccepted)
+		headerOnWrite = w.Header().Get("Set-Cookie")
+		w.Write([]byte("streamed"))
+		s.Put(r, "late", "value")
+	})
+
+	rr := httptest.NewRecorder()
+	s.LoadAndSave(h).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusAccepted)
+	}
+	if headerOnWrite == "" {
+		t.Errorf("expected the session cookie to be set before the body was written")
+	}
+	if rr.Header().Get("Content-Length") != "" {
+		t.Errorf("got %q: expected %q", rr.Header().Get("Content-Length"), "")
+	}
+	if rr.Body.String() != "streamed" {
+		t.Errorf("got %q: expected %q", rr.Body.String(), "streamed")
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"), s.Exists(r, "late"))
+	})
+	body, _ := testRequest(t, s.LoadAndSave(h), rr.Header().Get("Set-Cookie"))
+	if body != "barfalse" {
+		t.Errorf("got %q: expected %q", body, "barfalse")
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "baz")
+	})
+	_, cookie := testRequest(t, s.LoadAndSave(h), "")
+	if cookie == "" {
+		t.Errorf("expected a session cookie when the handler writes nothing")
+	}
+}
+
+func TestCommit(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	var committed string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		err := s.Commit(w, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		committed = w.Header().Get("Set-Cookie")
+		if r.URL.Path == "/again" {
+			s.Put(r, "baz", "qux")
+		}
+	})
+
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if committed == "" {
+		t.Errorf("expected the session cookie to be set by Commit")
+	}
+	if n := len(rr.Header()["Set-Cookie"]); n != 1 {
+		t.Errorf("got %d: expected %d", n, 1)
+	}
+
+	rr = httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/again", nil))
+	if n := len(rr.Header()["Set-Cookie"]); n != 2 {
+		t.Errorf("got %d: expected %d", n, 2)
+	}
+}
+
+func TestManualSave(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.ManualSave = true
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		if r.URL.Path == "/commit" {
+			err := s.Commit(w, r)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if cookie := rr.Header().Get("Set-Cookie"); cookie != "" {
+		t.Errorf("got %q: expected %q", cookie, "")
+	}
+
+	rr = httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/commit", nil))
+	if cookie := rr.Header().Get("Set-Cookie"); cookie == "" {
+		t.Errorf("expected the session cookie to be set by Commit")
+	}
+}
+
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+}
+
+func (rr *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	rr.readFrom = true
+	return io.Copy(rr.ResponseRecorder, src)
+}
+
+func TestReadFrom(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	for _, stream := range []bool{false, true} {
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.Put(r, "foo", "bar")
+			if stream {
+				s.Stream(r)
+			}
+			io.Copy(w, struct{ io.Reader }{strings.NewReader("hello")})
+		})
+
+		rr := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+		s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+		if rr.readFrom != stream {
+			t.Errorf("got %v: expected %v", rr.readFrom, stream)
+		}
+		if body := rr.Body.String(); body != "hello" {
+			t.Errorf("got %q: expected %q", body, "hello")
+		}
+		if cookie := rr.Header().Get("Set-Cookie"); !strings.HasPrefix(cookie, "session=") {
+			t.Errorf("got %q: expected a session cookie", cookie)
+		}
+	}
+}
+
+func TestResponseController(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	srv := httptest.NewServer(s.Enable(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		err := rc.SetWriteDeadline(time.Now().Add(time.Minute))
+		if err != nil {
+			t.Error(err)
+		}
+		if _, ok := w.(interface{ Unwrap() http.ResponseWriter }); !ok {
+			t.Error("expected Unwrap")
+		}
+	})))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+}
+
+func TestHijackNotSupported(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := w.(http.Hijacker).Hijack()
+		if err != http.ErrNotSupported {
+			t.Errorf("got %v: expected %v", err, http.ErrNotSupported)
+		}
+	})
+	testRequest(t, s.Enable(h), "")
+}
+
+func TestAfterResponse(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	var status, bytes int
+	var user string
+	s.AfterResponse = func(w http.ResponseWriter, r *http.Request, st int, n int) {
+		status, bytes = st, n
+		user = s.GetString(r, "user")
+	}
+
+	tests := []struct {
+		handler http.HandlerFunc
+		status  int
+		bytes   int
+	}{
+		{func(w http.ResponseWriter, r *http.Request) {
+			s.Put(r, "user", "alice")
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, "hello")
+		}, http.StatusCreated, 5},
+		{func(w http.ResponseWriter, r *http.Request) {
+			s.Put(r, "user", "alice")
+		}, http.StatusOK, 0},
+		{func(w http.ResponseWriter, r *http.Request) {
+			s.Put(r, "user", "alice")
+			w.(http.Flusher).Flush()
+			fmt.Fprint(w, "hello, ")
+			fmt.Fprint(w, "world")
+		}, http.StatusOK, 12},
+		{func(w http.ResponseWriter, r *http.Request) {
+			s.Put(r, "user", "alice")
+			s.Put(r, "big", strings.Repeat("x", 5000))
+			fmt.Fprint(w, "hello")
+		}, http.StatusInternalServerError, len(http.StatusText(http.StatusInternalServerError)) + 1},
+	}
+
+	for i, test := range tests {
+		testRequest(t, s.Enable(test.handler), "")
+		if status != test.status {
+			t.Errorf("%d: got %d: expected %d", i, status, test.status)
+		}
+		if bytes != test.bytes {
+			t.Errorf("%d: got %d: expected %d", i, bytes, test.bytes)
+		}
+		if user != "alice" {
+			t.Errorf("%d: got %q: expected %q", i, user, "alice")
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Package sessionstest provides helpers for testing handlers which use the
+// github.com/golangcollege/sessions package. Handlers can be called directly
+// with a request which already carries session data, without wrapping them
+// in the Enable middleware, and the session data saved in a response can be
+// decrypted and checked.
+package sessionstest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/golangcollege/sessions"
+)
+
+// NewRequestWithValues returns a new "GET /" request whose session holds the
+// given values. The handler under test can be called with it directly, or
+// through the session's Enable middleware, in which case any changes made to
+// the session are saved in the response.
+func NewRequestWithValues(t testing.TB, s *sessions.Session, values map[string]interface{}) *http.Request {
+	t.Helper()
+	return WithValues(t, s, httptest.NewRequest("GET", "/", nil), values)
+}
+
+// WithValues returns a copy of r whose session holds the given values, for
+// requests other than "GET /".
+func WithValues(t testing.TB, s *sessions.Session, r *http.Request, values map[string]interface{}) *http.Request {
+	t.Helper()
+
+	r = sessions.MockRequest(r)
+	for _, key := range sortedKeys(values) {
+		err := s.PutChecked(r, key, values[key])
+		if err != nil {
+			t.Fatalf("sessionstest: %q: %v", key, err)
+		}
+	}
+	return r
+}
+
+// ResponseValues decrypts the session cookie set by the response recorded in
+// rr (or loads the session from the Store, if one is set) and returns the
+// session data. It calls t.Fatal if the response doesn't set any cookies. If
+// the session cookie can't be decrypted, the returned data is empty.
+func ResponseValues(t testing.TB, s *sessions.Session, rr *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	found := false
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.MaxAge < 0 || cookie.Value == "" {
+			continue
+		}
+		r.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		found = true
+	}
+	if !found {
+		t.Fatal("sessionstest: the response doesn't set a session cookie")
+	}
+
+	var data map[string]interface{}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data = s.Data(r)
+		s.SkipSave(r)
+	})
+	s.Enable(h).ServeHTTP(httptest.NewRecorder(), r)
+	return data
+}
+
+// AssertValues checks that the session for r holds each of the expected
+// values, using reflect.DeepEqual, and calls t.Errorf for each one which
+// doesn't match. An expected value of nil checks that the key isn't present.
+func AssertValues(t testing.TB, s *sessions.Session, r *http.Request, expected map[string]interface{}) {
+	t.Helper()
+
+	for _, key := range sortedKeys(expected) {
+		want := expected[key]
+		if want == nil {
+			if s.Exists(r, key) {
+				t.Errorf("sessionstest: %q: got %#v: expected no value", key, s.Get(r, key))
+			}
+			continue
+		}
+		if got := s.Get(r, key); !reflect.DeepEqual(got, want) {
+			t.Errorf("sessionstest: %q: got %#v: expected %#v", key, got, want)
+		}
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
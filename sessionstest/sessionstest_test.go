@@ -0,0 +1,86 @@
+package sessionstest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/golangcollege/sessions"
+	"github.com/golangcollege/sessions/memstore"
+)
+
+func TestNewRequestWithValues(t *testing.T) {
+	s := sessions.New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "user"))
+		s.Put(r, "visits", s.GetInt(r, "visits")+1)
+		s.Remove(r, "flash")
+	})
+
+	r := NewRequestWithValues(t, s, map[string]interface{}{
+		"user":   "alice",
+		"visits": 1,
+		"flash":  "hello",
+	})
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	if body := rr.Body.String(); body != "alice" {
+		t.Errorf("got %q: expected %q", body, "alice")
+	}
+	AssertValues(t, s, r, map[string]interface{}{
+		"user":   "alice",
+		"visits": 2,
+		"flash":  nil,
+	})
+}
+
+func TestResponseValues(t *testing.T) {
+	for _, store := range []sessions.Store{nil, memstore.NewWithCleanupInterval(0)} {
+		s := sessions.New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+		s.Store = store
+
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.Put(r, "visits", s.GetInt(r, "visits")+1)
+		})
+
+		r := WithValues(t, s, httptest.NewRequest("POST", "/visit", nil), map[string]interface{}{"visits": 41})
+		rr := httptest.NewRecorder()
+		s.Enable(h).ServeHTTP(rr, r)
+
+		data := ResponseValues(t, s, rr)
+		if data["visits"] != 42 {
+			t.Errorf("got %v: expected %v", data["visits"], 42)
+		}
+	}
+}
+
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertValues(t *testing.T) {
+	s := sessions.New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	r := NewRequestWithValues(t, s, map[string]interface{}{"user": "alice", "role": "admin"})
+
+	rec := &recorder{TB: t}
+	AssertValues(rec, s, r, map[string]interface{}{"user": "bob", "role": nil, "missing": nil})
+
+	expected := []string{
+		`sessionstest: "role": got "admin": expected no value`,
+		`sessionstest: "user": got "alice": expected "bob"`,
+	}
+	if !reflect.DeepEqual(rec.errors, expected) {
+		t.Errorf("got %q: expected %q", rec.errors, expected)
+	}
+}
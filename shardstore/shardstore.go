@@ -0,0 +1,281 @@
+// Package shardstore provides a session store which spreads sessions across
+// several other stores, such as one redisstore per Redis instance, for
+// session volumes which are too large for a single backend. It is for use
+// with the github.com/golangcollege/sessions package.
+//
+// Each session token is assigned to a shard by consistent hashing, so adding
+// or removing a shard only moves about 1/N of the sessions, and those users
+// have to log in again.
+package shardstore
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golangcollege/sessions"
+)
+
+// replicas is the number of points each shard has on the hash ring, which
+// evens out the share of sessions each shard is assigned.
+const replicas = 128
+
+// ErrShardDown is returned, without contacting the shard, for operations on a
+// shard which has failed within the cool-down.
+var ErrShardDown = errors.New("shardstore: shard is down")
+
+// errNotLister is returned by List when a shard doesn't implement
+// sessions.Lister.
+var errNotLister = errors.New("shardstore: shard doesn't implement Lister")
+
+// errNoShards is returned for every operation on a ShardStore without shards.
+var errNoShards = errors.New("shardstore: no shards")
+
+type shard struct {
+	name  string
+	store sessions.Store
+
+	mu   sync.Mutex
+	down time.Time
+}
+
+type point struct {
+	hash  uint32
+	shard *shard
+}
+
+// ShardStore represents the session store.
+type ShardStore struct {
+	shards   []*shard
+	ring     []point
+	cooldown time.Duration
+}
+
+// New returns a new ShardStore instance which spreads sessions across the
+// given stores, keyed by shard name. The names place the shards on the hash
+// ring, so keep them the same when shards are added or removed. A shard which
+// fails is marked as down for 10 seconds.
+func New(shards map[string]sessions.Store) *ShardStore {
+	return NewWithCooldown(shards, 10*time.Second)
+}
+
+// NewWithCooldown returns a new ShardStore instance. The cooldown parameter
+// controls how long a shard is marked as down after an operation on it fails,
+// during which its operations fail straight away with ErrShardDown instead of
+// waiting for the shard to time out. Setting it to 0 means shards are never
+// marked as down.
+func NewWithCooldown(shards map[string]sessions.Store, cooldown time.Duration) *ShardStore {
+	s := &ShardStore{cooldown: cooldown}
+	for name, st := range shards {
+		sh := &shard{name: name, store: st}
+		s.shards = append(s.shards, sh)
+		for i := 0; i < replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(name + "#" + strconv.Itoa(i)))
+			s.ring = append(s.ring, point{hash: h, shard: sh})
+		}
+	}
+	sort.Slice(s.shards, func(i, j int) bool {
+		return s.shards[i].name < s.shards[j].name
+	})
+	sort.Slice(s.ring, func(i, j int) bool {
+		if s.ring[i].hash != s.ring[j].hash {
+			return s.ring[i].hash < s.ring[j].hash
+		}
+		return s.ring[i].shard.name < s.ring[j].shard.name
+	})
+	return s
+}
+
+// Shard returns the name of the shard which the session token is assigned
+// to, or "" if there are no shards.
+func (s *ShardStore) Shard(token string) string {
+	sh := s.shard(token)
+	if sh == nil {
+		return ""
+	}
+	return sh.name
+}
+
+// Find returns the data for a given session token from the shard it is
+// assigned to.
+func (s *ShardStore) Find(token string) (b []byte, found bool, err error) {
+	err = s.do(token, func(st sessions.Store) error {
+		b, found, err = st.Find(token)
+		return err
+	})
+	return b, found, err
+}
+
+// Commit adds a session token and data to the shard it is assigned to, with
+// the given expiry time.
+func (s *ShardStore) Commit(token string, b []byte, expiry time.Time) error {
+	return s.do(token, func(st sessions.Store) error {
+		return st.Commit(token, b, expiry)
+	})
+}
+
+// Delete removes a session token and corresponding data from the shard it is
+// assigned to.
+func (s *ShardStore) Delete(token string) error {
+	return s.do(token, func(st sessions.Store) error {
+		return st.Delete(token)
+	})
+}
+
+// List returns session tokens from each shard in turn, by name, if every
+// shard implements sessions.Lister. The cursor holds the shard's position and
+// its own cursor. The returned next cursor is "" after the last page of the
+// last shard.
+func (s *ShardStore) List(cursor string, limit int) ([]string, string, error) {
+	i, inner := 0, ""
+	if cursor != "" {
+		sep := strings.IndexByte(cursor, ':')
+		if sep < 0 {
+			return nil, "", errors.New("shardstore: invalid cursor")
+		}
+		var err error
+		i, err = strconv.Atoi(cursor[:sep])
+		if err != nil || i < 0 || i >= len(s.shards) {
+			return nil, "", errors.New("shardstore: invalid cursor")
+		}
+		inner = cursor[sep+1:]
+	}
+	if len(s.shards) == 0 {
+		return nil, "", nil
+	}
+
+	l, ok := s.shards[i].store.(sessions.Lister)
+	if !ok {
+		return nil, "", errNotLister
+	}
+	tokens, next, err := l.List(inner, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	if next == "" {
+		i++
+		if i == len(s.shards) {
+			return tokens, "", nil
+		}
+	}
+	return tokens, strconv.Itoa(i) + ":" + next, nil
+}
+
+// Count returns the total number of sessions in the shards, if every shard
+// implements sessions.Counter. Otherwise it returns
+// sessions.ErrCountUnsupported.
+func (s *ShardStore) Count() (int, error) {
+	total := 0
+	for _, sh := range s.shards {
+		c, ok := sh.store.(sessions.Counter)
+		if !ok {
+			return 0, sessions.ErrCountUnsupported
+		}
+		n, err := c.Count()
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// Down returns the names of the shards which are marked as down.
+func (s *ShardStore) Down() []string {
+	var names []string
+	for _, sh := range s.shards {
+		if sh.isDown() {
+			names = append(names, sh.name)
+		}
+	}
+	return names
+}
+
+// Ping pings every shard which implements sessions.Pinger, even those marked
+// as down, and updates their health. A shard which answers is marked as up
+// again straight away. The first error is returned.
+func (s *ShardStore) Ping(ctx context.Context) error {
+	var first error
+	for _, sh := range s.shards {
+		p, ok := sh.store.(sessions.Pinger)
+		if !ok {
+			continue
+		}
+		err := p.Ping(ctx)
+		sh.report(err, s.cooldown)
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Close closes every shard which implements io.Closer, and returns the first
+// error.
+func (s *ShardStore) Close() error {
+	var first error
+	for _, sh := range s.shards {
+		c, ok := sh.store.(io.Closer)
+		if !ok {
+			continue
+		}
+		err := c.Close()
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// shard returns the shard which the session token is assigned to: the first
+// point on the ring at or after the token's hash.
+func (s *ShardStore) shard(token string) *shard {
+	if len(s.ring) == 0 {
+		return nil
+	}
+	h := crc32.ChecksumIEEE([]byte(token))
+	i := sort.Search(len(s.ring), func(i int) bool {
+		return s.ring[i].hash >= h
+	})
+	if i == len(s.ring) {
+		i = 0
+	}
+	return s.ring[i].shard
+}
+
+// do runs op on the shard which the session token is assigned to, unless it
+// is marked as down, and records whether it failed.
+func (s *ShardStore) do(token string, op func(st sessions.Store) error) error {
+	sh := s.shard(token)
+	if sh == nil {
+		return errNoShards
+	}
+	if sh.isDown() {
+		return ErrShardDown
+	}
+	err := op(sh.store)
+	sh.report(err, s.cooldown)
+	return err
+}
+
+func (sh *shard) isDown() bool {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return time.Now().Before(sh.down)
+}
+
+func (sh *shard) report(err error, cooldown time.Duration) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if err != nil {
+		sh.down = time.Now().Add(cooldown)
+	} else {
+		sh.down = time.Time{}
+	}
+}
@@ -0,0 +1,211 @@
+package shardstore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golangcollege/sessions"
+	"github.com/golangcollege/sessions/memstore"
+	"github.com/golangcollege/sessions/storetest"
+)
+
+type flakyStore struct {
+	*memstore.MemStore
+	err error
+}
+
+func (fs *flakyStore) Find(token string) ([]byte, bool, error) {
+	if fs.err != nil {
+		return nil, false, fs.err
+	}
+	return fs.MemStore.Find(token)
+}
+
+func (fs *flakyStore) Ping(ctx context.Context) error {
+	return fs.err
+}
+
+func TestShards(t *testing.T) {
+	stores := map[string]*memstore.MemStore{
+		"a": memstore.NewWithCleanupInterval(0),
+		"b": memstore.NewWithCleanupInterval(0),
+		"c": memstore.NewWithCleanupInterval(0),
+	}
+	shards := make(map[string]sessions.Store)
+	for name, st := range stores {
+		shards[name] = st
+	}
+	s := New(shards)
+
+	counts := make(map[string]int)
+	expiry := time.Now().Add(time.Minute)
+	for i := 0; i < 3000; i++ {
+		token := "token" + strconv.Itoa(i)
+		err := s.Commit(token, []byte(token), expiry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := s.Shard(token)
+		counts[name]++
+
+		_, found, err := stores[name].Find(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != true {
+			t.Fatalf("got %v: expected %v", found, true)
+		}
+		b, _, err := s.Find(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != token {
+			t.Fatalf("got %q: expected %q", b, token)
+		}
+	}
+	for name, n := range counts {
+		if n < 500 || n > 1500 {
+			t.Errorf("%s: got %d: expected about %d", name, n, 1000)
+		}
+	}
+
+	// Adding a shard only moves some of the sessions.
+	shards["d"] = memstore.NewWithCleanupInterval(0)
+	s2 := New(shards)
+	moved := 0
+	for i := 0; i < 3000; i++ {
+		token := "token" + strconv.Itoa(i)
+		if s2.Shard(token) != s.Shard(token) {
+			if s2.Shard(token) != "d" {
+				t.Fatalf("got %q: expected %q", s2.Shard(token), "d")
+			}
+			moved++
+		}
+	}
+	if moved < 300 || moved > 1200 {
+		t.Errorf("got %d: expected about %d", moved, 750)
+	}
+}
+
+func TestShardDown(t *testing.T) {
+	errDown := errors.New("connection refused")
+	flaky := &flakyStore{MemStore: memstore.NewWithCleanupInterval(0), err: errDown}
+	s := New(map[string]sessions.Store{"a": flaky})
+
+	_, _, err := s.Find("session_token")
+	if err != errDown {
+		t.Errorf("got %v: expected %v", err, errDown)
+	}
+	_, _, err = s.Find("session_token")
+	if err != ErrShardDown {
+		t.Errorf("got %v: expected %v", err, ErrShardDown)
+	}
+	if down := s.Down(); len(down) != 1 || down[0] != "a" {
+		t.Errorf("got %v: expected %v", down, []string{"a"})
+	}
+
+	flaky.err = nil
+	err = s.Ping(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if down := s.Down(); len(down) != 0 {
+		t.Errorf("got %v: expected %v", down, []string{})
+	}
+	_, found, err := s.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != false {
+		t.Errorf("got %v: expected %v", found, false)
+	}
+}
+
+func TestNoShards(t *testing.T) {
+	s := New(nil)
+	err := s.Commit("session_token", nil, time.Now())
+	if err != errNoShards {
+		t.Errorf("got %v: expected %v", err, errNoShards)
+	}
+	if s.Shard("session_token") != "" {
+		t.Errorf("got %q: expected %q", s.Shard("session_token"), "")
+	}
+}
+
+func TestList(t *testing.T) {
+	shards := map[string]sessions.Store{
+		"a": memstore.NewWithCleanupInterval(0),
+		"b": memstore.NewWithCleanupInterval(0),
+	}
+	s := New(shards)
+	expiry := time.Now().Add(time.Minute)
+	for i := 0; i < 20; i++ {
+		err := s.Commit("token"+strconv.Itoa(i), nil, expiry)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	cursor := ""
+	for {
+		tokens, next, err := s.List(cursor, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, token := range tokens {
+			seen[token] = true
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(seen) != 20 {
+		t.Errorf("got %d: expected %d", len(seen), 20)
+	}
+
+	_, _, err := s.List("9:", 3)
+	if err == nil {
+		t.Error("expected an error for an invalid cursor")
+	}
+}
+
+func TestCount(t *testing.T) {
+	shards := map[string]sessions.Store{
+		"a": memstore.NewWithCleanupInterval(0),
+		"b": memstore.NewWithCleanupInterval(0),
+	}
+	s := New(shards)
+	expiry := time.Now().Add(time.Minute)
+	for i := 0; i < 20; i++ {
+		err := s.Commit("token"+strconv.Itoa(i), nil, expiry)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := s.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 20 {
+		t.Errorf("got %d: expected %d", n, 20)
+	}
+
+	shards["c"] = struct{ sessions.Store }{memstore.NewWithCleanupInterval(0)}
+	_, err = New(shards).Count()
+	if err != sessions.ErrCountUnsupported {
+		t.Errorf("got %v: expected %v", err, sessions.ErrCountUnsupported)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, New(map[string]sessions.Store{
+		"a": memstore.NewWithCleanupInterval(0),
+		"b": memstore.NewWithCleanupInterval(0),
+	}))
+}
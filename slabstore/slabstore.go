@@ -0,0 +1,311 @@
+// Package slabstore provides an in-memory session store for use with the
+// github.com/golangcollege/sessions package, for single nodes holding millions
+// of live sessions.
+//
+// Unlike memstore, which keeps each session as its own heap object, slabstore
+// copies the session data into large byte slabs which are indexed by a hash
+// of the session token. Neither the slabs nor the indexes contain pointers,
+// so the garbage collector doesn't have to scan them, however many sessions
+// are stored. As with memstore, session data is lost when the process exits,
+// and isn't shared between processes.
+package slabstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrShardFull is returned by Commit when a shard's slab would grow past
+// 4GB, which its 32-bit offsets can't address.
+var ErrShardFull = errors.New("slabstore: shard is full")
+
+// shardCount is the number of independently locked shards, which spreads the
+// lock contention and the cost of compaction.
+const shardCount = 64
+
+// headerLength is the length of an entry's header: the expiry time in Unix
+// nanoseconds, and the lengths of the token and the data.
+const headerLength = 8 + 4 + 4
+
+type shard struct {
+	mu      sync.RWMutex
+	index   map[uint64]uint32
+	slab    []byte
+	garbage int
+}
+
+// SlabStore represents the session store.
+type SlabStore struct {
+	shards      [shardCount]shard
+	stopCleanup chan bool
+	stopped     chan bool
+	stopOnce    sync.Once
+}
+
+// New returns a new SlabStore instance, with a background cleanup goroutine
+// that runs every minute to remove expired session data.
+func New() *SlabStore {
+	return NewWithCleanupInterval(time.Minute)
+}
+
+// NewWithCleanupInterval returns a new SlabStore instance. The
+// cleanupInterval parameter controls how frequently expired session data is
+// removed by the background cleanup goroutine. Setting it to 0 prevents the
+// cleanup goroutine from running, although space is still reclaimed from
+// expired sessions when a shard runs out of room.
+func NewWithCleanupInterval(cleanupInterval time.Duration) *SlabStore {
+	s := &SlabStore{}
+	for i := range s.shards {
+		s.shards[i].index = make(map[uint64]uint32)
+	}
+
+	if cleanupInterval > 0 {
+		s.stopCleanup = make(chan bool)
+		s.stopped = make(chan bool)
+		go s.startCleanup(cleanupInterval)
+	}
+
+	return s
+}
+
+// Find returns the data for a given session token from the SlabStore
+// instance. If the session token is not found or is expired, the returned
+// found value will be false.
+func (s *SlabStore) Find(token string) ([]byte, bool, error) {
+	h := hash(token)
+	sh := s.shard(h)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	off, ok := sh.index[h]
+	if !ok {
+		return nil, false, nil
+	}
+	expiry, key, b := sh.entry(off)
+	if string(key) != token || time.Now().UnixNano() > expiry {
+		return nil, false, nil
+	}
+	return append([]byte(nil), b...), true, nil
+}
+
+// Commit adds a session token and data to the SlabStore instance with the
+// given expiry time. If the session token already exists, then the data and
+// expiry time are updated.
+func (s *SlabStore) Commit(token string, b []byte, expiry time.Time) error {
+	h := hash(token)
+	sh := s.shard(h)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	sh.remove(h)
+	n := headerLength + len(token) + len(b)
+	if len(sh.slab)+n > cap(sh.slab) {
+		sh.compact(n)
+	}
+	if uint64(len(sh.slab)+n) > math.MaxUint32 {
+		return ErrShardFull
+	}
+
+	off := uint32(len(sh.slab))
+	var header [headerLength]byte
+	binary.LittleEndian.PutUint64(header[0:], uint64(expiry.UnixNano()))
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(token)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(b)))
+	sh.slab = append(sh.slab, header[:]...)
+	sh.slab = append(sh.slab, token...)
+	sh.slab = append(sh.slab, b...)
+	sh.index[h] = off
+	return nil
+}
+
+// Delete removes a session token and corresponding data from the SlabStore
+// instance.
+func (s *SlabStore) Delete(token string) error {
+	h := hash(token)
+	sh := s.shard(h)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	off, ok := sh.index[h]
+	if ok {
+		if _, key, _ := sh.entry(off); string(key) == token {
+			sh.remove(h)
+		}
+	}
+	return nil
+}
+
+// List returns up to limit session tokens from the SlabStore instance, in
+// order, after the cursor, which is the last token of the previous page. The
+// returned next cursor is "" after the last page. If limit isn't positive, all
+// of the tokens are returned. Expired sessions are left out.
+func (s *SlabStore) List(cursor string, limit int) ([]string, string, error) {
+	now := time.Now().UnixNano()
+	var tokens []string
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		for _, off := range sh.index {
+			expiry, token, _ := sh.entry(off)
+			if string(token) > cursor && now <= expiry {
+				tokens = append(tokens, string(token))
+			}
+		}
+		sh.mu.RUnlock()
+	}
+
+	sort.Strings(tokens)
+	if limit <= 0 || len(tokens) <= limit {
+		return tokens, "", nil
+	}
+	return tokens[:limit], tokens[limit-1], nil
+}
+
+// Count returns the number of unexpired sessions in the SlabStore instance.
+// Unlike Len, it reads the expiry time of every session.
+func (s *SlabStore) Count() (int, error) {
+	now := time.Now().UnixNano()
+	n := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		for _, off := range sh.index {
+			if expiry, _, _ := sh.entry(off); now <= expiry {
+				n++
+			}
+		}
+		sh.mu.RUnlock()
+	}
+	return n, nil
+}
+
+// Len returns the number of sessions in the SlabStore instance, including
+// expired sessions which haven't been removed yet.
+func (s *SlabStore) Len() int {
+	n := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		n += len(sh.index)
+		sh.mu.RUnlock()
+	}
+	return n
+}
+
+// StopCleanup terminates the background cleanup goroutine for the SlabStore
+// instance. It's rare to terminate this; generally SlabStore instances and
+// their cleanup goroutines are intended to be long-lived and run for the
+// lifetime of your application. StopCleanup waits for a cleanup which is in
+// progress to finish, and can safely be called more than once.
+func (s *SlabStore) StopCleanup() {
+	if s.stopCleanup == nil {
+		return
+	}
+	s.stopOnce.Do(func() {
+		close(s.stopCleanup)
+	})
+	<-s.stopped
+}
+
+// Close stops the background cleanup goroutine. It always returns nil, and
+// lets Session.Close() shut the SlabStore down along with the session.
+func (s *SlabStore) Close() error {
+	s.StopCleanup()
+	return nil
+}
+
+func (s *SlabStore) startCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer close(s.stopped)
+	for {
+		select {
+		case <-ticker.C:
+			s.deleteExpired()
+		case <-s.stopCleanup:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// deleteExpired removes the expired sessions from each shard's index, and
+// compacts the shards which are at least half garbage.
+func (s *SlabStore) deleteExpired() {
+	now := time.Now().UnixNano()
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		for h, off := range sh.index {
+			if expiry, _, _ := sh.entry(off); now > expiry {
+				sh.remove(h)
+			}
+		}
+		if sh.garbage > 0 && sh.garbage >= len(sh.slab)/2 {
+			sh.compact(0)
+		}
+		sh.mu.Unlock()
+	}
+}
+
+func (s *SlabStore) shard(h uint64) *shard {
+	return &s.shards[h%shardCount]
+}
+
+func hash(token string) uint64 {
+	f := fnv.New64a()
+	f.Write([]byte(token))
+	return f.Sum64()
+}
+
+// entry returns the expiry time, token and data of the entry at the offset.
+// The token and data share the slab's memory. The caller must hold sh.mu.
+func (sh *shard) entry(off uint32) (expiry int64, token []byte, b []byte) {
+	header := sh.slab[off : off+headerLength]
+	expiry = int64(binary.LittleEndian.Uint64(header[0:]))
+	tokenLength := binary.LittleEndian.Uint32(header[8:])
+	dataLength := binary.LittleEndian.Uint32(header[12:])
+	start := off + headerLength
+	token = sh.slab[start : start+tokenLength]
+	b = sh.slab[start+tokenLength : start+tokenLength+dataLength]
+	return expiry, token, b
+}
+
+// remove drops the entry for the hash from the index, and counts its space
+// as garbage to be reclaimed by the next compaction. The caller must hold
+// sh.mu.
+func (sh *shard) remove(h uint64) {
+	off, ok := sh.index[h]
+	if !ok {
+		return
+	}
+	_, token, b := sh.entry(off)
+	sh.garbage += headerLength + len(token) + len(b)
+	delete(sh.index, h)
+}
+
+// compact copies the live entries into a new slab, dropping deleted, replaced
+// and expired sessions, with room for at least another n bytes. The new slab
+// has twice the room the live entries need, so that compaction is rare. The
+// caller must hold sh.mu.
+func (sh *shard) compact(n int) {
+	now := time.Now().UnixNano()
+	live := len(sh.slab) - sh.garbage
+	slab := make([]byte, 0, 2*(live+n))
+	for h, off := range sh.index {
+		expiry, token, b := sh.entry(off)
+		if now > expiry {
+			delete(sh.index, h)
+			continue
+		}
+		sh.index[h] = uint32(len(slab))
+		end := off + uint32(headerLength+len(token)+len(b))
+		slab = append(slab, sh.slab[off:end]...)
+	}
+	sh.slab = slab
+	sh.garbage = 0
+}
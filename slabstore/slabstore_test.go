@@ -0,0 +1,251 @@
+package slabstore
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golangcollege/sessions/storetest"
+)
+
+func TestCommitAndFind(t *testing.T) {
+	s := NewWithCleanupInterval(0)
+	err := s.Commit("session_token", []byte("encoded_data"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, found, err := s.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != true {
+		t.Fatalf("got %v: expected %v", found, true)
+	}
+	if bytes.Equal(b, []byte("encoded_data")) == false {
+		t.Fatalf("got %v: expected %v", b, []byte("encoded_data"))
+	}
+
+	err = s.Commit("session_token", []byte("new_data"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err = s.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(b, []byte("new_data")) == false {
+		t.Fatalf("got %v: expected %v", b, []byte("new_data"))
+	}
+	if s.Len() != 1 {
+		t.Errorf("got %d: expected %d", s.Len(), 1)
+	}
+}
+
+func TestFindMissing(t *testing.T) {
+	s := NewWithCleanupInterval(0)
+
+	_, found, err := s.Find("missing_session_token")
+	if err != nil {
+		t.Fatalf("got %v: expected %v", err, nil)
+	}
+	if found != false {
+		t.Fatalf("got %v: expected %v", found, false)
+	}
+}
+
+func TestFindExpired(t *testing.T) {
+	s := NewWithCleanupInterval(0)
+	err := s.Commit("session_token", []byte("encoded_data"), time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, found, err := s.Find("session_token")
+	if err != nil {
+		t.Fatalf("got %v: expected %v", err, nil)
+	}
+	if found != false {
+		t.Fatalf("got %v: expected %v", found, false)
+	}
+}
+
+func TestFindCollision(t *testing.T) {
+	s := NewWithCleanupInterval(0)
+	err := s.Commit("session_token", []byte("encoded_data"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Point another token's hash at the entry, as if their hashes collided.
+	h := hash("other_token")
+	sh := s.shard(hash("session_token"))
+	s.shard(h).index[h] = sh.index[hash("session_token")]
+	s.shard(h).slab = sh.slab
+
+	_, found, err := s.Find("other_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != false {
+		t.Errorf("got %v: expected %v", found, false)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	s := NewWithCleanupInterval(0)
+	err := s.Commit("session_token", []byte("encoded_data"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Delete("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, found, err := s.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != false {
+		t.Errorf("got %v: expected %v", found, false)
+	}
+	if s.Len() != 0 {
+		t.Errorf("got %d: expected %d", s.Len(), 0)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	s := NewWithCleanupInterval(0)
+	expiry := time.Now().Add(time.Minute)
+	for i := 0; i < 1000; i++ {
+		token := "token" + strconv.Itoa(i%100)
+		err := s.Commit(token, bytes.Repeat([]byte("a"), 100), expiry)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.Commit("expired_token", []byte("encoded_data"), time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replaced and expired sessions never take up more than half a slab
+	// after a cleanup.
+	s.deleteExpired()
+	size := 0
+	for i := range s.shards {
+		size += len(s.shards[i].slab)
+	}
+	if limit := 2 * 100 * (headerLength + 7 + 100); size > limit {
+		t.Errorf("got %d: expected at most %d", size, limit)
+	}
+	if s.Len() != 100 {
+		t.Errorf("got %d: expected %d", s.Len(), 100)
+	}
+	for i := 0; i < 100; i++ {
+		_, found, err := s.Find("token" + strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != true {
+			t.Fatalf("got %v: expected %v", found, true)
+		}
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	s := NewWithCleanupInterval(0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				token := strconv.Itoa(i) + "-" + strconv.Itoa(j)
+				err := s.Commit(token, []byte(token), time.Now().Add(time.Minute))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				b, _, _ := s.Find(token)
+				if string(b) != token {
+					t.Errorf("got %q: expected %q", b, token)
+					return
+				}
+				s.Delete(token)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestClose(t *testing.T) {
+	s := NewWithCleanupInterval(time.Hour)
+	for i := 0; i < 2; i++ {
+		err := s.Close()
+		if err != nil {
+			t.Errorf("got %v: expected %v", err, nil)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	s := NewWithCleanupInterval(0)
+	for _, token := range []string{"c", "a", "d"} {
+		err := s.Commit(token, []byte(token), time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.Commit("b", []byte("b"), time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var all []string
+	cursor := ""
+	for {
+		tokens, next, err := s.List(cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, tokens...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if !reflect.DeepEqual(all, []string{"a", "c", "d"}) {
+		t.Errorf("got %v: expected %v", all, []string{"a", "c", "d"})
+	}
+}
+
+func TestCount(t *testing.T) {
+	s := NewWithCleanupInterval(0)
+	for _, token := range []string{"a", "b", "c"} {
+		err := s.Commit(token, []byte(token), time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.Commit("b", []byte("b"), time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got %d: expected %d", n, 2)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, NewWithCleanupInterval(0))
+}
@@ -0,0 +1,411 @@
+// Package sqlstore provides a database/sql based session store for use with
+// the github.com/golangcollege/sessions package. It works with PostgreSQL and
+// MySQL, and any other database which supports the same placeholder syntax.
+//
+// The session data is kept in a table named sessions. For PostgreSQL, create
+// it with:
+//
+//	CREATE TABLE sessions (
+//		token TEXT PRIMARY KEY,
+//		data BYTEA NOT NULL,
+//		expiry TIMESTAMPTZ NOT NULL
+//	);
+//
+//	CREATE INDEX sessions_expiry_idx ON sessions (expiry);
+//
+// And for MySQL:
+//
+//	CREATE TABLE sessions (
+//		token CHAR(43) PRIMARY KEY,
+//		data BLOB NOT NULL,
+//		expiry TIMESTAMP(6) NOT NULL
+//	);
+//
+//	CREATE INDEX sessions_expiry_idx ON sessions (expiry);
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/golangcollege/sessions/internal/recent"
+)
+
+// Dialect holds the SQL statements used by a SQLStore. List and Count are
+// optional, and are only needed for the methods of the same name.
+type Dialect struct {
+	Find          string
+	Commit        string
+	Delete        string
+	DeleteExpired string
+	List          string
+	Count         string
+}
+
+// Postgres is the Dialect for PostgreSQL.
+var Postgres = Dialect{
+	Find:          "SELECT data, expiry FROM sessions WHERE token = $1",
+	Commit:        "INSERT INTO sessions (token, data, expiry) VALUES ($1, $2, $3) ON CONFLICT (token) DO UPDATE SET data = EXCLUDED.data, expiry = EXCLUDED.expiry",
+	Delete:        "DELETE FROM sessions WHERE token = $1",
+	DeleteExpired: "DELETE FROM sessions WHERE expiry < $1",
+	List:          "SELECT token FROM sessions WHERE token > $1 AND expiry >= $2 ORDER BY token LIMIT $3",
+	Count:         "SELECT COUNT(*) FROM sessions WHERE expiry >= $1",
+}
+
+// MySQL is the Dialect for MySQL.
+var MySQL = Dialect{
+	Find:          "SELECT data, expiry FROM sessions WHERE token = ?",
+	Commit:        "INSERT INTO sessions (token, data, expiry) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE data = VALUES(data), expiry = VALUES(expiry)",
+	Delete:        "DELETE FROM sessions WHERE token = ?",
+	DeleteExpired: "DELETE FROM sessions WHERE expiry < ?",
+	List:          "SELECT token FROM sessions WHERE token > ? AND expiry >= ? ORDER BY token LIMIT ?",
+	Count:         "SELECT COUNT(*) FROM sessions WHERE expiry >= ?",
+}
+
+// Consistency sets which sessions a SQLStore with a Replica reads from the
+// replica.
+type Consistency int
+
+const (
+	// ReadYourWrites reads sessions which this SQLStore has committed or
+	// deleted within the last ReplicaLag from the primary, so that a request
+	// sees the changes made by the previous one, and a deleted session can't
+	// be found on a replica which hasn't caught up yet. Other sessions are
+	// read from the replica, and from the primary if they aren't found on
+	// the replica, in case another instance of your application has just
+	// written them. Sessions which another instance has just deleted may
+	// still be found on the replica. This is the default.
+	ReadYourWrites Consistency = iota
+
+	// Eventual reads every session from the replica, so a session may be
+	// read as it was before its latest change, or after it was deleted, until
+	// the replica catches up.
+	Eventual
+)
+
+// Options configures a SQLStore created with NewWithOptions.
+type Options struct {
+	// CleanupInterval controls how frequently expired session data is
+	// removed by the background cleanup goroutine. Setting it to 0 prevents
+	// the cleanup goroutine from running.
+	CleanupInterval time.Duration
+
+	// CleanupJitter randomly lengthens or shortens each wait between
+	// cleanups by up to this fraction of CleanupInterval, so that instances
+	// which were started together don't all delete expired sessions at the
+	// same moment. It should be between 0 and 1. The default is 0, which means
+	// no jitter.
+	CleanupJitter float64
+
+	// OnCleanup, if set, is called after each cleanup with the number of
+	// expired sessions which were removed, and any error, so that they can
+	// be reported to your metrics. By default, errors are logged with the
+	// standard logger.
+	OnCleanup func(removed int64, err error)
+
+	// Replica, if set, is a read-only replica of the database which sessions
+	// are found in, according to Consistency, to take load off the primary.
+	// Sessions are always committed and deleted on the primary.
+	Replica *sql.DB
+
+	// Consistency sets which sessions are read from the Replica. The default
+	// is ReadYourWrites.
+	Consistency Consistency
+
+	// ReplicaLag sets how far the Replica may fall behind the primary with
+	// ReadYourWrites. The default is 1 second.
+	ReplicaLag time.Duration
+
+	// Timeout, if set, limits how long each Find, Commit, Delete, List and
+	// Count waits for the database, including for a connection from the
+	// pool, so that a slow database fails requests quickly instead of
+	// holding them up. The cleanup of expired sessions isn't limited. The
+	// pool sizes are set on the sql.DB, with SetMaxOpenConns and
+	// SetMaxIdleConns, and the dial timeouts in the DSN. The default is 0,
+	// which means no timeout.
+	Timeout time.Duration
+}
+
+// errNoList is returned by List when the Dialect has no List statement.
+var errNoList = errors.New("sqlstore: the Dialect has no List statement")
+
+// errNoCount is returned by Count when the Dialect has no Count statement.
+var errNoCount = errors.New("sqlstore: the Dialect has no Count statement")
+
+// SQLStore represents the session store.
+type SQLStore struct {
+	db          *sql.DB
+	replica     *sql.DB
+	consistency Consistency
+	written     *recent.Set
+	dialect     Dialect
+	onCleanup   func(removed int64, err error)
+	timeout     time.Duration
+	stopCleanup chan bool
+	stopped     chan bool
+	stopOnce    sync.Once
+}
+
+// New returns a new SQLStore instance using the given Dialect, with a
+// background cleanup goroutine that runs every 5 minutes to remove expired
+// session data.
+func New(db *sql.DB, dialect Dialect) *SQLStore {
+	return NewWithCleanupInterval(db, dialect, 5*time.Minute)
+}
+
+// NewWithCleanupInterval returns a new SQLStore instance using the given
+// Dialect. The cleanupInterval parameter controls how frequently expired
+// session data is removed by the background cleanup goroutine. Setting it to 0
+// prevents the cleanup goroutine from running (i.e. expired sessions will not
+// be removed).
+func NewWithCleanupInterval(db *sql.DB, dialect Dialect, cleanupInterval time.Duration) *SQLStore {
+	return NewWithOptions(db, dialect, Options{CleanupInterval: cleanupInterval})
+}
+
+// NewWithOptions returns a new SQLStore instance using the given Dialect and
+// Options.
+func NewWithOptions(db *sql.DB, dialect Dialect, opts Options) *SQLStore {
+	s := &SQLStore{
+		db:          db,
+		replica:     opts.Replica,
+		consistency: opts.Consistency,
+		dialect:     dialect,
+		onCleanup:   opts.OnCleanup,
+		timeout:     opts.Timeout,
+	}
+	if s.replica != nil && s.consistency == ReadYourWrites {
+		lag := opts.ReplicaLag
+		if lag <= 0 {
+			lag = time.Second
+		}
+		s.written = recent.New(lag)
+	}
+
+	if opts.CleanupInterval > 0 {
+		s.stopCleanup = make(chan bool)
+		s.stopped = make(chan bool)
+		go s.startCleanup(opts.CleanupInterval, opts.CleanupJitter)
+	}
+
+	return s
+}
+
+// Find returns the data for a given session token from the SQLStore instance.
+// If the session token is not found or is expired, the returned found value
+// will be false.
+func (s *SQLStore) Find(token string) ([]byte, bool, error) {
+	db := s.reader(token)
+	b, found, err := s.find(db, token)
+	if err == nil && !found && db != s.db && s.consistency == ReadYourWrites {
+		// The session may have been written by another instance of the
+		// application, and not have reached the replica yet.
+		return s.find(s.db, token)
+	}
+	return b, found, err
+}
+
+func (s *SQLStore) find(db *sql.DB, token string) ([]byte, bool, error) {
+	var b []byte
+	var expiry time.Time
+	ctx, cancel := s.context()
+	defer cancel()
+	err := db.QueryRowContext(ctx, s.dialect.Find, token).Scan(&b, &expiry)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if time.Now().After(expiry) {
+		return nil, false, nil
+	}
+	return b, true, nil
+}
+
+// Commit adds a session token and data to the SQLStore instance with the given
+// expiry time. If the session token already exists, then the data and expiry
+// time are updated.
+func (s *SQLStore) Commit(token string, b []byte, expiry time.Time) error {
+	s.wrote(token)
+	ctx, cancel := s.context()
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, s.dialect.Commit, token, b, expiry.UTC())
+	return err
+}
+
+// Delete removes a session token and corresponding data from the SQLStore
+// instance.
+func (s *SQLStore) Delete(token string) error {
+	s.wrote(token)
+	ctx, cancel := s.context()
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, s.dialect.Delete, token)
+	return err
+}
+
+// context returns the context for an operation, which is done after the
+// Timeout.
+func (s *SQLStore) context() (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return context.Background(), func() {}
+	}
+	return context.WithTimeout(context.Background(), s.timeout)
+}
+
+// reader returns the database which the session token should be found in.
+func (s *SQLStore) reader(token string) *sql.DB {
+	if s.replica == nil || (s.written != nil && s.written.Contains(token)) {
+		return s.db
+	}
+	return s.replica
+}
+
+// wrote records that the session token is being written to the primary, so
+// that ReadYourWrites reads it from there until the replica has caught up.
+func (s *SQLStore) wrote(token string) {
+	if s.written != nil {
+		s.written.Add(token)
+	}
+}
+
+// List returns up to limit session tokens from the SQLStore instance, in
+// order, after the cursor, which is the last token of the previous page. The
+// returned next cursor is "" after the last page. If limit isn't positive, all
+// of the tokens are returned. Expired sessions are left out. List reads from
+// the Replica, if there is one.
+func (s *SQLStore) List(cursor string, limit int) ([]string, string, error) {
+	if s.dialect.List == "" {
+		return nil, "", errNoList
+	}
+	if limit <= 0 {
+		limit = math.MaxInt32 - 1
+	}
+
+	db := s.db
+	if s.replica != nil {
+		db = s.replica
+	}
+	ctx, cancel := s.context()
+	defer cancel()
+	rows, err := db.QueryContext(ctx, s.dialect.List, cursor, time.Now().UTC(), limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var tokens []string
+	for rows.Next() {
+		var token string
+		err = rows.Scan(&token)
+		if err != nil {
+			return nil, "", err
+		}
+		tokens = append(tokens, token)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(tokens) <= limit {
+		return tokens, "", nil
+	}
+	return tokens[:limit], tokens[limit-1], nil
+}
+
+// Count returns the number of unexpired sessions in the SQLStore instance.
+// Count reads from the Replica, if there is one.
+func (s *SQLStore) Count() (int, error) {
+	if s.dialect.Count == "" {
+		return 0, errNoCount
+	}
+
+	db := s.db
+	if s.replica != nil {
+		db = s.replica
+	}
+	ctx, cancel := s.context()
+	defer cancel()
+	var n int
+	err := db.QueryRowContext(ctx, s.dialect.Count, time.Now().UTC()).Scan(&n)
+	return n, err
+}
+
+// Ping checks that the database, and the Replica if there is one, can be
+// reached before ctx is done.
+func (s *SQLStore) Ping(ctx context.Context) error {
+	err := s.db.PingContext(ctx)
+	if err == nil && s.replica != nil {
+		err = s.replica.PingContext(ctx)
+	}
+	return err
+}
+
+// StopCleanup terminates the background cleanup goroutine for the SQLStore
+// instance. It's rare to terminate this; generally SQLStore instances and
+// their cleanup goroutines are intended to be long-lived and run for the
+// lifetime of your application. StopCleanup waits for a cleanup which is in
+// progress to finish, and can safely be called more than once.
+func (s *SQLStore) StopCleanup() {
+	if s.stopCleanup == nil {
+		return
+	}
+	s.stopOnce.Do(func() {
+		close(s.stopCleanup)
+	})
+	<-s.stopped
+}
+
+// Close stops the background cleanup goroutine, so that the database can be
+// closed safely afterwards. It doesn't close the *sql.DB, which belongs to the
+// caller. It always returns nil, and lets Session.Close() shut the SQLStore
+// down along with the session.
+func (s *SQLStore) Close() error {
+	s.StopCleanup()
+	return nil
+}
+
+func (s *SQLStore) startCleanup(interval time.Duration, jitter float64) {
+	timer := time.NewTimer(jittered(interval, jitter))
+	defer close(s.stopped)
+	for {
+		select {
+		case <-timer.C:
+			removed, err := s.deleteExpired()
+			if s.onCleanup != nil {
+				s.onCleanup(removed, err)
+			} else if err != nil {
+				log.Println(err)
+			}
+			timer.Reset(jittered(interval, jitter))
+		case <-s.stopCleanup:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// jittered returns the interval, randomly lengthened or shortened by up to
+// the jitter fraction of it.
+func jittered(interval time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	return interval + time.Duration((2*rand.Float64()-1)*jitter*float64(interval))
+}
+
+func (s *SQLStore) deleteExpired() (int64, error) {
+	res, err := s.db.Exec(s.dialect.DeleteExpired, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
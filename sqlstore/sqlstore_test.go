@@ -0,0 +1,423 @@
+package sqlstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestFind(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"data", "expiry"}).AddRow([]byte("encoded_data"), time.Now().Add(time.Minute))
+	mock.ExpectQuery(regexp.QuoteMeta(Postgres.Find)).WithArgs("session_token").WillReturnRows(rows)
+
+	s := NewWithCleanupInterval(db, Postgres, 0)
+	b, found, err := s.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != true {
+		t.Fatalf("got %v: expected %v", found, true)
+	}
+	if bytes.Equal(b, []byte("encoded_data")) == false {
+		t.Fatalf("got %v: expected %v", b, []byte("encoded_data"))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindMissing(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"data", "expiry"})
+	mock.ExpectQuery(regexp.QuoteMeta(MySQL.Find)).WithArgs("missing_session_token").WillReturnRows(rows)
+
+	s := NewWithCleanupInterval(db, MySQL, 0)
+	_, found, err := s.Find("missing_session_token")
+	if err != nil {
+		t.Fatalf("got %v: expected %v", err, nil)
+	}
+	if found != false {
+		t.Fatalf("got %v: expected %v", found, false)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"data", "expiry"}).AddRow([]byte("encoded_data"), time.Now().Add(-time.Minute))
+	mock.ExpectQuery(regexp.QuoteMeta(Postgres.Find)).WithArgs("session_token").WillReturnRows(rows)
+
+	s := NewWithCleanupInterval(db, Postgres, 0)
+	_, found, err := s.Find("session_token")
+	if err != nil {
+		t.Fatalf("got %v: expected %v", err, nil)
+	}
+	if found != false {
+		t.Fatalf("got %v: expected %v", found, false)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	expiry := time.Now().Add(time.Minute)
+	mock.ExpectExec(regexp.QuoteMeta(Postgres.Commit)).WithArgs("session_token", []byte("encoded_data"), expiry.UTC()).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	s := NewWithCleanupInterval(db, Postgres, 0)
+	err = s.Commit("session_token", []byte("encoded_data"), expiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(Postgres.Delete)).WithArgs("session_token").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s := NewWithCleanupInterval(db, Postgres, 0)
+	err = s.Delete("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(Postgres.DeleteExpired)).WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 3))
+
+	s := NewWithCleanupInterval(db, Postgres, 0)
+	removed, err := s.deleteExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 3 {
+		t.Errorf("got %d: expected %d", removed, 3)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	s := NewWithCleanupInterval(db, Postgres, time.Hour)
+	for i := 0; i < 2; i++ {
+		err = s.Close()
+		if err != nil {
+			t.Errorf("got %v: expected %v", err, nil)
+		}
+	}
+}
+
+func TestPing(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	errDown := errors.New("database is down")
+	mock.ExpectPing()
+	mock.ExpectPing().WillReturnError(errDown)
+
+	s := NewWithCleanupInterval(db, Postgres, 0)
+	err = s.Ping(context.Background())
+	if err != nil {
+		t.Errorf("got %v: expected %v", err, nil)
+	}
+	err = s.Ping(context.Background())
+	if err != errDown {
+		t.Errorf("got %v: expected %v", err, errDown)
+	}
+}
+
+func TestReplica(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	replica, replicaMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	expiry := time.Now().Add(time.Minute)
+	replicaMock.ExpectQuery(regexp.QuoteMeta(Postgres.Find)).WithArgs("other_token").WillReturnRows(sqlmock.NewRows([]string{"data", "expiry"}).AddRow([]byte("other_data"), expiry))
+	mock.ExpectExec(regexp.QuoteMeta(Postgres.Commit)).WithArgs("session_token", []byte("encoded_data"), expiry.UTC()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(Postgres.Find)).WithArgs("session_token").WillReturnRows(sqlmock.NewRows([]string{"data", "expiry"}).AddRow([]byte("encoded_data"), expiry))
+
+	s := NewWithOptions(db, Postgres, Options{Replica: replica})
+	_, found, err := s.Find("other_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != true {
+		t.Errorf("got %v: expected %v", found, true)
+	}
+	err = s.Commit("session_token", []byte("encoded_data"), expiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err := s.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(b, []byte("encoded_data")) == false {
+		t.Errorf("got %v: expected %v", b, []byte("encoded_data"))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if err := replicaMock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplicaMiss(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	replica, replicaMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	// A session written by another instance is found on the primary when it
+	// hasn't reached the replica yet.
+	expiry := time.Now().Add(time.Minute)
+	replicaMock.ExpectQuery(regexp.QuoteMeta(Postgres.Find)).WithArgs("session_token").WillReturnRows(sqlmock.NewRows([]string{"data", "expiry"}))
+	mock.ExpectQuery(regexp.QuoteMeta(Postgres.Find)).WithArgs("session_token").WillReturnRows(sqlmock.NewRows([]string{"data", "expiry"}).AddRow([]byte("encoded_data"), expiry))
+
+	s := NewWithOptions(db, Postgres, Options{Replica: replica})
+	b, found, err := s.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != true || !bytes.Equal(b, []byte("encoded_data")) {
+		t.Errorf("got %v, %q: expected %v, %q", found, b, true, "encoded_data")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if err := replicaMock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplicaEventual(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	replica, replicaMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	expiry := time.Now().Add(time.Minute)
+	mock.ExpectExec(regexp.QuoteMeta(Postgres.Delete)).WithArgs("session_token").WillReturnResult(sqlmock.NewResult(0, 1))
+	replicaMock.ExpectQuery(regexp.QuoteMeta(Postgres.Find)).WithArgs("session_token").WillReturnRows(sqlmock.NewRows([]string{"data", "expiry"}).AddRow([]byte("encoded_data"), expiry))
+
+	s := NewWithOptions(db, Postgres, Options{Replica: replica, Consistency: Eventual})
+	err = s.Delete("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, found, err := s.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != true {
+		t.Errorf("got %v: expected %v", found, true)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if err := replicaMock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOnCleanup(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(Postgres.DeleteExpired)).WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 2))
+
+	removed := make(chan int64, 1)
+	s := NewWithOptions(db, Postgres, Options{
+		CleanupInterval: 10 * time.Millisecond,
+		CleanupJitter:   0.5,
+		OnCleanup: func(n int64, err error) {
+			if err == nil {
+				select {
+				case removed <- n:
+				default:
+				}
+			}
+		},
+	})
+	defer s.Close()
+
+	select {
+	case n := <-removed:
+		if n != 2 {
+			t.Errorf("got %d: expected %d", n, 2)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a cleanup")
+	}
+}
+
+func TestJittered(t *testing.T) {
+	if d := jittered(time.Minute, 0); d != time.Minute {
+		t.Errorf("got %v: expected %v", d, time.Minute)
+	}
+	for i := 0; i < 100; i++ {
+		d := jittered(time.Minute, 0.1)
+		if d < 54*time.Second || d > 66*time.Second {
+			t.Fatalf("got %v: expected within 10%% of %v", d, time.Minute)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(Postgres.List)).WithArgs("", sqlmock.AnyArg(), 3).WillReturnRows(sqlmock.NewRows([]string{"token"}).AddRow("a").AddRow("b").AddRow("c"))
+	mock.ExpectQuery(regexp.QuoteMeta(Postgres.List)).WithArgs("b", sqlmock.AnyArg(), 3).WillReturnRows(sqlmock.NewRows([]string{"token"}).AddRow("c"))
+
+	s := NewWithCleanupInterval(db, Postgres, 0)
+	tokens, next, err := s.List("", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tokens, []string{"a", "b"}) || next != "b" {
+		t.Errorf("got %v, %q: expected %v, %q", tokens, next, []string{"a", "b"}, "b")
+	}
+	tokens, next, err = s.List(next, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tokens, []string{"c"}) || next != "" {
+		t.Errorf("got %v, %q: expected %v, %q", tokens, next, []string{"c"}, "")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = NewWithCleanupInterval(db, Dialect{}, 0).List("", 2)
+	if err != errNoList {
+		t.Errorf("got %v: expected %v", err, errNoList)
+	}
+}
+
+func TestCount(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(Postgres.Count)).WithArgs(sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+
+	s := NewWithCleanupInterval(db, Postgres, 0)
+	n, err := s.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 42 {
+		t.Errorf("got %d: expected %d", n, 42)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewWithCleanupInterval(db, Dialect{}, 0).Count()
+	if err != errNoCount {
+		t.Errorf("got %v: expected %v", err, errNoCount)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(Postgres.Find)).WithArgs("session_token").WillDelayFor(time.Second).WillReturnRows(sqlmock.NewRows([]string{"data", "expiry"}))
+
+	s := NewWithOptions(db, Postgres, Options{Timeout: 10 * time.Millisecond})
+	start := time.Now()
+	_, _, err = s.Find("session_token")
+	if err == nil {
+		t.Errorf("got %v: expected an error", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("got %v: expected the timeout to stop Find", d)
+	}
+}
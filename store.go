@@ -0,0 +1,236 @@
+package sessions
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"reflect"
+	"time"
+)
+
+// Store is the interface for server-side session stores. When Session.Store
+// is set, the session cookie only carries an opaque, randomly generated
+// session token, and the encrypted session data is kept in the store under
+// that token. This lifts the 4096 byte limit on the session data, and means
+// that a session can be revoked by deleting it from the store.
+//
+// The memstore, redisstore and sqlstore packages provide implementations for
+// common backends.
+type Store interface {
+	// Find returns the data for the given session token. If the token is not
+	// found or has expired then found should be false, and err should be nil.
+	Find(token string) (b []byte, found bool, err error)
+
+	// Commit adds the data for the given session token to the store, with the
+	// given expiry time. If the token already exists then its data and expiry
+	// time should be replaced.
+	Commit(token string, b []byte, expiry time.Time) error
+
+	// Delete removes the given session token and its data from the store. If
+	// the token doesn't exist then Delete should be a no-op.
+	Delete(token string) error
+}
+
+// Lister is implemented by stores which can list the session tokens they
+// hold, such as memstore, redisstore and sqlstore. It is used by
+// ListSessions() and UserSessions().
+type Lister interface {
+	// List returns up to limit session tokens, starting from the opaque
+	// cursor, which is "" for the first page, and the cursor for the next
+	// page, which is "" after the last page. A page may hold fewer than limit
+	// tokens, even none, before the last page. Expired sessions should be
+	// left out. Tokens which are committed or deleted while the list is being
+	// paged through may or may not be listed.
+	List(cursor string, limit int) (tokens []string, next string, err error)
+}
+
+// BatchFinder is implemented by stores which can find many sessions in one
+// round trip, such as memstore and redisstore. It is used by Preload().
+type BatchFinder interface {
+	// FindMany returns the data for each of the tokens which is found and
+	// hasn't expired, keyed by token. Tokens which aren't found are left out.
+	FindMany(tokens []string) (map[string][]byte, error)
+}
+
+// Pinger is implemented by stores which can check that their backend is
+// reachable, such as redisstore and sqlstore.
+type Pinger interface {
+	// Ping returns an error if the store's backend can't be reached before
+	// ctx is done.
+	Ping(ctx context.Context) error
+}
+
+// Ping checks that the session's stores are working, for use in readiness
+// probes, so that an instance can stop taking traffic while its session
+// backend is down rather than failing every request which uses a session.
+// Each of the Store and the OversizeStore which implements Pinger is pinged,
+// and the first error is returned, wrapping ErrStoreFailed. Stores which don't
+// implement Pinger, and sessions without a Store, are assumed to be healthy.
+func (s *Session) Ping(ctx context.Context) error {
+	for _, st := range []Store{s.Store, s.OversizeStore} {
+		p, ok := st.(Pinger)
+		if !ok {
+			continue
+		}
+		err := p.Ping(ctx)
+		if err != nil {
+			return wrapError(ErrStoreFailed, err)
+		}
+	}
+	return nil
+}
+
+// Close shuts down the session's stores for a graceful shutdown. Each of the
+// Store and the OversizeStore which implements io.Closer is closed, which
+// stops the background cleanup goroutines of memstore and sqlstore. Sessions
+// are saved before each response is sent, so there are no pending writes to
+// flush: call Close once http.Server.Shutdown has returned. Connection pools
+// which were passed to a store, such as a *redis.Pool or a *sql.DB, belong to
+// the caller and are left open. If ctx is done before the stores have closed,
+// Close returns ctx.Err().
+func (s *Session) Close(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		for i, st := range []Store{s.Store, s.OversizeStore} {
+			closer, ok := st.(io.Closer)
+			if !ok || (i == 1 && sameStore(st, s.Store)) {
+				continue
+			}
+			if cerr := closer.Close(); cerr != nil && err == nil {
+				err = wrapError(ErrStoreFailed, cerr)
+			}
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sameStore reports whether a and b are the same store. Stores whose type
+// can't be compared are never the same.
+func sameStore(a, b Store) bool {
+	t := reflect.TypeOf(a)
+	return t != nil && t.Comparable() && t == reflect.TypeOf(b) && a == b
+}
+
+// newToken returns a new random session token for use with a Store.
+func newToken(random io.Reader) (string, error) {
+	b := make([]byte, 32)
+	_, err := io.ReadFull(random, b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// storeFind calls st.Find, retrying it and reporting each attempt to the
+// Metrics.
+func (s *Session) storeFind(st Store, token string) (b []byte, found bool, err error) {
+	err = s.retryStore(func() error {
+		start := time.Now()
+		b, found, err = st.Find(token)
+		s.observeStore(st, "find", start, err)
+		return err
+	})
+	return b, found, err
+}
+
+// storeCommit calls st.Commit, retrying it and reporting each attempt to the
+// Metrics.
+func (s *Session) storeCommit(st Store, token string, b []byte, expiry time.Time) error {
+	return s.retryStore(func() error {
+		start := time.Now()
+		err := st.Commit(token, b, expiry)
+		s.observeStore(st, "commit", start, err)
+		return err
+	})
+}
+
+// storeDelete calls st.Delete, retrying it and reporting each attempt to the
+// Metrics.
+func (s *Session) storeDelete(st Store, token string) error {
+	return s.retryStore(func() error {
+		start := time.Now()
+		err := st.Delete(token)
+		s.observeStore(st, "delete", start, err)
+		return err
+	})
+}
+
+// retryStore calls op, and calls it again up to StoreRetries times while it
+// returns an error which StoreRetryable accepts, waiting StoreRetryBackoff
+// before the first retry and twice as long before each one after that.
+func (s *Session) retryStore(op func() error) error {
+	backoff := s.StoreRetryBackoff
+	err := op()
+	for i := 0; i < s.StoreRetries && err != nil; i++ {
+		if s.StoreRetryable != nil && !s.StoreRetryable(err) {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		err = op()
+	}
+	return err
+}
+
+// find loads the encrypted session data for the token from the store. If the
+// token isn't found then ErrInvalidToken is returned.
+func (s *Session) find(st Store, c *cache, token string) error {
+	b, found, err := s.storeFind(st, token)
+	if err != nil {
+		return wrapError(ErrStoreFailed, err)
+	}
+	if !found {
+		return ErrInvalidToken
+	}
+	return s.decodeStored(c, token, b)
+}
+
+// decodeStored decrypts and decodes the session data b, which was found in
+// the store under the token.
+func (s *Session) decodeStored(c *cache, token string, b []byte) error {
+	err := c.decode(s.codec(), s.ciphers(), string(b), s.decryptionKeys(c))
+	if err != nil {
+		return err
+	}
+	c.token = token
+	return nil
+}
+
+// commit encrypts the session data and commits it to the store, generating a
+// new session token if the session doesn't have one yet. If the session has
+// been renewed, then its old token is deleted. The caller must hold c.mu.
+func (s *Session) commit(st Store, c *cache) error {
+	c.Revision++
+	b, err := s.encode(c)
+	if err != nil {
+		return err
+	}
+
+	if c.token == "" {
+		c.token, err = newToken(s.random())
+		if err != nil {
+			return err
+		}
+	}
+	err = s.storeCommit(st, c.token, []byte(b), c.Expiry)
+	if err != nil {
+		return wrapError(ErrStoreFailed, err)
+	}
+
+	if c.oldToken != "" {
+		err = s.storeDelete(st, c.oldToken)
+		if err != nil {
+			return wrapError(ErrStoreFailed, err)
+		}
+		c.oldToken = ""
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golangcollege/sessions/memstore"
+)
+
+func TestStore(t *testing.T) {
+	store := memstore.NewWithCleanupInterval(0)
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = store
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", strings.Repeat("a", 5000))
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+	if cookie == "" {
+		t.Fatal("expected a session cookie")
+	}
+
+	token := strings.TrimPrefix(strings.SplitN(cookie, ";", 2)[0], cookieName+"=")
+	if len(token) != 43 {
+		t.Errorf("got %d: expected %d", len(token), 43)
+	}
+	_, found, err := store.Find(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != true {
+		t.Fatalf("got %v: expected %v", found, true)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, len(s.GetString(r, "foo")))
+		s.Put(r, "bar", "baz")
+	})
+	body, cookie2 := testRequest(t, s.Enable(h), cookie)
+	if body != "5000" {
+		t.Errorf("got %q: expected %q", body, "5000")
+	}
+	token2 := strings.TrimPrefix(strings.SplitN(cookie2, ";", 2)[0], cookieName+"=")
+	if token2 != token {
+		t.Errorf("got %q: expected %q", token2, token)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Destroy(r)
+	})
+	testRequest(t, s.Enable(h), cookie)
+	_, found, err = store.Find(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != false {
+		t.Errorf("got %v: expected %v", found, false)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "bar"))
+	})
+	body, _ = testRequest(t, s.Enable(h), cookie)
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+}
+
+func TestStoreDestroyAndRestart(t *testing.T) {
+	store := memstore.NewWithCleanupInterval(0)
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = store
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+	token := strings.TrimPrefix(strings.SplitN(cookie, ";", 2)[0], cookieName+"=")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Destroy(r)
+		s.Put(r, "baz", "qux")
+	})
+	_, cookie = testRequest(t, s.Enable(h), cookie)
+	newToken := strings.TrimPrefix(strings.SplitN(cookie, ";", 2)[0], cookieName+"=")
+	if newToken == token || newToken == "" {
+		t.Fatalf("got %q: expected a new token", newToken)
+	}
+
+	_, found, err := store.Find(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != false {
+		t.Errorf("got %v: expected %v", found, false)
+	}
+	_, found, err = store.Find(newToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != true {
+		t.Errorf("got %v: expected %v", found, true)
+	}
+}
+
+func TestStoreRevoke(t *testing.T) {
+	store := memstore.NewWithCleanupInterval(0)
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = store
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	token := strings.TrimPrefix(strings.SplitN(cookie, ";", 2)[0], cookieName+"=")
+	err := store.Delete(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+}
+
+func TestStoreInvalidToken(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = memstore.NewWithCleanupInterval(0)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.Exists(r, "foo"))
+	})
+	body, _ := testRequest(t, s.Enable(h), cookieName+"=unknown")
+	if body != "false" {
+		t.Errorf("got %q: expected %q", body, "false")
+	}
+}
+
+func TestStoreRenew(t *testing.T) {
+	store := memstore.NewWithCleanupInterval(0)
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = store
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+	token := strings.TrimPrefix(strings.SplitN(cookie, ";", 2)[0], cookieName+"=")
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Renew(r)
+	})
+	_, cookie = testRequest(t, s.Enable(h), cookie)
+	renewed := strings.TrimPrefix(strings.SplitN(cookie, ";", 2)[0], cookieName+"=")
+	if renewed == "" || renewed == token {
+		t.Fatalf("got %q: expected a new token", renewed)
+	}
+
+	_, found, err := store.Find(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != false {
+		t.Errorf("got %v: expected %v", found, false)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+}
+
+type closingStore struct {
+	*memstore.MemStore
+	closed int
+	block  chan bool
+}
+
+func (cs *closingStore) Close() error {
+	if cs.block != nil {
+		<-cs.block
+	}
+	cs.closed++
+	return nil
+}
+
+func TestClose(t *testing.T) {
+	store := &closingStore{MemStore: memstore.NewWithCleanupInterval(0)}
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = store
+	s.OversizeStore = store
+
+	err := s.Close(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.closed != 1 {
+		t.Errorf("got %d: expected %d", store.closed, 1)
+	}
+
+	store.block = make(chan bool)
+	defer close(store.block)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	err = s.Close(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("got %v: expected %v", err, context.DeadlineExceeded)
+	}
+
+	err = New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4")).Close(context.Background())
+	if err != nil {
+		t.Errorf("got %v: expected %v", err, nil)
+	}
+}
+
+type pingStore struct {
+	*memstore.MemStore
+	err error
+}
+
+func (ps pingStore) Ping(ctx context.Context) error {
+	return ps.err
+}
+
+func TestPing(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	err := s.Ping(context.Background())
+	if err != nil {
+		t.Errorf("got %v: expected %v", err, nil)
+	}
+
+	errDown := errors.New("store is down")
+	s.Store = pingStore{MemStore: memstore.NewWithCleanupInterval(0), err: errDown}
+	err = s.Ping(context.Background())
+	if !errors.Is(err, errDown) || !errors.Is(err, ErrStoreFailed) {
+		t.Errorf("got %v: expected %v", err, errDown)
+	}
+}
+
+type flakyStore struct {
+	*memstore.MemStore
+	failures int
+	calls    int
+}
+
+func (fs *flakyStore) Commit(token string, b []byte, expiry time.Time) error {
+	fs.calls++
+	if fs.calls <= fs.failures {
+		return errors.New("connection reset")
+	}
+	return fs.MemStore.Commit(token, b, expiry)
+}
+
+func TestStoreRetry(t *testing.T) {
+	store := &flakyStore{MemStore: memstore.NewWithCleanupInterval(0), failures: 2}
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = store
+	s.StoreRetries = 2
+	s.StoreRetryBackoff = time.Millisecond
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+	if cookie == "" {
+		t.Fatal("expected a session cookie")
+	}
+	if store.calls != 3 {
+		t.Errorf("got %d: expected %d", store.calls, 3)
+	}
+
+	store.calls = 0
+	s.StoreRetryable = func(err error) bool { return false }
+	var got error
+	s.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		got = err
+	}
+	testRequest(t, s.Enable(h), "")
+	if !errors.Is(got, ErrStoreFailed) {
+		t.Errorf("got %v: expected %v", got, ErrStoreFailed)
+	}
+	if store.calls != 1 {
+		t.Errorf("got %d: expected %d", store.calls, 1)
+	}
+}
@@ -0,0 +1,138 @@
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"time"
+)
+
+// EncryptedStore wraps a Store, and encrypts the session data with its own
+// storage key before it is committed, using SecretBox. The session data which
+// a Session commits is already encrypted with the session's key, unless its
+// Cipher is SignedOnly, so the storage key matters when the Cipher is
+// SignedOnly, or when reading a dump of the backend shouldn't only need the
+// cookie key.
+type EncryptedStore struct {
+	store Store
+	keys  [][32]byte
+}
+
+// NewEncryptedStore returns an EncryptedStore which encrypts the session data
+// for st with the key, which must be exactly 32 bytes long, and panics if it
+// isn't. Session data encrypted with any of the oldKeys can still be found,
+// and is encrypted with the key the next time the session is saved. Session
+// data which can't be decrypted with any of the keys, such as data committed
+// before st was wrapped, is treated as missing.
+func NewEncryptedStore(st Store, key []byte, oldKeys ...[]byte) *EncryptedStore {
+	keys, err := toKeys(append([][]byte{key}, oldKeys...))
+	if err != nil {
+		panic(err)
+	}
+	return &EncryptedStore{store: st, keys: keys}
+}
+
+// Find returns the decrypted data for the given session token.
+func (e *EncryptedStore) Find(token string) ([]byte, bool, error) {
+	b, found, err := e.store.Find(token)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	out, ok := e.open(b)
+	return out, ok, nil
+}
+
+// FindMany returns the decrypted data for each of the given session tokens
+// which is found, in one round trip if the wrapped Store implements
+// BatchFinder, and with a Find for each token if it doesn't.
+func (e *EncryptedStore) FindMany(tokens []string) (map[string][]byte, error) {
+	bf, ok := e.store.(BatchFinder)
+	if !ok {
+		found := make(map[string][]byte, len(tokens))
+		for _, token := range tokens {
+			b, ok, err := e.Find(token)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				found[token] = b
+			}
+		}
+		return found, nil
+	}
+
+	found, err := bf.FindMany(tokens)
+	if err != nil {
+		return nil, err
+	}
+	for token, b := range found {
+		out, ok := e.open(b)
+		if ok {
+			found[token] = out
+		} else {
+			delete(found, token)
+		}
+	}
+	return found, nil
+}
+
+// open decrypts b with each of the storage keys in turn.
+func (e *EncryptedStore) open(b []byte) ([]byte, bool) {
+	for _, key := range e.keys {
+		out, err := (SecretBox{}).Open(b, key)
+		if err == nil {
+			return out, true
+		}
+	}
+	return nil, false
+}
+
+// Commit encrypts the data with the storage key, and commits it to the
+// wrapped Store.
+func (e *EncryptedStore) Commit(token string, b []byte, expiry time.Time) error {
+	sealed, err := (SecretBox{}).Seal(b, e.keys[0], rand.Reader)
+	if err != nil {
+		return err
+	}
+	return e.store.Commit(token, sealed, expiry)
+}
+
+// Delete removes the given session token from the wrapped Store.
+func (e *EncryptedStore) Delete(token string) error {
+	return e.store.Delete(token)
+}
+
+// List lists the session tokens in the wrapped Store, if it implements
+// Lister.
+func (e *EncryptedStore) List(cursor string, limit int) ([]string, string, error) {
+	l, ok := e.store.(Lister)
+	if !ok {
+		return nil, "", ErrListUnsupported
+	}
+	return l.List(cursor, limit)
+}
+
+// Count counts the sessions in the wrapped Store, if it implements Counter.
+func (e *EncryptedStore) Count() (int, error) {
+	c, ok := e.store.(Counter)
+	if !ok {
+		return 0, ErrCountUnsupported
+	}
+	return c.Count()
+}
+
+// Ping pings the wrapped Store if it implements Pinger.
+func (e *EncryptedStore) Ping(ctx context.Context) error {
+	if p, ok := e.store.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// Close closes the wrapped Store if it implements io.Closer.
+func (e *EncryptedStore) Close() error {
+	if c, ok := e.store.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
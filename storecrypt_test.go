@@ -0,0 +1,68 @@
+package sessions
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golangcollege/sessions/memstore"
+)
+
+func TestEncryptedStore(t *testing.T) {
+	store := memstore.NewWithCleanupInterval(0)
+	key := []byte("Zq4t7w!z%C*F-JaNdRgUkXp2s5u8x/A?")
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4")).WithCipher(SignedOnly{})
+	s.Store = NewEncryptedStore(store, key)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "plaintext value")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+	token := strings.TrimPrefix(strings.SplitN(cookie, ";", 2)[0], cookieName+"=")
+
+	b, found, err := store.Find(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != true {
+		t.Fatalf("got %v: expected %v", found, true)
+	}
+	if bytes.Contains(b, []byte("plaintext value")) {
+		t.Errorf("got %q: expected no plaintext", b)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "plaintext value" {
+		t.Errorf("got %q: expected %q", body, "plaintext value")
+	}
+
+	// Data stays readable after the storage key is rotated.
+	s.Store = NewEncryptedStore(store, []byte("8x/A?D(G+KbPeShVmYq3t6w9z$C&F)J@"), key)
+	body, _ = testRequest(t, s.Enable(h), cookie)
+	if body != "plaintext value" {
+		t.Errorf("got %q: expected %q", body, "plaintext value")
+	}
+}
+
+func TestEncryptedStoreUnreadable(t *testing.T) {
+	store := memstore.NewWithCleanupInterval(0)
+	err := store.Commit("session_token", []byte("unencrypted"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEncryptedStore(store, []byte("Zq4t7w!z%C*F-JaNdRgUkXp2s5u8x/A?"))
+	_, found, err := e.Find("session_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != false {
+		t.Errorf("got %v: expected %v", found, false)
+	}
+}
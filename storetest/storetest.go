@@ -0,0 +1,252 @@
+// Package storetest provides a conformance test suite for implementations of
+// the sessions.Store interface, so that third-party stores can check that
+// they behave as the github.com/golangcollege/sessions package expects.
+package storetest
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golangcollege/sessions"
+)
+
+// Run runs the conformance tests against st as subtests of t. They check the
+// Find, Commit and Delete semantics, expiry and concurrent use, and the
+// FindMany, List and Count methods if st implements sessions.BatchFinder,
+// sessions.Lister or sessions.Counter. The
+// store should be empty, and mustn't be used by anything else while Run is
+// running. Wrappers which return sessions.ErrListUnsupported or
+// sessions.ErrCountUnsupported skip those tests. The Store methods don't take a context.Context, so there is no
+// cancellation to test.
+func Run(t *testing.T, st sessions.Store) {
+	t.Run("CommitAndFind", func(t *testing.T) { testCommitAndFind(t, st) })
+	t.Run("Replace", func(t *testing.T) { testReplace(t, st) })
+	t.Run("FindMissing", func(t *testing.T) { testFindMissing(t, st) })
+	t.Run("Expired", func(t *testing.T) { testExpired(t, st) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, st) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, st) })
+	if bf, ok := st.(sessions.BatchFinder); ok {
+		t.Run("FindMany", func(t *testing.T) { testFindMany(t, st, bf) })
+	}
+	if l, ok := st.(sessions.Lister); ok {
+		t.Run("List", func(t *testing.T) { testList(t, st, l) })
+	}
+	if c, ok := st.(sessions.Counter); ok {
+		t.Run("Count", func(t *testing.T) { testCount(t, st, c) })
+	}
+}
+
+func commit(t *testing.T, st sessions.Store, token string, b []byte, expiry time.Time) {
+	t.Helper()
+	err := st.Commit(token, b, expiry)
+	if err != nil {
+		t.Fatalf("Commit(%q): %v", token, err)
+	}
+}
+
+func find(t *testing.T, st sessions.Store, token string) ([]byte, bool) {
+	t.Helper()
+	b, found, err := st.Find(token)
+	if err != nil {
+		t.Fatalf("Find(%q): %v", token, err)
+	}
+	return b, found
+}
+
+func remove(t *testing.T, st sessions.Store, token string) {
+	t.Helper()
+	err := st.Delete(token)
+	if err != nil {
+		t.Fatalf("Delete(%q): %v", token, err)
+	}
+}
+
+func testCommitAndFind(t *testing.T, st sessions.Store) {
+	data := []byte("encoded_data\x00\xff")
+	commit(t, st, "storetest_find", data, time.Now().Add(time.Minute))
+	defer remove(t, st, "storetest_find")
+
+	b, found := find(t, st, "storetest_find")
+	if found != true {
+		t.Fatalf("got %v: expected %v", found, true)
+	}
+	if !bytes.Equal(b, data) {
+		t.Errorf("got %q: expected %q", b, data)
+	}
+}
+
+func testReplace(t *testing.T, st sessions.Store) {
+	commit(t, st, "storetest_replace", []byte("old_data"), time.Now().Add(time.Minute))
+	commit(t, st, "storetest_replace", []byte("new_data"), time.Now().Add(time.Minute))
+	defer remove(t, st, "storetest_replace")
+
+	b, found := find(t, st, "storetest_replace")
+	if found != true {
+		t.Fatalf("got %v: expected %v", found, true)
+	}
+	if !bytes.Equal(b, []byte("new_data")) {
+		t.Errorf("got %q: expected %q", b, "new_data")
+	}
+}
+
+func testFindMissing(t *testing.T, st sessions.Store) {
+	_, found := find(t, st, "storetest_missing")
+	if found != false {
+		t.Errorf("got %v: expected %v", found, false)
+	}
+}
+
+func testExpired(t *testing.T, st sessions.Store) {
+	commit(t, st, "storetest_expired", []byte("encoded_data"), time.Now().Add(-time.Minute))
+	defer remove(t, st, "storetest_expired")
+
+	_, found := find(t, st, "storetest_expired")
+	if found != false {
+		t.Fatalf("got %v: expected %v", found, false)
+	}
+
+	// Committing an expired session again with a later expiry brings it back.
+	commit(t, st, "storetest_expired", []byte("encoded_data"), time.Now().Add(time.Minute))
+	_, found = find(t, st, "storetest_expired")
+	if found != true {
+		t.Errorf("got %v: expected %v", found, true)
+	}
+}
+
+func testDelete(t *testing.T, st sessions.Store) {
+	commit(t, st, "storetest_delete", []byte("encoded_data"), time.Now().Add(time.Minute))
+	remove(t, st, "storetest_delete")
+
+	_, found := find(t, st, "storetest_delete")
+	if found != false {
+		t.Errorf("got %v: expected %v", found, false)
+	}
+
+	// Deleting a missing session is a no-op.
+	remove(t, st, "storetest_delete")
+}
+
+func testConcurrency(t *testing.T, st sessions.Store) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				token := "storetest_" + strconv.Itoa(i) + "_" + strconv.Itoa(j)
+				err := st.Commit(token, []byte(token), time.Now().Add(time.Minute))
+				if err != nil {
+					t.Errorf("Commit(%q): %v", token, err)
+					return
+				}
+				b, found, err := st.Find(token)
+				if err != nil || !found || string(b) != token {
+					t.Errorf("Find(%q): got %q, %v, %v: expected %q, %v, %v", token, b, found, err, token, true, nil)
+					return
+				}
+				err = st.Delete(token)
+				if err != nil {
+					t.Errorf("Delete(%q): %v", token, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func testFindMany(t *testing.T, st sessions.Store, bf sessions.BatchFinder) {
+	commit(t, st, "storetest_many_1", []byte("data_1"), time.Now().Add(time.Minute))
+	defer remove(t, st, "storetest_many_1")
+	commit(t, st, "storetest_many_2", []byte("data_2"), time.Now().Add(time.Minute))
+	defer remove(t, st, "storetest_many_2")
+	commit(t, st, "storetest_many_expired", []byte("expired"), time.Now().Add(-time.Minute))
+	defer remove(t, st, "storetest_many_expired")
+
+	found, err := bf.FindMany([]string{"storetest_many_1", "storetest_many_2", "storetest_many_expired", "storetest_many_missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Errorf("got %d: expected %d", len(found), 2)
+	}
+	for _, i := range []string{"1", "2"} {
+		if b := found["storetest_many_"+i]; !bytes.Equal(b, []byte("data_"+i)) {
+			t.Errorf("got %q: expected %q", b, "data_"+i)
+		}
+	}
+}
+
+func testList(t *testing.T, st sessions.Store, l sessions.Lister) {
+	expiry := time.Now().Add(time.Minute)
+	want := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		token := "storetest_list_" + strconv.Itoa(i)
+		commit(t, st, token, []byte(token), expiry)
+		defer remove(t, st, token)
+		want[token] = true
+	}
+	commit(t, st, "storetest_list_expired", nil, time.Now().Add(-time.Minute))
+	defer remove(t, st, "storetest_list_expired")
+
+	seen := map[string]bool{}
+	cursor := ""
+	for i := 0; ; i++ {
+		if i > 100 {
+			t.Fatal("List didn't finish after 100 pages")
+		}
+		tokens, next, err := l.List(cursor, 2)
+		if errors.Is(err, sessions.ErrListUnsupported) {
+			t.Skip("the wrapped store can't list sessions")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, token := range tokens {
+			seen[token] = true
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	for token := range want {
+		if !seen[token] {
+			t.Errorf("%q wasn't listed", token)
+		}
+	}
+	if seen["storetest_list_expired"] {
+		t.Error("an expired session was listed")
+	}
+}
+
+func testCount(t *testing.T, st sessions.Store, c sessions.Counter) {
+	before, err := c.Count()
+	if errors.Is(err, sessions.ErrCountUnsupported) {
+		t.Skip("the wrapped store can't count sessions")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiry := time.Now().Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		token := "storetest_count_" + strconv.Itoa(i)
+		commit(t, st, token, nil, expiry)
+		defer remove(t, st, token)
+	}
+	commit(t, st, "storetest_count_expired", nil, time.Now().Add(-time.Minute))
+	defer remove(t, st, "storetest_count_expired")
+
+	after, err := c.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after-before != 3 {
+		t.Errorf("got %d: expected %d", after-before, 3)
+	}
+}
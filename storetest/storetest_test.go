@@ -0,0 +1,23 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/golangcollege/sessions"
+	"github.com/golangcollege/sessions/memstore"
+)
+
+func TestEncryptedStore(t *testing.T) {
+	Run(t, sessions.NewEncryptedStore(memstore.NewWithCleanupInterval(0), []byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4")))
+}
+
+func TestEncryptedPlainStore(t *testing.T) {
+	// An EncryptedStore finds sessions one at a time when the wrapped Store
+	// isn't a BatchFinder.
+	Run(t, sessions.NewEncryptedStore(struct{ sessions.Store }{memstore.NewWithCleanupInterval(0)}, []byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4")))
+}
+
+func TestPlainStore(t *testing.T) {
+	// A Store without List or Count.
+	Run(t, struct{ sessions.Store }{memstore.NewWithCleanupInterval(0)})
+}
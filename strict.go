@@ -0,0 +1,145 @@
+package sessions
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net/http"
+)
+
+var (
+	// ErrWeakKey is returned by NewStrict when a secret key looks like it has
+	// been typed by hand rather than randomly generated.
+	ErrWeakKey = errors.New("session: secret key appears to have low entropy")
+
+	// ErrInsecureSameSiteNone is returned by CheckConfig when SameSite is set to
+	// None but Secure is false. Browsers reject such cookies.
+	ErrInsecureSameSiteNone = errors.New("session: SameSite=None requires Secure to be true")
+
+	// ErrInvalidLifetime is returned by CheckConfig when Lifetime is not
+	// positive.
+	ErrInvalidLifetime = errors.New("session: lifetime must be greater than zero")
+
+	// ErrInvalidCookiePrefix is returned by CheckConfig when the CookiePrefix
+	// is "__Secure-" but Secure is false, or is "__Host-" but Secure is false,
+	// Path isn't "/" or Domain is set, or is some other prefix starting with
+	// "__". Browsers reject such cookies.
+	ErrInvalidCookiePrefix = errors.New("session: cookie settings are incompatible with the cookie prefix")
+
+	// ErrInsecurePartitioned is returned by CheckConfig when Partitioned is
+	// true but Secure is false. Browsers reject such cookies.
+	ErrInsecurePartitioned = errors.New("session: Partitioned requires Secure to be true")
+
+	// ErrMissingOversizeStore is returned by CheckConfig when OnOversize is
+	// OversizeSpill but OversizeStore isn't set.
+	ErrMissingOversizeStore = errors.New("session: OversizeSpill requires an OversizeStore")
+)
+
+var weakKeyWords = [][]byte{
+	[]byte("secret"),
+	[]byte("password"),
+	[]byte("passwd"),
+	[]byte("changeme"),
+	[]byte("session"),
+	[]byte("example"),
+	[]byte("default"),
+	[]byte("qwerty"),
+	[]byte("123456"),
+}
+
+// NewStrict works like New, except that it returns an error instead of
+// panicking if any of the keys are not 32 bytes long, and also returns
+// ErrWeakKey if any of the keys look like they have low entropy (for example,
+// a repeated or dictionary-based phrase).
+//
+// Sessions created with NewStrict also check their configuration with
+// CheckConfig when the Enable middleware is set up, and panic if there is a
+// problem. This means that misconfigurations are caught at startup rather than
+// in production.
+func NewStrict(key []byte, oldKeys ...[]byte) (*Session, error) {
+	secrets := append([][]byte{key}, oldKeys...)
+
+	keys, err := toKeys(secrets)
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range secrets {
+		if weakKey(secret) {
+			return nil, ErrWeakKey
+		}
+	}
+
+	s := newSession(keys)
+	s.strict = true
+	return s, nil
+}
+
+// CheckConfig checks the session configuration for common mistakes. It returns
+// ErrInsecureSameSiteNone if SameSite is None but Secure is false,
+// ErrInsecurePartitioned if Partitioned is true but Secure is false,
+// ErrInvalidCookiePrefix if the cookie settings don't meet the requirements of
+// the CookiePrefix, ErrMissingOversizeStore if OnOversize is OversizeSpill
+// but there is no OversizeStore, and ErrInvalidLifetime if the Lifetime is
+// zero or negative.
+func (s *Session) CheckConfig() error {
+	if s.SameSite == http.SameSiteNoneMode && !s.Secure {
+		return ErrInsecureSameSiteNone
+	}
+	if s.Partitioned && !s.Secure {
+		return ErrInsecurePartitioned
+	}
+	err := s.checkCookiePrefix()
+	if err != nil {
+		return err
+	}
+	if s.OnOversize == OversizeSpill && s.OversizeStore == nil {
+		return ErrMissingOversizeStore
+	}
+	if s.Lifetime <= 0 {
+		return ErrInvalidLifetime
+	}
+	return nil
+}
+
+// weakKey reports whether a secret looks like it was chosen by a person rather
+// than generated randomly. It is a heuristic, and can only catch the most
+// obvious cases.
+func weakKey(secret []byte) bool {
+	if entropy(secret) < 3.0 {
+		return true
+	}
+
+	lower := bytes.ToLower(secret)
+	for _, word := range weakKeyWords {
+		if bytes.Contains(lower, word) {
+			return true
+		}
+	}
+
+	// Secrets made up only of lowercase letters and punctuation are most
+	// likely to be words or phrases.
+	for _, b := range secret {
+		if (b >= '0' && b <= '9') || (b >= 'A' && b <= 'Z') || b > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// entropy returns the Shannon entropy of b in bits per byte.
+func entropy(b []byte) float64 {
+	var counts [256]int
+	for _, c := range b {
+		counts[c]++
+	}
+
+	var h float64
+	for _, n := range counts {
+		if n == 0 {
+			continue
+		}
+		p := float64(n) / float64(len(b))
+		h -= p * math.Log2(p)
+	}
+	return h
+}
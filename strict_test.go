@@ -0,0 +1,78 @@
+package sessions
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNewStrict(t *testing.T) {
+	_, err := NewStrict([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		keys [][]byte
+		err  error
+	}{
+		{[][]byte{[]byte("short")}, ErrInvalidKeyLength},
+		{[][]byte{[]byte("passwordpasswordpasswordpassword")}, ErrWeakKey},
+		{[][]byte{[]byte("thisismysupersecretsessionkey123")}, ErrWeakKey},
+		{[][]byte{[]byte("correct horse battery staple abc")}, ErrWeakKey},
+		{[][]byte{[]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"), []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")}, ErrWeakKey},
+	}
+
+	for _, tt := range tests {
+		_, err := NewStrict(tt.keys[0], tt.keys[1:]...)
+		if err != tt.err {
+			t.Errorf("%q: got %v: expected %v", tt.keys, err, tt.err)
+		}
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	s, err := NewStrict([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.SameSite = http.SameSiteNoneMode
+	if err := s.CheckConfig(); err != ErrInsecureSameSiteNone {
+		t.Errorf("got %v: expected %v", err, ErrInsecureSameSiteNone)
+	}
+
+	s.Secure = true
+	if err := s.CheckConfig(); err != nil {
+		t.Errorf("got %v: expected %v", err, nil)
+	}
+
+	s.Secure = false
+	s.SameSite = http.SameSiteLaxMode
+	s.Partitioned = true
+	if err := s.CheckConfig(); err != ErrInsecurePartitioned {
+		t.Errorf("got %v: expected %v", err, ErrInsecurePartitioned)
+	}
+
+	s.Secure = true
+	if err := s.CheckConfig(); err != nil {
+		t.Errorf("got %v: expected %v", err, nil)
+	}
+
+	s.OnOversize = OversizeSpill
+	if err := s.CheckConfig(); err != ErrMissingOversizeStore {
+		t.Errorf("got %v: expected %v", err, ErrMissingOversizeStore)
+	}
+	s.OnOversize = OversizeError
+
+	s.Lifetime = 0
+	if err := s.CheckConfig(); err != ErrInvalidLifetime {
+		t.Errorf("got %v: expected %v", err, ErrInvalidLifetime)
+	}
+
+	defer func() {
+		if r := recover(); r != ErrInvalidLifetime {
+			t.Errorf("got %v: expected %v", r, ErrInvalidLifetime)
+		}
+	}()
+	s.Enable(http.NotFoundHandler())
+}
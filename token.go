@@ -0,0 +1,82 @@
+package sessions
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTokenExpired is returned by DecodeToken when the token has expired.
+var ErrTokenExpired = errors.New("session: token has expired")
+
+// tokenKeyLabel separates the keys used for tokens created by EncodeToken from
+// the keys used for session cookies.
+const tokenKeyLabel = "golangcollege/sessions out-of-band token"
+
+// tokenKey derives the key used for tokens created by EncodeToken from a
+// secret key.
+func tokenKey(key [32]byte) [32]byte {
+	return deriveKey(key[:], tokenKeyLabel)
+}
+
+// EncodeToken encrypts the data in the same format as a session cookie, for
+// use outside of sessions, such as in email verification links, password
+// reset tokens and handoffs between services which hold the same secret key.
+// The token is URL-safe, and can be decrypted with DecodeToken until the
+// expiry time. It uses the session's Codec, Cipher and current secret key, so
+// tokens survive key rotation in the same way as session cookies.
+//
+// Tokens are encrypted with a key derived from the secret key, so they can't
+// be used as session cookies or vice versa. However, tokens created for
+// different purposes are interchangeable, so include the purpose in the data
+// and check it when the token is decoded:
+//
+//	token, err := session.EncodeToken(map[string]interface{}{
+//		"purpose": "reset-password",
+//		"userID":  user.ID,
+//	}, time.Now().Add(time.Hour))
+func (s *Session) EncodeToken(data map[string]interface{}, expiry time.Time) (string, error) {
+	c := &cache{
+		Data:     make(map[string]interface{}, len(data)),
+		Expiry:   expiry.UTC(),
+		IssuedAt: time.Now().UTC(),
+	}
+	for key, val := range data {
+		c.Data[key] = val
+	}
+
+	sealed, err := s.sealFields(c)
+	if err != nil {
+		return "", err
+	}
+	return sealed.encode(s.codec(), s.Compress, s.LegacyFormat, s.cipher(), tokenKey(s.secretKeys()[0]), s.random())
+}
+
+// DecodeToken decrypts a token created by EncodeToken and returns its data.
+// ErrInvalidToken is returned if it can't be decrypted with any of the
+// session's keys, and ErrTokenExpired is returned if it has expired.
+func (s *Session) DecodeToken(token string) (map[string]interface{}, error) {
+	secrets := s.secretKeys()
+	keys := make([][32]byte, len(secrets))
+	for i, key := range secrets {
+		keys[i] = tokenKey(key)
+	}
+
+	c := &cache{}
+	err := c.decode(s.codec(), s.ciphers(), token, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.openFields(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.expired(c.Expiry) {
+		return nil, ErrTokenExpired
+	}
+	if c.Data == nil {
+		c.Data = make(map[string]interface{})
+	}
+	return c.Data, nil
+}
@@ -0,0 +1,75 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecodeToken(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	data := map[string]interface{}{"purpose": "reset-password", "userID": 42}
+	token, err := s.EncodeToken(data, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.DecodeToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("got %v: expected %v", got, data)
+	}
+
+	rotated := New([]byte("9y5Vlur8YvODJEhgOY8m9JVE4u46IpCV"), []byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	got, err = rotated.DecodeToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("got %v: expected %v", got, data)
+	}
+
+	_, err = s.DecodeToken(token[:len(token)-2])
+	if err != ErrInvalidToken {
+		t.Errorf("got %v: expected %v", err, ErrInvalidToken)
+	}
+
+	token, err = s.EncodeToken(data, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.DecodeToken(token)
+	if err != ErrTokenExpired {
+		t.Errorf("got %v: expected %v", err, ErrTokenExpired)
+	}
+}
+
+func TestTokenNotSessionCookie(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	token, err := s.EncodeToken(map[string]interface{}{"userID": 42}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetInt(r, "userID"))
+		s.Put(r, "userID", 7)
+	})
+	body, cookie := testRequest(t, s.Enable(h), "session="+token)
+	if body != "0" {
+		t.Errorf("got %q: expected %q", body, "0")
+	}
+
+	value := strings.TrimPrefix(strings.SplitN(cookie, ";", 2)[0], "session=")
+	_, err = s.DecodeToken(value)
+	if err != ErrInvalidToken {
+		t.Errorf("got %v: expected %v", err, ErrInvalidToken)
+	}
+}
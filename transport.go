@@ -0,0 +1,105 @@
+package sessions
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Transport is the interface for carrying the session token between the
+// client and the server by some means other than the session cookie. Token
+// must return http.ErrNoCookie if the request doesn't carry a session token.
+// SetToken is passed the expiry time of the session, or the zero time if the
+// session isn't persistent.
+type Transport interface {
+	Token(r *http.Request) (string, error)
+	SetToken(w http.ResponseWriter, r *http.Request, token string, expiry time.Time)
+	DeleteToken(w http.ResponseWriter, r *http.Request)
+}
+
+// HeaderTransport carries the session token in an HTTP header instead of a
+// cookie, for single-page applications and mobile clients calling JSON APIs.
+// The client reads the token from the response header whenever it is sent,
+// and returns it in the same request header with every subsequent request. An
+// empty response header means that the client should discard its token.
+//
+// To use bearer tokens in the Authorization header:
+//
+//	session.Transport = sessions.HeaderTransport{Name: "Authorization", Scheme: "Bearer"}
+//
+// The response header includes the Scheme, so the client can send it back
+// unchanged.
+type HeaderTransport struct {
+	// Name is the name of the header. The default value is
+	// "X-Session-Token".
+	Name string
+
+	// Scheme, if set, is the authentication scheme which precedes the token
+	// in the header, such as "Bearer". Request headers with a different
+	// scheme are ignored.
+	Scheme string
+}
+
+func (t HeaderTransport) name() string {
+	if t.Name == "" {
+		return "X-Session-Token"
+	}
+	return t.Name
+}
+
+// Token returns the session token from the request header.
+func (t HeaderTransport) Token(r *http.Request) (string, error) {
+	token := strings.TrimSpace(r.Header.Get(t.name()))
+	if t.Scheme != "" {
+		n := len(t.Scheme)
+		if len(token) <= n || !strings.EqualFold(token[:n], t.Scheme) || token[n] != ' ' {
+			return "", http.ErrNoCookie
+		}
+		token = strings.TrimSpace(token[n+1:])
+	}
+	if token == "" {
+		return "", http.ErrNoCookie
+	}
+	return token, nil
+}
+
+// SetToken adds the session token to the response header.
+func (t HeaderTransport) SetToken(w http.ResponseWriter, r *http.Request, token string, expiry time.Time) {
+	if t.Scheme != "" {
+		token = t.Scheme + " " + token
+	}
+	w.Header().Add("Vary", t.name())
+	w.Header().Set(t.name(), token)
+}
+
+// DeleteToken adds an empty response header.
+func (t HeaderTransport) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", t.name())
+	w.Header().Set(t.name(), "")
+}
+
+// writeToken sends the session token to the client, using the Transport if
+// one is set, or else the session cookie.
+func (s *Session) writeToken(w http.ResponseWriter, r *http.Request, cookie *http.Cookie) error {
+	if s.Transport == nil {
+		return s.writeCookie(w, r, cookie)
+	}
+	if s.CacheControl != "" {
+		w.Header().Set("Cache-Control", s.CacheControl)
+	}
+	s.Transport.SetToken(w, r, cookie.Value, cookie.Expires)
+	return nil
+}
+
+// deleteToken instructs the client to discard its session token.
+func (s *Session) deleteToken(w http.ResponseWriter, r *http.Request) {
+	if s.Transport == nil {
+		s.setCookie(w, r, s.deletionCookie(s.cookieName()))
+		s.deleteChunks(w, r, 0)
+		return
+	}
+	if s.CacheControl != "" {
+		w.Header().Set("Cache-Control", s.CacheControl)
+	}
+	s.Transport.DeleteToken(w, r)
+}
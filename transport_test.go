@@ -0,0 +1,93 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golangcollege/sessions/memstore"
+)
+
+func TestHeaderTransport(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Transport = HeaderTransport{Name: "Authorization", Scheme: "Bearer"}
+
+	do := func(h http.Handler, auth string) (string, *httptest.ResponseRecorder) {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		s.Enable(h).ServeHTTP(rr, r)
+		return rr.Body.String(), rr
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	_, rr := do(h, "")
+	if cookie := rr.Header().Get("Set-Cookie"); cookie != "" {
+		t.Errorf("got %q: expected %q", cookie, "")
+	}
+	auth := rr.Header().Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		t.Fatalf("got %q: expected a bearer token", auth)
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+	body, _ := do(h, auth)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+	body, _ = do(h, "bearer "+strings.TrimPrefix(auth, "Bearer "))
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+	body, _ = do(h, "Basic "+strings.TrimPrefix(auth, "Bearer "))
+	if body != "" {
+		t.Errorf("got %q: expected %q", body, "")
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Destroy(r)
+	})
+	_, rr = do(h, auth)
+	values, ok := rr.Header()["Authorization"]
+	if !ok || len(values) != 1 || values[0] != "" {
+		t.Errorf("got %q: expected an empty header", values)
+	}
+	if vary := rr.Header().Get("Vary"); vary != "Authorization" {
+		t.Errorf("got %q: expected %q", vary, "Authorization")
+	}
+}
+
+func TestHeaderTransportStore(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = memstore.NewWithCleanupInterval(0)
+	s.Transport = HeaderTransport{}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+	})
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	token := rr.Header().Get("X-Session-Token")
+	if token == "" {
+		t.Fatal("expected a session token")
+	}
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+	rr = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Session-Token", token)
+	s.Enable(h).ServeHTTP(rr, r)
+	if body := rr.Body.String(); body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+}
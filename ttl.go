@@ -0,0 +1,72 @@
+package sessions
+
+import (
+	"net/http"
+	"time"
+)
+
+// PutWithTTL works like Put, except that the key is removed from the session
+// data once ttl has passed, for short-lived values such as one-time password
+// challenges which are stored alongside long-lived login state. Expired keys
+// are removed when the session is loaded. Calling Put for the same key makes
+// the value permanent again. If any of the Validators reject the value, the
+// error is handled as it is by Put.
+func (s *Session) PutWithTTL(r *http.Request, key string, val interface{}, ttl time.Duration) {
+	c := getCacheFromRequestContext(r)
+
+	err := s.validate(key, val)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.reject(err)
+		return
+	}
+
+	s.put(c, key, val)
+	if c.KeyExpiry == nil {
+		c.KeyExpiry = make(map[string]time.Time)
+	}
+	c.KeyExpiry[key] = time.Now().Add(ttl).UTC()
+}
+
+// TTL returns the time remaining before a key added with PutWithTTL expires.
+// Zero is returned if the key doesn't exist or doesn't expire.
+func (s *Session) TTL(r *http.Request, key string) time.Duration {
+	c := getCacheFromRequestContext(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.Data[key]; !exists {
+		return 0
+	}
+	expiry, ok := c.KeyExpiry[key]
+	if !ok {
+		return 0
+	}
+	if d := time.Until(expiry); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// expireKeys removes the keys whose TTL has passed from the session data,
+// along with the expiry times of any keys which no longer exist. The caller
+// must hold c.mu, if the cache is shared.
+func (c *cache) expireKeys(now time.Time) {
+	for key, expiry := range c.KeyExpiry {
+		if _, exists := c.Data[key]; !exists {
+			delete(c.KeyExpiry, key)
+			continue
+		}
+		if !now.Before(expiry) {
+			delete(c.Data, key)
+			delete(c.KeyExpiry, key)
+		}
+	}
+	if len(c.KeyExpiry) == 0 {
+		c.KeyExpiry = nil
+	}
+}
@@ -0,0 +1,130 @@
+package sessions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPutWithTTL(t *testing.T) {
+	for _, codec := range []Codec{GobCodec{}, JSONCodec{}} {
+		s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+		s.Codec = codec
+
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.Put(r, "user", "alice")
+			s.PutWithTTL(r, "otp", "123456", 100*time.Millisecond)
+			s.PutWithTTL(r, "challenge", "abc", time.Hour)
+		})
+		_, cookie := testRequest(t, s.Enable(h), "")
+
+		h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, s.Keys(r), s.TTL(r, "challenge") > 59*time.Minute, s.TTL(r, "user"))
+		})
+		body, _ := testRequest(t, s.Enable(h), cookie)
+		if body != "[challenge otp user] true 0s" {
+			t.Errorf("%T: got %q: expected %q", codec, body, "[challenge otp user] true 0s")
+		}
+
+		time.Sleep(150 * time.Millisecond)
+
+		body, _ = testRequest(t, s.Enable(h), cookie)
+		if body != "[challenge user] true 0s" {
+			t.Errorf("%T: got %q: expected %q", codec, body, "[challenge user] true 0s")
+		}
+	}
+}
+
+func TestPutClearsTTL(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.PutWithTTL(r, "foo", "bar", time.Millisecond)
+		s.Put(r, "foo", "baz")
+	})
+	_, cookie := testRequest(t, s.Enable(h), "")
+
+	time.Sleep(10 * time.Millisecond)
+
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "baz" {
+		t.Errorf("got %q: expected %q", body, "baz")
+	}
+}
+
+func TestRemoveClearsTTL(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.PrincipalKey = "userID"
+
+	removals := map[string]func(r *http.Request){
+		"Remove":     func(r *http.Request) { s.Remove(r, "foo") },
+		"Pop":        func(r *http.Request) { s.Pop(r, "foo") },
+		"PopAll":     func(r *http.Request) { s.PopAll(r) },
+		"Destroy":    func(r *http.Request) { s.Destroy(r) },
+		"LogoutUser": func(r *http.Request) { s.LogoutUser(r) },
+		"WithLock": func(r *http.Request) {
+			s.WithLock(r, func(data map[string]interface{}) { delete(data, "foo") })
+		},
+	}
+	for name, remove := range removals {
+		r := MockRequest(httptest.NewRequest("GET", "/", nil))
+		c := getCacheFromRequestContext(r)
+
+		s.PutWithTTL(r, "foo", "bar", time.Millisecond)
+		remove(r)
+		if len(c.KeyExpiry) != 0 {
+			t.Errorf("%s: got %v: expected %v", name, c.KeyExpiry, map[string]time.Time{})
+		}
+	}
+}
+
+func TestDirectWriteClearsTTL(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.PrincipalKey = "userID"
+
+	r := MockRequest(httptest.NewRequest("GET", "/", nil))
+	c := getCacheFromRequestContext(r)
+
+	// A later write to a key which had a TTL, by a path which doesn't go
+	// through Put, isn't expired with the old TTL.
+	s.PutWithTTL(r, "userID", 1, time.Millisecond)
+	s.PutWithTTL(r, "kept", "value", time.Hour)
+	s.LoginUser(r, 2)
+	s.WithLock(r, func(data map[string]interface{}) { data["kept"] = "value" })
+	if _, ok := c.KeyExpiry["userID"]; ok {
+		t.Errorf("got %v: expected %v", ok, false)
+	}
+	if _, ok := c.KeyExpiry["kept"]; !ok {
+		t.Errorf("got %v: expected %v", ok, true)
+	}
+
+	s.WithLock(r, func(data map[string]interface{}) { data["kept"] = "changed" })
+	if len(c.KeyExpiry) != 0 {
+		t.Errorf("got %v: expected %v", c.KeyExpiry, map[string]time.Time{})
+	}
+}
+
+func TestPutWithTTLValidate(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	r = addCacheToRequestContext(r, c)
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Validators["otp"] = []ValidatorFunc{MaxLength(6)}
+
+	s.PutWithTTL(r, "otp", "12345678", time.Minute)
+	if _, exists := c.Data["otp"]; exists {
+		t.Errorf("got %v: expected the value not to be stored", c.Data["otp"])
+	}
+	if _, ok := c.invalid.(*ValidationError); !ok {
+		t.Errorf("got %v: expected a *ValidationError", c.invalid)
+	}
+}
@@ -0,0 +1,59 @@
+package sessions
+
+import (
+	"net/http"
+	"strings"
+)
+
+// isUpgrade reports whether the request asks to switch protocols, as in a
+// WebSocket handshake.
+func isUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, v := range r.Header["Connection"] {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headerRecorder is an http.ResponseWriter which only records headers.
+type headerRecorder http.Header
+
+func (h headerRecorder) Header() http.Header {
+	return http.Header(h)
+}
+
+func (h headerRecorder) Write(b []byte) (int, error) {
+	return 0, http.ErrBodyNotAllowed
+}
+
+func (h headerRecorder) WriteHeader(code int) {}
+
+// UpgradeHeader saves the session and returns the response headers which
+// carry the session token, such as Set-Cookie. WebSocket libraries like
+// gorilla/websocket write the handshake response to the hijacked connection
+// themselves, so any headers added to the http.ResponseWriter are never sent.
+// Pass the returned headers to the library instead:
+//
+//	header, err := session.UpgradeHeader(r)
+//	if err != nil {
+//		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+//		return
+//	}
+//	conn, err := upgrader.Upgrade(w, r, header)
+//
+// Any changes made to the session data after UpgradeHeader is called will not
+// be sent to the client, as there is no further HTTP response.
+func (s *Session) UpgradeHeader(r *http.Request) (http.Header, error) {
+	h := make(http.Header)
+	err := s.Commit(headerRecorder(h), r)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
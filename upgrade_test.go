@@ -0,0 +1,149 @@
+package sessions
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golangcollege/sessions/memstore"
+)
+
+// dialUpgrade sends a WebSocket-style upgrade request to the server, and
+// returns the response to it.
+func dialUpgrade(t *testing.T, srv *httptest.Server, cookie string) *http.Response {
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	r, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	if cookie != "" {
+		r.Header.Set("Cookie", cookie)
+	}
+	err = r.Write(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestUpgradeHeader(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	// The handler writes the handshake response itself, as gorilla/websocket
+	// does, so only the headers returned by UpgradeHeader are sent.
+	srv := httptest.NewServer(s.Enable(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		header, err := s.UpgradeHeader(r)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		header.Write(brw)
+		fmt.Fprint(brw, "\r\n")
+		brw.Flush()
+	})))
+	defer srv.Close()
+
+	res := dialUpgrade(t, srv, "")
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("got %d: expected %d", res.StatusCode, http.StatusSwitchingProtocols)
+	}
+	cookie := res.Header.Get("Set-Cookie")
+	if !strings.HasPrefix(cookie, "session=") {
+		t.Fatalf("got %q: expected a session cookie", cookie)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+}
+
+func TestUpgradeHijack(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Store = memstore.NewWithCleanupInterval(0)
+
+	// The handler sends the headers of the http.ResponseWriter with the
+	// handshake response, as httputil.ReverseProxy does.
+	srv := httptest.NewServer(s.Enable(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "foo", "bar")
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		w.Header().Write(brw)
+		fmt.Fprint(brw, "\r\n")
+		brw.Flush()
+	})))
+	defer srv.Close()
+
+	res := dialUpgrade(t, srv, "")
+	cookie := res.Header.Get("Set-Cookie")
+	if !strings.HasPrefix(cookie, "session=") {
+		t.Fatalf("got %q: expected a session cookie", cookie)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.GetString(r, "foo"))
+	})
+	body, _ := testRequest(t, s.Enable(h), cookie)
+	if body != "bar" {
+		t.Errorf("got %q: expected %q", body, "bar")
+	}
+}
+
+func TestIsUpgrade(t *testing.T) {
+	tests := []struct {
+		connection string
+		upgrade    string
+		expected   bool
+	}{
+		{"Upgrade", "websocket", true},
+		{"keep-alive, upgrade", "websocket", true},
+		{"keep-alive", "websocket", false},
+		{"Upgrade", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if test.connection != "" {
+			r.Header.Set("Connection", test.connection)
+		}
+		if test.upgrade != "" {
+			r.Header.Set("Upgrade", test.upgrade)
+		}
+		if got := isUpgrade(r); got != test.expected {
+			t.Errorf("%q %q: got %v: expected %v", test.connection, test.upgrade, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package sessions
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// ValidatorFunc checks a value before it is added to the session data. It
+// should return a non-nil error if the value is not acceptable.
+type ValidatorFunc func(key string, val interface{}) error
+
+// ValidationError is returned by PutChecked when a value is rejected by one of
+// the Validators. When a value added with Put (or another method which doesn't
+// return an error) is rejected, the session isn't saved, and the
+// ValidationError is passed to the ErrorHandler instead.
+type ValidationError struct {
+	Key string
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("session: invalid value for key %q: %s", e.Key, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// reject records an error, such as a value rejected by the Validators, so
+// that the session isn't saved. Only the first error is kept. The caller must hold c.mu.
+func (c *cache) reject(err error) {
+	if c.invalid == nil {
+		c.invalid = err
+	}
+}
+
+func (s *Session) validate(key string, val interface{}) error {
+	err := s.checkType(key, val)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkEncoding(key, val)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range []string{"", key} {
+		for _, fn := range s.Validators[k] {
+			err := fn(key, val)
+			if err != nil {
+				return &ValidationError{Key: key, Err: err}
+			}
+		}
+	}
+	return nil
+}
+
+// MaxLength returns a ValidatorFunc which rejects string and []byte values
+// longer than n bytes. Values of other types are accepted.
+func MaxLength(n int) ValidatorFunc {
+	return func(key string, val interface{}) error {
+		var l int
+		switch v := val.(type) {
+		case string:
+			l = len(v)
+		case []byte:
+			l = len(v)
+		default:
+			return nil
+		}
+
+		if l > n {
+			return fmt.Errorf("length %d exceeds maximum of %d", l, n)
+		}
+		return nil
+	}
+}
+
+// AllowTypes returns a ValidatorFunc which only accepts values with the same
+// type as one of the given examples. For example:
+//
+//	session.Validators[""] = []sessions.ValidatorFunc{
+//		sessions.AllowTypes("", 0, time.Time{}),
+//	}
+func AllowTypes(examples ...interface{}) ValidatorFunc {
+	types := make(map[reflect.Type]bool, len(examples))
+	for _, e := range examples {
+		types[reflect.TypeOf(e)] = true
+	}
+
+	return func(key string, val interface{}) error {
+		if !types[reflect.TypeOf(val)] {
+			return fmt.Errorf("type %T is not allowed", val)
+		}
+		return nil
+	}
+}
+
+// ErrUnregisteredType is wrapped by the error returned from PutChecked when
+// StrictTypes is enabled and a value's type has not been registered with
+// RegisterType.
+var ErrUnregisteredType = errors.New("type is not registered")
+
+// ErrNotNumber is wrapped by the *ValidationError passed to the ErrorHandler
+// when Increment or Decrement is called for a key which holds a value that
+// isn't a number.
+var ErrNotNumber = errors.New("value is not a number")
+
+// builtinTypes are the types which can always be stored in the session data,
+// because encoding/gob supports them without registration.
+var builtinTypes = map[reflect.Type]bool{}
+
+func init() {
+	for _, v := range []interface{}{
+		false, "", []byte(nil), time.Time{}, time.Duration(0),
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0), uintptr(0),
+		float32(0), float64(0), complex64(0), complex128(0),
+		[]bool(nil), []string(nil), []int(nil), []int8(nil), []int16(nil),
+		[]int32(nil), []int64(nil), []uint(nil), []uint16(nil), []uint32(nil),
+		[]uint64(nil), []uintptr(nil), []float32(nil), []float64(nil),
+		[]complex64(nil), []complex128(nil), map[string]string(nil),
+	} {
+		builtinTypes[reflect.TypeOf(v)] = true
+	}
+}
+
+// RegisterType registers the type of each of the given values with the
+// encoding/gob package, so that values of that type can be stored in the
+// session data. When StrictTypes is enabled, only registered types (and basic
+// types such as strings, numbers, []byte and time.Time) can be added to the
+// session data. For example:
+//
+//	session.StrictTypes = true
+//	session.RegisterType(User{}, &Cart{})
+func (s *Session) RegisterType(values ...interface{}) {
+	if s.types == nil {
+		s.types = make(map[reflect.Type]bool)
+	}
+	for _, v := range values {
+		gob.Register(v)
+		s.types[reflect.TypeOf(v)] = true
+	}
+}
+
+func (s *Session) checkType(key string, val interface{}) error {
+	if !s.StrictTypes {
+		return nil
+	}
+
+	t := reflect.TypeOf(val)
+	if builtinTypes[t] || s.types[t] {
+		return nil
+	}
+	return &ValidationError{Key: key, Err: fmt.Errorf("%w: %T", ErrUnregisteredType, val)}
+}
+
+// checkEncoding makes a trial encoding of the value with the session's Codec,
+// so that a value which can't be saved (such as a channel, a function or an
+// unregistered struct) is rejected when it is added rather than when the
+// session data is saved.
+func (s *Session) checkEncoding(key string, val interface{}) error {
+	if !s.CheckEncoding {
+		return nil
+	}
+
+	_, err := s.codec().Encode(map[string]interface{}{key: val})
+	if err != nil {
+		return &ValidationError{Key: key, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPutChecked(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	r = addCacheToRequestContext(r, c)
+
+	errNotPositive := errors.New("must be positive")
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Validators[""] = []ValidatorFunc{MaxLength(5)}
+	s.Validators["count"] = []ValidatorFunc{
+		AllowTypes(0),
+		func(key string, val interface{}) error {
+			if val.(int) <= 0 {
+				return errNotPositive
+			}
+			return nil
+		},
+	}
+
+	err = s.PutChecked(r, "foo", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.PutChecked(r, "foo", "barbaz")
+	if err == nil || !strings.Contains(err.Error(), `"foo"`) {
+		t.Errorf("got %v: expected a validation error for %q", err, "foo")
+	}
+	if c.Data["foo"] != "bar" {
+		t.Errorf("got %q: expected %q", c.Data["foo"], "bar")
+	}
+
+	err = s.PutChecked(r, "count", "1")
+	if err == nil {
+		t.Errorf("got %v: expected a validation error", err)
+	}
+
+	err = s.PutChecked(r, "count", -1)
+	if verr, ok := err.(*ValidationError); !ok || verr.Err != errNotPositive {
+		t.Errorf("got %v: expected %v", err, errNotPositive)
+	}
+
+	err = s.PutChecked(r, "count", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Put(r, "foo", "barbaz")
+	if c.Data["foo"] != "bar" {
+		t.Errorf("got %q: expected %q", c.Data["foo"], "bar")
+	}
+	if verr, ok := c.invalid.(*ValidationError); !ok || verr.Key != "foo" {
+		t.Errorf("got %v: expected a validation error for %q", c.invalid, "foo")
+	}
+}
+
+func TestValidatorErrorHandler(t *testing.T) {
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.Validators["count"] = []ValidatorFunc{AllowTypes(0)}
+
+	var got error
+	s.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		got = err
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Put(r, "name", "alice")
+		s.Put(r, "count", r.URL.Query().Get("count"))
+		if s.PutIfAbsent(r, "other", "x") != true {
+			t.Errorf("got %v: expected %v", false, true)
+		}
+		w.Write([]byte("OK"))
+	})
+
+	rr := httptest.NewRecorder()
+	s.Enable(h).ServeHTTP(rr, httptest.NewRequest("GET", "/?count=abc", nil))
+
+	var verr *ValidationError
+	if !errors.As(got, &verr) || verr.Key != "count" {
+		t.Fatalf("got %v: expected a validation error for %q", got, "count")
+	}
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("got %d: expected %d", rr.Code, http.StatusBadRequest)
+	}
+	if cookie := rr.Header().Get("Set-Cookie"); cookie != "" {
+		t.Errorf("got %q: expected %q", cookie, "")
+	}
+}
+
+func TestStrictTypes(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	r = addCacheToRequestContext(r, c)
+
+	type user struct {
+		Name string
+	}
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+	s.StrictTypes = true
+
+	for _, val := range []interface{}{"foo", 1, int64(1), 1.5, []byte("foo"), []string{"foo"}, time.Now()} {
+		err = s.PutChecked(r, "foo", val)
+		if err != nil {
+			t.Errorf("%T: got %v: expected %v", val, err, nil)
+		}
+	}
+
+	err = s.PutChecked(r, "user", user{"alice"})
+	if !errors.Is(err, ErrUnregisteredType) {
+		t.Errorf("got %v: expected %v", err, ErrUnregisteredType)
+	}
+	if err == nil || !strings.Contains(err.Error(), `"user"`) || !strings.Contains(err.Error(), "sessions.user") {
+		t.Errorf("got %v: expected the error to name the key and type", err)
+	}
+
+	s.RegisterType(user{})
+	err = s.PutChecked(r, "user", user{"alice"})
+	if err != nil {
+		t.Errorf("got %v: expected %v", err, nil)
+	}
+}
+
+func TestCheckEncoding(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCache(time.Hour)
+	r = addCacheToRequestContext(r, c)
+
+	type unregistered struct {
+		Name string
+	}
+
+	s := New([]byte("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4"))
+
+	err = s.validate("ch", make(chan int))
+	if err != nil {
+		t.Errorf("got %v: expected %v", err, nil)
+	}
+
+	s.CheckEncoding = true
+
+	for _, val := range []interface{}{make(chan int), func() {}, unregistered{"alice"}} {
+		err = s.PutChecked(r, "bad", val)
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Key != "bad" {
+			t.Errorf("%T: got %v: expected a validation error for key %q", val, err, "bad")
+		}
+	}
+	if _, exists := c.Data["bad"]; exists {
+		t.Errorf("got %v: expected %v", exists, false)
+	}
+
+	err = s.PutChecked(r, "foo", "bar")
+	if err != nil {
+		t.Errorf("got %v: expected %v", err, nil)
+	}
+}